@@ -36,6 +36,9 @@ var CheckinDashboardEnabled = false // show checkin calendar on dashboard
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// CryptoSecretConfigured 是否显式配置了 CRYPTO_SECRET，未配置时密钥可能随重启变化，不能用于需要长期解密的数据
+var CryptoSecretConfigured = false
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
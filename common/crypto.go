@@ -1,9 +1,13 @@
 package common
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -30,3 +34,38 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(CryptoSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWithSecret 使用 CryptoSecret 派生的密钥进行 AES-GCM 加密，随机 nonce 置于密文前
+func EncryptWithSecret(plaintext []byte) ([]byte, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptWithSecret 解密 EncryptWithSecret 生成的密文
+func DecryptWithSecret(ciphertext []byte) ([]byte, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
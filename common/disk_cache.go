@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -20,6 +21,9 @@ const (
 // 统一的缓存目录名
 const diskCacheDir = "new-api-body-cache"
 
+// 持久化文件存储子目录（位于缓存目录下，不参与临时缓存文件的过期清理）
+const diskFileStoreDir = "files"
+
 // GetDiskCacheDir 获取统一的磁盘缓存目录
 // 注意：每次调用都会重新计算，以响应配置变化
 func GetDiskCacheDir() string {
@@ -174,3 +178,51 @@ func ShouldUseDiskCache(dataSize int64) bool {
 	}
 	return IsDiskCacheAvailable(dataSize)
 }
+
+// GetDiskFileStoreDir 获取持久化文件存储目录（如 /v1/files 上传的文件）
+func GetDiskFileStoreDir() string {
+	return filepath.Join(GetDiskCacheDir(), diskFileStoreDir)
+}
+
+// CreateDiskStoreFile 在持久化文件存储目录中创建新文件，用于增量写入
+func CreateDiskStoreFile(name string) (*os.File, error) {
+	dir := GetDiskFileStoreDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create file store directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, filepath.Base(name)), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store file: %w", err)
+	}
+	return file, nil
+}
+
+// WriteDiskStoreFile 将 reader 内容写入持久化文件存储目录
+// name 为存储文件名（调用方需保证唯一），maxBytes <= 0 表示不限制大小
+// 返回文件路径和写入字节数
+func WriteDiskStoreFile(name string, reader io.Reader, maxBytes int64) (string, int64, error) {
+	file, err := CreateDiskStoreFile(name)
+	if err != nil {
+		return "", 0, err
+	}
+	filePath := file.Name()
+
+	src := reader
+	if maxBytes > 0 {
+		src = io.LimitReader(reader, maxBytes+1)
+	}
+	written, err := io.Copy(file, src)
+	if err == nil && maxBytes > 0 && written > maxBytes {
+		err = ErrRequestBodyTooLarge
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(filePath)
+		return "", 0, fmt.Errorf("failed to close store file: %w", err)
+	}
+	return filePath, written, nil
+}
@@ -127,6 +127,20 @@ func CleanupBodyStorage(c *gin.Context) {
 	}
 }
 
+// ReplaceRequestBody 替换已缓存的请求体（如改写请求中的引用 ID），后续读取将得到新内容
+func ReplaceRequestBody(c *gin.Context, body []byte) error {
+	storage, err := CreateBodyStorage(body)
+	if err != nil {
+		return err
+	}
+	CleanupBodyStorage(c)
+	c.Set(KeyBodyStorage, storage)
+	c.Set(KeyRequestBody, body)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+	c.Request.ContentLength = int64(len(body))
+	return nil
+}
+
 func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	requestBody, err := GetRequestBody(c)
 	if err != nil {
@@ -0,0 +1,23 @@
+-- 并发槽位，成员超时后自动释放，避免进程异常退出导致槽位泄漏
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 成员标识（请求 ID）
+-- ARGV[2]: 最大并发数
+-- ARGV[3]: 槽位超时毫秒数
+-- 返回: {是否获得槽位, 当前占用数}
+
+local key = KEYS[1]
+local member = ARGV[1]
+local limit = tonumber(ARGV[2])
+local ttlMs = tonumber(ARGV[3])
+
+local now = redis.call('TIME')
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', nowMs)
+local count = redis.call('ZCARD', key)
+if count >= limit then
+    return {0, count}
+end
+redis.call('ZADD', key, nowMs + ttlMs, member)
+redis.call('PEXPIRE', key, ttlMs)
+return {1, count + 1}
@@ -0,0 +1,43 @@
+-- 按 token 数计量的令牌桶，支持透支与退还
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 本次扣减数量，负数表示退还
+-- ARGV[2]: 放行所需的最少剩余数量
+-- ARGV[3]: 令牌生成速率 (每秒，可为小数)
+-- ARGV[4]: 桶容量
+-- ARGV[5]: 是否强制扣减 (1 表示不足时也扣减，用于按实际用量结算)
+-- 返回: {是否放行, 剩余数量, 距离满足所需数量的毫秒数}
+
+local key = KEYS[1]
+local requested = tonumber(ARGV[1])
+local required = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local capacity = tonumber(ARGV[4])
+local force = tonumber(ARGV[5]) == 1
+
+local now = redis.call('TIME')
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local bucket = redis.call('HMGET', key, 'tokens', 'last_ms')
+local tokens = tonumber(bucket[1])
+local lastMs = tonumber(bucket[2])
+
+if not tokens or not lastMs then
+    tokens = capacity
+else
+    tokens = math.min(capacity, tokens + (nowMs - lastMs) / 1000 * rate)
+end
+
+local allowed = tokens >= required
+if allowed or force then
+    tokens = math.min(capacity, tokens - requested)
+end
+
+local waitMs = 0
+if tokens < required then
+    waitMs = math.ceil((required - tokens) / rate * 1000)
+end
+
+redis.call('HMSET', key, 'tokens', tokens, 'last_ms', nowMs)
+redis.call('PEXPIRE', key, math.ceil(capacity / rate * 1000) + 60000)
+
+return {allowed and 1 or 0, math.floor(tokens), waitMs}
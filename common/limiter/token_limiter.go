@@ -0,0 +1,177 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// BucketState 令牌桶操作后的状态
+type BucketState struct {
+	Allowed   bool
+	Remaining int64
+	// 剩余数量恢复到放行所需数量还需等待的时间
+	Wait time.Duration
+}
+
+// BucketRequest 描述一次令牌桶操作
+type BucketRequest struct {
+	// 本次扣减数量，负数表示退还
+	Requested float64
+	// 放行所需的最少剩余数量
+	Required float64
+	// 每秒恢复的数量
+	Rate float64
+	// 桶容量
+	Capacity float64
+	// 不足时仍然扣减（允许透支），用于按实际用量结算
+	Force bool
+}
+
+// TokenLimiter 按数量计量的令牌桶与并发槽位，Redis 与内存实现行为一致
+type TokenLimiter interface {
+	TakeTokens(ctx context.Context, key string, req BucketRequest) (BucketState, error)
+	AcquireSlot(ctx context.Context, key string, member string, limit int, ttl time.Duration) (bool, int, error)
+	ReleaseSlot(ctx context.Context, key string, member string) error
+}
+
+func (rl *RedisLimiter) TakeTokens(ctx context.Context, key string, req BucketRequest) (BucketState, error) {
+	force := 0
+	if req.Force {
+		force = 1
+	}
+	result, err := rl.client.EvalSha(ctx, rl.tokenBucketScriptSHA, []string{key},
+		req.Requested, req.Required, req.Rate, req.Capacity, force).Int64Slice()
+	if err != nil {
+		return BucketState{}, fmt.Errorf("token bucket failed: %w", err)
+	}
+	if len(result) != 3 {
+		return BucketState{}, fmt.Errorf("token bucket failed: unexpected result %v", result)
+	}
+	return BucketState{
+		Allowed:   result[0] == 1,
+		Remaining: result[1],
+		Wait:      time.Duration(result[2]) * time.Millisecond,
+	}, nil
+}
+
+func (rl *RedisLimiter) AcquireSlot(ctx context.Context, key string, member string, limit int, ttl time.Duration) (bool, int, error) {
+	result, err := rl.client.EvalSha(ctx, rl.concurrencyScriptSHA, []string{key}, member, limit, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("concurrency limit failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("concurrency limit failed: unexpected result %v", result)
+	}
+	return result[0] == 1, int(result[1]), nil
+}
+
+func (rl *RedisLimiter) ReleaseSlot(ctx context.Context, key string, member string) error {
+	return rl.client.ZRem(ctx, key, member).Err()
+}
+
+type memoryBucket struct {
+	tokens   float64
+	last     time.Time
+	expireAt time.Time
+}
+
+// MemoryLimiter 未启用 Redis 时的单机实现
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	slots     map[string]map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*memoryBucket),
+		slots:     make(map[string]map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// sweepLocked 定期清理过期的桶与槽位
+func (l *MemoryLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if now.After(bucket.expireAt) {
+			delete(l.buckets, key)
+		}
+	}
+	for key, members := range l.slots {
+		for member, expireAt := range members {
+			if now.After(expireAt) {
+				delete(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(l.slots, key)
+		}
+	}
+}
+
+func (l *MemoryLimiter) TakeTokens(_ context.Context, key string, req BucketRequest) (BucketState, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: req.Capacity, last: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(req.Capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*req.Rate)
+		bucket.last = now
+	}
+
+	allowed := bucket.tokens >= req.Required
+	if allowed || req.Force {
+		bucket.tokens = math.Min(req.Capacity, bucket.tokens-req.Requested)
+	}
+	var wait time.Duration
+	if bucket.tokens < req.Required {
+		wait = time.Duration(math.Ceil((req.Required-bucket.tokens)/req.Rate*1000)) * time.Millisecond
+	}
+	bucket.expireAt = now.Add(time.Duration(req.Capacity/req.Rate*float64(time.Second)) + time.Minute)
+	return BucketState{Allowed: allowed, Remaining: int64(math.Floor(bucket.tokens)), Wait: wait}, nil
+}
+
+func (l *MemoryLimiter) AcquireSlot(_ context.Context, key string, member string, limit int, ttl time.Duration) (bool, int, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+
+	members, ok := l.slots[key]
+	if !ok {
+		members = make(map[string]time.Time)
+		l.slots[key] = members
+	}
+	for m, expireAt := range members {
+		if now.After(expireAt) {
+			delete(members, m)
+		}
+	}
+	if len(members) >= limit {
+		return false, len(members), nil
+	}
+	members[member] = now.Add(ttl)
+	return true, len(members), nil
+}
+
+func (l *MemoryLimiter) ReleaseSlot(_ context.Context, key string, member string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if members, ok := l.slots[key]; ok {
+		delete(members, member)
+	}
+	return nil
+}
@@ -325,3 +325,24 @@ func RedisHSetField(key, field string, value interface{}) error {
 	}
 	return nil
 }
+
+func RedisHSet(key, field string, value string) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HSET: key=%s, field=%s, value=%s", key, field, value))
+	}
+	return RDB.HSet(context.Background(), key, field, value).Err()
+}
+
+func RedisHDel(key, field string) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HDEL: key=%s, field=%s", key, field))
+	}
+	return RDB.HDel(context.Background(), key, field).Err()
+}
+
+func RedisHGetAll(key string) (map[string]string, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HGETALL: key=%s", key))
+	}
+	return RDB.HGetAll(context.Background(), key).Result()
+}
@@ -19,6 +19,16 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCacheTTL  ContextKey = "token_response_cache_ttl"
+	ContextKeyTokenProjectId         ContextKey = "token_project_id"
+	ContextKeyTokenBudgetRemain      ContextKey = "token_budget_remain"
+	ContextKeyTokenScopes            ContextKey = "token_scopes"
+	ContextKeyDelegatedTokenId       ContextKey = "delegated_token_id"
+	ContextKeyDelegatedTokenEndUser  ContextKey = "delegated_token_end_user"
+	ContextKeyDelegatedTokenClaims   ContextKey = "delegated_token_claims"
+	ContextKeyDelegatedTokenReserved ContextKey = "delegated_token_reserved"
+	ContextKeyTokenEndUserRateLimit  ContextKey = "token_end_user_rate_limit"
+	ContextKeyTokenEndUserQuotaLimit ContextKey = "token_end_user_quota_limit"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -52,6 +62,7 @@ const (
 	ContextKeyUserGroup   ContextKey = "user_group"
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
+	ContextKeyUserOrgId   ContextKey = "user_org_id"
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
@@ -66,4 +77,33 @@ const (
 
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyRelayBatchId marks a request executed as one line of a gateway-run batch (batch pricing applies)
+	ContextKeyRelayBatchId ContextKey = "relay_batch_id"
+	// ContextKeyRelayBatchLineQuota stores the quota settled for a batch line
+	ContextKeyRelayBatchLineQuota ContextKey = "relay_batch_line_quota"
+
+	// ContextKeyHedgeLost stores an *atomic.Bool that is set when a hedged attempt loses the race and must not be billed
+	ContextKeyHedgeLost ContextKey = "hedge_lost"
+
+	// ContextKeyResponseCacheHit marks a request served from the response cache without calling upstream
+	ContextKeyResponseCacheHit ContextKey = "response_cache_hit"
+
+	// ContextKeyConsumedPromptTokens / ContextKeyConsumedCompletionTokens accumulate the tokens billed for this request, used to settle TPM limits
+	ContextKeyConsumedPromptTokens     ContextKey = "consumed_prompt_tokens"
+	ContextKeyConsumedCompletionTokens ContextKey = "consumed_completion_tokens"
+	// ContextKeyConsumedQuota accumulates the quota billed for this request, used to settle delegated token and end-user usage
+	ContextKeyConsumedQuota ContextKey = "consumed_quota"
+
+	// ContextKeyModerationDecisions stores the moderation stages flagged for this request
+	ContextKeyModerationDecisions ContextKey = "moderation_decisions"
+
+	// ContextKeyPIIRedactedCount stores how many distinct PII values were replaced with placeholders before relaying
+	ContextKeyPIIRedactedCount ContextKey = "pii_redacted_count"
+
+	// ContextKeyEndUserId stores the end-user identifier the request is attributed to (header, request body or delegated token)
+	ContextKeyEndUserId ContextKey = "end_user_id"
+
+	// ContextKeyAuditReplayOf marks a request replayed from an audit capture, holding the capture id
+	ContextKeyAuditReplayOf ContextKey = "audit_replay_of"
 )
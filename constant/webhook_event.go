@@ -0,0 +1,30 @@
+package constant
+
+// 事件总线推送的事件类型，订阅方按事件类型过滤
+const (
+	WebhookEventPing                  = "ping"
+	WebhookEventChannelDisabled       = "channel.disabled"
+	WebhookEventChannelEnabled        = "channel.enabled"
+	WebhookEventTopUpCompleted        = "topup.completed"
+	WebhookEventSubscriptionActivated = "subscription.activated"
+	WebhookEventSubscriptionExpired   = "subscription.expired"
+	WebhookEventQuotaThresholdCrossed = "quota.threshold_crossed"
+	WebhookEventTokenCreated          = "token.created"
+	WebhookEventTokenDeleted          = "token.deleted"
+	WebhookEventAppealSubmitted       = "appeal.submitted"
+	WebhookEventUserArchived          = "user.archived"
+)
+
+// WebhookEvents 可订阅的事件类型，ping 仅用于测试投递，不在此列
+var WebhookEvents = []string{
+	WebhookEventChannelDisabled,
+	WebhookEventChannelEnabled,
+	WebhookEventTopUpCompleted,
+	WebhookEventSubscriptionActivated,
+	WebhookEventSubscriptionExpired,
+	WebhookEventQuotaThresholdCrossed,
+	WebhookEventTokenCreated,
+	WebhookEventTokenDeleted,
+	WebhookEventAppealSubmitted,
+	WebhookEventUserArchived,
+}
@@ -5,7 +5,9 @@ import (
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/gin-gonic/gin"
 )
 
@@ -75,6 +77,12 @@ func SubmitAppeal(c *gin.Context) {
 		})
 		return
 	}
+	service.PublishWebhookEvent(constant.WebhookEventAppealSubmitted, map[string]interface{}{
+		"appeal_id": appeal.Id,
+		"user_id":   userId,
+		"username":  user.Username,
+		"reason":    appeal.Reason,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -129,6 +137,32 @@ func GetAllAppeals(c *gin.Context) {
 	})
 }
 
+// GetAppealModerationLogs 查看申诉用户最近的内容审核记录
+func GetAppealModerationLogs(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	appeal, err := model.GetAppealById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的申诉ID",
+		})
+		return
+	}
+
+	logs, err := model.GetAppealModerationLogs(appeal.UserId, 50)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    logs,
+	})
+}
+
 type ReviewAppealRequest struct {
 	Note string `json:"note"`
 }
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type auditReplayContextKey struct{}
+
+// auditReplayState 重放请求在内部引擎中的上下文，仅能由网关自身注入
+type auditReplayState struct {
+	captureId   int
+	channelId   int
+	adminId     int
+	relayFormat types.RelayFormat
+}
+
+var (
+	auditReplayEngineOnce sync.Once
+	auditReplayEngine     *gin.Engine
+)
+
+// auditReplayContext 将重放请求固定到指定渠道，并标记来源采集记录；
+// 重放以发起的管理员身份执行，不使用原令牌，费用、限额与审核策略均不作用于原用户
+func auditReplayContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, ok := c.Request.Context().Value(auditReplayContextKey{}).(*auditReplayState)
+		if !ok {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		userCache, err := model.GetUserCache(state.adminId)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": types.NewOpenAIError(err, types.ErrorCodeQueryDataError, http.StatusInternalServerError).ToOpenAIError(),
+			})
+			return
+		}
+		userCache.WriteContext(c)
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, userCache.Group)
+		tempToken := &model.Token{
+			UserId: state.adminId,
+			Name:   fmt.Sprintf("audit-replay-%d", state.captureId),
+			Group:  userCache.Group,
+		}
+		_ = middleware.SetupContextForToken(c, tempToken)
+		common.SetContextKey(c, constant.ContextKeyAuditReplayOf, state.captureId)
+		common.SetContextKey(c, constant.ContextKeyTokenSpecificChannelId, strconv.Itoa(state.channelId))
+		c.Next()
+	}
+}
+
+// getAuditReplayEngine 构造执行重放的内部引擎，复用正常的鉴权、分发与计费流程，按采集时的格式处理任意路径
+func getAuditReplayEngine() *gin.Engine {
+	auditReplayEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(gin.Recovery())
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(auditReplayContext())
+		engine.Use(middleware.Distribute())
+		handler := func(c *gin.Context) {
+			state := c.Request.Context().Value(auditReplayContextKey{}).(*auditReplayState)
+			// NoRoute 预置了 404，流式响应不会显式写状态码
+			c.Status(http.StatusOK)
+			Relay(c, state.relayFormat)
+		}
+		engine.POST("/v1/engines/:model/embeddings", handler)
+		engine.NoRoute(handler)
+		auditReplayEngine = engine
+	})
+	return auditReplayEngine
+}
+
+func GetAuditCaptures(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	requestId := c.Query("request_id")
+	captures, total, err := model.GetAuditCaptures(userId, tokenId, channelId, requestId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(captures)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func getAuditCaptureWithBodies(c *gin.Context) (*model.AuditCapture, []byte, []byte, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的采集记录 ID")
+		return nil, nil, nil, false
+	}
+	capture, err := model.GetAuditCaptureById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, nil, false
+	}
+	requestBody, responseBody, err := service.LoadAuditCaptureBodies(capture)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, nil, false
+	}
+	return capture, requestBody, responseBody, true
+}
+
+func GetAuditCapture(c *gin.Context) {
+	capture, requestBody, responseBody, ok := getAuditCaptureWithBodies(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"capture":       capture,
+		"request_body":  string(requestBody),
+		"response_body": string(responseBody),
+	})
+}
+
+type ReplayAuditCaptureRequest struct {
+	ChannelId int `json:"channel_id"`
+}
+
+// ReplayAuditCapture 以管理员身份将采集的请求重新发送到指定渠道，并与原响应逐行比较
+// 重放费用计入管理员账户，消费日志中记录 audit_replay_of
+func ReplayAuditCapture(c *gin.Context) {
+	var req ReplayAuditCaptureRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.ChannelId <= 0 {
+		common.ApiErrorMsg(c, "请指定重放渠道")
+		return
+	}
+	capture, requestBody, responseBody, ok := getAuditCaptureWithBodies(c)
+	if !ok {
+		return
+	}
+	if capture.RequestTruncated {
+		common.ApiErrorMsg(c, "请求体超过采集上限被截断，无法重放")
+		return
+	}
+	if _, err := model.GetChannelById(req.ChannelId, false); err != nil {
+		common.ApiErrorMsg(c, "渠道不存在")
+		return
+	}
+	state := &auditReplayState{
+		captureId:   capture.Id,
+		channelId:   req.ChannelId,
+		adminId:     c.GetInt("id"),
+		relayFormat: types.RelayFormat(capture.RelayFormat),
+	}
+	replayReq := httptest.NewRequest(capture.Method, capture.Path, bytes.NewReader(requestBody))
+	replayReq = replayReq.WithContext(context.WithValue(c.Request.Context(), auditReplayContextKey{}, state))
+	if capture.RequestContentType != "" {
+		replayReq.Header.Set("Content-Type", capture.RequestContentType)
+	}
+	recorder := httptest.NewRecorder()
+	getAuditReplayEngine().ServeHTTP(recorder, replayReq)
+
+	diff := service.DiffAuditResponses(responseBody, recorder.Body.Bytes())
+	common.ApiSuccess(c, gin.H{
+		"capture_id":           capture.Id,
+		"channel_id":           req.ChannelId,
+		"request_id":           recorder.Header().Get(common.RequestIdKey),
+		"original_status_code": capture.StatusCode,
+		"status_code":          recorder.Code,
+		"original_body":        string(responseBody),
+		"body":                 string(recorder.Body.Bytes()),
+		"response_truncated":   capture.ResponseTruncated,
+		"identical":            len(diff) == 0 && capture.StatusCode == recorder.Code,
+		"diff":                 diff,
+	})
+}
+
+func DeleteHistoryAuditCaptures(c *gin.Context) {
+	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
+	if targetTimestamp == 0 {
+		common.ApiErrorMsg(c, "target timestamp is required")
+		return
+	}
+	count, err := service.DeleteOldAuditCaptures(c.Request.Context(), targetTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
@@ -63,6 +63,7 @@ func GetSubscription(c *gin.Context) {
 		HardLimitUSD:       amount,
 		SystemHardLimitUSD: amount,
 		AccessUntil:        expiredTime,
+		Budget:             getTokenBudgetWindow(c),
 	}
 	c.JSON(200, subscription)
 	return
@@ -102,7 +103,46 @@ func GetUsage(c *gin.Context) {
 	usage := OpenAIUsageResponse{
 		Object:     "list",
 		TotalUsage: amount * 100,
+		Budget:     getTokenBudgetWindow(c),
 	}
 	c.JSON(200, usage)
 	return
 }
+
+// quotaToBillingAmount 按站点展示类型换算额度
+func quotaToBillingAmount(quota int) float64 {
+	amount := float64(quota)
+	switch operation_setting.GetQuotaDisplayType() {
+	case operation_setting.QuotaDisplayTypeCNY:
+		amount = amount / common.QuotaPerUnit * operation_setting.USDExchangeRate
+	case operation_setting.QuotaDisplayTypeTokens:
+	default:
+		amount = amount / common.QuotaPerUnit
+	}
+	return amount
+}
+
+// getTokenBudgetWindow 返回当前令牌周期预算的窗口信息，未启用时返回 nil
+func getTokenBudgetWindow(c *gin.Context) *OpenAIBudgetWindow {
+	tokenId := c.GetInt("token_id")
+	if tokenId == 0 {
+		return nil
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil || !token.HasBudget() {
+		return nil
+	}
+	if err := model.ResetTokenBudgetIfDue(token); err != nil {
+		common.SysError("failed to reset token budget: " + err.Error())
+	}
+	remain := max(token.BudgetRemain, 0)
+	return &OpenAIBudgetWindow{
+		Period:   token.BudgetPeriod,
+		Rollover: token.BudgetRollover,
+		LimitUSD: quotaToBillingAmount(token.BudgetAmount),
+		// 结转后的余额可能超过单个周期的额度，此时视为本周期尚未使用
+		UsedUSD:   quotaToBillingAmount(max(token.BudgetAmount-remain, 0)),
+		RemainUSD: quotaToBillingAmount(remain),
+		ResetAt:   token.BudgetNextResetTime,
+	}
+}
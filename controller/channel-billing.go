@@ -30,6 +30,18 @@ type OpenAISubscriptionResponse struct {
 	HardLimitUSD       float64 `json:"hard_limit_usd"`
 	SystemHardLimitUSD float64 `json:"system_hard_limit_usd"`
 	AccessUntil        int64   `json:"access_until"`
+	// 令牌启用周期预算时返回当前周期的额度
+	Budget *OpenAIBudgetWindow `json:"budget,omitempty"`
+}
+
+// OpenAIBudgetWindow 令牌周期预算的当前窗口，金额单位与 *_usd 字段一致
+type OpenAIBudgetWindow struct {
+	Period    string  `json:"period"`
+	Rollover  string  `json:"rollover"`
+	LimitUSD  float64 `json:"limit_usd"`
+	UsedUSD   float64 `json:"used_usd"`
+	RemainUSD float64 `json:"remain_usd"`
+	ResetAt   int64   `json:"reset_at"`
 }
 
 type OpenAIUsageDailyCost struct {
@@ -50,7 +62,8 @@ type OpenAICreditGrants struct {
 type OpenAIUsageResponse struct {
 	Object string `json:"object"`
 	//DailyCosts []OpenAIUsageDailyCost `json:"daily_costs"`
-	TotalUsage float64 `json:"total_usage"` // unit: 0.01 dollar
+	TotalUsage float64             `json:"total_usage"` // unit: 0.01 dollar
+	Budget     *OpenAIBudgetWindow `json:"budget,omitempty"`
 }
 
 type OpenAISBUsageResponse struct {
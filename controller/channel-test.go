@@ -768,6 +768,7 @@ func TestChannel(c *gin.Context) {
 		})
 		return
 	}
+	model.ResetChannelBreaker(channel.Id, common.GetContextKeyInt(result.context, constant.ContextKeyChannelMultiKeyIndex))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -831,6 +832,10 @@ func testAllChannels(notify bool) error {
 				processChannelError(result.context, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(result.context, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 			}
 
+			if newAPIError == nil && result.localErr == nil && result.context != nil {
+				model.ResetChannelBreaker(channel.Id, common.GetContextKeyInt(result.context, constant.ContextKeyChannelMultiKeyIndex))
+			}
+
 			// enable channel
 			if !isChannelEnabled && service.ShouldEnableChannel(newAPIError, channel.Status) {
 				service.EnableChannel(channel.Id, common.GetContextKeyString(result.context, constant.ContextKeyChannelKey), channel.Name)
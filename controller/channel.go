@@ -145,6 +145,9 @@ func GetAllChannels(c *gin.Context) {
 
 	for _, datum := range channelData {
 		clearChannelInfo(datum)
+		stats := model.GetChannelRuntimeStats(datum.Id)
+		datum.RuntimeStats = &stats
+		datum.CircuitBreaker = model.GetChannelBreakerStatus(datum.Id)
 	}
 
 	countQuery := model.DB.Model(&model.Channel{})
@@ -1893,6 +1896,8 @@ func OllamaPullModel(c *gin.Context) {
 		return
 	}
 
+	syncOllamaChannelModelsAfterChange(channel)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": fmt.Sprintf("Model %s pulled successfully", req.ModelName),
@@ -1970,6 +1975,7 @@ func OllamaPullModelStream(c *gin.Context) {
 		})
 		fmt.Fprintf(c.Writer, "data: %s\n\n", string(errorData))
 	} else {
+		syncOllamaChannelModelsAfterChange(channel)
 		successData, _ := json.Marshal(gin.H{
 			"message": fmt.Sprintf("Model %s pulled successfully", req.ModelName),
 		})
@@ -2038,6 +2044,8 @@ func OllamaDeleteModel(c *gin.Context) {
 		return
 	}
 
+	syncOllamaChannelModelsAfterChange(channel)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": fmt.Sprintf("Model %s deleted successfully", req.ModelName),
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/ollama"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ollama 渠道模型列表定时同步间隔
+const ollamaModelSyncInterval = 10 * time.Minute
+
+// syncOllamaChannelModels 以 /api/tags 返回的本地模型覆盖渠道模型列表，模型映射中的别名予以保留
+func syncOllamaChannelModels(channel *model.Channel) ([]string, bool, error) {
+	baseURL := constant.ChannelBaseURLs[channel.Type]
+	if channel.GetBaseURL() != "" {
+		baseURL = channel.GetBaseURL()
+	}
+	key := strings.Split(channel.Key, "\n")[0]
+	models, err := ollama.FetchOllamaModels(baseURL, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	names := make([]string, 0, len(models))
+	seen := make(map[string]struct{}, len(models))
+	for _, modelInfo := range models {
+		if modelInfo.Name == "" {
+			continue
+		}
+		if _, ok := seen[modelInfo.Name]; ok {
+			continue
+		}
+		seen[modelInfo.Name] = struct{}{}
+		names = append(names, modelInfo.Name)
+	}
+
+	// 别名由模型映射指向实际模型，同步时不应被移除
+	modelMapping := make(map[string]string)
+	if mapping := channel.GetModelMapping(); mapping != "" && mapping != "{}" {
+		_ = common.UnmarshalJsonStr(mapping, &modelMapping)
+	}
+	for _, existing := range channel.GetModels() {
+		existing = strings.TrimSpace(existing)
+		if _, ok := modelMapping[existing]; !ok {
+			continue
+		}
+		if _, ok := seen[existing]; ok {
+			continue
+		}
+		seen[existing] = struct{}{}
+		names = append(names, existing)
+	}
+
+	newModels := strings.Join(names, ",")
+	if newModels == channel.Models {
+		return names, false, nil
+	}
+	if err := channel.UpdateModels(newModels); err != nil {
+		return nil, false, err
+	}
+	return names, true, nil
+}
+
+// syncOllamaChannelModelsAfterChange 拉取或删除模型后刷新渠道模型列表，仅对开启自动同步的渠道生效；失败只记录日志不影响原操作结果
+func syncOllamaChannelModelsAfterChange(channel *model.Channel) {
+	if !channel.GetOtherSettings().OllamaAutoSyncModels {
+		return
+	}
+	_, changed, err := syncOllamaChannelModels(channel)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to sync ollama models: channel_id=%d, error=%v", channel.Id, err))
+		return
+	}
+	if changed {
+		model.InitChannelCache()
+	}
+}
+
+// OllamaSyncModels 从 Ollama /api/tags 同步渠道模型列表
+func OllamaSyncModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Channel not found",
+		})
+		return
+	}
+
+	if channel.Type != constant.ChannelTypeOllama {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "This operation is only supported for Ollama channels",
+		})
+		return
+	}
+
+	models, changed, err := syncOllamaChannelModels(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("获取Ollama模型失败: %s", err.Error()),
+		})
+		return
+	}
+	if changed {
+		model.InitChannelCache()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"models":  models,
+			"changed": changed,
+		},
+	})
+}
+
+func syncAllOllamaChannelModels() {
+	count, err := model.CountChannelsByType(constant.ChannelTypeOllama)
+	if err != nil || count == 0 {
+		return
+	}
+	channels, err := model.GetChannelsByType(0, int(count), true, constant.ChannelTypeOllama)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load ollama channels: %v", err))
+		return
+	}
+	anyChanged := false
+	for _, channel := range channels {
+		if channel.Status != common.ChannelStatusEnabled || !channel.GetOtherSettings().OllamaAutoSyncModels {
+			continue
+		}
+		// 列表查询不含密钥，需重新读取完整渠道
+		fullChannel, err := model.GetChannelById(channel.Id, true)
+		if err != nil {
+			continue
+		}
+		_, changed, err := syncOllamaChannelModels(fullChannel)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to sync ollama models: channel_id=%d, error=%v", channel.Id, err))
+			continue
+		}
+		if changed {
+			anyChanged = true
+			common.SysLog(fmt.Sprintf("ollama channel models synced: channel_id=%d, models=%s", channel.Id, fullChannel.Models))
+		}
+	}
+	if anyChanged {
+		model.InitChannelCache()
+	}
+}
+
+var autoSyncOllamaModelsOnce sync.Once
+
+func AutomaticallySyncOllamaModels() {
+	// 只在Master节点定时同步
+	if !common.IsMasterNode {
+		return
+	}
+	autoSyncOllamaModelsOnce.Do(func() {
+		for {
+			time.Sleep(ollamaModelSyncInterval)
+			syncAllOllamaChannelModels()
+		}
+	})
+}
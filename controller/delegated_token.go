@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDelegatedToken 使用当前令牌签发短期子令牌，供前端或移动端直接调用，子令牌不能再签发子令牌
+func CreateDelegatedToken(c *gin.Context) {
+	if common.GetContextKeyString(c, constant.ContextKeyDelegatedTokenId) != "" {
+		relayFileError(c, http.StatusForbidden, "invalid_request_error", "delegated tokens cannot mint delegated tokens")
+		return
+	}
+	var req service.MintDelegatedTokenRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil && !errors.Is(err, io.EOF) {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+	parent, err := model.GetTokenByKey(common.GetContextKeyString(c, constant.ContextKeyTokenKey), false)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	resp, err := service.MintDelegatedToken(parent, &req)
+	if err != nil {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeDelegatedToken 撤销当前令牌签发的指定子令牌
+func RevokeDelegatedToken(c *gin.Context) {
+	if common.GetContextKeyString(c, constant.ContextKeyDelegatedTokenId) != "" {
+		relayFileError(c, http.StatusForbidden, "invalid_request_error", "delegated tokens cannot revoke delegated tokens")
+		return
+	}
+	id := c.Param("id")
+	if err := service.RevokeDelegatedToken(common.GetContextKeyInt(c, constant.ContextKeyTokenId), id); err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":  "delegated_token",
+		"id":      id,
+		"revoked": true,
+	})
+}
+
+// RevokeAllDelegatedTokens 撤销当前令牌此前签发的所有子令牌，用于子令牌泄露时的紧急处置
+func RevokeAllDelegatedTokens(c *gin.Context) {
+	if common.GetContextKeyString(c, constant.ContextKeyDelegatedTokenId) != "" {
+		relayFileError(c, http.StatusForbidden, "invalid_request_error", "delegated tokens cannot revoke delegated tokens")
+		return
+	}
+	parent, err := model.GetTokenByKey(common.GetContextKeyString(c, constant.ContextKeyTokenKey), false)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	if err := parent.RevokeDelegatedTokens(); err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":     "delegated_token.revocation",
+		"revoked_at": parent.DelegatedRevokedAt,
+	})
+}
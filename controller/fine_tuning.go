@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func getOwnedFineTuningTask(c *gin.Context) (*model.Task, bool) {
+	jobId := c.Param("id")
+	task, err := service.GetOwnedFineTuningTask(c, jobId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No fine-tuning job found with id '%s'.", jobId))
+		} else {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		}
+		return nil, false
+	}
+	return task, true
+}
+
+// FineTuningJobCreate POST /v1/fine_tuning/jobs (also legacy POST /v1/fine-tunes)
+// 微调任务按基础模型的按次价格计费，转发前预扣，上游创建失败时退还
+func FineTuningJobCreate(c *gin.Context) {
+	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAIFineTuning, nil, nil)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	relayInfo.InitChannelMeta(c)
+	priceData := helper.ModelPriceHelperPerCall(c, relayInfo)
+	if apiErr := service.PreConsumeBilling(c, priceData.Quota, relayInfo); apiErr != nil {
+		relayFileError(c, apiErr.StatusCode, string(apiErr.GetErrorCode()), apiErr.Error())
+		return
+	}
+
+	task, err := service.CreateFineTuningJob(c, priceData.Quota)
+	if task == nil {
+		relayInfo.Billing.Refund(c)
+		relayFileUpstreamError(c, err)
+		return
+	}
+	if settleErr := service.SettleBilling(c, relayInfo, priceData.Quota); settleErr != nil {
+		logger.LogError(c, "error settling fine-tuning quota: "+settleErr.Error())
+	}
+	recordFineTuningConsumeLog(c, relayInfo, priceData, task.TaskID)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.FineTuningTaskJob(task))
+}
+
+func recordFineTuningConsumeLog(c *gin.Context, relayInfo *relaycommon.RelayInfo, priceData types.PerCallPriceData, jobId string) {
+	if priceData.Quota == 0 {
+		return
+	}
+	other := map[string]interface{}{
+		"request_path": c.Request.URL.Path,
+		"model_price":  priceData.ModelPrice,
+		"group_ratio":  priceData.GroupRatioInfo.GroupRatio,
+	}
+	if priceData.GroupRatioInfo.HasSpecialRatio {
+		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
+	}
+	service.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId: relayInfo.ChannelId,
+		ModelName: relayInfo.OriginModelName,
+		TokenName: c.GetString("token_name"),
+		Quota:     priceData.Quota,
+		Content:   fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，微调任务 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, jobId),
+		TokenId:   relayInfo.TokenId,
+		Group:     relayInfo.UsingGroup,
+		Other:     other,
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
+}
+
+// FineTuningJobList GET /v1/fine_tuning/jobs
+func FineTuningJobList(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	var afterId int64
+	if after := c.Query("after"); after != "" {
+		if cursor, err := service.GetOwnedFineTuningTask(c, after); err == nil {
+			afterId = cursor.ID
+		}
+	}
+	resp := dto.FineTuningJobList{
+		Object: "list",
+		Data:   make([]*dto.FineTuningJob, 0, limit),
+	}
+	// 按令牌过滤归属，逐页扫描直到凑满一页
+	for len(resp.Data) <= limit {
+		tasks, err := model.GetUserTasksByPlatform(userId, constant.TaskPlatformFineTuning, afterId, limit+1)
+		if err != nil {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+			return
+		}
+		for _, task := range tasks {
+			if task.PrivateData.TokenId == tokenId {
+				resp.Data = append(resp.Data, service.FineTuningTaskJob(task))
+			}
+		}
+		if len(tasks) <= limit {
+			break
+		}
+		afterId = tasks[len(tasks)-1].ID
+	}
+	if len(resp.Data) > limit {
+		resp.Data = resp.Data[:limit]
+		resp.HasMore = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// FineTuningJobRetrieve GET /v1/fine_tuning/jobs/:id
+func FineTuningJobRetrieve(c *gin.Context) {
+	task, ok := getOwnedFineTuningTask(c)
+	if !ok {
+		return
+	}
+	if task.Status != model.TaskStatusSuccess && task.Status != model.TaskStatusFailure {
+		if err := service.SyncFineTuningTask(c.Request.Context(), task); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to refresh fine-tuning job %s: %s", task.TaskID, err.Error()))
+		}
+	}
+	c.JSON(http.StatusOK, service.FineTuningTaskJob(task))
+}
+
+// FineTuningJobCancel POST /v1/fine_tuning/jobs/:id/cancel
+func FineTuningJobCancel(c *gin.Context) {
+	task, ok := getOwnedFineTuningTask(c)
+	if !ok {
+		return
+	}
+	if err := service.CancelFineTuningJob(c.Request.Context(), task); err != nil {
+		relayFileUpstreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, service.FineTuningTaskJob(task))
+}
+
+// FineTuningJobSubresource GET /v1/fine_tuning/jobs/:id/events 和 /checkpoints，直接透传上游响应
+func FineTuningJobSubresource(subPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, ok := getOwnedFineTuningTask(c)
+		if !ok {
+			return
+		}
+		resp, err := service.DoFineTuningJobRequest(c.Request.Context(), task, http.MethodGet, subPath, c.Request.URL.RawQuery)
+		if err != nil {
+			relayFileUpstreamError(c, err)
+			return
+		}
+		defer service.CloseResponseBodyGracefully(resp)
+		c.Status(resp.StatusCode)
+		c.Header("Content-Type", resp.Header.Get("Content-Type"))
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to copy fine-tuning response: %s", err.Error()))
+		}
+	}
+}
+
+// UpdateFineTuningTaskAll 由任务轮询循环调用，同步未完成的微调任务
+func UpdateFineTuningTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, taskIds := range taskChannelM {
+		logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的微调任务有: %d", channelId, len(taskIds)))
+		for _, taskId := range taskIds {
+			task, ok := taskM[taskId]
+			if !ok {
+				continue
+			}
+			if err := service.SyncFineTuningTask(ctx, task); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("同步微调任务 %s 失败: %s", taskId, err.Error()))
+			}
+		}
+	}
+	return nil
+}
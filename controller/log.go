@@ -21,7 +21,8 @@ func GetAllLogs(c *gin.Context) {
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
 	requestId := c.Query("request_id")
-	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group, requestId)
+	endUserId := c.Query("end_user_id")
+	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group, requestId, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -42,7 +43,8 @@ func GetUserLogs(c *gin.Context) {
 	modelName := c.Query("model_name")
 	group := c.Query("group")
 	requestId := c.Query("request_id")
-	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId)
+	endUserId := c.Query("end_user_id")
+	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -102,7 +104,8 @@ func GetLogsStat(c *gin.Context) {
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
-	stat, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group)
+	endUserId := c.Query("end_user_id")
+	stat, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -129,7 +132,8 @@ func GetLogsSelfStat(c *gin.Context) {
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
-	quotaNum, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group)
+	endUserId := c.Query("end_user_id")
+	quotaNum, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -169,3 +173,30 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+func getEndUserUsages(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tokenName := c.Query("token_name")
+	endUserId := c.Query("end_user_id")
+	usages, total, err := model.GetEndUserUsages(userId, tokenName, endUserId, startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(usages)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetEndUserUsages 按终端用户汇总全部用户的消费，可按 user_id 过滤
+func GetEndUserUsages(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getEndUserUsages(c, userId)
+}
+
+// GetSelfEndUserUsages 按终端用户汇总当前用户的消费
+func GetSelfEndUserUsages(c *gin.Context) {
+	getEndUserUsages(c, c.GetInt("id"))
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsHandler     = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+	metricsRefreshLock sync.Mutex
+)
+
+// Metrics 以 Prometheus 文本格式暴露指标，未启用时返回 404
+func Metrics(c *gin.Context) {
+	if !operation_setting.GetMetricsSetting().Enabled {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	metricsRefreshLock.Lock()
+	defer metricsRefreshLock.Unlock()
+	refreshMetricGauges()
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
+
+// refreshMetricGauges 刷新渠道状态、熔断、亲和缓存与系统状态等快照类指标
+func refreshMetricGauges() {
+	channels, err := model.GetAllChannelStatuses()
+	if err != nil {
+		common.SysError("failed to load channels for metrics: " + err.Error())
+	} else {
+		metrics.ChannelStatus.Reset()
+		metrics.ChannelInflight.Reset()
+		metrics.ChannelCircuitState.Reset()
+		for _, channel := range channels {
+			label := metrics.ChannelLabel(channel.Id)
+			if label == metrics.OtherLabelValue {
+				continue
+			}
+			metrics.ChannelStatus.WithLabelValues(label).Set(float64(channel.Status))
+			metrics.ChannelInflight.WithLabelValues(label).Set(float64(model.GetChannelRuntimeStats(channel.Id).Inflight))
+			if status := model.GetChannelBreakerStatus(channel.Id); status != nil {
+				for _, state := range []string{model.CircuitBreakerClosed, model.CircuitBreakerOpen, model.CircuitBreakerHalfOpen} {
+					value := 0.0
+					if status.State == state {
+						value = 1
+					}
+					metrics.ChannelCircuitState.WithLabelValues(label, state).Set(value)
+				}
+			}
+		}
+	}
+
+	affinity := service.GetChannelAffinityCacheStats()
+	metrics.AffinityCacheEntries.Reset()
+	if affinity.Enabled {
+		for rule, count := range affinity.ByRuleName {
+			metrics.AffinityCacheEntries.WithLabelValues(rule).Set(float64(count))
+		}
+		if affinity.Unknown > 0 {
+			metrics.AffinityCacheEntries.WithLabelValues("").Set(float64(affinity.Unknown))
+		}
+	}
+	metrics.AffinityCacheCapacity.Set(float64(affinity.CacheCapacity))
+
+	metrics.ActiveConnections.Set(float64(middleware.GetStats().ActiveConnections))
+	system := common.GetSystemStatus()
+	metrics.SystemUsage.WithLabelValues("cpu").Set(system.CPUUsage)
+	metrics.SystemUsage.WithLabelValues("memory").Set(system.MemoryUsage)
+	metrics.SystemUsage.WithLabelValues("disk").Set(system.DiskUsage)
+}
@@ -181,6 +181,9 @@ func UpdateMidjourneyTaskBulk() {
 						if err != nil {
 							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
+						if err := model.AdjustBudget(task.GetBudgetChain(), -task.Quota); err != nil {
+							logger.LogError(ctx, "fail to refund budget: "+err.Error())
+						}
 						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(task.Quota))
 						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
 					}
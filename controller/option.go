@@ -28,9 +28,13 @@ func GetOptions(c *gin.Context) {
 			strings.HasSuffix(k, "api_key") {
 			continue
 		}
+		value := common.Interface2String(v)
+		if k == "moderation_setting.stages" {
+			value = operation_setting.RedactModerationStages(value)
+		}
 		options = append(options, &model.Option{
 			Key:   k,
-			Value: common.Interface2String(v),
+			Value: value,
 		})
 	}
 	common.OptionMapRWMutex.Unlock()
@@ -76,6 +80,31 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "audit_capture_setting.enabled":
+		if option.Value == "true" && !common.CryptoSecretConfigured {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用请求采集，请先设置 CRYPTO_SECRET 环境变量，否则重启后已采集的数据无法解密！",
+			})
+			return
+		}
+	case "delegated_token_setting.enabled":
+		if option.Value == "true" && !common.CryptoSecretConfigured {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用子令牌，请先设置 CRYPTO_SECRET 环境变量，否则重启后或在其它节点上已签发的子令牌将失效！",
+			})
+			return
+		}
+	case "moderation_setting.stages":
+		option.Value, err = operation_setting.RestoreModerationStageSecrets(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "审核阶段配置格式错误: " + err.Error(),
+			})
+			return
+		}
 	case "discord.enabled":
 		if option.Value == "true" && system_setting.GetDiscordSettings().ClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,301 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type organizationMemberRequest struct {
+	UserId int `json:"user_id"`
+	OrgId  int `json:"org_id"`
+}
+
+func validateBudgetFields(name string, remainQuota int, spendCap int) error {
+	if utf8.RuneCountInString(name) == 0 || utf8.RuneCountInString(name) > 64 {
+		return errors.New("名称长度必须在 1-64 之间")
+	}
+	if remainQuota < 0 || spendCap < 0 {
+		return errors.New("额度与消费上限不能为负数")
+	}
+	return nil
+}
+
+// validateTokenProject 令牌只能归属于用户所在组织下的项目
+func validateTokenProject(userId int, projectId int) error {
+	if projectId == 0 {
+		return nil
+	}
+	project, err := model.GetProjectById(projectId)
+	if err != nil {
+		return errors.New("项目不存在")
+	}
+	user, err := model.GetUserCache(userId)
+	if err != nil {
+		return err
+	}
+	if user.OrgId == 0 || project.OrgId != user.OrgId {
+		return errors.New("只能选择所在组织下的项目")
+	}
+	return nil
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetOrganization 返回组织、项目与成员三级的额度与消耗
+func GetOrganization(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	projects, err := model.GetProjectsByOrgId(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	members, err := model.GetOrganizationMembers(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": org,
+		"projects":     projects,
+		"members":      members,
+	})
+}
+
+func AddOrganization(c *gin.Context) {
+	org := model.Organization{}
+	if err := c.ShouldBindJSON(&org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateBudgetFields(org.Name, org.RemainQuota, org.SpendCap); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:           org.Name,
+		Status:         common.UserStatusEnabled,
+		RemainQuota:    org.RemainQuota,
+		UnlimitedQuota: org.UnlimitedQuota,
+		SpendCap:       org.SpendCap,
+		ModelLimits:    org.ModelLimits,
+		CreatedTime:    common.GetTimestamp(),
+	}
+	if err := cleanOrg.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanOrg)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org := model.Organization{}
+	if err := c.ShouldBindJSON(&org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateBudgetFields(org.Name, org.RemainQuota, org.SpendCap); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	cleanOrg, err := model.GetOrganizationById(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	cleanOrg.Name = org.Name
+	cleanOrg.Status = org.Status
+	cleanOrg.RemainQuota = org.RemainQuota
+	cleanOrg.UnlimitedQuota = org.UnlimitedQuota
+	cleanOrg.SpendCap = org.SpendCap
+	cleanOrg.ModelLimits = org.ModelLimits
+	if err := cleanOrg.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanOrg)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteOrganization(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// SetOrganizationMember 将用户加入组织，org_id 为 0 时移出组织
+func SetOrganizationMember(c *gin.Context) {
+	req := organizationMemberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetUserById(req.UserId, false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.OrgId != 0 {
+		if _, err := model.GetOrganizationById(req.OrgId); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err := model.SetUserOrganization(req.UserId, req.OrgId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetProject 返回项目及其下令牌的额度与消耗
+func GetProject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	project, err := model.GetProjectById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	tokens, err := model.GetProjectTokens(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"project": project,
+		"tokens":  tokens,
+	})
+}
+
+func AddProject(c *gin.Context) {
+	project := model.Project{}
+	if err := c.ShouldBindJSON(&project); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateBudgetFields(project.Name, project.RemainQuota, project.SpendCap); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetOrganizationById(project.OrgId); err != nil {
+		common.ApiErrorMsg(c, "组织不存在")
+		return
+	}
+	cleanProject := model.Project{
+		OrgId:          project.OrgId,
+		Name:           project.Name,
+		Status:         common.UserStatusEnabled,
+		RemainQuota:    project.RemainQuota,
+		UnlimitedQuota: project.UnlimitedQuota,
+		SpendCap:       project.SpendCap,
+		ModelLimits:    project.ModelLimits,
+		CreatedTime:    common.GetTimestamp(),
+	}
+	if err := cleanProject.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanProject)
+}
+
+func UpdateProject(c *gin.Context) {
+	project := model.Project{}
+	if err := c.ShouldBindJSON(&project); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateBudgetFields(project.Name, project.RemainQuota, project.SpendCap); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	cleanProject, err := model.GetProjectById(project.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	cleanProject.Name = project.Name
+	cleanProject.Status = project.Status
+	cleanProject.RemainQuota = project.RemainQuota
+	cleanProject.UnlimitedQuota = project.UnlimitedQuota
+	cleanProject.SpendCap = project.SpendCap
+	cleanProject.ModelLimits = project.ModelLimits
+	if err := cleanProject.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanProject)
+}
+
+func DeleteProject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteProject(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetSelfOrganization 返回当前用户所在组织及其项目的额度与消耗，未加入组织时 data 为 null
+func GetSelfOrganization(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.OrgId == 0 {
+		common.ApiSuccess(c, nil)
+		return
+	}
+	org, err := model.GetOrganizationById(user.OrgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	projects, err := model.GetProjectsByOrgId(user.OrgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": org,
+		"projects":     projects,
+		"used_quota":   user.UsedQuota,
+	})
+}
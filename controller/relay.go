@@ -16,6 +16,8 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -29,6 +31,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -83,6 +86,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			return
 		}
 		defer ws.Close()
+	} else {
+		// 先于错误响应的 defer 注册，错误响应也会被采集
+		defer relay.StartAuditCapture(c, relayFormat)()
 	}
 
 	defer func() {
@@ -103,6 +109,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 				})
 			}
 		}
+		status := c.Writer.Status()
+		if newAPIError != nil {
+			status = newAPIError.StatusCode
+		}
+		metrics.RecordRelayRequest(common.GetContextKeyString(c, constant.ContextKeyOriginalModel), common.GetContextKeyString(c, constant.ContextKeyUsingGroup), status, len(c.GetStringSlice("use_channel")))
 	}()
 
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
@@ -122,11 +133,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	service.ResolveEndUserId(c, request)
+	newAPIError = service.CheckEndUserLimits(c)
+	if newAPIError != nil {
+		return
+	}
+	defer service.RecordEndUserUsage(c)
+
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
+	needModeration := operation_setting.GetModerationSetting().HasStage(false)
 	needCountToken := constant.CountToken
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needModeration || needCountToken {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -141,6 +160,13 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	if needModeration && meta != nil {
+		newAPIError = service.ModeratePrompt(c, relayInfo, request, meta.CombineText)
+		if newAPIError != nil {
+			return
+		}
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -149,6 +175,13 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	var releaseRateLimit func()
+	releaseRateLimit, newAPIError = service.AcquireTokenRateLimit(c, relayInfo, tokens)
+	if newAPIError != nil {
+		return
+	}
+	defer releaseRateLimit()
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -205,15 +238,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if delay, ok := getHedgeDelay(c, relayInfo, relayFormat); ok {
+			channel, newAPIError = relayWithHedge(c, relayInfo, relayFormat, channel, retryParam, delay)
+		} else {
+			newAPIError = relayChannelAttempt(c, relayInfo, relayFormat, channel)
 		}
 
 		if newAPIError == nil {
@@ -222,7 +250,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+		// 启用熔断后 5xx、限流、超时等暂时性错误交由熔断器暂停渠道，密钥失效等永久性错误仍直接禁用
+		autoBan := channel.GetAutoBan() && !(operation_setting.GetCircuitBreakerSetting().Enabled && service.IsTransientChannelError(channel.Type, newAPIError))
+		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), autoBan), newAPIError)
 
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
 			break
@@ -243,6 +273,64 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// relayChannelAttempt 向当前选中的渠道发送一次请求，并记录渠道实时统计与熔断结果
+func relayChannelAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel) *types.NewAPIError {
+	span := tracing.StartSpan(c, "relay_attempt",
+		attribute.Int("channel.id", channel.Id),
+		attribute.Int("channel.type", channel.Type),
+		attribute.String("model", relayInfo.OriginModelName),
+		attribute.Int("attempt", len(c.GetStringSlice("use_channel"))),
+	)
+	defer span.End()
+	newAPIError := relayWithChannelStats(c, channel.Id, relayInfo, func() *types.NewAPIError {
+		switch relayFormat {
+		case types.RelayFormatOpenAIRealtime:
+			return relay.WssHelper(c, relayInfo)
+		case types.RelayFormatClaude:
+			return relay.ClaudeHelper(c, relayInfo)
+		case types.RelayFormatGemini:
+			return geminiRelayHandler(c, relayInfo)
+		default:
+			return relayHandler(c, relayInfo)
+		}
+	})
+	if newAPIError != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", newAPIError.StatusCode))
+		span.SetError(newAPIError)
+	}
+	if service.IsHedgeLoser(c) {
+		span.SetAttributes(attribute.Bool("hedge.lost", true))
+	}
+	// 对冲落败被取消的请求不计入熔断
+	if !service.IsHedgeLoser(c) {
+		model.RecordChannelBreakerResult(channel.Id, common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey), common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex), service.IsCircuitBreakerFailure(channel.Type, newAPIError))
+	}
+	return newAPIError
+}
+
+// relayWithChannelStats 记录一次渠道请求的并发数、延迟与首字时间，供渠道选择策略使用
+func relayWithChannelStats(c *gin.Context, channelId int, info *relaycommon.RelayInfo, doRelay func() *types.NewAPIError) (newAPIError *types.NewAPIError) {
+	start := time.Now()
+	model.ChannelRequestStart(channelId)
+	defer func() {
+		var ttft time.Duration
+		if info.IsStream && info.FirstResponseTime.After(start) {
+			ttft = info.FirstResponseTime.Sub(start)
+		}
+		// 实时会话的时长与上游快慢无关，对冲落败的请求已被取消，命中响应缓存的请求没有访问上游，都不计入延迟
+		success := newAPIError == nil && info.RelayFormat != types.RelayFormatOpenAIRealtime && !service.IsHedgeLoser(c) && !service.IsResponseCacheHit(c)
+		model.ChannelRequestEnd(channelId, time.Since(start), ttft, success)
+		if !service.IsHedgeLoser(c) && !service.IsResponseCacheHit(c) {
+			status := c.Writer.Status()
+			if newAPIError != nil {
+				status = newAPIError.StatusCode
+			}
+			metrics.RecordChannelAttempt(channelId, info.OriginModelName, info.UsingGroup, status, time.Since(start), ttft)
+		}
+	}()
+	return doRelay()
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -290,19 +378,24 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 			AutoBan: &autoBanInt,
 		}, nil
 	}
+	span := tracing.StartSpan(c, "select_channel", attribute.Int("retry", retryParam.GetRetry()))
+	defer span.End()
 	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(retryParam)
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
 	if err != nil {
+		span.SetError(err)
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
 	if channel == nil {
 		return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在（retry）", selectGroup, info.OriginModelName), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
+	span.SetAttributes(attribute.Int("channel.id", channel.Id), attribute.String("group", selectGroup))
 
 	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, info.OriginModelName)
 	if newAPIError != nil {
+		span.SetError(newAPIError)
 		return nil, newAPIError
 	}
 	return channel, nil
@@ -339,6 +432,7 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 
 func processChannelError(c *gin.Context, channelError types.ChannelError, err *types.NewAPIError) {
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
+	metrics.RecordChannelError(channelError.ChannelId, err.StatusCode, string(err.GetErrorCode()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
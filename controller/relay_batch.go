@@ -0,0 +1,605 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+const (
+	relayBatchCompletionWindow = "24h"
+	// 本地执行的批次超过该时间没有心跳，视为所在节点已中断
+	relayBatchLocalStaleSeconds = 10 * 60
+	relayBatchHeartbeatInterval = 10 * time.Second
+)
+
+var relayBatchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/moderations":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+}
+
+var (
+	relayBatchEngineOnce sync.Once
+	relayBatchEngine     *gin.Engine
+	relayBatchSlots      chan struct{}
+	// 当前节点正在执行的本地批次，batch id -> cancel func
+	relayBatchCancels sync.Map
+)
+
+type relayBatchLineContextKey struct{}
+
+// relayBatchLineState 批处理单行请求在内部引擎中的上下文，仅能由网关自身注入
+type relayBatchLineState struct {
+	batchId string
+	quota   int
+}
+
+func getOwnedRelayBatch(c *gin.Context) (*model.RelayBatch, bool) {
+	batchId := c.Param("id")
+	batch, err := model.GetRelayBatchByBatchId(c.GetInt("id"), batchId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No batch found with id '%s'.", batchId))
+		} else {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+// RelayBatchCreate POST /v1/batches
+func RelayBatchCreate(c *gin.Context) {
+	var req dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+	if _, ok := relayBatchEndpointFormats[req.Endpoint]; !ok {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("unsupported endpoint %s", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = relayBatchCompletionWindow
+	}
+	if req.CompletionWindow != relayBatchCompletionWindow {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "completion_window must be 24h")
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetRelayFileByFileId(userId, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		} else {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		}
+		return
+	}
+	userQuota, err := model.GetUserQuota(userId, false)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	if userQuota <= 0 {
+		relayFileError(c, http.StatusForbidden, "insufficient_user_quota", "用户额度不足")
+		return
+	}
+	input, err := service.LoadRelayBatchInput(c.Request.Context(), inputFile, req.Endpoint)
+	if err != nil {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.RelayBatch{
+		BatchId:          model.RelayBatchIdPrefix + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Group:            common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Mode:             model.RelayBatchModeLocal,
+		Endpoint:         req.Endpoint,
+		CompletionWindow: req.CompletionWindow,
+		InputFileId:      inputFile.FileId,
+		Status:           model.RelayBatchStatusValidating,
+		TotalCount:       len(input.Lines),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(req.Metadata) > 0 {
+		batch.Metadata = common.GetJsonString(req.Metadata)
+	}
+	batch.InputModels = common.GetJsonString(input.Models)
+	if service.CanForwardRelayBatch(inputFile, input) {
+		if err := service.PreConsumeRelayBatchQuota(batch, input); err != nil {
+			if errors.Is(err, service.ErrRelayBatchInsufficientQuota) {
+				relayFileError(c, http.StatusForbidden, "insufficient_user_quota", err.Error())
+			} else {
+				relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+			}
+			return
+		}
+		if err := service.CreateUpstreamRelayBatch(c.Request.Context(), batch, inputFile, req.Metadata); err != nil {
+			// 上游不支持 Batch API 时退回到网关本地执行，本地执行按行实时扣费，退还预扣额度
+			logger.LogWarn(c, fmt.Sprintf("create upstream batch failed, fallback to local execution: %s", err.Error()))
+			refundRelayBatchPreConsumed(c, batch)
+		}
+	}
+	if err := batch.Insert(); err != nil {
+		refundRelayBatchPreConsumed(c, batch)
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	if batch.Mode == model.RelayBatchModeLocal {
+		token, err := model.GetTokenById(batch.TokenId)
+		if err != nil {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+			return
+		}
+		startLocalRelayBatch(batch, input, token)
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func refundRelayBatchPreConsumed(c *gin.Context, batch *model.RelayBatch) {
+	if err := service.RefundRelayBatchPreConsumed(batch); err != nil {
+		logger.LogError(c, fmt.Sprintf("batch %s: failed to refund pre-consumed quota: %s", batch.BatchId, err.Error()))
+	}
+}
+
+// RelayBatchList GET /v1/batches
+func RelayBatchList(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserRelayBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	resp := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]*dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		resp.Data = append(resp.Data, batch.ToOpenAIBatch())
+	}
+	if len(batches) > 0 {
+		resp.FirstId = batches[0].BatchId
+		resp.LastId = batches[len(batches)-1].BatchId
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RelayBatchRetrieve GET /v1/batches/:id
+func RelayBatchRetrieve(c *gin.Context) {
+	batch, ok := getOwnedRelayBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+// RelayBatchCancel POST /v1/batches/:id/cancel
+func RelayBatchCancel(c *gin.Context) {
+	batch, ok := getOwnedRelayBatch(c)
+	if !ok {
+		return
+	}
+	if batch.IsFinished() || batch.Status == model.RelayBatchStatusCancelling {
+		c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+		return
+	}
+	if batch.Mode == model.RelayBatchModeUpstream {
+		if err := service.CancelUpstreamRelayBatch(c.Request.Context(), batch); err != nil {
+			relayFileUpstreamError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+		return
+	}
+	fromStatus := batch.Status
+	batch.Status = model.RelayBatchStatusCancelling
+	if _, err := batch.UpdateWithStatus(fromStatus); err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	// 其它节点上执行的批次会在下一次心跳时发现取消状态
+	if cancel, ok := relayBatchCancels.Load(batch.Id); ok {
+		cancel.(context.CancelFunc)()
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+// relayBatchLineContext 将内部请求携带的批次标记写入 gin 上下文
+// 批次标记只能通过 Go context 注入，外部请求无法伪造批处理计费
+func relayBatchLineContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, ok := c.Request.Context().Value(relayBatchLineContextKey{}).(*relayBatchLineState)
+		if !ok {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		common.SetContextKey(c, constant.ContextKeyRelayBatchId, state.batchId)
+		c.Next()
+		state.quota = common.GetContextKeyInt(c, constant.ContextKeyRelayBatchLineQuota)
+	}
+}
+
+// getRelayBatchEngine 构造执行批处理行的内部引擎，复用正常的鉴权、分发与计费流程
+func getRelayBatchEngine() *gin.Engine {
+	relayBatchEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(gin.Recovery())
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(relayBatchLineContext())
+		engine.Use(middleware.TokenAuth())
+		engine.Use(middleware.Distribute())
+		for endpoint, format := range relayBatchEndpointFormats {
+			relayFormat := format
+			engine.POST(endpoint, func(c *gin.Context) {
+				Relay(c, relayFormat)
+			})
+		}
+		relayBatchEngine = engine
+
+		maxRunning := operation_setting.GetBatchSetting().MaxLocalRunning
+		if maxRunning <= 0 {
+			maxRunning = 1
+		}
+		relayBatchSlots = make(chan struct{}, maxRunning)
+	})
+	return relayBatchEngine
+}
+
+// relayBatchLineResult 单行执行结果
+type relayBatchLineResult struct {
+	line    *dto.OpenAIBatchOutputLine
+	success bool
+	quota   int
+}
+
+func executeRelayBatchLine(ctx context.Context, batch *model.RelayBatch, token *model.Token, inputLine *dto.OpenAIBatchInputLine) relayBatchLineResult {
+	body := []byte(inputLine.Body)
+	// 批处理结果需要完整响应体，强制关闭流式输出
+	if bytes.Contains(body, []byte(`"stream"`)) {
+		var payload map[string]any
+		if err := common.Unmarshal(body, &payload); err == nil {
+			delete(payload, "stream")
+			delete(payload, "stream_options")
+			if data, err := common.Marshal(payload); err == nil {
+				body = data
+			}
+		}
+	}
+	state := &relayBatchLineState{batchId: batch.BatchId}
+	req := httptest.NewRequest(http.MethodPost, inputLine.Url, bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(ctx, relayBatchLineContextKey{}, state))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	recorder := httptest.NewRecorder()
+	getRelayBatchEngine().ServeHTTP(recorder, req)
+
+	output := &dto.OpenAIBatchOutputLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: inputLine.CustomId,
+		Response: &dto.OpenAIBatchOutputResponse{
+			StatusCode: recorder.Code,
+			RequestId:  recorder.Header().Get(common.RequestIdKey),
+			Body:       recorder.Body.Bytes(),
+		},
+	}
+	if common.GetJsonType(recorder.Body.Bytes()) != "object" {
+		output.Response.Body = nil
+	}
+	success := recorder.Code >= http.StatusOK && recorder.Code < http.StatusMultipleChoices
+	if !success {
+		var errResp struct {
+			Error *types.OpenAIError `json:"error"`
+		}
+		message := http.StatusText(recorder.Code)
+		if err := common.Unmarshal(recorder.Body.Bytes(), &errResp); err == nil && errResp.Error != nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+		output.Error = &dto.OpenAIBatchError{
+			Code:    strconv.Itoa(recorder.Code),
+			Message: message,
+		}
+	}
+	return relayBatchLineResult{line: output, success: success, quota: state.quota}
+}
+
+// relayBatchWriter 将批处理结果逐行写入本地文件
+type relayBatchWriter struct {
+	kind  string
+	file  *os.File
+	bytes int64
+	lines int
+}
+
+func (w *relayBatchWriter) write(batch *model.RelayBatch, line *dto.OpenAIBatchOutputLine) error {
+	if w.file == nil {
+		file, err := common.CreateDiskStoreFile(fmt.Sprintf("%s_%s.jsonl", batch.BatchId, w.kind))
+		if err != nil {
+			return err
+		}
+		w.file = file
+	}
+	data, err := common.Marshal(line)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	n, err := w.file.Write(data)
+	w.bytes += int64(n)
+	w.lines++
+	return err
+}
+
+// finish 关闭文件并登记为用户可下载的网关本地文件
+func (w *relayBatchWriter) finish(batch *model.RelayBatch) (string, error) {
+	if w.file == nil {
+		return "", nil
+	}
+	localPath := w.file.Name()
+	if err := w.file.Close(); err != nil {
+		return "", err
+	}
+	relayFile := &model.RelayFile{
+		FileId:    model.RelayFileIdPrefix + common.GetRandomString(24),
+		UserId:    batch.UserId,
+		TokenId:   batch.TokenId,
+		Filename:  fmt.Sprintf("%s_%s.jsonl", batch.BatchId, w.kind),
+		Purpose:   "batch_" + w.kind,
+		Bytes:     w.bytes,
+		Status:    model.RelayFileStatusProcessed,
+		LocalPath: localPath,
+	}
+	if retentionDays := operation_setting.GetFileSetting().RetentionDays; retentionDays > 0 {
+		relayFile.ExpiresAt = time.Now().Add(time.Duration(retentionDays) * 24 * time.Hour).Unix()
+	}
+	if err := relayFile.Insert(); err != nil {
+		return "", err
+	}
+	return relayFile.FileId, nil
+}
+
+func startLocalRelayBatch(batch *model.RelayBatch, input *service.RelayBatchInput, token *model.Token) {
+	getRelayBatchEngine()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(batch.ExpiresAt, 0))
+	relayBatchCancels.Store(batch.Id, context.CancelFunc(cancel))
+	go func() {
+		defer func() {
+			relayBatchCancels.Delete(batch.Id)
+			cancel()
+		}()
+		runLocalRelayBatch(ctx, cancel, batch, input, token)
+	}()
+}
+
+func runLocalRelayBatch(ctx context.Context, cancel context.CancelFunc, batch *model.RelayBatch, input *service.RelayBatchInput, token *model.Token) {
+	// 限制同时执行的批次数，排队期间保持 validating 状态并持续心跳，避免被其它节点判定为中断
+	queueTicker := time.NewTicker(relayBatchHeartbeatInterval)
+waitSlot:
+	for {
+		select {
+		case relayBatchSlots <- struct{}{}:
+			defer func() { <-relayBatchSlots }()
+			break waitSlot
+		case <-queueTicker.C:
+			if updated, err := batch.UpdateWithStatus(model.RelayBatchStatusValidating); err == nil && !updated {
+				// 排队期间已被取消
+				cancel()
+			}
+		case <-ctx.Done():
+			break waitSlot
+		}
+	}
+	queueTicker.Stop()
+
+	var mu sync.Mutex
+	outputWriter := &relayBatchWriter{kind: "output"}
+	errorWriter := &relayBatchWriter{kind: "error"}
+	lastHeartbeat := time.Now()
+
+	mu.Lock()
+	fromStatus := batch.Status
+	batch.Status = model.RelayBatchStatusInProgress
+	batch.InProgressAt = common.GetTimestamp()
+	if updated, err := batch.UpdateWithStatus(fromStatus); err != nil || !updated {
+		// 排队期间已被取消
+		cancel()
+	}
+	mu.Unlock()
+
+	// heartbeat 更新进度，并感知其它节点发起的取消；调用方需持有锁
+	heartbeat := func() {
+		if time.Since(lastHeartbeat) < relayBatchHeartbeatInterval {
+			return
+		}
+		lastHeartbeat = time.Now()
+		if updated, err := batch.UpdateWithStatus(model.RelayBatchStatusInProgress); err == nil && !updated {
+			cancel()
+		}
+	}
+
+	concurrency := operation_setting.GetBatchSetting().LocalConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, inputLine := range input.Lines {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(inputLine *dto.OpenAIBatchInputLine) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := executeRelayBatchLine(ctx, batch, token, inputLine)
+			mu.Lock()
+			defer mu.Unlock()
+			writer := outputWriter
+			if result.success {
+				batch.CompletedCount++
+			} else {
+				batch.FailedCount++
+				writer = errorWriter
+			}
+			batch.Quota += result.quota
+			if err := writer.write(batch, result.line); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("batch %s: failed to write result: %s", batch.BatchId, err.Error()))
+			}
+			heartbeat()
+		}(inputLine)
+	}
+	wg.Wait()
+
+	finalizeLocalRelayBatch(ctx, batch, outputWriter, errorWriter)
+}
+
+func finalizeLocalRelayBatch(ctx context.Context, batch *model.RelayBatch, outputWriter *relayBatchWriter, errorWriter *relayBatchWriter) {
+	now := common.GetTimestamp()
+	batch.FinalizingAt = now
+	var err error
+	if batch.OutputFileId, err = outputWriter.finish(batch); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("batch %s: failed to save output file: %s", batch.BatchId, err.Error()))
+	}
+	if batch.ErrorFileId, err = errorWriter.finish(batch); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("batch %s: failed to save error file: %s", batch.BatchId, err.Error()))
+	}
+
+	// 重新读取状态，区分取消与过期；其它节点已写入终态时不再覆盖
+	current, err := model.GetRelayBatchById(batch.Id)
+	fromStatus := batch.Status
+	if err == nil {
+		fromStatus = current.Status
+		if current.IsFinished() {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: already finished as %s, skip finalize", batch.BatchId, current.Status))
+			return
+		}
+	}
+	switch {
+	case fromStatus == model.RelayBatchStatusCancelling:
+		batch.Status = model.RelayBatchStatusCancelled
+		batch.CancelledAt = now
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		batch.Status = model.RelayBatchStatusExpired
+	case batch.CompletedCount == 0 && batch.FailedCount > 0:
+		batch.Status = model.RelayBatchStatusFailed
+		batch.FailedAt = now
+	default:
+		batch.Status = model.RelayBatchStatusCompleted
+		batch.CompletedAt = now
+	}
+	batch.Settled = true
+	if updated, err := batch.UpdateIfUnfinished(); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("batch %s: failed to update status: %s", batch.BatchId, err.Error()))
+	} else if !updated {
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s: already finished by another process, skip finalize", batch.BatchId))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("batch %s finished: status=%s, completed=%d, failed=%d, quota=%d",
+		batch.BatchId, batch.Status, batch.CompletedCount, batch.FailedCount, batch.Quota))
+}
+
+// UpdateRelayBatchBulk 轮询上游批处理状态，并回收中断的本地批次
+func UpdateRelayBatchBulk() {
+	for {
+		interval := operation_setting.GetBatchSetting().PollIntervalSeconds
+		if interval <= 0 {
+			interval = 30
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		ctx := context.Background()
+
+		upstreamBatches, err := model.GetUnfinishedRelayBatches(model.RelayBatchModeUpstream, constant.TaskQueryLimit)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("get unfinished upstream batches failed: %s", err.Error()))
+		}
+		for _, batch := range upstreamBatches {
+			syncCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			if err := service.SyncUpstreamRelayBatch(syncCtx, batch); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("sync batch %s failed: %s", batch.BatchId, err.Error()))
+			}
+			cancel()
+		}
+
+		// 结算失败的批次已释放租约，在此重试
+		unsettledBatches, err := model.GetUnsettledUpstreamRelayBatches(constant.TaskQueryLimit)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("get unsettled upstream batches failed: %s", err.Error()))
+		}
+		for _, batch := range unsettledBatches {
+			settleCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			if err := service.SettleUpstreamRelayBatch(settleCtx, batch); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("settle batch %s failed: %s", batch.BatchId, err.Error()))
+			}
+			cancel()
+		}
+
+		localBatches, err := model.GetUnfinishedRelayBatches(model.RelayBatchModeLocal, constant.TaskQueryLimit)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("get unfinished local batches failed: %s", err.Error()))
+		}
+		now := common.GetTimestamp()
+		for _, batch := range lo.Filter(localBatches, func(batch *model.RelayBatch, _ int) bool {
+			_, running := relayBatchCancels.Load(batch.Id)
+			return !running && now-batch.UpdatedAt > relayBatchLocalStaleSeconds
+		}) {
+			// 已执行的行在执行时已实时扣费，这里仅结束批次
+			fromStatus := batch.Status
+			if fromStatus == model.RelayBatchStatusCancelling {
+				batch.Status = model.RelayBatchStatusCancelled
+				batch.CancelledAt = now
+			} else {
+				batch.Status = model.RelayBatchStatusFailed
+				batch.FailedAt = now
+				batch.FailReason = "batch execution was interrupted"
+			}
+			if _, err := batch.UpdateWithStatus(fromStatus); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("batch %s: failed to update status: %s", batch.BatchId, err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func relayFileError(c *gin.Context, statusCode int, errType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    errType,
+			"param":   "",
+			"code":    nil,
+		},
+	})
+}
+
+func relayFileUpstreamError(c *gin.Context, err error) {
+	var upstreamErr *service.RelayFileUpstreamError
+	if errors.As(err, &upstreamErr) {
+		c.Data(upstreamErr.StatusCode, "application/json", upstreamErr.Body)
+		return
+	}
+	logger.LogError(c, fmt.Sprintf("relay file request failed: %s", err.Error()))
+	relayFileError(c, http.StatusBadGateway, "upstream_error", err.Error())
+}
+
+func getOwnedRelayFile(c *gin.Context) (*model.RelayFile, bool) {
+	fileId := c.Param("id")
+	relayFile, err := model.GetRelayFileByFileId(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", fileId))
+		} else {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		}
+		return nil, false
+	}
+	return relayFile, true
+}
+
+// RelayFileUpload POST /v1/files
+func RelayFileUpload(c *gin.Context) {
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) {
+			relayFileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", err.Error())
+			return
+		}
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "invalid multipart form: "+err.Error())
+		return
+	}
+	defer form.RemoveAll()
+
+	purpose := ""
+	if values := form.Value["purpose"]; len(values) > 0 {
+		purpose = values[0]
+	}
+	if purpose == "" {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "purpose is required")
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "file is required")
+		return
+	}
+	modelName := c.Query("model")
+	if values := form.Value["model"]; len(values) > 0 && values[0] != "" {
+		modelName = values[0]
+	}
+
+	channel, err := service.SelectRelayFileChannel(c, modelName)
+	if err != nil {
+		relayFileError(c, http.StatusServiceUnavailable, "new_api_error", err.Error())
+		return
+	}
+	relayFile, err := service.UploadRelayFile(c, channel, files[0], purpose)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) {
+			relayFileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", err.Error())
+			return
+		}
+		relayFileUpstreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, relayFile.ToOpenAIFile())
+}
+
+// RelayFileList GET /v1/files
+func RelayFileList(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 10000 {
+		limit = 100
+	}
+	files, err := model.GetUserRelayFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	resp := dto.OpenAIFileList{
+		Object:  "list",
+		Data:    make([]*dto.OpenAIFile, 0, len(files)),
+		HasMore: hasMore,
+	}
+	for _, file := range files {
+		resp.Data = append(resp.Data, file.ToOpenAIFile())
+	}
+	if len(files) > 0 {
+		resp.FirstId = files[0].FileId
+		resp.LastId = files[len(files)-1].FileId
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RelayFileRetrieve GET /v1/files/:id
+func RelayFileRetrieve(c *gin.Context) {
+	relayFile, ok := getOwnedRelayFile(c)
+	if !ok {
+		return
+	}
+	if err := service.RefreshRelayFileStatus(c.Request.Context(), relayFile); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to refresh relay file %s status: %s", relayFile.FileId, err.Error()))
+	}
+	c.JSON(http.StatusOK, relayFile.ToOpenAIFile())
+}
+
+// RelayFileContent GET /v1/files/:id/content
+func RelayFileContent(c *gin.Context) {
+	relayFile, ok := getOwnedRelayFile(c)
+	if !ok {
+		return
+	}
+	content, err := service.OpenRelayFileContent(c.Request.Context(), relayFile)
+	if err != nil {
+		relayFileUpstreamError(c, err)
+		return
+	}
+	defer content.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", relayFile.Filename))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, content); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to stream file content: %s", err.Error()))
+	}
+}
+
+// RelayFileDelete DELETE /v1/files/:id
+func RelayFileDelete(c *gin.Context) {
+	relayFile, ok := getOwnedRelayFile(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteRelayFile(c.Request.Context(), relayFile); err != nil {
+		relayFileUpstreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		Id:      relayFile.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errHedgeLost = errors.New("hedged request lost the race")
+
+// hedgeRace 记录对冲请求的胜者：第一个向客户端写出响应体的请求胜出，其余请求被取消
+type hedgeRace struct {
+	mu      sync.Mutex
+	target  gin.ResponseWriter
+	winner  *hedgeWriter
+	writers []*hedgeWriter
+}
+
+func (r *hedgeRace) add(w *hedgeWriter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return false
+	}
+	r.writers = append(r.writers, w)
+	return true
+}
+
+func (r *hedgeRace) isWinner(w *hedgeWriter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner == w
+}
+
+func (r *hedgeRace) decided() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner != nil
+}
+
+func (r *hedgeRace) claim(w *hedgeWriter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return r.winner == w
+	}
+	r.winner = w
+	for k, v := range w.header {
+		r.target.Header()[k] = v
+	}
+	if w.status != 0 {
+		r.target.WriteHeader(w.status)
+	}
+	for _, other := range r.writers {
+		if other != w {
+			other.lost.Store(true)
+			other.cancel()
+		}
+	}
+	return true
+}
+
+// hedgeWriter 胜出前缓存响应头，胜出后直接写入客户端；落败后丢弃所有写入
+type hedgeWriter struct {
+	race   *hedgeRace
+	header http.Header
+	status int
+	lost   *atomic.Bool
+	cancel context.CancelFunc
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.race.isWinner(w) {
+		return w.race.target.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.race.isWinner(w) {
+		w.race.target.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.race.isWinner(w) {
+		if w.lost.Load() {
+			return 0, errHedgeLost
+		}
+		// SSE 注释（如保活 PING）不算首字节
+		if bytes.HasPrefix(data, []byte(":")) {
+			return len(data), nil
+		}
+		if !w.race.claim(w) {
+			return 0, errHedgeLost
+		}
+	}
+	return w.race.target.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.race.isWinner(w) {
+		w.race.target.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.race.isWinner(w) {
+		return w.race.target.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.race.isWinner(w) {
+		return w.race.target.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	if w.race.isWinner(w) {
+		return w.race.target.Written()
+	}
+	return false
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.race.isWinner(w) {
+		w.race.target.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported for hedged requests")
+}
+
+func (w *hedgeWriter) CloseNotify() <-chan bool {
+	return w.race.target.CloseNotify()
+}
+
+func (w *hedgeWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// hedgeBilling 只有胜出的请求可以结算或退款，预扣费由主请求统一持有
+type hedgeBilling struct {
+	relaycommon.BillingSettler
+	lost   *atomic.Bool
+	info   *relaycommon.RelayInfo
+	origin *relaycommon.RelayInfo
+}
+
+func (b *hedgeBilling) Settle(actualQuota int) error {
+	if b.lost.Load() {
+		return nil
+	}
+	err := b.BillingSettler.Settle(actualQuota)
+	b.info.SubscriptionPostDelta = b.origin.SubscriptionPostDelta
+	return err
+}
+
+func (b *hedgeBilling) Refund(c *gin.Context) {
+	if b.lost.Load() {
+		return
+	}
+	b.BillingSettler.Refund(c)
+}
+
+type hedgeAttempt struct {
+	ctx     *gin.Context
+	info    *relaycommon.RelayInfo
+	channel *model.Channel
+	writer  *hedgeWriter
+}
+
+type hedgeResult struct {
+	attempt *hedgeAttempt
+	err     *types.NewAPIError
+}
+
+// newHedgeAttempt 复制请求上下文，两个请求各自持有请求体、上下文键与 RelayInfo
+func newHedgeAttempt(c *gin.Context, race *hedgeRace, relayInfo *relaycommon.RelayInfo, body []byte) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attemptCtx := c.Copy()
+	attemptCtx.Request = c.Request.Clone(ctx)
+	attemptCtx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	delete(attemptCtx.Keys, common.KeyBodyStorage)
+	attemptCtx.Set(common.KeyRequestBody, body)
+	lost := &atomic.Bool{}
+	common.SetContextKey(attemptCtx, constant.ContextKeyHedgeLost, lost)
+	writer := &hedgeWriter{race: race, header: make(http.Header), lost: lost, cancel: cancel}
+	attemptCtx.Writer = writer
+
+	info := relayInfo.CloneForAttempt()
+	if relayInfo.Billing != nil {
+		info.Billing = &hedgeBilling{BillingSettler: relayInfo.Billing, lost: lost, info: info, origin: relayInfo}
+	}
+	return &hedgeAttempt{ctx: attemptCtx, info: info, writer: writer}
+}
+
+func (a *hedgeAttempt) run(relayFormat types.RelayFormat, results chan<- hedgeResult) {
+	go func() {
+		var newAPIError *types.NewAPIError
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("hedged relay panic: %v", r))
+				newAPIError = types.NewError(fmt.Errorf("hedged relay panic: %v", r), types.ErrorCodeDoRequestFailed)
+			}
+			a.writer.cancel()
+			results <- hedgeResult{attempt: a, err: newAPIError}
+		}()
+		newAPIError = relayChannelAttempt(a.ctx, a.info, relayFormat, a.channel)
+	}()
+}
+
+// getHedgeDelay 判断本次请求是否启用对冲
+func getHedgeDelay(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat) (time.Duration, bool) {
+	if relayFormat == types.RelayFormatOpenAIRealtime {
+		return 0, false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0, false
+	}
+	return operation_setting.GetHedgeDelay(relayInfo.UsingGroup, relayInfo.OriginModelName)
+}
+
+// relayWithHedge 主请求在 delay 内没有首字节时，向另一个渠道发送同样的请求，先写出首字节的请求胜出，
+// 落败的请求被取消且不计费。返回最终结果对应的渠道
+func relayWithHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel, retryParam *service.RetryParam, delay time.Duration) (*model.Channel, *types.NewAPIError) {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return channel, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	race := &hedgeRace{target: c.Writer}
+	results := make(chan hedgeResult, 2)
+
+	primary := newHedgeAttempt(c, race, relayInfo, body)
+	primary.channel = channel
+	race.add(primary.writer)
+	primary.run(relayFormat, results)
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if hedge := startHedgeAttempt(c, race, relayInfo, retryParam, channel, body); hedge != nil {
+				logger.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %s 内未返回首字节，对冲请求渠道 #%d", channel.Id, delay, hedge.channel.Id))
+				hedge.run(relayFormat, results)
+				pending++
+			}
+		case res := <-results:
+			pending--
+			// 已胜出、未写出内容但成功完成、或者已没有其他请求时，以该请求的结果为准
+			if race.isWinner(res.attempt.writer) || (res.err == nil && race.claim(res.attempt.writer)) || pending == 0 {
+				return finishHedge(c, relayInfo, res), res.err
+			}
+		}
+	}
+}
+
+func startHedgeAttempt(c *gin.Context, race *hedgeRace, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, primary *model.Channel, body []byte) *hedgeAttempt {
+	if race.decided() {
+		return nil
+	}
+	attempt := newHedgeAttempt(c, race, relayInfo, body)
+	param := &service.RetryParam{
+		Ctx:        attempt.ctx,
+		TokenGroup: retryParam.TokenGroup,
+		ModelName:  retryParam.ModelName,
+		Retry:      common.GetPointer(retryParam.GetRetry()),
+	}
+	// 对冲请求必须落在与主请求不同的渠道上，同优先级多次抽到主渠道时再尝试下一优先级
+	for i := 0; i < 6 && attempt.channel == nil; i++ {
+		if i == 3 {
+			param.IncreaseRetry()
+		}
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(param)
+		if err != nil || channel == nil {
+			break
+		}
+		if channel.Id != primary.Id {
+			attempt.channel = channel
+		}
+	}
+	if attempt.channel == nil {
+		attempt.writer.cancel()
+		return nil
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(attempt.ctx, attempt.channel, relayInfo.OriginModelName); apiErr != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to setup hedged channel #%d: %s", attempt.channel.Id, apiErr.Error()))
+		attempt.writer.cancel()
+		return nil
+	}
+	attempt.info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(attempt.ctx, attempt.info)
+	if !race.add(attempt.writer) {
+		attempt.writer.cancel()
+		return nil
+	}
+	addUsedChannel(c, attempt.channel.Id)
+	return attempt
+}
+
+// finishHedge 将最终请求的上下文与 RelayInfo 同步回主请求，供错误处理与重试使用
+func finishHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, res hedgeResult) *model.Channel {
+	for k, v := range res.attempt.ctx.Keys {
+		switch k {
+		case string(constant.ContextKeyHedgeLost), common.KeyRequestBody, "use_channel":
+			continue
+		}
+		c.Set(k, v)
+	}
+	billing := relayInfo.Billing
+	*relayInfo = *res.attempt.info
+	relayInfo.Billing = billing
+	return res.attempt.channel
+}
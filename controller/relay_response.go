@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func getOwnedStoredResponse(c *gin.Context) (*model.StoredResponse, bool) {
+	responseId := c.Param("id")
+	stored, err := model.GetStoredResponse(c.GetInt("token_id"), responseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No response found with id '%s'.", responseId))
+		} else {
+			relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		}
+		return nil, false
+	}
+	return stored, true
+}
+
+// RelayResponseRetrieve GET /v1/responses/:id
+func RelayResponseRetrieve(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(stored.Body))
+}
+
+// RelayResponseDelete DELETE /v1/responses/:id
+func RelayResponseDelete(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteStoredResponse(c.Request.Context(), stored); err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.ResponsesDeleted{
+		Id:      stored.ResponseId,
+		Object:  "response.deleted",
+		Deleted: true,
+	})
+}
+
+// RelayResponseInputItems GET /v1/responses/:id/input_items
+func RelayResponseInputItems(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	items, err := service.GetStoredResponseInputItems(stored)
+	if err != nil {
+		relayFileError(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		relayFileError(c, http.StatusBadRequest, "invalid_request_error", "order must be 'asc' or 'desc'")
+		return
+	}
+	if order == "desc" {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if after := c.Query("after"); after != "" {
+		for i, item := range items {
+			if id, _ := item["id"].(string); id == after {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	resp := dto.ResponsesInputItemList{
+		Object:  "list",
+		Data:    items,
+		HasMore: hasMore,
+	}
+	if len(items) > 0 {
+		resp.FirstId, _ = items[0]["id"].(string)
+		resp.LastId, _ = items[len(items)-1]["id"].(string)
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -197,6 +197,9 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
 									logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
 								} else {
+									if err := model.AdjustBudget(task.GetBudgetChain(), quotaDelta); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("补扣组织与项目额度失败: %s", err.Error()))
+									}
 									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
 									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
 									task.Quota = actualQuota // 更新任务记录的实际扣费额度
@@ -220,6 +223,9 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
 									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
 								} else {
+									if err := model.AdjustBudget(task.GetBudgetChain(), -refundQuota); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("退还组织与项目额度失败: %s", err.Error()))
+									}
 									task.Quota = actualQuota // 更新任务记录的实际扣费额度
 
 									// 记录退款日志
@@ -271,6 +277,9 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
 			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
 		}
+		if err := model.AdjustBudget(task.GetBudgetChain(), -quota); err != nil {
+			logger.LogWarn(ctx, "Failed to refund budget: "+err.Error())
+		}
 		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota))
 		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
 	}
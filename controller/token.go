@@ -133,6 +133,10 @@ func GetTokenUsage(c *gin.Context) {
 			"model_limits":         token.GetModelLimitsMap(),
 			"model_limits_enabled": token.ModelLimitsEnabled,
 			"expires_at":           expiredAt,
+			"budget_period":        token.BudgetPeriod,
+			"budget_amount":        token.BudgetAmount,
+			"budget_remain":        token.BudgetRemain,
+			"budget_reset_at":      token.BudgetNextResetTime,
 		},
 	})
 }
@@ -160,6 +164,22 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if err := validateTokenProject(c.GetInt("id"), token.ProjectId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.ValidateBudget(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.ValidateScopes(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if token.EndUserRateLimit < 0 || token.EndUserQuotaLimit < 0 {
+		common.ApiErrorMsg(c, "终端用户限制不能为负数")
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -194,7 +214,16 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCacheTTL:   token.ResponseCacheTTL,
+		ProjectId:          token.ProjectId,
+		BudgetPeriod:       token.BudgetPeriod,
+		BudgetAmount:       token.BudgetAmount,
+		BudgetRollover:     token.BudgetRollover,
+		Scopes:             token.Scopes,
+		EndUserRateLimit:   token.EndUserRateLimit,
+		EndUserQuotaLimit:  token.EndUserQuotaLimit,
 	}
+	cleanToken.ResetBudgetWindow()
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
@@ -251,6 +280,24 @@ func UpdateToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if statusOnly == "" {
+		if err := validateTokenProject(userId, token.ProjectId); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if err := token.ValidateBudget(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if err := token.ValidateScopes(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if token.EndUserRateLimit < 0 || token.EndUserQuotaLimit < 0 {
+			common.ApiErrorMsg(c, "终端用户限制不能为负数")
+			return
+		}
+	}
 	if token.Status == common.TokenStatusEnabled {
 		if cleanToken.Status == common.TokenStatusExpired && cleanToken.ExpiredTime <= common.GetTimestamp() && cleanToken.ExpiredTime != -1 {
 			common.ApiErrorI18n(c, i18n.MsgTokenExpiredCannotEnable)
@@ -274,6 +321,19 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCacheTTL = token.ResponseCacheTTL
+		cleanToken.ProjectId = token.ProjectId
+		cleanToken.Scopes = token.Scopes
+		cleanToken.EndUserRateLimit = token.EndUserRateLimit
+		cleanToken.EndUserQuotaLimit = token.EndUserQuotaLimit
+		// 修改周期或额度后从当前时刻重新开始一个周期
+		budgetChanged := token.BudgetChanged(cleanToken)
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetAmount = token.BudgetAmount
+		cleanToken.BudgetRollover = token.BudgetRollover
+		if budgetChanged {
+			cleanToken.ResetBudgetWindow()
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseUsageExportFilter 读取导出筛选条件；未指定 type 时默认只导出消费日志
+func parseUsageExportFilter(c *gin.Context) *model.UsageExportFilter {
+	filter := &model.UsageExportFilter{LogType: model.LogTypeConsume}
+	if logType := c.Query("type"); logType != "" {
+		filter.LogType, _ = strconv.Atoi(logType)
+	}
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	filter.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	filter.Username = c.Query("username")
+	filter.TokenName = c.Query("token_name")
+	filter.ModelName = c.Query("model_name")
+	filter.Channel, _ = strconv.Atoi(c.Query("channel"))
+	filter.Group = c.Query("group")
+	return filter
+}
+
+func streamUsageExport(c *gin.Context, filter *model.UsageExportFilter) {
+	source := c.DefaultQuery("source", service.UsageExportSourceLogs)
+	if source != service.UsageExportSourceLogs && source != service.UsageExportSourceQuotaData {
+		common.ApiErrorMsg(c, "不支持的导出数据源")
+		return
+	}
+	format := c.DefaultQuery("format", service.UsageExportFormatCSV)
+	contentType, ok := service.UsageExportContentType(format)
+	if !ok {
+		common.ApiErrorMsg(c, "不支持的导出格式")
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=usage_%s_%d.%s", source, time.Now().Unix(), format))
+	c.Status(http.StatusOK)
+	err := service.ExportUsage(c.Writer, source, format, filter, c.Writer.Flush)
+	if err != nil {
+		// 响应头已发出，只能记录错误并中断输出
+		common.SysError(fmt.Sprintf("failed to export usage: %s", err.Error()))
+		_ = c.Error(err)
+	}
+}
+
+func ExportUsage(c *gin.Context) {
+	streamUsageExport(c, parseUsageExportFilter(c))
+}
+
+// 普通用户单次导出的最大时间跨度
+const selfUsageExportMaxRange = 93 * 24 * time.Hour
+
+func ExportSelfUsage(c *gin.Context) {
+	filter := parseUsageExportFilter(c)
+	if filter.EndTimestamp == 0 {
+		filter.EndTimestamp = time.Now().Unix()
+	}
+	if filter.StartTimestamp <= 0 || filter.EndTimestamp < filter.StartTimestamp {
+		common.ApiErrorMsg(c, "请指定有效的导出时间范围")
+		return
+	}
+	if time.Duration(filter.EndTimestamp-filter.StartTimestamp)*time.Second > selfUsageExportMaxRange {
+		common.ApiErrorMsg(c, fmt.Sprintf("导出时间范围不能超过 %d 天", int(selfUsageExportMaxRange.Hours()/24)))
+		return
+	}
+	filter.UserId = c.GetInt("id")
+	filter.Username = ""
+	filter.Channel = 0
+	streamUsageExport(c, filter)
+}
+
+func GenerateUsageStatements(c *gin.Context) {
+	period := c.Query("period")
+	if period == "" {
+		period = service.PreviousUsageStatementPeriod(time.Now())
+	}
+	result, err := service.GenerateUsageStatements(period)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type webhookSubscriptionRequest struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	// 更新时留空表示保留原密钥
+	Secret  string   `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled bool     `json:"enabled"`
+}
+
+// normalize 校验地址与事件类型，返回逗号分隔的事件列表
+func (r *webhookSubscriptionRequest) normalize() (string, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Url = strings.TrimSpace(r.Url)
+	parsed, err := url.Parse(r.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", errors.New("无效的 webhook 地址")
+	}
+	events := make([]string, 0, len(r.Events))
+	for _, event := range r.Events {
+		event = strings.TrimSpace(event)
+		if event == "" || slices.Contains(events, event) {
+			continue
+		}
+		if !slices.Contains(constant.WebhookEvents, event) {
+			return "", errors.New("不支持的事件类型: " + event)
+		}
+		events = append(events, event)
+	}
+	return strings.Join(events, ","), nil
+}
+
+func GetWebhookEventTypes(c *gin.Context) {
+	common.ApiSuccess(c, constant.WebhookEvents)
+}
+
+func GetWebhookSubscriptions(c *gin.Context) {
+	subs, err := model.GetAllWebhookSubscriptions()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subs)
+}
+
+func CreateWebhookSubscription(c *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	events, err := req.normalize()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	sub := &model.WebhookSubscription{
+		Name:    req.Name,
+		Url:     req.Url,
+		Secret:  req.Secret,
+		Events:  events,
+		Enabled: req.Enabled,
+	}
+	if err := sub.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+func UpdateWebhookSubscription(c *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	sub, err := model.GetWebhookSubscriptionById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	events, err := req.normalize()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	sub.Name = req.Name
+	sub.Url = req.Url
+	sub.Events = events
+	sub.Enabled = req.Enabled
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if err := sub.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+func DeleteWebhookSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的订阅 ID")
+		return
+	}
+	if err := model.DeleteWebhookSubscriptionById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// TestWebhookSubscription 立即向订阅方发送一次 ping 事件并返回投递结果
+func TestWebhookSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的订阅 ID")
+		return
+	}
+	sub, err := model.GetWebhookSubscriptionById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	delivery, err := service.SendWebhookTestEvent(sub)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, delivery)
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	subscriptionId, _ := strconv.Atoi(c.Query("subscription_id"))
+	deliveries, total, err := model.GetWebhookDeliveries(subscriptionId, c.Query("event"), c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RetryWebhookDelivery 将已结束的投递重新放入队列，由投递任务再尝试一次
+func RetryWebhookDelivery(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的投递记录 ID")
+		return
+	}
+	if err := model.RetryWebhookDelivery(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
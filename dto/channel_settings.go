@@ -23,15 +23,32 @@ const (
 	AwsKeyTypeApiKey AwsKeyType = "api_key"
 )
 
+// AwsRequestMode AWS 渠道对话请求使用的 Bedrock 接口，留空时按上游模型 ID 判断
+type AwsRequestMode string
+
+const (
+	AwsRequestModeInvoke   AwsRequestMode = "invoke"   // InvokeModel，原生 Claude 格式
+	AwsRequestModeConverse AwsRequestMode = "converse" // Converse / ConverseStream
+)
+
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	ClaudeBetaQuery       bool          `json:"claude_beta_query,omitempty"`      // Claude 渠道是否强制追加 ?beta=true
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion string                       `json:"azure_responses_version,omitempty"`
+	VertexKeyType         VertexKeyType                `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise  *bool                        `json:"openrouter_enterprise,omitempty"`
+	ClaudeBetaQuery       bool                         `json:"claude_beta_query,omitempty"`       // Claude 渠道是否强制追加 ?beta=true
+	AllowServiceTier      bool                         `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore          bool                         `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier bool                         `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType            AwsKeyType                   `json:"aws_key_type,omitempty"`
+	AwsRequestMode        AwsRequestMode               `json:"aws_request_mode,omitempty"`        // AWS 渠道对话接口，留空时自动判断
+	OllamaModelOptions    map[string]OllamaModelOption `json:"ollama_model_options,omitempty"`    // Ollama 按模型设置的默认参数，"*" 对所有模型生效
+	OllamaAutoSyncModels  bool                         `json:"ollama_auto_sync_models,omitempty"` // Ollama 渠道是否定时从 /api/tags 同步模型列表
+}
+
+// OllamaModelOption Ollama 模型默认参数，仅在请求未指定时生效
+type OllamaModelOption struct {
+	KeepAlive string `json:"keep_alive,omitempty"` // 如 "10m"，"-1" 表示常驻内存，"0" 表示立即卸载
+	NumCtx    int    `json:"num_ctx,omitempty"`
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -40,3 +57,20 @@ func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
 	}
 	return *s.OpenRouterEnterprise
 }
+
+// GetOllamaModelOption 获取模型的 Ollama 默认参数，模型单独配置的字段优先于 "*"
+func (s *ChannelOtherSettings) GetOllamaModelOption(model string) OllamaModelOption {
+	if s == nil || len(s.OllamaModelOptions) == 0 {
+		return OllamaModelOption{}
+	}
+	option := s.OllamaModelOptions["*"]
+	if modelOption, ok := s.OllamaModelOptions[model]; ok {
+		if modelOption.KeepAlive != "" {
+			option.KeepAlive = modelOption.KeepAlive
+		}
+		if modelOption.NumCtx > 0 {
+			option.NumCtx = modelOption.NumCtx
+		}
+	}
+	return option
+}
@@ -0,0 +1,39 @@
+package dto
+
+import "encoding/json"
+
+// FineTuningJob https://platform.openai.com/docs/api-reference/fine-tuning/object
+type FineTuningJob struct {
+	Id              string              `json:"id"`
+	Object          string              `json:"object"`
+	CreatedAt       int64               `json:"created_at"`
+	Error           *FineTuningJobError `json:"error"`
+	FineTunedModel  *string             `json:"fine_tuned_model"`
+	FinishedAt      *int64              `json:"finished_at"`
+	Hyperparameters json.RawMessage     `json:"hyperparameters,omitempty"`
+	Model           string              `json:"model"`
+	OrganizationId  string              `json:"organization_id,omitempty"`
+	ResultFiles     []string            `json:"result_files"`
+	Status          string              `json:"status"`
+	TrainedTokens   *int                `json:"trained_tokens"`
+	TrainingFile    string              `json:"training_file"`
+	ValidationFile  *string             `json:"validation_file"`
+	Integrations    json.RawMessage     `json:"integrations,omitempty"`
+	Seed            *int                `json:"seed,omitempty"`
+	EstimatedFinish *int64              `json:"estimated_finish,omitempty"`
+	Method          json.RawMessage     `json:"method,omitempty"`
+	Metadata        json.RawMessage     `json:"metadata,omitempty"`
+	Suffix          *string             `json:"suffix,omitempty"`
+}
+
+type FineTuningJobError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+}
+
+type FineTuningJobList struct {
+	Object  string           `json:"object"`
+	Data    []*FineTuningJob `json:"data"`
+	HasMore bool             `json:"has_more"`
+}
@@ -330,7 +330,9 @@ func (o *OpenAIResponsesResponse) GetSize() string {
 }
 
 type IncompleteDetails struct {
-	Reasoning string `json:"reasoning"`
+	Reasoning string `json:"reasoning,omitempty"`
+	// 未完成原因：max_output_tokens / content_filter
+	Reason string `json:"reason,omitempty"`
 }
 
 type ResponsesOutput struct {
@@ -344,6 +346,10 @@ type ResponsesOutput struct {
 	CallId    string                   `json:"call_id,omitempty"`
 	Name      string                   `json:"name,omitempty"`
 	Arguments string                   `json:"arguments,omitempty"`
+	// reasoning 条目的摘要
+	Summary []ResponsesReasoningSummaryPart `json:"summary,omitempty"`
+	// reasoning 条目的加密推理内容（请求 include reasoning.encrypted_content 时返回）
+	EncryptedContent string `json:"encrypted_content,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -384,6 +390,10 @@ type ResponsesStreamResponse struct {
 	SummaryIndex *int                           `json:"summary_index,omitempty"`
 	ItemID       string                         `json:"item_id,omitempty"`
 	Part         *ResponsesReasoningSummaryPart `json:"part,omitempty"`
+	// - response.output_text.done / response.reasoning_summary_text.done
+	Text string `json:"text,omitempty"`
+	// - response.function_call_arguments.done
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -427,3 +437,19 @@ func GetOpenAIError(errorField any) *types.OpenAIError {
 		}
 	}
 }
+
+// ResponsesInputItemList GET /v1/responses/{id}/input_items
+type ResponsesInputItemList struct {
+	Object  string           `json:"object"`
+	Data    []map[string]any `json:"data"`
+	FirstId string           `json:"first_id,omitempty"`
+	LastId  string           `json:"last_id,omitempty"`
+	HasMore bool             `json:"has_more"`
+}
+
+// ResponsesDeleted DELETE /v1/responses/{id}
+type ResponsesDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
@@ -0,0 +1,25 @@
+package dto
+
+const (
+	TokenStreamModeAny       = ""
+	TokenStreamModeOnly      = "stream_only"
+	TokenStreamModeNonStream = "non_stream_only"
+)
+
+// TokenScopes 令牌可调用的接口格式与能力范围，零值表示不限制
+type TokenScopes struct {
+	RelayFormats    []string `json:"relay_formats,omitempty"`     // 允许的 types.RelayFormat，为空不限制
+	MaxOutputTokens int      `json:"max_output_tokens,omitempty"` // 单次请求最大输出 token 数，未指定时自动补上该上限
+	DenyTools       bool     `json:"deny_tools,omitempty"`        // 禁止函数调用及除联网搜索外的内置工具
+	DenyWebSearch   bool     `json:"deny_web_search,omitempty"`   // 禁止联网搜索类内置工具
+	StreamMode      string   `json:"stream_mode,omitempty"`       // stream_only / non_stream_only
+}
+
+func (s *TokenScopes) IsRestricted() bool {
+	return s != nil && (len(s.RelayFormats) > 0 || s.HasCapabilityLimits())
+}
+
+// HasCapabilityLimits 是否存在需要检查请求体的限制
+func (s *TokenScopes) HasCapabilityLimits() bool {
+	return s != nil && (s.MaxOutputTokens > 0 || s.DenyTools || s.DenyWebSearch || s.StreamMode != TokenStreamModeAny)
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
 	_ "github.com/QuantumNous/new-api/setting/performance_setting"
@@ -90,6 +91,9 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
+	// 从 redis 恢复渠道熔断状态
+	model.InitChannelBreakers()
+
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
@@ -114,12 +118,33 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	// Sync model lists of Ollama channels with auto sync enabled every 10 minutes
+	go controller.AutomaticallySyncOllamaModels()
+
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Token budget window reset task (daily/weekly/monthly)
+	service.StartTokenBudgetResetTask()
+
+	// Relay file retention cleanup (/v1/files)
+	service.StartRelayFileCleanupTask()
+
+	// Audit capture retention cleanup
+	service.StartAuditCaptureCleanupTask()
+
+	// Webhook event delivery with retry and delivery log retention
+	service.StartWebhookDeliveryTask()
+
+	// Monthly usage statements per user and organization
+	service.StartUsageStatementTask()
+
+	// Stored /v1/responses retention cleanup
+	service.StartResponseStoreCleanupTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -127,6 +152,9 @@ func main() {
 		gopool.Go(func() {
 			controller.UpdateTaskBulk()
 		})
+		gopool.Go(func() {
+			controller.UpdateRelayBatchBulk()
+		})
 	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
@@ -147,6 +175,10 @@ func main() {
 		common.SysError(fmt.Sprintf("start pyroscope error : %v", err))
 	}
 
+	if _, err = tracing.Start(); err != nil {
+		common.SysError(fmt.Sprintf("start tracing error : %v", err))
+	}
+
 	// Initialize HTTP server
 	server := gin.New()
 	server.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
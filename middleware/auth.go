@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -158,6 +160,22 @@ func AdminAuth() func(c *gin.Context) {
 	}
 }
 
+// MetricsAuth 配置了 scrape_secret 时校验 Bearer 密钥，否则要求管理员登录或 access token
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		secret := operation_setting.GetMetricsSetting().ScrapeSecret
+		if secret == "" {
+			authHelper(c, common.RoleAdminUser)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+secret)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, common.RoleRootUser)
@@ -268,7 +286,17 @@ func TokenAuth() func(c *gin.Context) {
 		if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
 			key = strings.TrimSpace(key[7:])
 		}
-		if key == "" || key == "midjourney-proxy" {
+		// 子令牌经签名校验后按其父令牌处理
+		var delegated *service.DelegatedTokenClaims
+		if strings.HasPrefix(key, service.DelegatedTokenPrefix) {
+			claims, parentKey, err := service.ParseDelegatedToken(key)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			delegated = claims
+			key = parentKey
+		} else if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
 				key = strings.TrimSpace(key[7:])
@@ -289,6 +317,11 @@ func TokenAuth() func(c *gin.Context) {
 			}
 		}
 		if err != nil {
+			if delegated != nil {
+				// 不向子令牌持有者暴露父令牌 key 的片段
+				abortWithOpenAiMessage(c, http.StatusUnauthorized, "子令牌的父令牌不可用")
+				return
+			}
 			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
 			return
 		}
@@ -345,8 +378,54 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		if delegated != nil {
+			if err := setupContextForDelegatedToken(c, token, delegated); err != nil {
+				return
+			}
+		}
+		if err := service.CheckTokenScopeFormat(c); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error(), types.ErrorCodeAccessDenied)
+			return
+		}
 		c.Next()
+		if delegated != nil {
+			service.RecordDelegatedTokenUsage(c, delegated)
+		}
+	}
+}
+
+// setupContextForDelegatedToken 在父令牌的上下文基础上收紧子令牌的额度与模型范围
+func setupContextForDelegatedToken(c *gin.Context, token *model.Token, claims *service.DelegatedTokenClaims) error {
+	if claims.ParentTokenId != token.Id {
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, "无效的子令牌")
+		return fmt.Errorf("delegated token parent mismatch")
+	}
+	if err := service.CheckDelegatedTokenRevoked(token, claims); err != nil {
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+		return err
+	}
+	if err := service.CheckDelegatedTokenQuota(claims); err != nil {
+		abortWithOpenAiMessage(c, http.StatusForbidden, err.Error(), types.ErrorCodeInsufficientUserQuota)
+		return err
 	}
+	if len(claims.Models) > 0 {
+		// 父令牌的模型限制可能在签发后收紧，取两者交集
+		parentLimits := token.GetModelLimitsMap()
+		modelLimits := make(map[string]bool, len(claims.Models))
+		for _, modelName := range claims.Models {
+			if !token.ModelLimitsEnabled || parentLimits[modelName] {
+				modelLimits[modelName] = true
+			}
+		}
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", modelLimits)
+	}
+	common.SetContextKey(c, constant.ContextKeyDelegatedTokenId, claims.ID)
+	common.SetContextKey(c, constant.ContextKeyDelegatedTokenClaims, claims)
+	if claims.EndUserId != "" {
+		common.SetContextKey(c, constant.ContextKeyDelegatedTokenEndUser, claims.EndUserId)
+	}
+	return nil
 }
 
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
@@ -369,6 +448,16 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCacheTTL, token.ResponseCacheTTL)
+	common.SetContextKey(c, constant.ContextKeyTokenProjectId, token.ProjectId)
+	if token.HasBudget() {
+		common.SetContextKey(c, constant.ContextKeyTokenBudgetRemain, token.BudgetRemain)
+	}
+	if scopes := token.GetScopes(); scopes.IsRestricted() {
+		common.SetContextKey(c, constant.ContextKeyTokenScopes, scopes)
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenEndUserRateLimit, token.EndUserRateLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenEndUserQuotaLimit, token.EndUserQuotaLimit)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -13,12 +13,14 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -28,13 +30,27 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span := tracing.StartSpan(c, "select_channel")
+		defer span.End()
 		var channel *model.Channel
+		var pinnedFile *model.RelayFile
+		var pinnedResponse *model.StoredResponse
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
 			abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
 			return
 		}
+		if err := service.CheckTokenScopes(c); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error(), types.ErrorCodeAccessDenied)
+			return
+		}
+		// previous_response_id 引用网关保存的响应时，固定到原渠道或展开历史
+		pinnedResponse, err = service.ResolveStoredResponseReference(c)
+		if err != nil {
+			abortWithStoredResponseError(c, err)
+			return
+		}
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -98,7 +114,49 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				// 请求引用了通过网关上传的文件时，固定到文件所在的上游渠道
+				pinnedFile, err = service.ResolveRelayFileReferences(c)
+				if err != nil {
+					abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+					return
+				}
+				if pinnedFile != nil {
+					channel, err = model.CacheGetChannel(pinnedFile.ChannelId)
+					if err != nil || channel.Status != common.ChannelStatusEnabled {
+						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("文件 %s 所在的渠道不可用", pinnedFile.FileId), types.ErrorCodeGetChannelFailed)
+						return
+					}
+					// 文件所在渠道同样须在当前分组下对该模型启用
+					selectGroup = ""
+					if usingGroup == "auto" {
+						userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+						for _, g := range service.GetUserAutoGroup(userGroup) {
+							if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, channel.Id) {
+								selectGroup = g
+								common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
+								break
+							}
+						}
+					} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, channel.Id) {
+						selectGroup = usingGroup
+					}
+					if selectGroup == "" {
+						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("文件 %s 所在的渠道在分组 %s 下不支持模型 %s", pinnedFile.FileId, usingGroup, modelRequest.Model), types.ErrorCodeGetChannelFailed)
+						return
+					}
+					common.SetContextKey(c, constant.ContextKeyTokenSpecificChannelId, strconv.Itoa(channel.Id))
+				}
+
+				if pinnedResponse != nil && pinnedFile == nil && usingGroup != "auto" {
+					preferred, err := model.CacheGetChannel(pinnedResponse.ChannelId)
+					if err == nil && preferred.Status == common.ChannelStatusEnabled && model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) {
+						channel = preferred
+						selectGroup = usingGroup
+						common.SetContextKey(c, constant.ContextKeyTokenSpecificChannelId, strconv.Itoa(channel.Id))
+					}
+				}
+
+				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found && channel == nil {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled {
 						if usingGroup == "auto" {
@@ -149,8 +207,23 @@ func Distribute() func(c *gin.Context) {
 				}
 			}
 		}
+		_, channelPinned := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
+		if pinnedResponse != nil && (!channelPinned || channel == nil || channel.Id != pinnedResponse.ChannelId) {
+			// 无法固定到原渠道时展开历史，由所选渠道处理
+			if err := service.ExpandStoredResponseHistory(c, pinnedResponse); err != nil {
+				abortWithStoredResponseError(c, err)
+				return
+			}
+			pinnedResponse = nil
+		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		service.ApplyRelayFileKeyPin(c, channel, pinnedFile)
+		service.ApplyStoredResponseKeyPin(c, channel, pinnedResponse)
+		if channel != nil {
+			span.SetAttributes(attribute.Int("channel.id", channel.Id), attribute.String("model", modelRequest.Model), attribute.String("group", common.GetContextKeyString(c, constant.ContextKeyUsingGroup)))
+		}
+		span.End()
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -427,3 +500,12 @@ func extractModelNameFromGeminiPath(path string) string {
 	// 返回模型名部分
 	return path[startIndex : startIndex+colonIndex]
 }
+
+// abortWithStoredResponseError 数据库故障返回 500，其余视为请求错误
+func abortWithStoredResponseError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrResponseStoreUnavailable) {
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Tracing 为已匹配路由的请求创建服务端 span，未启用链路追踪时直接放行
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !tracing.Enabled() || route == "" {
+			c.Next()
+			return
+		}
+		span := tracing.StartServerSpan(c, c.Request.Method+" "+route,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("request_id", c.GetString(common.RequestIdKey)),
+		)
+		defer span.End()
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if userId := c.GetInt("id"); userId != 0 {
+			span.SetAttributes(attribute.Int("user.id", userId))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
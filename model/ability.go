@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -23,6 +24,9 @@ type Ability struct {
 	Tag       *string `json:"tag" gorm:"index"`
 }
 
+// FineTunedModelPrefix 微调产出的模型名前缀，这类能力只登记给任务所属用户的分组
+const FineTunedModelPrefix = "ft:"
+
 type AbilityWithChannel struct {
 	Ability
 	ChannelType int `json:"channel_type"`
@@ -119,8 +123,20 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 跳过熔断中的渠道
+	if operation_setting.GetCircuitBreakerSetting().Enabled {
+		abilities = lo.Filter(abilities, func(ability_ Ability, _ int) bool {
+			return channelBreakerAvailable(ability_.ChannelId, channelBreakerChannelLevel)
+		})
+	}
 	channel := Channel{}
-	if len(abilities) > 0 {
+	if strategy := operation_setting.GetChannelSelectStrategy(group); len(abilities) > 0 && strategy != operation_setting.ChannelSelectStrategyWeightedRandom {
+		candidates := make([]channelCandidate, 0, len(abilities))
+		for _, ability_ := range abilities {
+			candidates = append(candidates, channelCandidate{id: ability_.ChannelId, weight: int(ability_.Weight)})
+		}
+		channel.Id = abilities[pickChannelCandidate(strategy, candidates)].ChannelId
+	} else if len(abilities) > 0 {
 		// Randomly choose one
 		weightSum := uint(0)
 		for _, ability_ := range abilities {
@@ -214,8 +230,8 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 		}()
 	}
 
-	// First delete all abilities of this channel
-	err := tx.Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error
+	// First delete all abilities of this channel (fine-tuned models are registered by their jobs, keep them)
+	err := tx.Where("channel_id = ? AND model NOT LIKE ?", channel.Id, FineTunedModelPrefix+"%").Delete(&Ability{}).Error
 	if err != nil {
 		if isNewTx {
 			tx.Rollback()
@@ -276,6 +292,28 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 	return nil
 }
 
+// AddFineTunedAbility 将微调模型登记为指定分组在该渠道上的能力
+func AddFineTunedAbility(group string, modelName string, channel *Channel) error {
+	if !strings.HasPrefix(modelName, FineTunedModelPrefix) {
+		return fmt.Errorf("model %s is not a fine-tuned model", modelName)
+	}
+	ability := Ability{
+		Group:     group,
+		Model:     modelName,
+		ChannelId: channel.Id,
+		Enabled:   channel.Status == common.ChannelStatusEnabled,
+		Priority:  channel.Priority,
+		Weight:    uint(channel.GetWeight()),
+		Tag:       channel.Tag,
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ability).Error
+}
+
+// DeleteFineTunedAbilities 删除微调模型的所有能力
+func DeleteFineTunedAbilities(modelName string) error {
+	return DB.Where("model = ?", modelName).Delete(&Ability{}).Error
+}
+
 func UpdateAbilityStatus(channelId int, status bool) error {
 	return DB.Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
 }
@@ -308,22 +346,15 @@ func FixAbility() (int, int, error) {
 	defer fixLock.Unlock()
 
 	// truncate abilities table
-	if common.UsingSQLite {
-		err := DB.Exec("DELETE FROM abilities").Error
-		if err != nil {
-			common.SysLog(fmt.Sprintf("Delete abilities failed: %s", err.Error()))
-			return 0, 0, err
-		}
-	} else {
-		err := DB.Exec("TRUNCATE TABLE abilities").Error
-		if err != nil {
-			common.SysLog(fmt.Sprintf("Truncate abilities failed: %s", err.Error()))
-			return 0, 0, err
-		}
+	// 微调模型的能力由微调任务登记，无法从渠道配置重建，需要保留
+	err := DB.Where("model NOT LIKE ?", FineTunedModelPrefix+"%").Delete(&Ability{}).Error
+	if err != nil {
+		common.SysLog(fmt.Sprintf("Delete abilities failed: %s", err.Error()))
+		return 0, 0, err
 	}
 	var channels []*Channel
 	// Find all channels
-	err := DB.Model(&Channel{}).Find(&channels).Error
+	err = DB.Model(&Channel{}).Find(&channels).Error
 	if err != nil {
 		return 0, 0, err
 	}
@@ -335,7 +366,7 @@ func FixAbility() (int, int, error) {
 	for _, chunk := range lo.Chunk(channels, 50) {
 		ids := lo.Map(chunk, func(c *Channel, _ int) int { return c.Id })
 		// Delete all abilities of this channel
-		err = DB.Where("channel_id IN ?", ids).Delete(&Ability{}).Error
+		err = DB.Where("channel_id IN ? AND model NOT LIKE ?", ids, FineTunedModelPrefix+"%").Delete(&Ability{}).Error
 		if err != nil {
 			common.SysLog(fmt.Sprintf("Delete abilities failed: %s", err.Error()))
 			failCount += len(chunk)
@@ -88,6 +88,13 @@ func GetAllAppeals(status int, page, pageSize int) ([]*AppealWithUser, int64, er
 	return appeals, total, err
 }
 
+// GetAppealModerationLogs 返回申诉用户最近被内容审核标记的日志，供审核人员查看拦截原因
+func GetAppealModerationLogs(userId int, limit int) ([]*Log, error) {
+	var logs []*Log
+	err := LOG_DB.Where("user_id = ? AND moderated = ?", userId, true).Order("id DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
 func ApproveAppeal(appealId int, adminId int, note string) error {
 	appeal, err := GetAppealById(appealId)
 	if err != nil {
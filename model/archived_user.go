@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"gorm.io/gorm"
 )
 
@@ -116,7 +117,7 @@ func CountInactiveUsers(minDays int, startId int, endId int) (int64, error) {
 }
 
 func ArchiveAndDeleteUser(user *User, archivedBy int, reason string) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
 		archived := &ArchivedUser{
 			OriginalUserId:     user.Id,
 			Username:           user.Username,
@@ -163,6 +164,16 @@ func ArchiveAndDeleteUser(user *User, archivedBy int, reason string) error {
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	EnqueueWebhookEvent(constant.WebhookEventUserArchived, map[string]interface{}{
+		"user_id":     user.Id,
+		"username":    user.Username,
+		"archived_by": archivedBy,
+		"reason":      reason,
+	})
+	return nil
 }
 
 func BatchArchiveInactiveUsers(minDays int, startId int, endId int, archivedBy int, reason string) (int, error) {
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"context"
+)
+
+// AuditCapture 一次请求的完整请求体与响应体，正文经 gzip 压缩并加密后存入本表或磁盘
+type AuditCapture struct {
+	Id        int    `json:"id" gorm:"primaryKey"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"index"`
+	ChannelId int    `json:"channel_id" gorm:"index"`
+	ModelName string `json:"model_name" gorm:"type:varchar(255);index"`
+	// 重放时按原请求的格式与路径重新发起
+	RelayFormat string `json:"relay_format" gorm:"type:varchar(32)"`
+	Method      string `json:"method" gorm:"type:varchar(16)"`
+	Path        string `json:"path" gorm:"type:varchar(255)"`
+	StatusCode  int    `json:"status_code"`
+	// 原始大小（截断前）
+	RequestSize  int64 `json:"request_size"`
+	ResponseSize int64 `json:"response_size"`
+	// 超过大小上限时只保存前 MaxBodyBytes 字节
+	RequestTruncated    bool   `json:"request_truncated"`
+	ResponseTruncated   bool   `json:"response_truncated"`
+	RequestContentType  string `json:"request_content_type" gorm:"type:varchar(255)"`
+	ResponseContentType string `json:"response_content_type" gorm:"type:varchar(255)"`
+	Storage             string `json:"storage" gorm:"type:varchar(16)"`
+	// 数据库存储时的密文，禁止直接返回
+	RequestBody  []byte `json:"-"`
+	ResponseBody []byte `json:"-"`
+	// 磁盘存储时的密文文件路径
+	RequestPath  string `json:"-" gorm:"type:varchar(512)"`
+	ResponsePath string `json:"-" gorm:"type:varchar(512)"`
+}
+
+func (a *AuditCapture) Insert() error {
+	return LOG_DB.Create(a).Error
+}
+
+func GetAuditCaptureById(id int) (*AuditCapture, error) {
+	var capture AuditCapture
+	err := LOG_DB.First(&capture, "id = ?", id).Error
+	return &capture, err
+}
+
+// GetAuditCaptures 分页查询采集记录，列表不加载正文
+func GetAuditCaptures(userId int, tokenId int, channelId int, requestId string, startIdx int, num int) ([]*AuditCapture, int64, error) {
+	var captures []*AuditCapture
+	var total int64
+	tx := LOG_DB.Model(&AuditCapture{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if tokenId != 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if requestId != "" {
+		tx = tx.Where("request_id = ?", requestId)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Omit("request_body", "response_body").Order("id DESC").Limit(num).Offset(startIdx).Find(&captures).Error
+	return captures, total, err
+}
+
+// GetOldAuditCaptureFiles 返回早于指定时间、存储在磁盘上的采集记录的文件路径
+func GetOldAuditCaptureFiles(targetTimestamp int64, limit int) ([]*AuditCapture, error) {
+	var captures []*AuditCapture
+	err := LOG_DB.Select("id", "request_path", "response_path").
+		Where("created_at < ? AND (request_path <> '' OR response_path <> '')", targetTimestamp).
+		Order("id").Limit(limit).Find(&captures).Error
+	return captures, err
+}
+
+func DeleteAuditCapturesByIds(ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := LOG_DB.Where("id IN ?", ids).Delete(&AuditCapture{})
+	return result.RowsAffected, result.Error
+}
+
+func DeleteOldAuditCaptures(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+
+		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&AuditCapture{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+
+		total += result.RowsAffected
+
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+
+	return total, nil
+}
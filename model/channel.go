@@ -56,6 +56,10 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+
+	// 当前节点的实时统计与熔断状态，仅在渠道列表接口中填充
+	RuntimeStats   *ChannelRuntimeStats  `json:"runtime_stats,omitempty" gorm:"-"`
+	CircuitBreaker *CircuitBreakerStatus `json:"circuit_breaker,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -104,6 +108,14 @@ func (channel *Channel) GetKeys() []string {
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	key, idx, err := channel.getNextEnabledKey()
+	if err == nil && channel.ChannelInfo.IsMultiKey {
+		acquireChannelBreaker(channel.Id, idx)
+	}
+	return key, idx, err
+}
+
+func (channel *Channel) getNextEnabledKey() (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -132,10 +144,15 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return common.ChannelStatusEnabled
 	}
 
+	// 熔断中的 key 视为不可用
+	isUsable := func(idx int) bool {
+		return getStatus(idx) == common.ChannelStatusEnabled && channelBreakerAvailable(channel.Id, idx)
+	}
+
 	// Collect indexes of enabled keys
 	enabledIdx := make([]int, 0, len(keys))
 	for i := range keys {
-		if getStatus(i) == common.ChannelStatusEnabled {
+		if isUsable(i) {
 			enabledIdx = append(enabledIdx, i)
 		}
 	}
@@ -176,7 +193,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isUsable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -525,6 +542,16 @@ func (channel *Channel) UpdateBalance(balance float64) {
 	}
 }
 
+// UpdateModels 仅更新渠道模型列表，并同步重建 abilities
+func (channel *Channel) UpdateModels(models string) error {
+	err := DB.Model(channel).Select("models").Updates(Channel{Models: models}).Error
+	if err != nil {
+		return err
+	}
+	channel.Models = models
+	return channel.UpdateAbilities(nil)
+}
+
 func (channel *Channel) Delete() error {
 	var err error
 	err = DB.Delete(channel).Error
@@ -965,6 +992,13 @@ func CountAllChannels() (int64, error) {
 	return total, err
 }
 
+// GetAllChannelStatuses returns id and status of every channel
+func GetAllChannelStatuses() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Model(&Channel{}).Select("id", "status").Find(&channels).Error
+	return channels, err
+}
+
 // CountAllTags returns number of non-empty distinct tags
 func CountAllTags() (int64, error) {
 	var total int64
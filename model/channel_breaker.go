@@ -0,0 +1,333 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	CircuitBreakerClosed   = "closed"
+	CircuitBreakerOpen     = "open"
+	CircuitBreakerHalfOpen = "half_open"
+)
+
+// 熔断状态持久化到 redis hash，field 为 "渠道ID:key下标"
+const channelBreakerRedisKey = "channel_circuit_breaker"
+
+// 渠道级熔断器使用的 key 下标
+const channelBreakerChannelLevel = -1
+
+const channelBreakerBuckets = 6
+
+type channelBreakerKey struct {
+	channelId int
+	keyIdx    int
+}
+
+type channelBreakerBucket struct {
+	epoch    int64
+	total    int
+	failures int
+}
+
+type channelBreaker struct {
+	State             string `json:"state"`
+	Trips             int    `json:"trips"`
+	OpenUntil         int64  `json:"open_until"`
+	lastProbeAt       int64
+	halfOpenSuccesses int
+	buckets           [channelBreakerBuckets]channelBreakerBucket
+}
+
+// CircuitBreakerStatus 渠道列表接口中展示的熔断状态，Keys 为多 key 渠道中每个 key 的状态
+type CircuitBreakerStatus struct {
+	State     string                        `json:"state"`
+	Requests  int                           `json:"requests"`
+	Failures  int                           `json:"failures"`
+	ErrorRate float64                       `json:"error_rate"`
+	Trips     int                           `json:"trips,omitempty"`
+	OpenUntil int64                         `json:"open_until,omitempty"`
+	Keys      map[int]*CircuitBreakerStatus `json:"keys,omitempty"`
+}
+
+var (
+	channelBreakerLock sync.Mutex
+	channelBreakers    = make(map[channelBreakerKey]*channelBreaker)
+)
+
+func channelBreakerBucketSeconds() int64 {
+	window := operation_setting.GetCircuitBreakerSetting().WindowSeconds
+	if window < channelBreakerBuckets {
+		window = channelBreakerBuckets
+	}
+	return int64(window / channelBreakerBuckets)
+}
+
+// refreshLocked 冷却结束后由 open 转为 half_open
+func (b *channelBreaker) refreshLocked(key channelBreakerKey, now int64) {
+	if b.State == CircuitBreakerOpen && now >= b.OpenUntil {
+		b.State = CircuitBreakerHalfOpen
+		b.lastProbeAt = 0
+		b.halfOpenSuccesses = 0
+		persistChannelBreaker(key, b)
+	}
+}
+
+func (b *channelBreaker) windowLocked(now int64) (total int, failures int) {
+	bucketSeconds := channelBreakerBucketSeconds()
+	epoch := now / bucketSeconds
+	for _, bucket := range b.buckets {
+		if epoch-bucket.epoch < channelBreakerBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+func (b *channelBreaker) tripLocked(key channelBreakerKey, now int64) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	b.Trips++
+	cooldown := int64(setting.CooldownSeconds)
+	for i := 1; i < b.Trips && (setting.MaxCooldownSeconds <= 0 || cooldown < int64(setting.MaxCooldownSeconds)); i++ {
+		cooldown *= 2
+	}
+	if setting.MaxCooldownSeconds > 0 && cooldown > int64(setting.MaxCooldownSeconds) {
+		cooldown = int64(setting.MaxCooldownSeconds)
+	}
+	b.State = CircuitBreakerOpen
+	b.OpenUntil = now + cooldown
+	b.buckets = [channelBreakerBuckets]channelBreakerBucket{}
+	persistChannelBreaker(key, b)
+	if key.keyIdx == channelBreakerChannelLevel {
+		common.SysLog(fmt.Sprintf("渠道 #%d 熔断，冷却 %d 秒", key.channelId, cooldown))
+	} else {
+		common.SysLog(fmt.Sprintf("渠道 #%d 的 key #%d 熔断，冷却 %d 秒", key.channelId, key.keyIdx, cooldown))
+	}
+}
+
+func (b *channelBreaker) recordLocked(key channelBreakerKey, failed bool, now int64) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	b.refreshLocked(key, now)
+	switch b.State {
+	case CircuitBreakerOpen:
+		// 熔断前发出的请求，结果不再计入
+		return
+	case CircuitBreakerHalfOpen:
+		if failed {
+			b.tripLocked(key, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= setting.HalfOpenSuccesses {
+			b.State = CircuitBreakerClosed
+			b.Trips = 0
+			b.OpenUntil = 0
+			persistChannelBreaker(key, b)
+		}
+		return
+	}
+	epoch := now / channelBreakerBucketSeconds()
+	bucket := &b.buckets[epoch%channelBreakerBuckets]
+	if bucket.epoch != epoch {
+		*bucket = channelBreakerBucket{epoch: epoch}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+	total, failures := b.windowLocked(now)
+	if failed && total >= setting.MinRequests && float64(failures) >= setting.ErrorRateThreshold*float64(total) {
+		b.tripLocked(key, now)
+	}
+}
+
+// availableLocked closed 可用；open 不可用；half_open 每个探测间隔放行一个请求
+func (b *channelBreaker) availableLocked(key channelBreakerKey, now int64) bool {
+	b.refreshLocked(key, now)
+	switch b.State {
+	case CircuitBreakerOpen:
+		return false
+	case CircuitBreakerHalfOpen:
+		return now-b.lastProbeAt >= int64(operation_setting.GetCircuitBreakerSetting().ProbeIntervalSeconds)
+	default:
+		return true
+	}
+}
+
+func channelBreakerAvailable(channelId int, keyIdx int) bool {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return true
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	key := channelBreakerKey{channelId: channelId, keyIdx: keyIdx}
+	b, ok := channelBreakers[key]
+	if !ok {
+		return true
+	}
+	return b.availableLocked(key, time.Now().Unix())
+}
+
+// acquireChannelBreaker 选中渠道或 key 后调用，半开状态下占用本次探测机会
+func acquireChannelBreaker(channelId int, keyIdx int) {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	if b, ok := channelBreakers[channelBreakerKey{channelId: channelId, keyIdx: keyIdx}]; ok && b.State == CircuitBreakerHalfOpen {
+		b.lastProbeAt = time.Now().Unix()
+	}
+}
+
+// RecordChannelBreakerResult 记录一次请求结果，同时计入渠道级熔断器和多 key 渠道的 key 级熔断器
+func RecordChannelBreakerResult(channelId int, isMultiKey bool, keyIdx int, failed bool) {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return
+	}
+	now := time.Now().Unix()
+	keys := []channelBreakerKey{{channelId: channelId, keyIdx: channelBreakerChannelLevel}}
+	if isMultiKey {
+		keys = append(keys, channelBreakerKey{channelId: channelId, keyIdx: keyIdx})
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	for _, key := range keys {
+		b, ok := channelBreakers[key]
+		if !ok {
+			if !failed {
+				// 没有失败记录的 closed 熔断器不需要创建
+				continue
+			}
+			b = &channelBreaker{State: CircuitBreakerClosed}
+			channelBreakers[key] = b
+		}
+		b.recordLocked(key, failed, now)
+	}
+}
+
+// ResetChannelBreaker 手动测试成功后重置渠道及对应 key 的熔断状态
+func ResetChannelBreaker(channelId int, keyIdx int) {
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	for _, key := range []channelBreakerKey{{channelId: channelId, keyIdx: channelBreakerChannelLevel}, {channelId: channelId, keyIdx: keyIdx}} {
+		if b, ok := channelBreakers[key]; ok {
+			if b.State != CircuitBreakerClosed {
+				b.State = CircuitBreakerClosed
+				b.Trips = 0
+				b.OpenUntil = 0
+				persistChannelBreaker(key, b)
+			}
+			delete(channelBreakers, key)
+		}
+	}
+}
+
+func (b *channelBreaker) statusLocked(key channelBreakerKey, now int64) *CircuitBreakerStatus {
+	b.refreshLocked(key, now)
+	total, failures := b.windowLocked(now)
+	status := &CircuitBreakerStatus{
+		State:     b.State,
+		Requests:  total,
+		Failures:  failures,
+		Trips:     b.Trips,
+		OpenUntil: b.OpenUntil,
+	}
+	if total > 0 {
+		status.ErrorRate = float64(failures) / float64(total)
+	}
+	return status
+}
+
+// GetChannelBreakerStatus 返回渠道的熔断状态，未启用熔断时返回 nil
+func GetChannelBreakerStatus(channelId int) *CircuitBreakerStatus {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return nil
+	}
+	now := time.Now().Unix()
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	status := &CircuitBreakerStatus{State: CircuitBreakerClosed}
+	for key, b := range channelBreakers {
+		if key.channelId != channelId {
+			continue
+		}
+		if key.keyIdx == channelBreakerChannelLevel {
+			keys := status.Keys
+			status = b.statusLocked(key, now)
+			status.Keys = keys
+			continue
+		}
+		if status.Keys == nil {
+			status.Keys = make(map[int]*CircuitBreakerStatus)
+		}
+		status.Keys[key.keyIdx] = b.statusLocked(key, now)
+	}
+	return status
+}
+
+func persistChannelBreaker(key channelBreakerKey, b *channelBreaker) {
+	if !common.RedisEnabled {
+		return
+	}
+	field := fmt.Sprintf("%d:%d", key.channelId, key.keyIdx)
+	if b.State == CircuitBreakerClosed {
+		gopool.Go(func() {
+			if err := common.RedisHDel(channelBreakerRedisKey, field); err != nil {
+				common.SysError("failed to delete circuit breaker state: " + err.Error())
+			}
+		})
+		return
+	}
+	data, err := common.Marshal(b)
+	if err != nil {
+		return
+	}
+	gopool.Go(func() {
+		if err := common.RedisHSet(channelBreakerRedisKey, field, string(data)); err != nil {
+			common.SysError("failed to save circuit breaker state: " + err.Error())
+		}
+	})
+}
+
+// InitChannelBreakers 启动时从 redis 恢复未关闭的熔断器
+func InitChannelBreakers() {
+	if !common.RedisEnabled {
+		return
+	}
+	states, err := common.RedisHGetAll(channelBreakerRedisKey)
+	if err != nil {
+		common.SysError("failed to load circuit breaker states: " + err.Error())
+		return
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	for field, data := range states {
+		channelIdStr, keyIdxStr, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		channelId, err1 := strconv.Atoi(channelIdStr)
+		keyIdx, err2 := strconv.Atoi(keyIdxStr)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		b := &channelBreaker{}
+		if err := common.UnmarshalJsonStr(data, b); err != nil || b.State == CircuitBreakerClosed {
+			continue
+		}
+		channelBreakers[channelBreakerKey{channelId: channelId, keyIdx: keyIdx}] = b
+	}
+	if len(channelBreakers) > 0 {
+		common.SysLog(fmt.Sprintf("restored %d circuit breaker states from redis", len(channelBreakers)))
+	}
+}
@@ -11,7 +11,10 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/samber/lo"
 )
 
 var group2model2channels map[string]map[string][]int // enabled channel
@@ -62,6 +65,20 @@ func InitChannelCache() {
 		}
 	}
 
+	// fine-tuned models only exist as abilities of the owner's group
+	for _, ability := range abilities {
+		if !ability.Enabled || !strings.HasPrefix(ability.Model, FineTunedModelPrefix) {
+			continue
+		}
+		channel, ok := newChannelId2channel[ability.ChannelId]
+		if !ok || channel.Status != common.ChannelStatusEnabled {
+			continue
+		}
+		if !lo.Contains(newGroup2model2channels[ability.Group][ability.Model], ability.ChannelId) {
+			newGroup2model2channels[ability.Group][ability.Model] = append(newGroup2model2channels[ability.Group][ability.Model], ability.ChannelId)
+		}
+	}
+
 	// sort by priority
 	for group, model2channels := range newGroup2model2channels {
 		for model, channels := range model2channels {
@@ -102,6 +119,14 @@ func SyncChannelCache(frequency int) {
 }
 
 func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+	channel, err := getRandomSatisfiedChannel(group, model, retry)
+	if err == nil && channel != nil {
+		acquireChannelBreaker(channel.Id, channelBreakerChannelLevel)
+	}
+	return channel, err
+}
+
+func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
 		return GetChannel(group, model, retry)
@@ -119,6 +144,13 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
+	// 跳过熔断中的渠道
+	if operation_setting.GetCircuitBreakerSetting().Enabled {
+		channels = lo.Filter(channels, func(channelId int, _ int) bool {
+			return channelBreakerAvailable(channelId, channelBreakerChannelLevel)
+		})
+	}
+
 	if len(channels) == 0 {
 		return nil, nil
 	}
@@ -167,6 +199,14 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
+	if strategy := operation_setting.GetChannelSelectStrategy(group); strategy != operation_setting.ChannelSelectStrategyWeightedRandom {
+		candidates := make([]channelCandidate, 0, len(targetChannels))
+		for _, channel := range targetChannels {
+			candidates = append(candidates, channelCandidate{id: channel.Id, weight: channel.GetWeight(), responseTime: channel.ResponseTime})
+		}
+		return targetChannels[pickChannelCandidate(strategy, candidates)], nil
+	}
+
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
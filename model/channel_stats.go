@@ -0,0 +1,194 @@
+package model
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// ChannelRuntimeStats 渠道实时统计，仅保存在当前节点内存中，由 relay 请求实时更新
+type ChannelRuntimeStats struct {
+	Inflight     int64   `json:"inflight"`
+	LatencyMs    float64 `json:"latency_ms"`
+	TTFTMs       float64 `json:"ttft_ms"`
+	Samples      int64   `json:"samples"`
+	TTFTSamples  int64   `json:"ttft_samples"`
+	LastSampleAt int64   `json:"last_sample_at"`
+}
+
+var (
+	channelStatsLock sync.Mutex
+	channelStats     = make(map[int]*ChannelRuntimeStats)
+)
+
+func getChannelStatsLocked(channelId int) *ChannelRuntimeStats {
+	stats, ok := channelStats[channelId]
+	if !ok {
+		stats = &ChannelRuntimeStats{}
+		channelStats[channelId] = stats
+	}
+	return stats
+}
+
+// ChannelRequestStart 记录渠道开始处理一个请求，必须与 ChannelRequestEnd 成对调用
+func ChannelRequestStart(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	getChannelStatsLocked(channelId).Inflight++
+}
+
+// ChannelRequestEnd 记录请求结束；只有成功的请求会计入延迟，避免快速失败的渠道被误判为更快。
+// ttft 为 0 表示本次请求没有首字时间（非流式）
+func ChannelRequestEnd(channelId int, latency time.Duration, ttft time.Duration, success bool) {
+	alpha := operation_setting.GetChannelSelectSetting().EWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.3
+	}
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStatsLocked(channelId)
+	if stats.Inflight > 0 {
+		stats.Inflight--
+	}
+	if !success {
+		return
+	}
+	if !stats.fresh() {
+		stats.Samples = 0
+		stats.TTFTSamples = 0
+	}
+	stats.LatencyMs = ewma(stats.LatencyMs, float64(latency.Milliseconds()), alpha, stats.Samples)
+	stats.Samples++
+	if ttft > 0 {
+		stats.TTFTMs = ewma(stats.TTFTMs, float64(ttft.Milliseconds()), alpha, stats.TTFTSamples)
+		stats.TTFTSamples++
+	}
+	stats.LastSampleAt = time.Now().Unix()
+}
+
+func ewma(old float64, sample float64, alpha float64, samples int64) float64 {
+	if samples == 0 {
+		return sample
+	}
+	return alpha*sample + (1-alpha)*old
+}
+
+func (stats *ChannelRuntimeStats) fresh() bool {
+	ttl := operation_setting.GetChannelSelectSetting().StatsTTLSeconds
+	return stats.LastSampleAt > 0 && (ttl <= 0 || time.Now().Unix()-stats.LastSampleAt <= int64(ttl))
+}
+
+// GetChannelRuntimeStats 返回渠道实时统计的快照
+func GetChannelRuntimeStats(channelId int) ChannelRuntimeStats {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	if stats, ok := channelStats[channelId]; ok {
+		return *stats
+	}
+	return ChannelRuntimeStats{}
+}
+
+type channelCandidate struct {
+	id           int
+	weight       int
+	responseTime int
+}
+
+// pickChannelCandidate 按策略从同优先级的候选渠道中选出一个，返回下标
+func pickChannelCandidate(strategy string, candidates []channelCandidate) int {
+	if len(candidates) <= 1 {
+		return 0
+	}
+	weights := make([]float64, len(candidates))
+	sumWeight := 0
+	for _, candidate := range candidates {
+		sumWeight += candidate.weight
+	}
+	for i, candidate := range candidates {
+		// 全部权重为 0 时视为等权重
+		if sumWeight == 0 {
+			weights[i] = 1
+		} else {
+			weights[i] = float64(candidate.weight)
+		}
+	}
+
+	channelStatsLock.Lock()
+	snapshots := make([]ChannelRuntimeStats, len(candidates))
+	for i, candidate := range candidates {
+		if stats, ok := channelStats[candidate.id]; ok {
+			snapshots[i] = *stats
+		}
+	}
+	channelStatsLock.Unlock()
+
+	switch strategy {
+	case operation_setting.ChannelSelectStrategyLeastInflight:
+		// 只在并发最少的渠道中按权重随机
+		minInflight := snapshots[0].Inflight
+		for _, stats := range snapshots[1:] {
+			minInflight = min(minInflight, stats.Inflight)
+		}
+		remaining := 0.0
+		for i, stats := range snapshots {
+			if stats.Inflight != minInflight {
+				weights[i] = 0
+			}
+			remaining += weights[i]
+		}
+		if remaining == 0 {
+			for i, stats := range snapshots {
+				if stats.Inflight == minInflight {
+					weights[i] = 1
+				}
+			}
+		}
+	case operation_setting.ChannelSelectStrategyEWMALatency, operation_setting.ChannelSelectStrategyTTFT:
+		// 流量与延迟成反比；没有样本的渠道使用测速结果，仍没有则取当前最快值，保证新渠道能被探索到
+		scores := make([]float64, len(candidates))
+		minScore := 0.0
+		for i, stats := range snapshots {
+			if stats.fresh() {
+				if strategy == operation_setting.ChannelSelectStrategyTTFT && stats.TTFTSamples > 0 {
+					scores[i] = max(stats.TTFTMs, 1)
+				} else {
+					scores[i] = max(stats.LatencyMs, 1)
+				}
+			} else if candidates[i].responseTime > 0 {
+				scores[i] = float64(candidates[i].responseTime)
+			}
+			if scores[i] > 0 && (minScore == 0 || scores[i] < minScore) {
+				minScore = scores[i]
+			}
+		}
+		if minScore > 0 {
+			for i := range weights {
+				if scores[i] <= 0 {
+					scores[i] = minScore
+				}
+				weights[i] = weights[i] * minScore / scores[i]
+			}
+		}
+	}
+	return weightedRandomIndex(weights)
+}
+
+func weightedRandomIndex(weights []float64) int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+	r := rand.Float64() * total
+	for i, weight := range weights {
+		r -= weight
+		if r < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
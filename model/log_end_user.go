@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// EndUserUsage 单个终端用户在时间范围内的消费汇总
+type EndUserUsage struct {
+	EndUserId        string `json:"end_user_id"`
+	Requests         int    `json:"requests"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	LastUsedAt       int64  `json:"last_used_at"`
+}
+
+// GetEndUserUsages 按终端用户汇总消费日志并按额度降序分页，userId 为 0 时统计全部用户
+func GetEndUserUsages(userId int, tokenName string, endUserId string, startTimestamp int64, endTimestamp int64, startIdx int, num int) ([]*EndUserUsage, int64, error) {
+	filter := func() *gorm.DB {
+		tx := LOG_DB.Table("logs").Where("type = ? AND end_user_id <> ''", LogTypeConsume)
+		if userId != 0 {
+			tx = tx.Where("user_id = ?", userId)
+		}
+		if tokenName != "" {
+			tx = tx.Where("token_name = ?", tokenName)
+		}
+		if endUserId != "" {
+			tx = tx.Where("end_user_id = ?", endUserId)
+		}
+		if startTimestamp != 0 {
+			tx = tx.Where("created_at >= ?", startTimestamp)
+		}
+		if endTimestamp != 0 {
+			tx = tx.Where("created_at <= ?", endTimestamp)
+		}
+		return tx
+	}
+	var total int64
+	if err := filter().Select("count(distinct end_user_id)").Scan(&total).Error; err != nil {
+		common.SysError("failed to count end user usages: " + err.Error())
+		return nil, 0, errors.New("查询终端用户用量失败")
+	}
+	var usages []*EndUserUsage
+	err := filter().
+		Select("end_user_id, count(*) as requests, sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, max(created_at) as last_used_at").
+		Group("end_user_id").
+		Order("quota desc").
+		Limit(num).Offset(startIdx).
+		Scan(&usages).Error
+	if err != nil {
+		common.SysError("failed to query end user usages: " + err.Error())
+		return nil, 0, errors.New("查询终端用户用量失败")
+	}
+	return usages, total, nil
+}
@@ -213,6 +213,11 @@ func InitDB() (err error) {
 func InitLogDB() (err error) {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
+		if !common.IsMasterNode {
+			return
+		}
+		// 日志表已随主库迁移，这里只补充仅存于日志库的表
+		err = LOG_DB.AutoMigrate(&AuditCapture{})
 		return
 	}
 	db, err := chooseDB("LOG_SQL_DSN", true)
@@ -282,6 +287,13 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&RelayFile{},
+		&RelayBatch{},
+		&Organization{},
+		&Project{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&StoredResponse{},
 	)
 	if err != nil {
 		return err
@@ -335,6 +347,13 @@ func migrateDBFast() error {
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&RelayFile{}, "RelayFile"},
+		{&RelayBatch{}, "RelayBatch"},
+		{&Organization{}, "Organization"},
+		{&Project{}, "Project"},
+		{&WebhookSubscription{}, "WebhookSubscription"},
+		{&WebhookDelivery{}, "WebhookDelivery"},
+		{&StoredResponse{}, "StoredResponse"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -374,7 +393,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &AuditCapture{}); err != nil {
 		return err
 	}
 	return nil
@@ -23,6 +23,13 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	OrgId       int    `json:"-" gorm:"default:0"` // 扣费所属组织，失败退款时退还组织与项目额度
+	ProjectId   int    `json:"-" gorm:"default:0"`
+}
+
+// GetBudgetChain 任务扣费时所属的组织与项目
+func (midjourney *Midjourney) GetBudgetChain() BudgetChain {
+	return BudgetChain{OrgId: midjourney.OrgId, ProjectId: midjourney.ProjectId}
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -0,0 +1,414 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+// ErrBudgetExceeded 组织或项目的额度不足、超出消费上限时返回
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Organization 组织，用户归属于组织，组织下的所有项目共享组织额度
+type Organization struct {
+	Id             int    `json:"id"`
+	Name           string `json:"name" gorm:"type:varchar(64);index"`
+	Status         int    `json:"status" gorm:"default:1"`
+	RemainQuota    int    `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota bool   `json:"unlimited_quota"`
+	UsedQuota      int    `json:"used_quota" gorm:"default:0"`
+	SpendCap       int    `json:"spend_cap" gorm:"default:0"` // 累计消耗上限，0 表示不限制
+	ModelLimits    string `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// Project 项目，隶属于组织，令牌归属于项目
+type Project struct {
+	Id             int    `json:"id"`
+	OrgId          int    `json:"org_id" gorm:"index"`
+	Name           string `json:"name" gorm:"type:varchar(64);index"`
+	Status         int    `json:"status" gorm:"default:1"`
+	RemainQuota    int    `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota bool   `json:"unlimited_quota"`
+	UsedQuota      int    `json:"used_quota" gorm:"default:0"`
+	SpendCap       int    `json:"spend_cap" gorm:"default:0"` // 累计消耗上限，0 表示不限制
+	ModelLimits    string `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// BudgetChain 一次请求需要逐级扣减的组织与项目，0 表示不属于任何组织或项目
+type BudgetChain struct {
+	OrgId     int
+	ProjectId int
+}
+
+func (b BudgetChain) Empty() bool {
+	return b.OrgId == 0 && b.ProjectId == 0
+}
+
+const projectOrgCacheNamespace = "new-api:project_org:v1"
+
+var (
+	projectOrgCacheOnce sync.Once
+	projectOrgCache     *cachex.HybridCache[int]
+)
+
+func projectOrgCacheTTL() time.Duration {
+	ttlSeconds := common.GetEnvOrDefault("PROJECT_ORG_CACHE_TTL", 600)
+	if ttlSeconds <= 0 {
+		ttlSeconds = 600
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+// getProjectOrgCache 项目所属组织创建后不可修改，按项目缓存以避免每次请求查库
+func getProjectOrgCache() *cachex.HybridCache[int] {
+	projectOrgCacheOnce.Do(func() {
+		ttl := projectOrgCacheTTL()
+		projectOrgCache = cachex.NewHybridCache[int](cachex.HybridCacheConfig[int]{
+			Namespace: cachex.Namespace(projectOrgCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[int]{},
+			Memory: func() *hot.HotCache[string, int] {
+				return hot.NewHotCache[string, int](hot.LRU, 10000).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return projectOrgCache
+}
+
+// GetBudgetChain 令牌所属项目决定组织；令牌未指定项目时使用用户所在组织
+func GetBudgetChain(userOrgId int, projectId int) (BudgetChain, error) {
+	if projectId == 0 {
+		return BudgetChain{OrgId: userOrgId}, nil
+	}
+	key := strconv.Itoa(projectId)
+	if orgId, found, err := getProjectOrgCache().Get(key); err == nil && found {
+		return BudgetChain{OrgId: orgId, ProjectId: projectId}, nil
+	}
+	var orgId int
+	if err := DB.Model(&Project{}).Where("id = ?", projectId).Select("org_id").Scan(&orgId).Error; err != nil {
+		return BudgetChain{}, err
+	}
+	_ = getProjectOrgCache().SetWithTTL(key, orgId, projectOrgCacheTTL())
+	return BudgetChain{OrgId: orgId, ProjectId: projectId}, nil
+}
+
+func splitModelLimits(limits string) map[string]bool {
+	if limits == "" {
+		return nil
+	}
+	limitsMap := make(map[string]bool)
+	for _, limit := range strings.Split(limits, ",") {
+		if limit = strings.TrimSpace(limit); limit != "" {
+			limitsMap[limit] = true
+		}
+	}
+	return limitsMap
+}
+
+// budgetLevel 抽象组织与项目共同的额度字段，便于逐级检查
+type budgetLevel struct {
+	table          string
+	label          string
+	id             int
+	status         int
+	remainQuota    int
+	unlimitedQuota bool
+	usedQuota      int
+	spendCap       int
+	modelLimits    string
+}
+
+func (l *budgetLevel) check(modelName string, quota int) error {
+	if l.status != common.UserStatusEnabled {
+		return fmt.Errorf("%s %d 已被禁用", l.label, l.id)
+	}
+	if limits := splitModelLimits(l.modelLimits); limits != nil && !limits[modelName] {
+		return fmt.Errorf("%s %d 无权访问模型 %s", l.label, l.id, modelName)
+	}
+	// 预扣为 0（信任额度旁路）时仍要求额度未耗尽
+	need := max(quota, 1)
+	if !l.unlimitedQuota && l.remainQuota < need {
+		return fmt.Errorf("%w: %s %d 剩余额度不足", ErrBudgetExceeded, l.label, l.id)
+	}
+	if l.spendCap > 0 && l.usedQuota+need > l.spendCap {
+		return fmt.Errorf("%w: %s %d 已达到消费上限", ErrBudgetExceeded, l.label, l.id)
+	}
+	return nil
+}
+
+func (l *budgetLevel) consume(tx *gorm.DB, quota int) error {
+	need := max(quota, 1)
+	result := tx.Table(l.table).Where("id = ? AND status = ?", l.id, common.UserStatusEnabled).
+		Where("unlimited_quota = ? OR remain_quota >= ?", true, need).
+		Where("spend_cap = 0 OR used_quota + ? <= spend_cap", need).
+		Updates(map[string]interface{}{
+			"remain_quota": gorm.Expr("remain_quota - ?", quota),
+			"used_quota":   gorm.Expr("used_quota + ?", quota),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 检查与扣减之间额度被并发请求用完
+		return fmt.Errorf("%w: %s %d 剩余额度不足", ErrBudgetExceeded, l.label, l.id)
+	}
+	return nil
+}
+
+func loadBudgetLevels(tx *gorm.DB, chain BudgetChain) ([]*budgetLevel, error) {
+	levels := make([]*budgetLevel, 0, 2)
+	if chain.ProjectId != 0 {
+		var project Project
+		if err := tx.First(&project, chain.ProjectId).Error; err != nil {
+			return nil, err
+		}
+		levels = append(levels, &budgetLevel{table: "projects", label: "项目", id: project.Id, status: project.Status,
+			remainQuota: project.RemainQuota, unlimitedQuota: project.UnlimitedQuota, usedQuota: project.UsedQuota,
+			spendCap: project.SpendCap, modelLimits: project.ModelLimits})
+	}
+	if chain.OrgId != 0 {
+		var org Organization
+		if err := tx.First(&org, chain.OrgId).Error; err != nil {
+			return nil, err
+		}
+		levels = append(levels, &budgetLevel{table: "organizations", label: "组织", id: org.Id, status: org.Status,
+			remainQuota: org.RemainQuota, unlimitedQuota: org.UnlimitedQuota, usedQuota: org.UsedQuota,
+			spendCap: org.SpendCap, modelLimits: org.ModelLimits})
+	}
+	return levels, nil
+}
+
+// PreConsumeBudget 在同一事务内检查并扣减项目与组织额度，任一级不满足时整体回滚
+func PreConsumeBudget(chain BudgetChain, modelName string, quota int) error {
+	if chain.Empty() {
+		return nil
+	}
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		levels, err := loadBudgetLevels(tx, chain)
+		if err != nil {
+			return err
+		}
+		for _, level := range levels {
+			if err := level.check(modelName, quota); err != nil {
+				return err
+			}
+		}
+		if quota == 0 {
+			return nil
+		}
+		for _, level := range levels {
+			if err := level.consume(tx, quota); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AdjustBudget 结算或退款时按差额调整项目与组织额度，不做额度检查
+func AdjustBudget(chain BudgetChain, delta int) error {
+	if chain.Empty() || delta == 0 {
+		return nil
+	}
+	updates := map[string]interface{}{
+		"remain_quota": gorm.Expr("remain_quota - ?", delta),
+		"used_quota":   gorm.Expr("used_quota + ?", delta),
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if chain.ProjectId != 0 {
+			if err := tx.Model(&Project{}).Where("id = ?", chain.ProjectId).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if chain.OrgId != 0 {
+			if err := tx.Model(&Organization{}).Where("id = ?", chain.OrgId).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	if err = DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, id).Error
+	return &org, err
+}
+
+func (org *Organization) Insert() error {
+	return DB.Create(org).Error
+}
+
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "status", "remain_quota", "unlimited_quota", "spend_cap", "model_limits").Updates(org).Error
+}
+
+// DeleteOrganization 删除组织及其项目，并解除成员与令牌的归属
+func DeleteOrganization(id int) error {
+	var memberIds []int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var projectIds []int
+		if err := tx.Model(&Project{}).Where("org_id = ?", id).Pluck("id", &projectIds).Error; err != nil {
+			return err
+		}
+		if len(projectIds) > 0 {
+			if err := detachTokensFromProjects(tx, projectIds); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("org_id = ?", id).Delete(&Project{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("org_id = ?", id).Pluck("id", &memberIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("org_id = ?", id).Update("org_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, userId := range memberIds {
+		_ = invalidateUserCache(userId)
+	}
+	return nil
+}
+
+func GetProjectsByOrgId(orgId int) (projects []*Project, err error) {
+	err = DB.Where("org_id = ?", orgId).Order("id desc").Find(&projects).Error
+	return projects, err
+}
+
+func GetProjectById(id int) (*Project, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	project := Project{}
+	err := DB.First(&project, id).Error
+	return &project, err
+}
+
+func (project *Project) Insert() error {
+	return DB.Create(project).Error
+}
+
+func (project *Project) Update() error {
+	return DB.Model(project).Select("name", "status", "remain_quota", "unlimited_quota", "spend_cap", "model_limits").Updates(project).Error
+}
+
+func DeleteProject(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := detachTokensFromProjects(tx, []int{id}); err != nil {
+			return err
+		}
+		return tx.Delete(&Project{}, id).Error
+	})
+	if err == nil {
+		_, _ = getProjectOrgCache().DeleteMany([]string{strconv.Itoa(id)})
+	}
+	return err
+}
+
+func detachTokensFromProjects(tx *gorm.DB, projectIds []int) error {
+	return detachTokens(tx, tx.Where("project_id IN ?", projectIds))
+}
+
+// detachTokens 清除匹配令牌的项目归属，并删除令牌缓存使其重新加载
+func detachTokens(tx *gorm.DB, query *gorm.DB) error {
+	var tokens []Token
+	if err := query.Select("id", commonKeyCol).Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	if err := tx.Model(&Token{}).Where("id IN ?", ids).Update("project_id", 0).Error; err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for _, token := range tokens {
+			_ = cacheDeleteToken(token.Key)
+		}
+	}
+	return nil
+}
+
+// SetUserOrganization 调整用户所属组织，用户令牌上不属于新组织的项目归属会被清除
+func SetUserOrganization(userId int, orgId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("org_id", orgId).Error; err != nil {
+			return err
+		}
+		stale := tx.Where("user_id = ? AND project_id <> 0", userId).
+			Where("project_id NOT IN (?)", tx.Model(&Project{}).Select("id").Where("org_id = ?", orgId))
+		return detachTokens(tx, stale)
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// OrganizationMemberSpend 组织成员的额度与消耗
+type OrganizationMemberSpend struct {
+	Id        int    `json:"id"`
+	Username  string `json:"username"`
+	Quota     int    `json:"quota"`
+	UsedQuota int    `json:"used_quota"`
+}
+
+func GetOrganizationMembers(orgId int) (members []*OrganizationMemberSpend, err error) {
+	err = DB.Model(&User{}).Where("org_id = ?", orgId).Select("id", "username", "quota", "used_quota").Order("id").Scan(&members).Error
+	return members, err
+}
+
+// ProjectTokenSpend 项目下令牌的额度与消耗
+type ProjectTokenSpend struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id"`
+	Name        string `json:"name"`
+	RemainQuota int    `json:"remain_quota"`
+	UsedQuota   int    `json:"used_quota"`
+}
+
+func GetProjectTokens(projectId int) (tokens []*ProjectTokenSpend, err error) {
+	err = DB.Model(&Token{}).Where("project_id = ?", projectId).Select("id", "user_id", "name", "remain_quota", "used_quota").Order("id").Scan(&tokens).Error
+	return tokens, err
+}
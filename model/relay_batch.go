@@ -0,0 +1,251 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+// RelayBatchIdPrefix 网关批处理 ID 前缀
+const RelayBatchIdPrefix = "batch_newapi_"
+
+const (
+	RelayBatchModeUpstream = "upstream" // 转发到上游渠道的 Batch API
+	RelayBatchModeLocal    = "local"    // 网关逐行执行
+)
+
+const (
+	RelayBatchStatusValidating = "validating"
+	RelayBatchStatusInProgress = "in_progress"
+	RelayBatchStatusFinalizing = "finalizing"
+	RelayBatchStatusCompleted  = "completed"
+	RelayBatchStatusFailed     = "failed"
+	RelayBatchStatusExpired    = "expired"
+	RelayBatchStatusCancelling = "cancelling"
+	RelayBatchStatusCancelled  = "cancelled"
+)
+
+// RelayBatch 通过网关创建的批处理任务，计费在结果产出后按行结算
+type RelayBatch struct {
+	Id               int    `json:"id" gorm:"primaryKey"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Group            string `json:"group" gorm:"type:varchar(50)"` // 创建时使用的分组，结算时计算分组倍率
+	ChannelId        int    `json:"channel_id" gorm:"index"`
+	ChannelKeyIdx    int    `json:"channel_key_idx" gorm:"default:0"`
+	Mode             string `json:"mode" gorm:"type:varchar(20);index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(20)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	UpstreamBatchId  string `json:"upstream_batch_id" gorm:"type:varchar(191);index"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	Quota            int    `json:"quota"`
+	PreConsumedQuota int    `json:"pre_consumed_quota"` // 上游模式创建时预扣的额度，结算时按实际用量多退少补
+	Settled          bool   `json:"settled" gorm:"default:false"`
+	SettlingAt       int64  `json:"-" gorm:"bigint;default:0"` // 结算租约开始时间，结算失败时清零以便重试
+	InputModels      string `json:"-" gorm:"type:text"`        // 创建时的 custom_id -> model 快照，结算时使用
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	FailReason       string `json:"fail_reason" gorm:"type:text"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt        int64  `json:"updated_at" gorm:"bigint"` // 本地执行时作为心跳
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+}
+
+// IsFinished 批处理已到达终态
+func (b *RelayBatch) IsFinished() bool {
+	switch b.Status {
+	case RelayBatchStatusCompleted, RelayBatchStatusFailed, RelayBatchStatusExpired, RelayBatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (b *RelayBatch) ToOpenAIBatch() *dto.OpenAIBatch {
+	batch := &dto.OpenAIBatch{
+		Id:               b.BatchId,
+		Object:           "batch",
+		Endpoint:         b.Endpoint,
+		InputFileId:      b.InputFileId,
+		CompletionWindow: b.CompletionWindow,
+		Status:           b.Status,
+		CreatedAt:        b.CreatedAt,
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     b.TotalCount,
+			Completed: b.CompletedCount,
+			Failed:    b.FailedCount,
+		},
+	}
+	if b.OutputFileId != "" {
+		batch.OutputFileId = &b.OutputFileId
+	}
+	if b.ErrorFileId != "" {
+		batch.ErrorFileId = &b.ErrorFileId
+	}
+	if b.FailReason != "" {
+		batch.Errors = &dto.OpenAIBatchErrors{
+			Object: "list",
+			Data:   []dto.OpenAIBatchError{{Code: "batch_failed", Message: b.FailReason}},
+		}
+	}
+	setTimestamp := func(dst **int64, v int64) {
+		if v > 0 {
+			value := v
+			*dst = &value
+		}
+	}
+	setTimestamp(&batch.InProgressAt, b.InProgressAt)
+	setTimestamp(&batch.FinalizingAt, b.FinalizingAt)
+	setTimestamp(&batch.CompletedAt, b.CompletedAt)
+	setTimestamp(&batch.FailedAt, b.FailedAt)
+	setTimestamp(&batch.CancelledAt, b.CancelledAt)
+	setTimestamp(&batch.ExpiresAt, b.ExpiresAt)
+	if b.Metadata != "" {
+		var metadata map[string]string
+		if err := common.UnmarshalJsonStr(b.Metadata, &metadata); err == nil {
+			batch.Metadata = metadata
+		}
+	}
+	return batch
+}
+
+func (b *RelayBatch) Insert() error {
+	if b.CreatedAt == 0 {
+		b.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(b).Error
+}
+
+func (b *RelayBatch) Update() error {
+	b.UpdatedAt = common.GetTimestamp()
+	return DB.Save(b).Error
+}
+
+// UpdateWithStatus 仅在状态未被其它流程修改时更新，防止取消与完成并发覆盖
+func (b *RelayBatch) UpdateWithStatus(fromStatus string) (bool, error) {
+	b.UpdatedAt = common.GetTimestamp()
+	result := DB.Model(b).Where("status = ?", fromStatus).Select("*").Updates(b)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateIfUnfinished 仅在批处理尚未到达终态时更新，防止覆盖其它节点已写入的终态
+func (b *RelayBatch) UpdateIfUnfinished() (bool, error) {
+	b.UpdatedAt = common.GetTimestamp()
+	result := DB.Model(b).Where("status NOT IN ?", []string{
+		RelayBatchStatusCompleted, RelayBatchStatusFailed, RelayBatchStatusExpired, RelayBatchStatusCancelled,
+	}).Select("*").Updates(b)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ClaimRelayBatchSettlement 抢占批处理结算租约，租约过期前其它流程无法重复结算
+func ClaimRelayBatchSettlement(id int, now int64, leaseSeconds int64) (bool, error) {
+	result := DB.Model(&RelayBatch{}).Where("id = ? AND settled = ? AND settling_at < ?", id, false, now-leaseSeconds).
+		Update("settling_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseRelayBatchSettlement 结算失败时释放租约，由下一轮轮询重试
+func ReleaseRelayBatchSettlement(id int) error {
+	return DB.Model(&RelayBatch{}).Where("id = ? AND settled = ?", id, false).Update("settling_at", 0).Error
+}
+
+// FinishRelayBatchSettlement 结算成功后记录最终额度并标记已结算
+func FinishRelayBatchSettlement(id int, quota int) error {
+	return DB.Model(&RelayBatch{}).Where("id = ?", id).Updates(map[string]any{
+		"settled":     true,
+		"settling_at": 0,
+		"quota":       quota,
+	}).Error
+}
+
+// GetInputModels 获取创建时保存的 custom_id -> model 快照
+func (b *RelayBatch) GetInputModels() map[string]string {
+	if b.InputModels == "" {
+		return nil
+	}
+	var models map[string]string
+	if err := common.UnmarshalJsonStr(b.InputModels, &models); err != nil {
+		return nil
+	}
+	return models
+}
+
+// GetRelayBatchByBatchId 获取用户的批处理任务
+func GetRelayBatchByBatchId(userId int, batchId string) (*RelayBatch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch RelayBatch
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetRelayBatchById(id int) (*RelayBatch, error) {
+	var batch RelayBatch
+	err := DB.First(&batch, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserRelayBatches 按创建时间倒序列出用户批处理，after 为分页游标
+func GetUserRelayBatches(userId int, after string, limit int) ([]*RelayBatch, error) {
+	var batches []*RelayBatch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var cursor RelayBatch
+		err := DB.Where("user_id = ? AND batch_id = ?", userId, after).First(&cursor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	err := query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnfinishedRelayBatches 获取未结束的批处理，用于轮询上游状态与恢复本地执行
+func GetUnfinishedRelayBatches(mode string, limit int) ([]*RelayBatch, error) {
+	var batches []*RelayBatch
+	err := DB.Where("mode = ? AND status NOT IN ?", mode, []string{
+		RelayBatchStatusCompleted, RelayBatchStatusFailed, RelayBatchStatusExpired, RelayBatchStatusCancelled,
+	}).Order("id").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnsettledUpstreamRelayBatches 获取已结束但尚未结算的上游批处理，用于重试结算
+func GetUnsettledUpstreamRelayBatches(limit int) ([]*RelayBatch, error) {
+	var batches []*RelayBatch
+	err := DB.Where("mode = ? AND settled = ? AND status IN ?", RelayBatchModeUpstream, false, []string{
+		RelayBatchStatusCompleted, RelayBatchStatusFailed, RelayBatchStatusExpired, RelayBatchStatusCancelled,
+	}).Order("id").Limit(limit).Find(&batches).Error
+	return batches, err
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+// RelayFileIdPrefix 网关自有文件 ID 前缀，用于在请求体中识别需要改写的 file_id
+const RelayFileIdPrefix = "file-newapi-"
+
+const (
+	RelayFileStatusUploaded  = "uploaded"
+	RelayFileStatusProcessed = "processed"
+	RelayFileStatusError     = "error"
+	RelayFileStatusDeleted   = "deleted"
+)
+
+// RelayFile 通过网关上传的文件，记录归属令牌/用户以及所绑定的上游渠道
+type RelayFile struct {
+	Id             int    `json:"id" gorm:"primaryKey"`
+	FileId         string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TokenId        int    `json:"token_id" gorm:"index"`
+	ChannelId      int    `json:"channel_id" gorm:"index"`
+	ChannelKeyIdx  int    `json:"channel_key_idx" gorm:"default:0"` // 多 Key 渠道上传时使用的 key 索引
+	UpstreamFileId string `json:"upstream_file_id" gorm:"type:varchar(191);index"`
+	Filename       string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose        string `json:"purpose" gorm:"type:varchar(64);index"`
+	Bytes          int64  `json:"bytes"`
+	Status         string `json:"status" gorm:"type:varchar(20);index"`
+	// 禁止返回给用户，本地存储路径
+	LocalPath string `json:"-" gorm:"type:varchar(512)"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;default:0"`
+	// 过期清理失败次数及下次重试时间，超过上限后不再自动清理
+	CleanupAttempts int   `json:"-" gorm:"default:0"`
+	NextCleanupAt   int64 `json:"-" gorm:"bigint;default:0"`
+}
+
+func (f *RelayFile) ToOpenAIFile() *dto.OpenAIFile {
+	file := &dto.OpenAIFile{
+		Id:        f.FileId,
+		Object:    "file",
+		Bytes:     f.Bytes,
+		CreatedAt: f.CreatedAt,
+		Filename:  f.Filename,
+		Purpose:   f.Purpose,
+		Status:    f.Status,
+	}
+	if f.ExpiresAt > 0 {
+		file.ExpiresAt = &f.ExpiresAt
+	}
+	return file
+}
+
+// IsLocal 网关本地生成的文件（如批处理输出），没有对应的上游文件
+func (f *RelayFile) IsLocal() bool {
+	return f.UpstreamFileId == ""
+}
+
+func (f *RelayFile) Insert() error {
+	if f.CreatedAt == 0 {
+		f.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(f).Error
+}
+
+func (f *RelayFile) Update() error {
+	return DB.Save(f).Error
+}
+
+// GetRelayFileByFileId 获取用户的文件，已删除的文件视为不存在
+func GetRelayFileByFileId(userId int, fileId string) (*RelayFile, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file RelayFile
+	err := DB.Where("user_id = ? AND file_id = ? AND status <> ?", userId, fileId, RelayFileStatusDeleted).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetRelayFileByUpstreamFileId 通过上游文件 ID 反查用户的网关文件，用于改写上游响应中的文件引用
+func GetRelayFileByUpstreamFileId(userId int, channelId int, upstreamFileId string) (*RelayFile, error) {
+	var file RelayFile
+	err := DB.Where("user_id = ? AND channel_id = ? AND upstream_file_id = ? AND status <> ?", userId, channelId, upstreamFileId, RelayFileStatusDeleted).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetRelayFilesByFileIds 批量获取用户的文件，用于改写请求体中的 file_id
+func GetRelayFilesByFileIds(userId int, fileIds []string) ([]*RelayFile, error) {
+	if len(fileIds) == 0 {
+		return nil, nil
+	}
+	var files []*RelayFile
+	err := DB.Where("user_id = ? AND file_id IN ? AND status <> ?", userId, fileIds, RelayFileStatusDeleted).Find(&files).Error
+	return files, err
+}
+
+// GetUserRelayFiles 按创建时间倒序列出用户文件，after 为分页游标（上一页最后一个 file_id）
+func GetUserRelayFiles(userId int, purpose string, after string, limit int) ([]*RelayFile, error) {
+	var files []*RelayFile
+	query := DB.Where("user_id = ? AND status <> ?", userId, RelayFileStatusDeleted)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var cursor RelayFile
+		err := DB.Where("user_id = ? AND file_id = ?", userId, after).First(&cursor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	err := query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func MarkRelayFileDeleted(id int) error {
+	return DB.Model(&RelayFile{}).Where("id = ?", id).Updates(map[string]any{
+		"status":     RelayFileStatusDeleted,
+		"local_path": "",
+	}).Error
+}
+
+// GetExpiredRelayFiles 获取已过期但尚未删除的文件，跳过处于退避期或已达到重试上限的文件
+func GetExpiredRelayFiles(now int64, maxAttempts int, limit int) ([]*RelayFile, error) {
+	var files []*RelayFile
+	err := DB.Where("expires_at > 0 AND expires_at <= ? AND status <> ?", now, RelayFileStatusDeleted).
+		Where("cleanup_attempts < ? AND next_cleanup_at <= ?", maxAttempts, now).
+		Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// MarkRelayFileCleanupFailed 记录一次过期清理失败及下次重试时间
+func MarkRelayFileCleanupFailed(id int, attempts int, nextCleanupAt int64) error {
+	return DB.Model(&RelayFile{}).Where("id = ?", id).Updates(map[string]any{
+		"cleanup_attempts": attempts,
+		"next_cleanup_at":  nextCleanupAt,
+	}).Error
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// StoredResponse 网关保存的 /v1/responses 响应，记录归属令牌、生成渠道以及本轮的输入与输出条目
+type StoredResponse struct {
+	Id                 int    `json:"id" gorm:"primaryKey"`
+	ResponseId         string `json:"response_id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id" gorm:"index"`
+	ChannelId          int    `json:"channel_id" gorm:"index"`
+	ChannelKeyIdx      int    `json:"channel_key_idx" gorm:"default:0"` // 多 Key 渠道生成响应时使用的 key 索引
+	Model              string `json:"model" gorm:"type:varchar(255)"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(191);index"`
+	// UpstreamStored 响应同时保存在上游（原生 Responses 渠道且未设置 store=false），可固定渠道由上游解析
+	UpstreamStored bool `json:"upstream_stored" gorm:"default:false"`
+	// InputItems 本轮请求的 input 条目（JSON 数组），不含展开的历史
+	InputItems string `json:"-" gorm:"type:text"`
+	// OutputItems 本轮响应的 output 条目（JSON 数组）
+	OutputItems string `json:"-" gorm:"type:text"`
+	// Body 完整的响应对象（JSON），用于 GET /v1/responses/{id}
+	Body      string `json:"-" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;default:0;index"`
+}
+
+func (r *StoredResponse) Insert() error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(r).Error
+}
+
+// IsExpired 是否已超过保存期限（清理任务尚未删除）
+func (r *StoredResponse) IsExpired(now int64) bool {
+	return r.ExpiresAt > 0 && r.ExpiresAt <= now
+}
+
+// GetStoredResponse 获取令牌保存的响应，已过期的响应视为不存在
+func GetStoredResponse(tokenId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, errors.New("response id is empty")
+	}
+	var stored StoredResponse
+	err := DB.Where("token_id = ? AND response_id = ? AND (expires_at = 0 OR expires_at > ?)", tokenId, responseId, common.GetTimestamp()).
+		First(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func DeleteStoredResponse(id int) error {
+	return DB.Delete(&StoredResponse{}, id).Error
+}
+
+// DeleteExpiredStoredResponses 删除已过期的响应，返回删除条数
+func DeleteExpiredStoredResponses(now int64, limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&StoredResponse{}).Where("expires_at > 0 AND expires_at <= ?", now).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Where("id IN ?", ids).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
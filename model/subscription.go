@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/pkg/cachex"
 	"github.com/samber/hot"
 	"gorm.io/gorm"
@@ -518,6 +519,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 	var logMoney float64
 	var logPaymentMethod string
 	var upgradeGroup string
+	var createdSub *UserSubscription
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		var order SubscriptionOrder
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(&order).Error; err != nil {
@@ -537,7 +539,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 			// still allow completion for already purchased orders
 		}
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		_, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
+		createdSub, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
 		if err != nil {
 			return err
 		}
@@ -568,9 +570,25 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 		msg := fmt.Sprintf("订阅购买成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, logMoney, logPaymentMethod)
 		RecordLog(logUserId, LogTypeTopup, msg)
 	}
+	if createdSub != nil {
+		enqueueSubscriptionEvent(constant.WebhookEventSubscriptionActivated, createdSub, logPlanTitle)
+	}
 	return nil
 }
 
+// enqueueSubscriptionEvent 推送订阅生效或到期事件
+func enqueueSubscriptionEvent(event string, sub *UserSubscription, planTitle string) {
+	EnqueueWebhookEvent(event, map[string]interface{}{
+		"user_id":         sub.UserId,
+		"subscription_id": sub.Id,
+		"plan_id":         sub.PlanId,
+		"plan_title":      planTitle,
+		"source":          sub.Source,
+		"start_time":      sub.StartTime,
+		"end_time":        sub.EndTime,
+	})
+}
+
 func upsertSubscriptionTopUpTx(tx *gorm.DB, order *SubscriptionOrder) error {
 	if tx == nil || order == nil {
 		return errors.New("invalid subscription order")
@@ -636,13 +654,16 @@ func AdminBindSubscription(userId int, planId int, sourceNote string) (string, e
 	if err != nil {
 		return "", err
 	}
+	var sub *UserSubscription
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		_, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "admin")
+		created, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "admin")
+		sub = created
 		return err
 	})
 	if err != nil {
 		return "", err
 	}
+	enqueueSubscriptionEvent(constant.WebhookEventSubscriptionActivated, sub, plan.Title)
 	if strings.TrimSpace(plan.UpgradeGroup) != "" {
 		_ = UpdateUserGroupCache(userId, plan.UpgradeGroup)
 		return fmt.Sprintf("用户分组将升级到 %s", plan.UpgradeGroup), nil
@@ -888,6 +909,16 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 		if cacheGroup != "" {
 			_ = UpdateUserGroupCache(userId, cacheGroup)
 		}
+		for i := range subs {
+			if subs[i].UserId != userId {
+				continue
+			}
+			planTitle := ""
+			if plan, err := GetSubscriptionPlanById(subs[i].PlanId); err == nil {
+				planTitle = plan.Title
+			}
+			enqueueSubscriptionEvent(constant.WebhookEventSubscriptionExpired, &subs[i], planTitle)
+		}
 	}
 	return expiredCount, nil
 }
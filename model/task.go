@@ -63,6 +63,11 @@ type Task struct {
 	Data        json.RawMessage `json:"data" gorm:"type:json"`
 }
 
+// GetBudgetChain 任务预扣费时所属的组织与项目
+func (t *Task) GetBudgetChain() BudgetChain {
+	return BudgetChain{OrgId: t.PrivateData.OrgId, ProjectId: t.PrivateData.ProjectId}
+}
+
 func (t *Task) SetData(data any) {
 	b, _ := json.Marshal(data)
 	t.Data = json.RawMessage(b)
@@ -96,7 +101,10 @@ func (m Properties) Value() (driver.Value, error) {
 }
 
 type TaskPrivateData struct {
-	Key string `json:"key,omitempty"`
+	Key       string `json:"key,omitempty"`
+	TokenId   int    `json:"token_id,omitempty"`   // 创建任务的令牌，微调任务按令牌区分归属
+	OrgId     int    `json:"org_id,omitempty"`     // 预扣费所属组织，失败退款时退还组织与项目额度
+	ProjectId int    `json:"project_id,omitempty"` // 预扣费所属项目
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -141,6 +149,10 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 			properties.OriginModelName = relayInfo.OriginModelName
 		}
 	}
+	if relayInfo != nil && !relayInfo.IsPlayground {
+		privateData.OrgId = relayInfo.OrgId
+		privateData.ProjectId = relayInfo.ProjectId
+	}
 
 	t := &Task{
 		UserId:      relayInfo.UserId,
@@ -297,6 +309,17 @@ func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	return task, nil
 }
 
+// GetUserTasksByPlatform 按创建时间倒序列出用户某平台的任务，afterId > 0 时返回 id 更小的任务
+func GetUserTasksByPlatform(userId int, platform constant.TaskPlatform, afterId int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("user_id = ? AND platform = ?", userId, platform)
+	if afterId > 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
 func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
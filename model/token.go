@@ -3,32 +3,45 @@ package model
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
 )
 
 type Token struct {
-	Id                 int            `json:"id"`
-	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status             int            `json:"status" gorm:"default:1"`
-	Name               string         `json:"name" gorm:"index" `
-	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
-	AccessedTime       int64          `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime        int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota        int            `json:"remain_quota" gorm:"default:0"`
-	UnlimitedQuota     bool           `json:"unlimited_quota"`
-	ModelLimitsEnabled bool           `json:"model_limits_enabled"`
-	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
-	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
-	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
-	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Id                  int            `json:"id"`
+	UserId              int            `json:"user_id" gorm:"index"`
+	Key                 string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Status              int            `json:"status" gorm:"default:1"`
+	Name                string         `json:"name" gorm:"index" `
+	CreatedTime         int64          `json:"created_time" gorm:"bigint"`
+	AccessedTime        int64          `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime         int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota         int            `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota      bool           `json:"unlimited_quota"`
+	ModelLimitsEnabled  bool           `json:"model_limits_enabled"`
+	ModelLimits         string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	AllowIps            *string        `json:"allow_ips" gorm:"default:''"`
+	UsedQuota           int            `json:"used_quota" gorm:"default:0"` // used quota
+	Group               string         `json:"group" gorm:"default:''"`
+	CrossGroupRetry     bool           `json:"cross_group_retry"`                                      // 跨分组重试，仅auto分组有效
+	ResponseCacheTTL    int            `json:"response_cache_ttl" gorm:"default:0"`                    // 响应缓存时长（秒），0 跟随分组设置，-1 不缓存
+	ProjectId           int            `json:"project_id" gorm:"index;default:0"`                      // 所属项目，0 表示不属于任何项目
+	BudgetPeriod        string         `json:"budget_period" gorm:"type:varchar(16);default:'never'"`  // 周期预算：never/daily/weekly/monthly，按 UTC 对齐
+	BudgetAmount        int            `json:"budget_amount" gorm:"default:0"`                         // 每个周期的额度，与 RemainQuota 同时生效
+	BudgetRollover      string         `json:"budget_rollover" gorm:"type:varchar(16);default:'none'"` // none 不结转，carry_over 结转未用完的额度（最多一个周期）
+	BudgetRemain        int            `json:"budget_remain" gorm:"default:0"`                         // 当前周期剩余额度
+	BudgetNextResetTime int64          `json:"budget_next_reset_time" gorm:"bigint;default:0;index"`
+	Scopes              string         `json:"scopes" gorm:"type:text"`                      // 接口格式与能力范围，详见dto.TokenScopes
+	EndUserRateLimit    int            `json:"end_user_rate_limit" gorm:"default:0"`         // 每个终端用户每分钟最多请求数，0 不限制
+	EndUserQuotaLimit   int            `json:"end_user_quota_limit" gorm:"default:0"`        // 每个终端用户每日（UTC）最多消耗额度，0 不限制
+	DelegatedRevokedAt  int64          `json:"delegated_revoked_at" gorm:"bigint;default:0"` // 不晚于该时间签发的子令牌全部失效
+	DeletedAt           gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
@@ -267,9 +280,21 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 func (token *Token) Insert() error {
 	var err error
 	err = DB.Create(token).Error
+	if err == nil {
+		enqueueTokenEvent(constant.WebhookEventTokenCreated, token)
+	}
 	return err
 }
 
+// enqueueTokenEvent 推送令牌创建或删除事件，不包含令牌 key
+func enqueueTokenEvent(event string, token *Token) {
+	EnqueueWebhookEvent(event, map[string]interface{}{
+		"token_id": token.Id,
+		"user_id":  token.UserId,
+		"name":     token.Name,
+	})
+}
+
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() (err error) {
 	defer func() {
@@ -283,10 +308,25 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache_ttl", "project_id",
+		"budget_period", "budget_amount", "budget_rollover", "budget_remain", "budget_next_reset_time", "scopes",
+		"end_user_rate_limit", "end_user_quota_limit").Updates(token).Error
 	return err
 }
 
+// RevokeDelegatedTokens 使该令牌此前签发的所有子令牌失效，token.Key 需为完整 key
+func (token *Token) RevokeDelegatedTokens() error {
+	token.DelegatedRevokedAt = common.GetTimestamp()
+	if err := DB.Model(token).Update("delegated_revoked_at", token.DelegatedRevokedAt).Error; err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		// 同步写入缓存，撤销在返回前即对所有节点生效
+		return cacheSetTokenField(token.Key, "delegated_revoked_at", strconv.FormatInt(token.DelegatedRevokedAt, 10))
+	}
+	return nil
+}
+
 func (token *Token) SelectUpdate() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
@@ -357,7 +397,11 @@ func DeleteTokenById(id int, userId int) (err error) {
 	if err != nil {
 		return err
 	}
-	return token.Delete()
+	if err = token.Delete(); err != nil {
+		return err
+	}
+	enqueueTokenEvent(constant.WebhookEventTokenDeleted, &token)
+	return nil
 }
 
 func IncreaseTokenQuota(id int, key string, quota int) (err error) {
@@ -384,6 +428,7 @@ func increaseTokenQuota(id int, quota int) (err error) {
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
 			"used_quota":    gorm.Expr("used_quota - ?", quota),
+			"budget_remain": gorm.Expr("CASE WHEN budget_amount > 0 THEN budget_remain + ? ELSE budget_remain END", quota),
 			"accessed_time": common.GetTimestamp(),
 		},
 	).Error
@@ -414,6 +459,7 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
 			"used_quota":    gorm.Expr("used_quota + ?", quota),
+			"budget_remain": gorm.Expr("CASE WHEN budget_amount > 0 THEN budget_remain - ? ELSE budget_remain END", quota),
 			"accessed_time": common.GetTimestamp(),
 		},
 	).Error
@@ -457,6 +503,9 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 			}
 		})
 	}
+	for i := range tokens {
+		enqueueTokenEvent(constant.WebhookEventTokenDeleted, &tokens[i])
+	}
 
 	return len(tokens), nil
 }
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// Token budget rollover policy
+const (
+	TokenBudgetRolloverNone      = "none"
+	TokenBudgetRolloverCarryOver = "carry_over"
+)
+
+// NormalizeTokenBudgetPeriod 令牌预算只支持自然日、周、月，其余视为不启用
+func NormalizeTokenBudgetPeriod(period string) string {
+	switch strings.TrimSpace(period) {
+	case SubscriptionResetDaily, SubscriptionResetWeekly, SubscriptionResetMonthly:
+		return strings.TrimSpace(period)
+	default:
+		return SubscriptionResetNever
+	}
+}
+
+// HasBudget 是否启用了周期预算
+func (token *Token) HasBudget() bool {
+	return token.BudgetAmount > 0 && NormalizeTokenBudgetPeriod(token.BudgetPeriod) != SubscriptionResetNever
+}
+
+// calcTokenBudgetNextReset 与订阅重置使用相同的对齐规则，统一按 UTC 计算
+func calcTokenBudgetNextReset(base int64, period string) int64 {
+	return calcNextResetTime(time.Unix(base, 0).UTC(), &SubscriptionPlan{QuotaResetPeriod: period}, 0)
+}
+
+// ValidateBudget 校验并规范化预算配置
+func (token *Token) ValidateBudget() error {
+	token.BudgetPeriod = NormalizeTokenBudgetPeriod(token.BudgetPeriod)
+	if token.BudgetRollover != TokenBudgetRolloverCarryOver {
+		token.BudgetRollover = TokenBudgetRolloverNone
+	}
+	if token.BudgetAmount < 0 {
+		return errors.New("周期预算额度不能为负数")
+	}
+	return nil
+}
+
+// ResetBudgetWindow 预算配置变更时重新开始当前周期
+func (token *Token) ResetBudgetWindow() {
+	if !token.HasBudget() {
+		token.BudgetRemain = 0
+		token.BudgetNextResetTime = 0
+		return
+	}
+	token.BudgetRemain = token.BudgetAmount
+	token.BudgetNextResetTime = calcTokenBudgetNextReset(common.GetTimestamp(), token.BudgetPeriod)
+}
+
+// BudgetChanged 判断预算配置是否与已保存的令牌不同
+func (token *Token) BudgetChanged(saved *Token) bool {
+	return token.BudgetPeriod != saved.BudgetPeriod || token.BudgetAmount != saved.BudgetAmount
+}
+
+// nextBudgetRemain 周期结束时的新余额：不结转时恢复为周期额度，结转时最多再带上一整个周期的额度
+func (token *Token) nextBudgetRemain() int {
+	if token.BudgetRollover != TokenBudgetRolloverCarryOver {
+		return token.BudgetAmount
+	}
+	carry := token.BudgetRemain
+	if carry < 0 {
+		carry = 0
+	}
+	if carry > token.BudgetAmount {
+		carry = token.BudgetAmount
+	}
+	return token.BudgetAmount + carry
+}
+
+// resetTokenBudgetTx 推进到包含 now 的周期并刷新余额，以原重置时间作为条件防止并发重复重置
+func resetTokenBudgetTx(tx *gorm.DB, token *Token, now int64) (bool, error) {
+	if !token.HasBudget() || token.BudgetNextResetTime <= 0 || token.BudgetNextResetTime > now {
+		return false, nil
+	}
+	next := token.BudgetNextResetTime
+	skipped := false
+	for {
+		following := calcTokenBudgetNextReset(next, token.BudgetPeriod)
+		if following <= 0 || following > now {
+			next = following
+			break
+		}
+		next = following
+		skipped = true
+	}
+	remain := token.nextBudgetRemain()
+	if skipped {
+		// 跨过了完整的空闲周期，上一周期的余额不再结转
+		remain = token.BudgetAmount
+	}
+	result := tx.Model(&Token{}).
+		Where("id = ? AND budget_next_reset_time = ?", token.Id, token.BudgetNextResetTime).
+		Updates(map[string]interface{}{
+			"budget_remain":          remain,
+			"budget_next_reset_time": next,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	token.BudgetRemain = remain
+	token.BudgetNextResetTime = next
+	return true, nil
+}
+
+// ResetTokenBudgetIfDue 请求时发现周期已结束则立即重置，不必等待后台任务
+func ResetTokenBudgetIfDue(token *Token) error {
+	reset, err := resetTokenBudgetTx(DB, token, common.GetTimestamp())
+	if err != nil {
+		return err
+	}
+	if !reset {
+		// 其它请求或后台任务已完成重置，重新读取最新余额
+		if token.HasBudget() && token.BudgetNextResetTime <= common.GetTimestamp() {
+			latest, err := GetTokenByKey(token.Key, true)
+			if err != nil {
+				return err
+			}
+			token.BudgetRemain = latest.BudgetRemain
+			token.BudgetNextResetTime = latest.BudgetNextResetTime
+		}
+		return nil
+	}
+	if common.RedisEnabled {
+		if err := cacheDeleteToken(token.Key); err != nil {
+			common.SysLog("failed to delete token cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// ResetDueTokenBudgets 批量重置已到期的令牌预算
+func ResetDueTokenBudgets(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	now := common.GetTimestamp()
+	var tokens []*Token
+	if err := DB.Where("budget_next_reset_time > 0 AND budget_next_reset_time <= ? AND budget_amount > 0", now).
+		Order("budget_next_reset_time asc").
+		Limit(limit).
+		Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	resetCount := 0
+	for _, token := range tokens {
+		reset, err := resetTokenBudgetTx(DB, token, now)
+		if err != nil {
+			return resetCount, err
+		}
+		if !reset {
+			continue
+		}
+		resetCount++
+		if common.RedisEnabled {
+			if err := cacheDeleteToken(token.Key); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		}
+	}
+	return resetCount, nil
+}
@@ -33,7 +33,8 @@ func cacheIncrTokenQuota(key string, increment int64) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	// 未启用周期预算的令牌不读取该字段，缓存中的值无需与数据库保持一致
+	return common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFieldBudgetRemain, increment)
 }
 
 func cacheDecrTokenQuota(key string, decrement int64) error {
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// tokenScopeRelayFormats 令牌范围中可以配置的接口格式
+var tokenScopeRelayFormats = []string{
+	string(types.RelayFormatOpenAI),
+	types.RelayFormatClaude,
+	types.RelayFormatGemini,
+	types.RelayFormatOpenAIResponses,
+	types.RelayFormatOpenAIResponsesCompaction,
+	types.RelayFormatOpenAIAudio,
+	types.RelayFormatOpenAIImage,
+	types.RelayFormatOpenAIRealtime,
+	types.RelayFormatRerank,
+	types.RelayFormatEmbedding,
+	types.RelayFormatTask,
+	types.RelayFormatMjProxy,
+	types.RelayFormatOpenAIBatch,
+	types.RelayFormatOpenAIFile,
+	types.RelayFormatOpenAIFineTuning,
+	types.RelayFormatDelegatedToken,
+}
+
+func (token *Token) GetScopes() *dto.TokenScopes {
+	scopes := &dto.TokenScopes{}
+	if token.Scopes == "" {
+		return scopes
+	}
+	if err := common.UnmarshalJsonStr(token.Scopes, scopes); err != nil {
+		common.SysLog(fmt.Sprintf("failed to unmarshal token scopes: token_id=%d, error=%v", token.Id, err))
+		// 解析失败时拒绝所有格式，避免范围被意外放开
+		return &dto.TokenScopes{RelayFormats: []string{""}}
+	}
+	return scopes
+}
+
+// ValidateScopes 校验并规范化令牌范围，未做任何限制时清空
+func (token *Token) ValidateScopes() error {
+	token.Scopes = strings.TrimSpace(token.Scopes)
+	if token.Scopes == "" {
+		return nil
+	}
+	scopes := &dto.TokenScopes{}
+	if err := common.UnmarshalJsonStr(token.Scopes, scopes); err != nil {
+		return fmt.Errorf("令牌范围格式错误: %v", err)
+	}
+	formats := make([]string, 0, len(scopes.RelayFormats))
+	for _, format := range scopes.RelayFormats {
+		format = strings.TrimSpace(format)
+		if !slices.Contains(tokenScopeRelayFormats, format) {
+			return fmt.Errorf("不支持的接口格式: %s", format)
+		}
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	scopes.RelayFormats = formats
+	if scopes.MaxOutputTokens < 0 {
+		return fmt.Errorf("最大输出 token 数不能为负数")
+	}
+	switch scopes.StreamMode {
+	case dto.TokenStreamModeAny, dto.TokenStreamModeOnly, dto.TokenStreamModeNonStream:
+	default:
+		return fmt.Errorf("不支持的流式模式: %s", scopes.StreamMode)
+	}
+	if !scopes.IsRestricted() {
+		token.Scopes = ""
+		return nil
+	}
+	data, err := common.Marshal(scopes)
+	if err != nil {
+		return err
+	}
+	token.Scopes = string(data)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 
 	"github.com/shopspring/decimal"
@@ -35,6 +36,18 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// EnqueueTopUpCompletedEvent 充值到账后推送 topup.completed 事件
+func EnqueueTopUpCompletedEvent(topUp *TopUp, quota int) {
+	EnqueueWebhookEvent(constant.WebhookEventTopUpCompleted, map[string]interface{}{
+		"user_id":        topUp.UserId,
+		"trade_no":       topUp.TradeNo,
+		"payment_method": topUp.PaymentMethod,
+		"amount":         topUp.Amount,
+		"money":          topUp.Money,
+		"quota":          quota,
+	})
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
@@ -100,6 +113,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	EnqueueTopUpCompletedEvent(topUp, int(quota))
 
 	return nil
 }
@@ -249,6 +263,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 	var userId int
 	var quotaToAdd int
 	var payMoney float64
+	var completed *TopUp
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		topUp := &TopUp{}
@@ -295,6 +310,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
+		completed = topUp
 		return nil
 	})
 
@@ -304,6 +320,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	if completed != nil {
+		EnqueueTopUpCompletedEvent(completed, quotaToAdd)
+	}
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -373,6 +392,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	EnqueueTopUpCompletedEvent(topUp, int(quota))
 
 	return nil
 }
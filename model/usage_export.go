@@ -0,0 +1,154 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// UsageExportFilter 用量导出的筛选条件，零值表示不限制；quota_data 只支持时间、用户与模型
+type UsageExportFilter struct {
+	StartTimestamp int64
+	EndTimestamp   int64
+	LogType        int
+	UserId         int
+	Username       string
+	TokenName      string
+	ModelName      string
+	Channel        int
+	Group          string
+}
+
+func (f *UsageExportFilter) logQuery() *gorm.DB {
+	tx := LOG_DB.Model(&Log{})
+	if f.LogType != LogTypeUnknown {
+		tx = tx.Where("type = ?", f.LogType)
+	}
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", f.EndTimestamp)
+	}
+	if f.UserId != 0 {
+		tx = tx.Where("user_id = ?", f.UserId)
+	}
+	if f.Username != "" {
+		tx = tx.Where("username = ?", f.Username)
+	}
+	if f.TokenName != "" {
+		tx = tx.Where("token_name = ?", f.TokenName)
+	}
+	if f.ModelName != "" {
+		tx = tx.Where("model_name = ?", f.ModelName)
+	}
+	if f.Channel != 0 {
+		tx = tx.Where("channel_id = ?", f.Channel)
+	}
+	if f.Group != "" {
+		tx = tx.Where(logGroupCol+" = ?", f.Group)
+	}
+	return tx
+}
+
+func (f *UsageExportFilter) quotaDataQuery() *gorm.DB {
+	tx := DB.Model(&QuotaData{})
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", f.EndTimestamp)
+	}
+	if f.UserId != 0 {
+		tx = tx.Where("user_id = ?", f.UserId)
+	}
+	if f.Username != "" {
+		tx = tx.Where("username = ?", f.Username)
+	}
+	if f.ModelName != "" {
+		tx = tx.Where("model_name = ?", f.ModelName)
+	}
+	return tx
+}
+
+// ForEachLogBatch 按 id 递增分批读取日志，导出大范围数据时不会一次性载入内存
+func ForEachLogBatch(filter *UsageExportFilter, batchSize int, fn func(logs []*Log) error) error {
+	lastId := 0
+	for {
+		var logs []*Log
+		if err := filter.logQuery().Where("id > ?", lastId).Order("id asc").Limit(batchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+}
+
+// ForEachQuotaDataBatch 按 id 递增分批读取按小时汇总的用量数据
+func ForEachQuotaDataBatch(filter *UsageExportFilter, batchSize int, fn func(data []*QuotaData) error) error {
+	lastId := 0
+	for {
+		var data []*QuotaData
+		if err := filter.quotaDataQuery().Where("id > ?", lastId).Order("id asc").Limit(batchSize).Find(&data).Error; err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		if len(data) < batchSize {
+			return nil
+		}
+		lastId = data[len(data)-1].Id
+	}
+}
+
+// UsageStatementRow 账单明细：一个用户在账期内某个模型的用量合计
+type UsageStatementRow struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	ModelName        string `json:"model_name"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// GetUsageStatementRows 按用户与模型汇总 [startTimestamp, endTimestamp) 内的消费日志
+func GetUsageStatementRows(startTimestamp int64, endTimestamp int64) ([]*UsageStatementRow, error) {
+	var rows []*UsageStatementRow
+	err := LOG_DB.Model(&Log{}).
+		Select("user_id, username, model_name, count(*) as requests, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("type = ? AND created_at >= ? AND created_at < ?", LogTypeConsume, startTimestamp, endTimestamp).
+		Group("user_id, username, model_name").
+		Order("user_id asc, model_name asc").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// GetUsersForStatement 读取生成账单所需的用户邮箱与所属组织
+func GetUsersForStatement(userIds []int) ([]*User, error) {
+	var users []*User
+	if len(userIds) == 0 {
+		return users, nil
+	}
+	err := DB.Select("id", "username", "email", "org_id").Where("id IN ?", userIds).Find(&users).Error
+	return users, err
+}
+
+func GetOrganizationsByIds(ids []int) ([]*Organization, error) {
+	var orgs []*Organization
+	if len(ids) == 0 {
+		return orgs, nil
+	}
+	err := DB.Where("id IN ?", ids).Find(&orgs).Error
+	return orgs, err
+}
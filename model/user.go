@@ -43,6 +43,7 @@ type User struct {
 	AffQuota         int            `json:"aff_quota" gorm:"type:int;default:0;column:aff_quota"`           // 邀请剩余额度
 	AffHistoryQuota  int            `json:"aff_history_quota" gorm:"type:int;default:0;column:aff_history"` // 邀请历史额度
 	InviterId        int            `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	OrgId            int            `json:"org_id" gorm:"type:int;column:org_id;index;default:0"` // 所属组织，0 表示不属于任何组织
 	DeletedAt        gorm.DeletedAt `gorm:"index"`
 	LinuxDOId        string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	LinuxDOUsername  string         `json:"linux_do_username" gorm:"column:linux_do_username;type:varchar(64)"`
@@ -64,6 +65,7 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+		OrgId:    user.OrgId,
 	}
 	return cache
 }
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	WebhookDeliveryStatusPending = "pending"
+	WebhookDeliveryStatusSuccess = "success"
+	WebhookDeliveryStatusFailed  = "failed"
+)
+
+// WebhookSubscription 事件订阅方，按事件类型过滤后向其 URL 推送签名后的事件
+type WebhookSubscription struct {
+	Id     int    `json:"id" gorm:"primaryKey"`
+	Name   string `json:"name" gorm:"type:varchar(128)"`
+	Url    string `json:"url" gorm:"type:varchar(1024);not null"`
+	Secret string `json:"-" gorm:"type:varchar(256)"`
+	// 逗号分隔的事件类型，留空表示订阅全部事件
+	Events      string `json:"events" gorm:"type:varchar(1024)"`
+	Enabled     bool   `json:"enabled"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// WebhookDelivery 一次事件投递，既是持久化的重试队列也是投递记录
+type WebhookDelivery struct {
+	Id             int    `json:"id" gorm:"primaryKey"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index"`
+	EventId        string `json:"event_id" gorm:"type:varchar(64);index"`
+	Event          string `json:"event" gorm:"type:varchar(64);index"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_webhook_deliveries_due,priority:2"`
+	ResponseCode   int    `json:"response_code"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	DeliveredAt    int64  `json:"delivered_at" gorm:"bigint"`
+}
+
+// WebhookEventPayload 推送给订阅方的事件正文，签名基于该正文的原始字节
+type WebhookEventPayload struct {
+	Id        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt int64       `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+func (s *WebhookSubscription) GetEvents() []string {
+	events := make([]string, 0)
+	for _, event := range strings.Split(s.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Subscribes 判断订阅方是否订阅了该事件，ping 总是投递
+func (s *WebhookSubscription) Subscribes(event string) bool {
+	events := s.GetEvents()
+	return len(events) == 0 || slices.Contains(events, event) || event == constant.WebhookEventPing
+}
+
+func (s *WebhookSubscription) Insert() error {
+	now := common.GetTimestamp()
+	s.CreatedTime = now
+	s.UpdatedTime = now
+	return DB.Create(s).Error
+}
+
+func (s *WebhookSubscription) Update() error {
+	s.UpdatedTime = common.GetTimestamp()
+	return DB.Model(s).Select("name", "url", "secret", "events", "enabled", "updated_time").Updates(s).Error
+}
+
+func DeleteWebhookSubscriptionById(id int) error {
+	return DB.Delete(&WebhookSubscription{}, "id = ?", id).Error
+}
+
+func GetAllWebhookSubscriptions() ([]*WebhookSubscription, error) {
+	var subs []*WebhookSubscription
+	err := DB.Order("id asc").Find(&subs).Error
+	return subs, err
+}
+
+func GetWebhookSubscriptionById(id int) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	err := DB.First(&sub, "id = ?", id).Error
+	return &sub, err
+}
+
+// CreateWebhookDeliveries 为每个订阅方写入一条待投递记录，同一事件共用事件 ID 与正文
+func CreateWebhookDeliveries(subs []*WebhookSubscription, event string, data interface{}) ([]*WebhookDelivery, error) {
+	if len(subs) == 0 {
+		return nil, nil
+	}
+	now := common.GetTimestamp()
+	eventId := "evt_" + common.GetRandomString(24)
+	payload, err := common.Marshal(WebhookEventPayload{
+		Id:        eventId,
+		Event:     event,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]*WebhookDelivery, 0, len(subs))
+	for _, sub := range subs {
+		deliveries = append(deliveries, &WebhookDelivery{
+			SubscriptionId: sub.Id,
+			EventId:        eventId,
+			Event:          event,
+			Payload:        string(payload),
+			Status:         WebhookDeliveryStatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	return deliveries, DB.Create(&deliveries).Error
+}
+
+// EnqueueWebhookEvent 向订阅了该事件的订阅方写入待投递记录，由投递任务异步发送；
+// 失败只记录日志，不影响业务流程
+func EnqueueWebhookEvent(event string, data interface{}) int {
+	if !operation_setting.GetWebhookEventSetting().Enabled {
+		return 0
+	}
+	var subs []*WebhookSubscription
+	if err := DB.Where("enabled = ?", true).Find(&subs).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to load webhook subscriptions for event %s: %s", event, err.Error()))
+		return 0
+	}
+	matched := make([]*WebhookSubscription, 0, len(subs))
+	for _, sub := range subs {
+		if sub.Subscribes(event) {
+			matched = append(matched, sub)
+		}
+	}
+	deliveries, err := CreateWebhookDeliveries(matched, event, data)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to enqueue webhook event %s: %s", event, err.Error()))
+		return 0
+	}
+	return len(deliveries)
+}
+
+func GetDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := DB.Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryStatusPending, now).
+		Order("next_attempt_at asc, id asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// UpdateResult 记录一次投递尝试的结果
+func (d *WebhookDelivery) UpdateResult() error {
+	return DB.Model(d).Select("status", "attempts", "next_attempt_at", "response_code", "last_error", "delivered_at").Updates(d).Error
+}
+
+func GetWebhookDeliveryById(id int) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := DB.First(&delivery, "id = ?", id).Error
+	return &delivery, err
+}
+
+func GetWebhookDeliveries(subscriptionId int, event string, status string, startIdx int, num int) ([]*WebhookDelivery, int64, error) {
+	var deliveries []*WebhookDelivery
+	var total int64
+	tx := DB.Model(&WebhookDelivery{})
+	if subscriptionId != 0 {
+		tx = tx.Where("subscription_id = ?", subscriptionId)
+	}
+	if event != "" {
+		tx = tx.Where("event = ?", event)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// RetryWebhookDelivery 将投递重新放回队列，立即再尝试一次
+func RetryWebhookDelivery(id int) error {
+	result := DB.Model(&WebhookDelivery{}).Where("id = ? AND status <> ?", id, WebhookDeliveryStatusPending).
+		Updates(map[string]interface{}{
+			"status":          WebhookDeliveryStatusPending,
+			"next_attempt_at": common.GetTimestamp(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("投递记录不存在或仍在队列中")
+	}
+	return nil
+}
+
+// DeleteOldWebhookDeliveries 清理早于指定时间且已结束的投递记录
+func DeleteOldWebhookDeliveries(targetTimestamp int64, limit int) (int64, error) {
+	var total int64
+	for {
+		result := DB.Where("created_at < ? AND status <> ?", targetTimestamp, WebhookDeliveryStatusPending).
+			Limit(limit).Delete(&WebhookDelivery{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(limit) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "newapi"
+
+// 超过 MaxLabelValues 后新出现的标签取值统一记为 OtherLabelValue
+const OtherLabelValue = "other"
+
+// Registry 独立的指标注册表，只暴露本服务的指标与 Go 运行时指标
+var Registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "requests_total",
+		Help:      "Relay requests by final status code, after retries.",
+	}, []string{"model", "group", "status"})
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "retries_total",
+		Help:      "Extra channel attempts made by relay retries.",
+	}, []string{"model", "group"})
+
+	channelRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "requests_total",
+		Help:      "Upstream attempts per channel by status code.",
+	}, []string{"channel", "model", "group", "status"})
+	channelDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "request_duration_seconds",
+		Help:      "Upstream attempt latency per channel.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"channel", "model", "group"})
+	channelTTFT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "ttft_seconds",
+		Help:      "Time to first token of streaming attempts per channel.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	}, []string{"channel", "model", "group"})
+	channelErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "errors_total",
+		Help:      "Upstream errors per channel by status code and error code.",
+	}, []string{"channel", "status", "code"})
+
+	tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "tokens_total",
+		Help:      "Billed tokens by type.",
+	}, []string{"channel", "model", "group", "type"})
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "quota_consumed_total",
+		Help:      "Quota consumed by settled requests.",
+	}, []string{"channel", "model", "group"})
+	billingRefunds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "refunds_total",
+		Help:      "Billing sessions refunded after failed requests.",
+	}, []string{"source"})
+	billingRefundedQuota = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "refunded_quota_total",
+		Help:      "Pre-consumed quota returned by billing refunds.",
+	}, []string{"source"})
+
+	affinityLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel_affinity",
+		Name:      "lookups_total",
+		Help:      "Channel affinity cache lookups by result.",
+	}, []string{"result"})
+
+	// 以下指标在每次抓取时由 controller 刷新
+	ChannelStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "status",
+		Help:      "Channel status: 1 enabled, 2 manually disabled, 3 auto disabled.",
+	}, []string{"channel"})
+	ChannelInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "inflight_requests",
+		Help:      "Upstream requests in flight per channel on this node.",
+	}, []string{"channel"})
+	ChannelCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "circuit_state",
+		Help:      "Channel circuit breaker state, 1 for the current state.",
+	}, []string{"channel", "state"})
+	AffinityCacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "channel_affinity",
+		Name:      "cache_entries",
+		Help:      "Channel affinity cache entries by rule.",
+	}, []string{"rule"})
+	AffinityCacheCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "channel_affinity",
+		Name:      "cache_capacity",
+		Help:      "Channel affinity cache capacity.",
+	})
+	ActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "active_connections",
+		Help:      "Relay HTTP connections currently being served.",
+	})
+	SystemUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "system",
+		Name:      "usage_percent",
+		Help:      "Host resource usage from the performance monitor.",
+	}, []string{"resource"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests, relayRetries,
+		channelRequests, channelDuration, channelTTFT, channelErrors,
+		tokens, quotaConsumed, billingRefunds, billingRefundedQuota,
+		affinityLookups,
+		ChannelStatus, ChannelInflight, ChannelCircuitState,
+		AffinityCacheEntries, AffinityCacheCapacity,
+		ActiveConnections, SystemUsage,
+	)
+}
+
+func Enabled() bool {
+	return operation_setting.GetMetricsSetting().Enabled
+}
+
+var (
+	labelGuardLock sync.Mutex
+	labelValues    = make(map[string]map[string]struct{})
+)
+
+// guardLabel 限制每个标签的取值数量，防止渠道、模型或分组过多导致时间序列膨胀
+func guardLabel(label string, value string) string {
+	limit := operation_setting.GetMetricsSetting().MaxLabelValues
+	if limit <= 0 {
+		return value
+	}
+	labelGuardLock.Lock()
+	defer labelGuardLock.Unlock()
+	values, ok := labelValues[label]
+	if !ok {
+		values = make(map[string]struct{})
+		labelValues[label] = values
+	}
+	if _, ok := values[value]; ok {
+		return value
+	}
+	if len(values) >= limit {
+		return OtherLabelValue
+	}
+	values[value] = struct{}{}
+	return value
+}
+
+func ChannelLabel(channelId int) string {
+	return guardLabel("channel", strconv.Itoa(channelId))
+}
+
+func modelLabel(model string) string {
+	return guardLabel("model", model)
+}
+
+func groupLabel(group string) string {
+	return guardLabel("group", group)
+}
+
+// RecordRelayRequest 记录一次客户端请求的最终结果，attempts 为实际尝试的渠道次数
+func RecordRelayRequest(model string, group string, status int, attempts int) {
+	if !Enabled() {
+		return
+	}
+	model, group = modelLabel(model), groupLabel(group)
+	relayRequests.WithLabelValues(model, group, strconv.Itoa(status)).Inc()
+	if attempts > 1 {
+		relayRetries.WithLabelValues(model, group).Add(float64(attempts - 1))
+	}
+}
+
+// RecordChannelAttempt 记录一次上游请求，ttft 为 0 表示非流式
+func RecordChannelAttempt(channelId int, model string, group string, status int, latency time.Duration, ttft time.Duration) {
+	if !Enabled() {
+		return
+	}
+	channel, model, group := ChannelLabel(channelId), modelLabel(model), groupLabel(group)
+	channelRequests.WithLabelValues(channel, model, group, strconv.Itoa(status)).Inc()
+	channelDuration.WithLabelValues(channel, model, group).Observe(latency.Seconds())
+	if ttft > 0 {
+		channelTTFT.WithLabelValues(channel, model, group).Observe(ttft.Seconds())
+	}
+}
+
+func RecordChannelError(channelId int, status int, code string) {
+	if !Enabled() {
+		return
+	}
+	channelErrors.WithLabelValues(ChannelLabel(channelId), strconv.Itoa(status), code).Inc()
+}
+
+// RecordConsume 记录结算后的 token 数与扣费额度
+func RecordConsume(channelId int, model string, group string, promptTokens int, completionTokens int, quota int) {
+	if !Enabled() {
+		return
+	}
+	channel, model, group := ChannelLabel(channelId), modelLabel(model), groupLabel(group)
+	tokens.WithLabelValues(channel, model, group, "prompt").Add(float64(max(promptTokens, 0)))
+	tokens.WithLabelValues(channel, model, group, "completion").Add(float64(max(completionTokens, 0)))
+	quotaConsumed.WithLabelValues(channel, model, group).Add(float64(max(quota, 0)))
+}
+
+func RecordBillingRefund(source string, quota int) {
+	if !Enabled() {
+		return
+	}
+	billingRefunds.WithLabelValues(source).Inc()
+	billingRefundedQuota.WithLabelValues(source).Add(float64(max(quota, 0)))
+}
+
+func RecordAffinityLookup(hit bool) {
+	if !Enabled() {
+		return
+	}
+	if hit {
+		affinityLookups.WithLabelValues("hit").Inc()
+	} else {
+		affinityLookups.WithLabelValues("miss").Inc()
+	}
+}
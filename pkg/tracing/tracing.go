@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+var enabled bool
+
+// 只传播 W3C traceparent，不转发客户端携带的 baggage，避免其内容被透传到上游
+var propagator = propagation.TraceContext{}
+
+// Start 配置了 OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT 时启用 OTLP/HTTP 链路追踪，
+// 其余导出参数（headers、采样率等）使用 OpenTelemetry 标准环境变量。返回的函数用于刷新并关闭导出器
+func Start() (func(context.Context) error, error) {
+	if common.GetEnvOrDefaultString("OTEL_EXPORTER_OTLP_ENDPOINT", "") == "" && common.GetEnvOrDefaultString("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "new-api"),
+			attribute.String("service.version", common.Version),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	enabled = true
+	common.SysLog("OpenTelemetry tracing enabled")
+	return provider.Shutdown, nil
+}
+
+func Enabled() bool {
+	return enabled
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Span 包装 trace.Span，结束时将 gin 请求上下文恢复为父 span，可重复调用 End
+type Span struct {
+	trace.Span
+	c      *gin.Context
+	parent context.Context
+	ended  bool
+}
+
+var noopSpan = &Span{Span: trace.SpanFromContext(context.Background())}
+
+// StartSpan 以请求上下文中的 span 为父节点开始子 span，并将其设为请求上下文，后续 span 挂在它下面
+func StartSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	if !enabled || c == nil || c.Request == nil {
+		return noopSpan
+	}
+	parent := c.Request.Context()
+	ctx, span := tracer().Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return &Span{Span: span, c: c, parent: parent}
+}
+
+// StartClientSpan 为发往上游的请求开始 span，并注入 traceparent 请求头
+func StartClientSpan(c *gin.Context, req *http.Request, attrs ...attribute.KeyValue) *Span {
+	if !enabled || c == nil || c.Request == nil {
+		return noopSpan
+	}
+	attrs = append(attrs, attribute.String("http.request.method", req.Method), attribute.String("server.address", req.URL.Host))
+	ctx, span := tracer().Start(c.Request.Context(), "upstream "+req.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return &Span{Span: span}
+}
+
+func (s *Span) End() {
+	if s == noopSpan || s.ended {
+		return
+	}
+	s.ended = true
+	s.Span.End()
+	if s.c != nil && s.c.Request != nil {
+		s.c.Request = s.c.Request.WithContext(s.parent)
+	}
+}
+
+// SetError 记录错误并将 span 标记为失败，err 为 nil 时不做处理
+func (s *Span) SetError(err error) {
+	if s == noopSpan || err == nil {
+		return
+	}
+	s.RecordError(err)
+	s.SetStatus(codes.Error, err.Error())
+}
+
+// StartServerSpan 从请求头提取 W3C traceparent，以调用方的 span 为父节点开始服务端 span
+func StartServerSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	if !enabled || c == nil || c.Request == nil {
+		return noopSpan
+	}
+	parent := c.Request.Context()
+	ctx := propagator.Extract(parent, propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return &Span{Span: span, c: c, parent: parent}
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	incomingTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanId  = "00f067aa0ba902b7"
+)
+
+// collectorStub 模拟 OTLP/HTTP collector，记录收到的 span
+type collectorStub struct {
+	mu    sync.Mutex
+	spans map[string]*tracepb.Span
+}
+
+func (s *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if r.URL.Path != "/v1/traces" || proto.Unmarshal(body, req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				s.spans[span.Name] = span
+			}
+		}
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestTracePropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	collector := &collectorStub{spans: make(map[string]*tracepb.Span)}
+	collectorServer := httptest.NewServer(collector)
+	defer collectorServer.Close()
+
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collectorServer.URL)
+	shutdown, err := Start()
+	require.NoError(t, err)
+	require.True(t, Enabled())
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		server := StartServerSpan(c, "POST /v1/chat/completions")
+		defer server.End()
+		attempt := StartSpan(c, "relay_attempt")
+		req, _ := http.NewRequest(http.MethodPost, upstream.URL, nil)
+		client := StartClientSpan(c, req)
+		resp, err := http.DefaultClient.Do(req)
+		client.End()
+		if err == nil {
+			resp.Body.Close()
+		}
+		attempt.End()
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceId+"-"+incomingSpanId+"-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	require.NoError(t, shutdown(context.Background()))
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	server := collector.spans["POST /v1/chat/completions"]
+	attempt := collector.spans["relay_attempt"]
+	client := collector.spans["upstream POST"]
+	require.NotNil(t, server)
+	require.NotNil(t, attempt)
+	require.NotNil(t, client)
+
+	for _, span := range []*tracepb.Span{server, attempt, client} {
+		require.Equal(t, incomingTraceId, hex.EncodeToString(span.TraceId))
+	}
+	require.Equal(t, incomingSpanId, hex.EncodeToString(server.ParentSpanId))
+	require.Equal(t, server.SpanId, attempt.ParentSpanId)
+	require.Equal(t, attempt.SpanId, client.ParentSpanId)
+
+	// 上游收到的 traceparent 指向发出请求的 client span
+	parts := strings.Split(upstreamTraceparent, "-")
+	require.Len(t, parts, 4)
+	require.Equal(t, incomingTraceId, parts[1])
+	require.Equal(t, hex.EncodeToString(client.SpanId), parts[2])
+}
@@ -0,0 +1,116 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracedAdaptor 为请求转换与响应处理创建 span，仅在启用链路追踪时使用
+type tracedAdaptor struct {
+	channel.Adaptor
+}
+
+func startConvertSpan(c *gin.Context, info *relaycommon.RelayInfo) *tracing.Span {
+	var attrs []attribute.KeyValue
+	if info != nil {
+		attrs = append(attrs, attribute.String("relay.format", string(info.RelayFormat)))
+		if info.ChannelMeta != nil {
+			attrs = append(attrs, attribute.String("relay.upstream_model", info.UpstreamModelName))
+		}
+	}
+	return tracing.StartSpan(c, "convert_request", attrs...)
+}
+
+// endConvertSpan 记录转换后的请求格式，与 appendRequestConversionChain 记录的转换链一致
+func endConvertSpan(span *tracing.Span, info *relaycommon.RelayInfo, converted any, err error) {
+	if format, ok := relaycommon.GuessRelayFormatFromRequest(converted); ok {
+		span.SetAttributes(attribute.String("relay.convert_to", string(format)))
+	}
+	if info != nil && len(info.RequestConversionChain) > 0 {
+		chain := make([]string, 0, len(info.RequestConversionChain))
+		for _, format := range info.RequestConversionChain {
+			chain = append(chain, string(format))
+		}
+		span.SetAttributes(attribute.StringSlice("relay.request_conversion", chain))
+	}
+	span.SetError(err)
+	span.End()
+}
+
+func (a *tracedAdaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertOpenAIRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
+	span := startConvertSpan(c, nil)
+	converted, err := a.Adaptor.ConvertRerankRequest(c, relayMode, request)
+	endConvertSpan(span, nil, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertEmbeddingRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertAudioRequest(c, info, request)
+	endConvertSpan(span, info, nil, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertImageRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertOpenAIResponsesRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertClaudeRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	span := startConvertSpan(c, info)
+	converted, err := a.Adaptor.ConvertGeminiRequest(c, info, request)
+	endConvertSpan(span, info, converted, err)
+	return converted, err
+}
+
+func (a *tracedAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (any, *types.NewAPIError) {
+	span := tracing.StartSpan(c, "handle_response")
+	defer span.End()
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	usage, newAPIError := a.Adaptor.DoResponse(c, resp, info)
+	if newAPIError != nil {
+		span.SetError(newAPIError)
+	}
+	return usage, newAPIError
+}
@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"bytes"
+
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditCaptureWriter 在写给客户端的同时保存响应体，超过上限的部分只计入大小
+type auditCaptureWriter struct {
+	gin.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+	size  int64
+}
+
+func (w *auditCaptureWriter) capture(data []byte) {
+	w.size += int64(len(data))
+	if w.limit > 0 {
+		remaining := w.limit - w.buf.Len()
+		if remaining <= 0 {
+			return
+		}
+		if len(data) > remaining {
+			data = data[:remaining]
+		}
+	}
+	w.buf.Write(data)
+}
+
+func (w *auditCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// StartAuditCapture 替换 c.Writer 以采集最终返回给客户端的响应（含错误响应），
+// 返回的函数需在响应写完后调用，恢复原 writer 并保存采集记录
+func StartAuditCapture(c *gin.Context, relayFormat types.RelayFormat) func() {
+	if !service.ShouldStartAuditCapture(c) {
+		return func() {}
+	}
+	original := c.Writer
+	writer := &auditCaptureWriter{ResponseWriter: original, limit: operation_setting.GetAuditCaptureSetting().MaxBodyBytes}
+	c.Writer = writer
+	return func() {
+		c.Writer = original
+		service.RecordAuditCapture(c, string(relayFormat), service.AuditCaptureResponse{
+			StatusCode:  writer.Status(),
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.buf.Bytes(),
+			Size:        writer.size,
+		})
+	}
+}
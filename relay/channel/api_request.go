@@ -13,6 +13,7 @@ import (
 
 	common2 "github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -23,6 +24,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // hopByHopHeaders are headers that should not be forwarded per RFC 7230
@@ -554,14 +556,24 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	// 对冲请求落败时需要中断上游连接
+	if service.IsHedgedRequest(c) {
+		req = req.WithContext(c.Request.Context())
+	}
+	span := tracing.StartClientSpan(c, req, attribute.Int("channel.id", info.ChannelId))
 	resp, err := client.Do(req)
 	if err != nil {
+		span.SetError(err)
+		span.End()
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
+		span.End()
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	span.End()
 
 	// Decompress response body if needed (handles gzip/deflate/brotli)
 	// For streaming requests, skip magic byte sniffing to avoid blocking SSE connections
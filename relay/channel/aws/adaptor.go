@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
@@ -25,12 +26,29 @@ const (
 	ClientModeAKSK
 )
 
+// RequestMode 按模型选择的上游接口
+type RequestMode int
+
+const (
+	// RequestModeClaude Anthropic 模型，InvokeModel 原生 Claude 格式
+	RequestModeClaude RequestMode = iota
+	// RequestModeConverse 其余对话模型（Llama、Mistral、Nova 等），Converse / ConverseStream
+	RequestModeConverse
+	// RequestModeEmbedding Titan / Cohere 向量模型，InvokeModel
+	RequestModeEmbedding
+)
+
 type Adaptor struct {
-	ClientMode ClientMode
-	AwsClient  *bedrockruntime.Client
-	AwsModelId string
-	AwsReq     any
-	IsNova     bool
+	ClientMode  ClientMode
+	RequestMode RequestMode
+	AwsClient   *bedrockruntime.Client
+	AwsModelId  string
+	AwsReq      any
+
+	EmbeddingFamily         string
+	EmbeddingInputs         []string
+	EmbeddingEncodingFormat string
+	TitanEmbeddings         []AwsTitanEmbeddingResponse
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -39,6 +57,14 @@ func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dt
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if !isAwsClaudeModel(info) {
+		adaptor := openai.Adaptor{}
+		oaiReq, err := adaptor.ConvertClaudeRequest(c, info, request)
+		if err != nil {
+			return nil, err
+		}
+		return a.ConvertOpenAIRequest(c, info, oaiReq.(*dto.GeneralOpenAIRequest))
+	}
 	for i, message := range request.Messages {
 		updated := false
 		if !message.IsStringContent() {
@@ -89,6 +115,15 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	switch a.RequestMode {
+	case RequestModeConverse:
+		if info.IsStream {
+			return getBedrockRuntimeURL(info, "converse-stream")
+		}
+		return getBedrockRuntimeURL(info, "converse")
+	case RequestModeEmbedding:
+		return getBedrockRuntimeURL(info, "invoke")
+	}
 	if info.ChannelOtherSettings.AwsKeyType == dto.AwsKeyTypeApiKey {
 		awsModelId := getAwsModelID(info.UpstreamModelName)
 		a.ClientMode = ClientModeApiKey
@@ -115,11 +150,9 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	if !isAwsClaudeModel(info) {
+		a.RequestMode = RequestModeConverse
+		return convertOpenAIToConverseRequest(c, request)
 	}
 
 	// 原有的Claude模型处理逻辑
@@ -136,16 +169,37 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	a.RequestMode = RequestModeEmbedding
+	return a.convertEmbeddingRequest(info, request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	chatRequest, err := service.ResponsesRequestToChatCompletionsRequest(&request)
+	if err != nil {
+		return nil, err
+	}
+	return a.ConvertOpenAIRequest(c, info, chatRequest)
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if a.RequestMode != RequestModeClaude {
+		requestURL, err := a.GetRequestURL(info)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		if a.EmbeddingFamily == awsEmbeddingTitan {
+			return a.doTitanEmbeddingRequest(c, info, requestURL, body)
+		}
+		accept := "application/json"
+		if a.RequestMode == RequestModeConverse && info.IsStream {
+			accept = "application/vnd.amazon.eventstream"
+		}
+		return doBedrockRequest(c, info, requestURL, accept, body)
+	}
 	if a.ClientMode == ClientModeApiKey {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
@@ -154,19 +208,26 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if a.ClientMode == ClientModeApiKey {
-		claudeAdaptor := claude.Adaptor{}
-		usage, err = claudeAdaptor.DoResponse(c, resp, info)
-	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+	switch {
+	case a.RequestMode == RequestModeEmbedding:
+		if a.EmbeddingFamily == awsEmbeddingTitan {
+			usage, err = titanEmbeddingHandler(c, info, a)
 		} else {
-			if info.IsStream {
-				err, usage = awsStreamHandler(c, info, a)
-			} else {
-				err, usage = awsHandler(c, info, a)
-			}
+			usage, err = cohereEmbeddingHandler(c, info, resp, a.EmbeddingEncodingFormat)
 		}
+	case a.RequestMode == RequestModeConverse:
+		if info.IsStream {
+			usage, err = converseStreamHandler(c, info, resp)
+		} else {
+			usage, err = converseHandler(c, info, resp)
+		}
+	case a.ClientMode == ClientModeApiKey:
+		claudeAdaptor := claude.Adaptor{}
+		usage, err = claudeAdaptor.DoResponse(c, resp, info)
+	case info.IsStream:
+		err, usage = awsStreamHandler(c, info, a)
+	default:
+		err, usage = awsHandler(c, info, a)
 	}
 	return
 }
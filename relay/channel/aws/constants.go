@@ -1,6 +1,11 @@
 package aws
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
 
 var awsModelIDMap = map[string]string{
 	"claude-3-sonnet-20240229":   "anthropic.claude-3-sonnet-20240229-v1:0",
@@ -26,6 +31,17 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Converse models
+	"llama3-3-70b-instruct-v1:0":   "meta.llama3-3-70b-instruct-v1:0",
+	"llama4-maverick-17b-instruct": "meta.llama4-maverick-17b-instruct-v1:0",
+	"llama4-scout-17b-instruct":    "meta.llama4-scout-17b-instruct-v1:0",
+	"mistral-large-2407-v1:0":      "mistral.mistral-large-2407-v1:0",
+	"pixtral-large-2502-v1:0":      "mistral.pixtral-large-2502-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -127,6 +143,20 @@ var awsModelCanCrossRegionMap = map[string]map[string]bool{
 		"eu":   true,
 		"apac": true,
 	},
+	// Llama / Pixtral 仅支持通过跨区域推理配置文件调用
+	"meta.llama3-3-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-maverick-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-scout-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"mistral.pixtral-large-2502-v1:0": {
+		"us": true,
+		"eu": true,
+	},
 }
 
 var awsRegionCrossModelPrefixMap = map[string]string{
@@ -137,7 +167,45 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 
 var ChannelName = "aws"
 
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
+// awsConverseModelProviders 确定走 Converse API 的模型提供方前缀，可带跨区域推理前缀（如 us.meta.）
+var awsConverseModelProviders = []string{
+	"meta.", "mistral.", "amazon.nova", "amazon.titan-text", "cohere.command", "ai21.", "deepseek.", "writer.", "qwen.", "openai.",
+}
+
+// isAwsClaudeModel 按解析后的上游模型 ID 选择接口：渠道显式指定时以渠道为准，
+// 能识别为其余对话模型时走 Converse API，其余（含 Anthropic、推理配置文件 ARN、自定义模型 ID）保持 InvokeModel
+func isAwsClaudeModel(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelOtherSettings.AwsRequestMode {
+	case dto.AwsRequestModeInvoke:
+		return true
+	case dto.AwsRequestModeConverse:
+		return false
+	}
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	if strings.Contains(awsModelId, "anthropic.") {
+		return true
+	}
+	for _, provider := range awsConverseModelProviders {
+		if strings.HasPrefix(awsModelId, provider) || strings.Contains(awsModelId, "."+provider) || strings.Contains(awsModelId, "/"+provider) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	awsEmbeddingTitan  = "titan"
+	awsEmbeddingCohere = "cohere"
+)
+
+// getAwsEmbeddingFamily 按模型 ID 判断向量模型的请求格式，不支持时返回空
+func getAwsEmbeddingFamily(awsModelId string) string {
+	switch {
+	case strings.Contains(awsModelId, "titan-embed"):
+		return awsEmbeddingTitan
+	case strings.Contains(awsModelId, "cohere.embed"):
+		return awsEmbeddingCohere
+	default:
+		return ""
+	}
 }
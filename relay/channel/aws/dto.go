@@ -54,68 +54,150 @@ func formatRequest(requestBody io.Reader, requestHeader http.Header) (*AwsClaude
 	return &awsClaudeRequest, nil
 }
 
-// NovaMessage Nova模型使用messages-v1格式
-type NovaMessage struct {
-	Role    string        `json:"role"`
-	Content []NovaContent `json:"content"`
+// ConverseRequest Bedrock Converse / ConverseStream 请求体，模型 ID 位于 URL 中
+type ConverseRequest struct {
+	Messages                     []ConverseMessage        `json:"messages"`
+	System                       []ConverseContentBlock   `json:"system,omitempty"`
+	InferenceConfig              *ConverseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig                   *ConverseToolConfig      `json:"toolConfig,omitempty"`
+	AdditionalModelRequestFields map[string]any           `json:"additionalModelRequestFields,omitempty"`
 }
 
-type NovaContent struct {
-	Text string `json:"text"`
+type ConverseMessage struct {
+	Role    string                 `json:"role"`
+	Content []ConverseContentBlock `json:"content"`
 }
 
-type NovaRequest struct {
-	SchemaVersion   string               `json:"schemaVersion"`             // 请求版本，例如 "1.0"
-	Messages        []NovaMessage        `json:"messages"`                  // 对话消息列表
-	InferenceConfig *NovaInferenceConfig `json:"inferenceConfig,omitempty"` // 推理配置，可选
+type ConverseContentBlock struct {
+	Text             string                    `json:"text,omitempty"`
+	Image            *ConverseImageBlock       `json:"image,omitempty"`
+	ToolUse          *ConverseToolUseBlock     `json:"toolUse,omitempty"`
+	ToolResult       *ConverseToolResultBlock  `json:"toolResult,omitempty"`
+	ReasoningContent *ConverseReasoningContent `json:"reasoningContent,omitempty"`
 }
 
-type NovaInferenceConfig struct {
-	MaxTokens     int      `json:"maxTokens,omitempty"`     // 最大生成的 token 数
-	Temperature   float64  `json:"temperature,omitempty"`   // 随机性 (默认 0.7, 范围 0-1)
-	TopP          float64  `json:"topP,omitempty"`          // nucleus sampling (默认 0.9, 范围 0-1)
-	TopK          int      `json:"topK,omitempty"`          // 限制候选 token 数 (默认 50, 范围 0-128)
-	StopSequences []string `json:"stopSequences,omitempty"` // 停止生成的序列
+type ConverseImageBlock struct {
+	Format string `json:"format"`
+	Source struct {
+		// Bytes base64 编码的图片数据
+		Bytes string `json:"bytes"`
+	} `json:"source"`
 }
 
-// 转换OpenAI请求为Nova格式
-func convertToNovaRequest(req *dto.GeneralOpenAIRequest) *NovaRequest {
-	novaMessages := make([]NovaMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		novaMessages[i] = NovaMessage{
-			Role:    msg.Role,
-			Content: []NovaContent{{Text: msg.StringContent()}},
-		}
-	}
+type ConverseToolUseBlock struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
 
-	novaReq := &NovaRequest{
-		SchemaVersion: "messages-v1",
-		Messages:      novaMessages,
-	}
+type ConverseToolResultBlock struct {
+	ToolUseId string                      `json:"toolUseId"`
+	Content   []ConverseToolResultContent `json:"content"`
+	Status    string                      `json:"status,omitempty"`
+}
 
-	// 设置推理配置
-	if req.MaxTokens != 0 || (req.Temperature != nil && *req.Temperature != 0) || req.TopP != 0 || req.TopK != 0 || req.Stop != nil {
-		novaReq.InferenceConfig = &NovaInferenceConfig{}
-		if req.MaxTokens != 0 {
-			novaReq.InferenceConfig.MaxTokens = int(req.MaxTokens)
-		}
-		if req.Temperature != nil && *req.Temperature != 0 {
-			novaReq.InferenceConfig.Temperature = *req.Temperature
-		}
-		if req.TopP != 0 {
-			novaReq.InferenceConfig.TopP = req.TopP
-		}
-		if req.TopK != 0 {
-			novaReq.InferenceConfig.TopK = req.TopK
-		}
-		if req.Stop != nil {
-			if stopSequences := parseStopSequences(req.Stop); len(stopSequences) > 0 {
-				novaReq.InferenceConfig.StopSequences = stopSequences
-			}
-		}
-	}
+type ConverseToolResultContent struct {
+	Text string `json:"text,omitempty"`
+}
+
+type ConverseReasoningContent struct {
+	ReasoningText *struct {
+		Text      string `json:"text"`
+		Signature string `json:"signature,omitempty"`
+	} `json:"reasoningText,omitempty"`
+}
+
+type ConverseInferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ConverseToolConfig struct {
+	Tools      []ConverseTool      `json:"tools"`
+	ToolChoice *ConverseToolChoice `json:"toolChoice,omitempty"`
+}
+
+type ConverseTool struct {
+	ToolSpec ConverseToolSpec `json:"toolSpec"`
+}
+
+type ConverseToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema struct {
+		Json any `json:"json"`
+	} `json:"inputSchema"`
+}
+
+// ConverseToolChoice auto / any / tool 三选一
+type ConverseToolChoice struct {
+	Auto *struct{} `json:"auto,omitempty"`
+	Any  *struct{} `json:"any,omitempty"`
+	Tool *struct {
+		Name string `json:"name"`
+	} `json:"tool,omitempty"`
+}
+
+type ConverseUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens,omitempty"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens,omitempty"`
+}
+
+type ConverseResponse struct {
+	Output struct {
+		Message *ConverseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string         `json:"stopReason"`
+	Usage      *ConverseUsage `json:"usage"`
+}
+
+// ConverseStreamEvent ConverseStream 各事件的载荷，事件类型由 eventstream 的 :event-type 头给出
+type ConverseStreamEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             *struct {
+		ToolUse *ConverseToolUseBlock `json:"toolUse,omitempty"`
+	} `json:"start,omitempty"`
+	Delta *struct {
+		Text    *string `json:"text,omitempty"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse,omitempty"`
+		ReasoningContent *struct {
+			Text      *string `json:"text,omitempty"`
+			Signature string  `json:"signature,omitempty"`
+		} `json:"reasoningContent,omitempty"`
+	} `json:"delta,omitempty"`
+	StopReason string         `json:"stopReason,omitempty"`
+	Usage      *ConverseUsage `json:"usage,omitempty"`
+	Message    string         `json:"message,omitempty"`
+}
+
+// AwsTitanEmbeddingRequest Titan 文本向量模型每次只接受一条输入
+type AwsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+	Normalize  *bool  `json:"normalize,omitempty"`
+}
+
+type AwsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type AwsCohereEmbeddingRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+	Truncate  string   `json:"truncate,omitempty"`
+}
 
-	return novaReq
+type AwsCohereEmbeddingResponse struct {
+	// Embeddings 未指定 embedding_types 时为二维数组，否则为按类型分组的对象
+	Embeddings json.RawMessage `json:"embeddings"`
 }
 
 // parseStopSequences 解析停止序列，支持字符串或字符串数组
@@ -0,0 +1,502 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relay/reasonmap"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const bedrockSigningName = "bedrock"
+
+// awsCredential 渠道密钥：<api-key>|<region> 或 <ak>|<sk>|<region>
+type awsCredential struct {
+	ApiKey    string
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+func parseAwsCredential(key string) (*awsCredential, error) {
+	parts := strings.Split(key, "|")
+	switch len(parts) {
+	case 2:
+		return &awsCredential{ApiKey: parts[0], Region: parts[1]}, nil
+	case 3:
+		return &awsCredential{AccessKey: parts[0], SecretKey: parts[1], Region: parts[2]}, nil
+	default:
+		return nil, errors.New("invalid aws secret key, should be in format of <api-key>|<region> or <ak>|<sk>|<region>")
+	}
+}
+
+// getBedrockRuntimeURL 拼接 Bedrock Runtime 接口地址，渠道配置了 Base URL（如 VPC 终端节点）时优先使用
+func getBedrockRuntimeURL(info *relaycommon.RelayInfo, action string) (string, error) {
+	credential, err := parseAwsCredential(info.ApiKey)
+	if err != nil {
+		return "", err
+	}
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	if regionPrefix := getAwsRegionPrefix(credential.Region); awsModelCanCrossRegion(awsModelId, regionPrefix) {
+		awsModelId = awsModelCrossRegion(awsModelId, regionPrefix)
+	}
+	baseURL := strings.TrimSuffix(info.ChannelBaseUrl, "/")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", credential.Region)
+	}
+	// 与官方 SDK 一致，模型 ID 中的冒号编码为 %3A
+	modelPath := strings.ReplaceAll(url.PathEscape(awsModelId), ":", "%3A")
+	return fmt.Sprintf("%s/model/%s/%s", baseURL, modelPath, action), nil
+}
+
+// signBedrockRequest 使用 AK/SK 对请求做 SigV4 签名，必须在所有请求头设置完成后调用
+func signBedrockRequest(req *http.Request, body []byte, credential *awsCredential, signTime time.Time) error {
+	payloadHash := sha256.Sum256(body)
+	return v4.NewSigner().SignHTTP(req.Context(), aws.Credentials{
+		AccessKeyID:     credential.AccessKey,
+		SecretAccessKey: credential.SecretKey,
+	}, req, hex.EncodeToString(payloadHash[:]), bedrockSigningName, credential.Region, signTime)
+}
+
+// doBedrockRequest 直接调用 Bedrock Runtime REST 接口：API Key 使用 Bearer 认证，AK/SK 使用 SigV4 签名
+func doBedrockRequest(c *gin.Context, info *relaycommon.RelayInfo, requestURL string, accept string, body []byte) (*http.Response, error) {
+	req, err := newBedrockRequest(info, requestURL, accept, body, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if common.DebugEnabled {
+		println("fullRequestURL:", requestURL)
+	}
+	return channel.DoRequest(c, req, info)
+}
+
+// newBedrockRequest 构造并签名 Bedrock Runtime 请求
+func newBedrockRequest(info *relaycommon.RelayInfo, requestURL string, accept string, body []byte, signTime time.Time) (*http.Request, error) {
+	credential, err := parseAwsCredential(info.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("new request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if credential.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+credential.ApiKey)
+	} else if err := signBedrockRequest(req, body, credential, signTime); err != nil {
+		return nil, fmt.Errorf("sign aws request failed: %w", err)
+	}
+	return req, nil
+}
+
+func converseImageFormat(mimeType string) string {
+	format := strings.TrimPrefix(mimeType, "image/")
+	if format == "jpg" {
+		return "jpeg"
+	}
+	return format
+}
+
+func appendConverseMessage(messages []ConverseMessage, role string, blocks ...ConverseContentBlock) []ConverseMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	// Converse 要求 user / assistant 交替出现，连续同角色消息合并
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, ConverseMessage{Role: role, Content: blocks})
+}
+
+func convertOpenAIContentToConverse(c *gin.Context, message *dto.Message) ([]ConverseContentBlock, error) {
+	if message.IsStringContent() {
+		if text := message.StringContent(); text != "" {
+			return []ConverseContentBlock{{Text: text}}, nil
+		}
+		return nil, nil
+	}
+	blocks := make([]ConverseContentBlock, 0)
+	for _, part := range message.ParseContent() {
+		switch part.Type {
+		case dto.ContentTypeText:
+			if part.Text != "" {
+				blocks = append(blocks, ConverseContentBlock{Text: part.Text})
+			}
+		case dto.ContentTypeImageURL:
+			imageUrl := part.GetImageMedia()
+			var source *types.FileSource
+			if strings.HasPrefix(imageUrl.Url, "http") {
+				source = types.NewURLFileSource(imageUrl.Url)
+			} else {
+				source = types.NewBase64FileSource(imageUrl.Url, "")
+			}
+			base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Bedrock Converse")
+			if err != nil {
+				return nil, fmt.Errorf("get file data failed: %s", err.Error())
+			}
+			image := &ConverseImageBlock{Format: converseImageFormat(mimeType)}
+			image.Source.Bytes = base64Data
+			blocks = append(blocks, ConverseContentBlock{Image: image})
+		default:
+			return nil, fmt.Errorf("content type %q is not supported by bedrock converse", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+func convertOpenAIToolChoiceToConverse(toolChoice any) *ConverseToolChoice {
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "auto":
+			return &ConverseToolChoice{Auto: &struct{}{}}
+		case "required":
+			return &ConverseToolChoice{Any: &struct{}{}}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			name, _ := function["name"].(string)
+			if name != "" {
+				return &ConverseToolChoice{Tool: &struct {
+					Name string `json:"name"`
+				}{Name: name}}
+			}
+		}
+	}
+	return nil
+}
+
+// convertOpenAIToConverseRequest 将 OpenAI 对话请求转换为 Bedrock Converse 请求
+func convertOpenAIToConverseRequest(c *gin.Context, request *dto.GeneralOpenAIRequest) (*ConverseRequest, error) {
+	converseReq := &ConverseRequest{Messages: make([]ConverseMessage, 0, len(request.Messages))}
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				converseReq.System = append(converseReq.System, ConverseContentBlock{Text: text})
+			}
+		case "tool":
+			converseReq.Messages = appendConverseMessage(converseReq.Messages, "user", ConverseContentBlock{
+				ToolResult: &ConverseToolResultBlock{
+					ToolUseId: message.ToolCallId,
+					Content:   []ConverseToolResultContent{{Text: message.StringContent()}},
+				},
+			})
+		case "user", "assistant":
+			blocks, err := convertOpenAIContentToConverse(c, message)
+			if err != nil {
+				return nil, err
+			}
+			if message.Role == "assistant" && message.ToolCalls != nil {
+				for _, toolCall := range message.ParseToolCalls() {
+					input := make(map[string]any)
+					if toolCall.Function.Arguments != "" {
+						if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+							return nil, fmt.Errorf("tool call %s arguments is not a json object: %w", toolCall.ID, err)
+						}
+					}
+					blocks = append(blocks, ConverseContentBlock{ToolUse: &ConverseToolUseBlock{
+						ToolUseId: toolCall.ID,
+						Name:      toolCall.Function.Name,
+						Input:     input,
+					}})
+				}
+			}
+			converseReq.Messages = appendConverseMessage(converseReq.Messages, message.Role, blocks...)
+		default:
+			return nil, fmt.Errorf("message role %q is not supported by bedrock converse", message.Role)
+		}
+	}
+
+	inferenceConfig := &ConverseInferenceConfig{
+		MaxTokens:     int(request.GetMaxTokens()),
+		Temperature:   request.Temperature,
+		StopSequences: parseStopSequences(request.Stop),
+	}
+	if request.TopP != 0 {
+		inferenceConfig.TopP = common.GetPointer(request.TopP)
+	}
+	if inferenceConfig.MaxTokens != 0 || inferenceConfig.Temperature != nil || inferenceConfig.TopP != nil || len(inferenceConfig.StopSequences) > 0 {
+		converseReq.InferenceConfig = inferenceConfig
+	}
+	if request.TopK != 0 {
+		converseReq.AdditionalModelRequestFields = map[string]any{"top_k": request.TopK}
+	}
+
+	if len(request.Tools) > 0 {
+		toolConfig := &ConverseToolConfig{Tools: make([]ConverseTool, 0, len(request.Tools))}
+		for _, tool := range request.Tools {
+			if tool.Type != "" && tool.Type != "function" {
+				return nil, fmt.Errorf("tool type %q is not supported by bedrock converse", tool.Type)
+			}
+			spec := ConverseToolSpec{Name: tool.Function.Name, Description: tool.Function.Description}
+			spec.InputSchema.Json = tool.Function.Parameters
+			if spec.InputSchema.Json == nil {
+				spec.InputSchema.Json = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			toolConfig.Tools = append(toolConfig.Tools, ConverseTool{ToolSpec: spec})
+		}
+		// Converse 没有 none 选项，保留工具定义以便历史中的 toolUse 通过校验
+		toolConfig.ToolChoice = convertOpenAIToolChoiceToConverse(request.ToolChoice)
+		converseReq.ToolConfig = toolConfig
+	}
+	return converseReq, nil
+}
+
+func converseUsageToOpenAIUsage(usage *ConverseUsage) *dto.Usage {
+	if usage == nil {
+		return &dto.Usage{}
+	}
+	// Bedrock 的 inputTokens 不含缓存读写部分
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheWriteInputTokens
+	openaiUsage := &dto.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+	openaiUsage.PromptTokensDetails.CachedTokens = usage.CacheReadInputTokens
+	openaiUsage.PromptTokensDetails.CachedCreationTokens = usage.CacheWriteInputTokens
+	return openaiUsage
+}
+
+func converseStopReasonToOpenAI(stopReason string) string {
+	switch stopReason {
+	case "guardrail_intervened", "content_filtered":
+		return constant.FinishReasonContentFilter
+	case "":
+		return constant.FinishReasonStop
+	default:
+		return reasonmap.ClaudeStopReasonToOpenAIFinishReason(stopReason)
+	}
+}
+
+func converseResponseToOpenAI(c *gin.Context, info *relaycommon.RelayInfo, converseResp *ConverseResponse) *dto.OpenAITextResponse {
+	message := dto.Message{Role: "assistant"}
+	var text, reasoning strings.Builder
+	toolCalls := make([]dto.ToolCallResponse, 0)
+	if converseResp.Output.Message != nil {
+		for _, block := range converseResp.Output.Message.Content {
+			switch {
+			case block.ToolUse != nil:
+				arguments, _ := common.Marshal(block.ToolUse.Input)
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   block.ToolUse.ToolUseId,
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      block.ToolUse.Name,
+						Arguments: string(arguments),
+					},
+				})
+			case block.ReasoningContent != nil && block.ReasoningContent.ReasoningText != nil:
+				reasoning.WriteString(block.ReasoningContent.ReasoningText.Text)
+			default:
+				text.WriteString(block.Text)
+			}
+		}
+	}
+	message.SetStringContent(text.String())
+	message.ReasoningContent = reasoning.String()
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	return &dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReasonToOpenAI(converseResp.StopReason),
+		}},
+		Usage: *converseUsageToOpenAIUsage(converseResp.Usage),
+	}
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var converseResp ConverseResponse
+	if err := common.Unmarshal(responseBody, &converseResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	fullTextResponse := converseResponseToOpenAI(c, info, &converseResp)
+	usage := fullTextResponse.Usage
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		fullTextResponse.Usage = usage
+	}
+
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		responseBody, err = common.Marshal(service.ResponseOpenAI2Claude(fullTextResponse, info))
+	default:
+		responseBody, err = common.Marshal(fullTextResponse)
+	}
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeJsonMarshalFailed, http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := c.Writer.Write(responseBody); err != nil {
+		logger.LogError(c, "failed to write bedrock converse response: "+err.Error())
+	}
+	return &usage, nil
+}
+
+func sendConverseStreamChunk(c *gin.Context, info *relaycommon.RelayInfo, chunk *dto.ChatCompletionsStreamResponse) {
+	data, err := common.Marshal(chunk)
+	if err != nil {
+		logger.LogError(c, "failed to marshal stream response: "+err.Error())
+		return
+	}
+	if err := openai.HandleStreamFormat(c, info, string(data), info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent); err != nil {
+		logger.LogError(c, "failed to handle stream format: "+err.Error())
+	}
+}
+
+// converseStreamHandler 读取 ConverseStream 的 eventstream 响应，逐事件转换为 OpenAI 流式分片
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	id := helper.GetResponseID(c)
+	createAt := common.GetTimestamp()
+	newChunk := func() *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createAt,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{}},
+		}
+	}
+
+	var (
+		usage        *dto.Usage
+		responseText strings.Builder
+		stopReason   string
+		toolIndexes  = make(map[int]int)
+	)
+	decoder := eventstream.NewDecoder()
+	payloadBuf := make([]byte, 0, 10*1024)
+	for {
+		message, err := decoder.Decode(resp.Body, payloadBuf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		info.SetFirstResponseTime()
+
+		var event ConverseStreamEvent
+		if err := common.Unmarshal(message.Payload, &event); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		if messageType := message.Headers.Get(":message-type"); messageType != nil && messageType.String() != "event" {
+			exceptionType := ""
+			if value := message.Headers.Get(":exception-type"); value != nil {
+				exceptionType = value.String()
+			}
+			return nil, types.NewOpenAIError(fmt.Errorf("bedrock stream %s: %s", exceptionType, event.Message), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError)
+		}
+		eventType := ""
+		if value := message.Headers.Get(":event-type"); value != nil {
+			eventType = value.String()
+		}
+
+		switch eventType {
+		case "messageStart":
+			sendConverseStreamChunk(c, info, helper.GenerateStartEmptyResponse(id, createAt, info.UpstreamModelName, nil))
+		case "contentBlockStart":
+			if event.Start == nil || event.Start.ToolUse == nil {
+				break
+			}
+			index := len(toolIndexes)
+			toolIndexes[event.ContentBlockIndex] = index
+			chunk := newChunk()
+			chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{{
+				Index:    common.GetPointer(index),
+				ID:       event.Start.ToolUse.ToolUseId,
+				Type:     "function",
+				Function: dto.FunctionResponse{Name: event.Start.ToolUse.Name},
+			}}
+			sendConverseStreamChunk(c, info, chunk)
+		case "contentBlockDelta":
+			if event.Delta == nil {
+				break
+			}
+			chunk := newChunk()
+			delta := &chunk.Choices[0].Delta
+			switch {
+			case event.Delta.Text != nil:
+				responseText.WriteString(*event.Delta.Text)
+				delta.SetContentString(*event.Delta.Text)
+			case event.Delta.ToolUse != nil:
+				responseText.WriteString(event.Delta.ToolUse.Input)
+				delta.ToolCalls = []dto.ToolCallResponse{{
+					Index:    common.GetPointer(toolIndexes[event.ContentBlockIndex]),
+					Function: dto.FunctionResponse{Arguments: event.Delta.ToolUse.Input},
+				}}
+			case event.Delta.ReasoningContent != nil && event.Delta.ReasoningContent.Text != nil:
+				responseText.WriteString(*event.Delta.ReasoningContent.Text)
+				delta.ReasoningContent = event.Delta.ReasoningContent.Text
+			default:
+				continue
+			}
+			sendConverseStreamChunk(c, info, chunk)
+		case "messageStop":
+			stopReason = event.StopReason
+			sendConverseStreamChunk(c, info, helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, converseStopReasonToOpenAI(stopReason)))
+		case "metadata":
+			if event.Usage != nil {
+				usage = converseUsageToOpenAIUsage(event.Usage)
+			}
+		}
+	}
+
+	if usage == nil || usage.TotalTokens == 0 {
+		usage = service.ResponseText2Usage(c, responseText.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
+	}
+	if stopReason == "" {
+		sendConverseStreamChunk(c, info, helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, constant.FinishReasonStop))
+	}
+	finalResponse := helper.GenerateFinalUsageResponse(id, createAt, info.UpstreamModelName, *usage)
+	finalData, err := common.Marshal(finalResponse)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeJsonMarshalFailed, http.StatusInternalServerError)
+	}
+	openai.HandleFinalResponse(c, info, string(finalData), id, createAt, info.UpstreamModelName, "", usage, false)
+	return usage, nil
+}
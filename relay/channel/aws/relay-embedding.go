@@ -0,0 +1,171 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// convertEmbeddingRequest 按模型转换向量请求；Titan 每次只接受一条输入，多条输入时由 doTitanEmbeddingRequest 逐条调用
+func (a *Adaptor) convertEmbeddingRequest(info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is required")
+	}
+	// Bedrock 只返回浮点向量，base64 由网关按 OpenAI 格式自行编码
+	switch request.EncodingFormat {
+	case "", "float", "base64":
+		a.EmbeddingEncodingFormat = request.EncodingFormat
+	default:
+		return nil, newEmbeddingParamError(fmt.Errorf("encoding_format %s is not supported", request.EncodingFormat))
+	}
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	a.EmbeddingFamily = getAwsEmbeddingFamily(awsModelId)
+	switch a.EmbeddingFamily {
+	case awsEmbeddingTitan:
+		a.EmbeddingInputs = inputs
+		titanReq := &AwsTitanEmbeddingRequest{InputText: inputs[0]}
+		// v1 不支持 dimensions / normalize 参数
+		if awsModelId != "amazon.titan-embed-text-v1" {
+			titanReq.Dimensions = request.Dimensions
+			titanReq.Normalize = common.GetPointer(true)
+		}
+		return titanReq, nil
+	case awsEmbeddingCohere:
+		// Cohere v3 向量维度固定，不能按请求截断
+		if request.Dimensions > 0 {
+			return nil, newEmbeddingParamError(fmt.Errorf("dimensions is not supported by model %s", awsModelId))
+		}
+		return &AwsCohereEmbeddingRequest{
+			Texts:     inputs,
+			InputType: "search_document",
+		}, nil
+	default:
+		return nil, fmt.Errorf("model %s is not a supported bedrock embedding model", awsModelId)
+	}
+}
+
+func newEmbeddingParamError(err error) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// doTitanEmbeddingRequest 以转换后的请求体为模板逐条发送输入，遇到非 200 响应时直接返回交给上层处理错误
+func (a *Adaptor) doTitanEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, requestURL string, body []byte) (any, error) {
+	var template map[string]any
+	if err := common.Unmarshal(body, &template); err != nil {
+		return nil, errors.Wrap(err, "decode titan embedding request fail")
+	}
+	a.TitanEmbeddings = make([]AwsTitanEmbeddingResponse, 0, len(a.EmbeddingInputs))
+	for _, input := range a.EmbeddingInputs {
+		template["inputText"] = input
+		inputBody, err := common.Marshal(template)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := doBedrockRequest(c, info, requestURL, "application/json", inputBody)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		service.CloseResponseBodyGracefully(resp)
+		if err != nil {
+			return nil, err
+		}
+		var titanResp AwsTitanEmbeddingResponse
+		if err := common.Unmarshal(responseBody, &titanResp); err != nil {
+			return nil, errors.Wrap(err, "decode titan embedding response fail")
+		}
+		a.TitanEmbeddings = append(a.TitanEmbeddings, titanResp)
+	}
+	// 响应已全部读取，DoResponse 直接使用 a.TitanEmbeddings
+	return nil, nil
+}
+
+func writeEmbeddingResponse(c *gin.Context, info *relaycommon.RelayInfo, embeddings [][]float64, promptTokens int, encodingFormat string) (*dto.Usage, *types.NewAPIError) {
+	if promptTokens == 0 {
+		promptTokens = info.GetEstimatePromptTokens()
+	}
+	openAIResponse := dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, len(embeddings)),
+		Model:  info.UpstreamModelName,
+		Usage: dto.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	}
+	for i, embedding := range embeddings {
+		var data any = embedding
+		if encodingFormat == "base64" {
+			data = encodeEmbeddingBase64(embedding)
+		}
+		openAIResponse.Data = append(openAIResponse.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: data,
+		})
+	}
+	c.JSON(http.StatusOK, openAIResponse)
+	return &openAIResponse.Usage, nil
+}
+
+// encodeEmbeddingBase64 与 OpenAI 一致，按小端 float32 序列编码
+func encodeEmbeddingBase64(embedding []float64) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func titanEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*dto.Usage, *types.NewAPIError) {
+	embeddings := make([][]float64, 0, len(a.TitanEmbeddings))
+	promptTokens := 0
+	for _, titanResp := range a.TitanEmbeddings {
+		embeddings = append(embeddings, titanResp.Embedding)
+		promptTokens += titanResp.InputTextTokenCount
+	}
+	return writeEmbeddingResponse(c, info, embeddings, promptTokens, a.EmbeddingEncodingFormat)
+}
+
+func cohereEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response, encodingFormat string) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var cohereResp AwsCohereEmbeddingResponse
+	if err := common.Unmarshal(responseBody, &cohereResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	var embeddings [][]float64
+	if err := common.Unmarshal(cohereResp.Embeddings, &embeddings); err != nil {
+		var byType struct {
+			Float [][]float64 `json:"float"`
+		}
+		if err := common.Unmarshal(cohereResp.Embeddings, &byType); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		embeddings = byType.Float
+	}
+	// Cohere 响应体不含用量，输入 token 数由 Bedrock 在响应头中返回
+	promptTokens, _ := strconv.Atoi(resp.Header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	return writeEmbeddingResponse(c, info, embeddings, promptTokens, encodingFormat)
+}
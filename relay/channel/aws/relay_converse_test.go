@@ -0,0 +1,338 @@
+package aws
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const testAwsKey = "AKIDEXAMPLE|wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY|us-east-1"
+
+type recordedBedrockCall struct {
+	Path string
+	Body string
+}
+
+// newSigV4VerifyingStub 按记录的响应回放 Bedrock 接口，并检查请求带有 SigV4 签名；
+// 签名本身与官方 SDK 的一致性由 TestBedrockSigV4MatchesOfficialClient 校验
+func newSigV4VerifyingStub(t *testing.T, respond func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *[]recordedBedrockCall) {
+	calls := make([]recordedBedrockCall, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		calls = append(calls, recordedBedrockCall{Path: r.URL.EscapedPath(), Body: string(body)})
+
+		authorization := r.Header.Get("Authorization")
+		require.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), authorization)
+		require.Contains(t, authorization, "/us-east-1/bedrock/aws4_request")
+		require.Contains(t, authorization, "SignedHeaders=accept;content-length;content-type;host;x-amz-date,")
+		_, err = time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		require.NoError(t, err)
+
+		respond(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// TestBedrockSigV4MatchesOfficialClient 固定时间、密钥与请求体，签名须与官方 bedrockruntime 客户端记录的结果一致。
+// 记录时移除了官方客户端的 amz-sdk-invocation-id 与 amz-sdk-request 请求头并补充 Accept，使签名的请求头与网关一致
+func TestBedrockSigV4MatchesOfficialClient(t *testing.T) {
+	const (
+		recordedURL           = "https://bedrock-runtime.us-east-1.amazonaws.com/model/mistral.mistral-large-2407-v1%3A0/converse"
+		recordedBody          = `{"messages":[{"content":[{"text":"hi"}],"role":"user"}]}`
+		recordedDate          = "20261017T225050Z"
+		recordedAuthorization = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20261017/us-east-1/bedrock/aws4_request, " +
+			"SignedHeaders=accept;content-length;content-type;host;x-amz-date, " +
+			"Signature=b5070efd956b53b68db80254cb1a24e1ac1a9955279594275ccfa0e65a014d8d"
+	)
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiKey:            testAwsKey,
+			UpstreamModelName: "mistral.mistral-large-2407-v1:0",
+		},
+	}
+	requestURL, err := getBedrockRuntimeURL(info, "converse")
+	require.NoError(t, err)
+	require.Equal(t, recordedURL, requestURL)
+
+	signTime, err := time.Parse("20060102T150405Z", recordedDate)
+	require.NoError(t, err)
+	req, err := newBedrockRequest(info, requestURL, "application/json", []byte(recordedBody), signTime)
+	require.NoError(t, err)
+	require.Equal(t, recordedDate, req.Header.Get("X-Amz-Date"))
+	require.Equal(t, recordedAuthorization, req.Header.Get("Authorization"))
+}
+
+func newTestRelayContext(t *testing.T, baseURL string, model string, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	gin.SetMode(gin.TestMode)
+	service.InitHttpClient()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	info := &relaycommon.RelayInfo{
+		IsStream:           stream,
+		ShouldIncludeUsage: true,
+		RelayFormat:        types.RelayFormatOpenAI,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiKey:            testAwsKey,
+			ChannelBaseUrl:    baseURL,
+			UpstreamModelName: model,
+		},
+	}
+	return c, recorder, info
+}
+
+func relayThroughAdaptor(t *testing.T, c *gin.Context, info *relaycommon.RelayInfo, adaptor *Adaptor, converted any) *dto.Usage {
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	resp, err := adaptor.DoRequest(c, info, bytes.NewReader(body))
+	require.NoError(t, err)
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		require.Equal(t, http.StatusOK, httpResp.StatusCode)
+	}
+	usage, apiErr := adaptor.DoResponse(c, httpResp, info)
+	require.Nil(t, apiErr)
+	return usage.(*dto.Usage)
+}
+
+func TestConverseToolUseWithSigV4(t *testing.T) {
+	server, calls := newSigV4VerifyingStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"output":{"message":{"role":"assistant","content":[{"text":"Checking."},{"toolUse":{"toolUseId":"tooluse_1","name":"get_weather","input":{"city":"Paris"}}}]}},"stopReason":"tool_use","usage":{"inputTokens":20,"outputTokens":9,"totalTokens":29,"cacheReadInputTokens":4}}`))
+	})
+	c, recorder, info := newTestRelayContext(t, server.URL, "mistral-large-2407-v1:0", false)
+
+	var request dto.GeneralOpenAIRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"model": "mistral-large-2407-v1:0",
+		"max_tokens": 256,
+		"messages": [
+			{"role":"system","content":"be brief"},
+			{"role":"user","content":"weather in Paris?"},
+			{"role":"assistant","content":null,"tool_calls":[{"id":"tooluse_0","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+			{"role":"tool","tool_call_id":"tooluse_0","content":"sunny"}
+		],
+		"tools": [{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],
+		"tool_choice": "required"
+	}`, &request))
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertOpenAIRequest(c, info, &request)
+	require.NoError(t, err)
+	usage := relayThroughAdaptor(t, c, info, adaptor, converted)
+
+	require.Len(t, *calls, 1)
+	require.Equal(t, "/model/mistral.mistral-large-2407-v1%3A0/converse", (*calls)[0].Path)
+	require.JSONEq(t, `{
+		"messages": [
+			{"role":"user","content":[{"text":"weather in Paris?"}]},
+			{"role":"assistant","content":[{"toolUse":{"toolUseId":"tooluse_0","name":"get_weather","input":{"city":"Rome"}}}]},
+			{"role":"user","content":[{"toolResult":{"toolUseId":"tooluse_0","content":[{"text":"sunny"}]}}]}
+		],
+		"system": [{"text":"be brief"}],
+		"inferenceConfig": {"maxTokens":256},
+		"toolConfig": {"tools":[{"toolSpec":{"name":"get_weather","inputSchema":{"json":{"type":"object"}}}}],"toolChoice":{"any":{}}}
+	}`, (*calls)[0].Body)
+
+	var response dto.OpenAITextResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "tool_calls", response.Choices[0].FinishReason)
+	require.Equal(t, "Checking.", response.Choices[0].Message.StringContent())
+	toolCalls := response.Choices[0].Message.ParseToolCalls()
+	require.Len(t, toolCalls, 1)
+	require.Equal(t, "tooluse_1", toolCalls[0].ID)
+	require.JSONEq(t, `{"city":"Paris"}`, toolCalls[0].Function.Arguments)
+	require.Equal(t, 24, usage.PromptTokens)
+	require.Equal(t, 4, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 9, usage.CompletionTokens)
+}
+
+func writeConverseStreamEvent(t *testing.T, w io.Writer, eventType string, payload string) {
+	encoder := eventstream.NewEncoder()
+	require.NoError(t, encoder.Encode(w, eventstream.Message{
+		Headers: eventstream.Headers{
+			{Name: ":message-type", Value: eventstream.StringValue("event")},
+			{Name: ":event-type", Value: eventstream.StringValue(eventType)},
+			{Name: ":content-type", Value: eventstream.StringValue("application/json")},
+		},
+		Payload: []byte(payload),
+	}))
+}
+
+func TestConverseStreamWithSigV4(t *testing.T) {
+	server, calls := newSigV4VerifyingStub(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/vnd.amazon.eventstream", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		writeConverseStreamEvent(t, w, "messageStart", `{"role":"assistant"}`)
+		writeConverseStreamEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hel"}}`)
+		writeConverseStreamEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"lo"}}`)
+		writeConverseStreamEvent(t, w, "contentBlockStop", `{"contentBlockIndex":0}`)
+		writeConverseStreamEvent(t, w, "contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"f"}}}`)
+		writeConverseStreamEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"a\":1}"}}}`)
+		writeConverseStreamEvent(t, w, "contentBlockStop", `{"contentBlockIndex":1}`)
+		writeConverseStreamEvent(t, w, "messageStop", `{"stopReason":"tool_use"}`)
+		writeConverseStreamEvent(t, w, "metadata", `{"usage":{"inputTokens":7,"outputTokens":5,"totalTokens":12},"metrics":{"latencyMs":10}}`)
+	})
+	c, recorder, info := newTestRelayContext(t, server.URL, "nova-lite-v1:0", true)
+
+	var request dto.GeneralOpenAIRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{"model":"nova-lite-v1:0","stream":true,"messages":[{"role":"user","content":"hi"}]}`, &request))
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertOpenAIRequest(c, info, &request)
+	require.NoError(t, err)
+	usage := relayThroughAdaptor(t, c, info, adaptor, converted)
+
+	// us-east-1 下 Nova 走跨区域推理配置文件
+	require.Equal(t, "/model/us.amazon.nova-lite-v1%3A0/converse-stream", (*calls)[0].Path)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Equal(t, 5, usage.CompletionTokens)
+
+	var content, arguments strings.Builder
+	finishReasons := make([]string, 0)
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(data, &chunk))
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.GetContentString())
+			for _, toolCall := range choice.Delta.ToolCalls {
+				arguments.WriteString(toolCall.Function.Arguments)
+			}
+			if choice.FinishReason != nil {
+				finishReasons = append(finishReasons, *choice.FinishReason)
+			}
+		}
+	}
+	require.Equal(t, "Hello", content.String())
+	require.Equal(t, `{"a":1}`, arguments.String())
+	require.Equal(t, []string{"tool_calls"}, finishReasons)
+	require.True(t, strings.HasSuffix(strings.TrimSpace(recorder.Body.String()), "data: [DONE]"))
+}
+
+func TestTitanEmbeddingsWithSigV4(t *testing.T) {
+	server, calls := newSigV4VerifyingStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"embedding":[0.1,0.2],"inputTextTokenCount":3}`))
+	})
+	c, recorder, info := newTestRelayContext(t, server.URL, "titan-embed-text-v2:0", false)
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertEmbeddingRequest(c, info, dto.EmbeddingRequest{
+		Model:      "titan-embed-text-v2:0",
+		Input:      []any{"first", "second"},
+		Dimensions: 256,
+	})
+	require.NoError(t, err)
+	usage := relayThroughAdaptor(t, c, info, adaptor, converted)
+
+	require.Len(t, *calls, 2)
+	require.Equal(t, "/model/amazon.titan-embed-text-v2%3A0/invoke", (*calls)[0].Path)
+	require.JSONEq(t, `{"inputText":"first","dimensions":256,"normalize":true}`, (*calls)[0].Body)
+	require.JSONEq(t, `{"inputText":"second","dimensions":256,"normalize":true}`, (*calls)[1].Body)
+	require.Equal(t, 6, usage.PromptTokens)
+
+	var response dto.OpenAIEmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Len(t, response.Data, 2)
+	require.Equal(t, 1, response.Data[1].Index)
+	require.Equal(t, []float64{0.1, 0.2}, response.Data[1].Embedding)
+}
+
+func TestCohereEmbeddingsWithSigV4(t *testing.T) {
+	server, calls := newSigV4VerifyingStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Amzn-Bedrock-Input-Token-Count", "5")
+		_, _ = w.Write([]byte(`{"id":"e1","response_type":"embeddings_floats","texts":["a","b"],"embeddings":[[1,2],[3,4]]}`))
+	})
+	c, recorder, info := newTestRelayContext(t, server.URL, "cohere.embed-english-v3", false)
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertEmbeddingRequest(c, info, dto.EmbeddingRequest{
+		Model: "cohere.embed-english-v3",
+		Input: []any{"a", "b"},
+	})
+	require.NoError(t, err)
+	usage := relayThroughAdaptor(t, c, info, adaptor, converted)
+
+	require.Len(t, *calls, 1)
+	require.JSONEq(t, `{"texts":["a","b"],"input_type":"search_document"}`, (*calls)[0].Body)
+	require.Equal(t, 5, usage.PromptTokens)
+
+	var response dto.OpenAIEmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, []float64{3, 4}, response.Data[1].Embedding)
+}
+
+func TestCohereEmbeddingOptions(t *testing.T) {
+	server, _ := newSigV4VerifyingStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"e1","response_type":"embeddings_floats","texts":["a"],"embeddings":[[1,0.5]]}`))
+	})
+	c, recorder, info := newTestRelayContext(t, server.URL, "cohere.embed-english-v3", false)
+
+	// Cohere 不支持 dimensions，未知的 encoding_format 同样直接拒绝
+	_, err := (&Adaptor{}).ConvertEmbeddingRequest(c, info, dto.EmbeddingRequest{Input: "a", Dimensions: 256})
+	var apiErr *types.NewAPIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	_, err = (&Adaptor{}).ConvertEmbeddingRequest(c, info, dto.EmbeddingRequest{Input: "a", EncodingFormat: "int8"})
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertEmbeddingRequest(c, info, dto.EmbeddingRequest{Input: "a", EncodingFormat: "base64"})
+	require.NoError(t, err)
+	relayThroughAdaptor(t, c, info, adaptor, converted)
+
+	var response dto.FlexibleEmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &response))
+	// 1.0 与 0.5 的小端 float32 编码
+	require.Equal(t, "AACAPwAAAD8=", response.Data[0].Embedding)
+}
+
+func TestIsAwsClaudeModel(t *testing.T) {
+	cases := []struct {
+		model string
+		mode  dto.AwsRequestMode
+		want  bool
+	}{
+		{model: "claude-3-5-haiku-20241022", want: true},
+		{model: "us.anthropic.claude-3-7-sonnet-20250219-v1:0", want: true},
+		{model: "mistral.mistral-large-2407-v1:0", want: false},
+		{model: "us.meta.llama3-2-90b-instruct-v1:0", want: false},
+		{model: "arn:aws:bedrock:us-east-1::foundation-model/amazon.nova-pro-v1:0", want: false},
+		// 无法识别的推理配置文件 ARN 与自定义模型保持 InvokeModel
+		{model: "arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/abc123", want: true},
+		{model: "my-custom-model", want: true},
+		// 渠道显式指定时以渠道为准
+		{model: "arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/abc123", mode: dto.AwsRequestModeConverse, want: false},
+		{model: "mistral.mistral-large-2407-v1:0", mode: dto.AwsRequestModeInvoke, want: true},
+	}
+	for _, tc := range cases {
+		info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName:    tc.model,
+			ChannelOtherSettings: dto.ChannelOtherSettings{AwsRequestMode: tc.mode},
+		}}
+		require.Equal(t, tc.want, isAwsClaudeModel(info), tc.model)
+	}
+}
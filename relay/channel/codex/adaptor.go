@@ -25,6 +25,7 @@ func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayIn
 	return nil, errors.New("codex channel: endpoint not supported")
 }
 
+// ConvertClaudeRequest Claude Messages 请求由 relay 层转换为 Responses 请求后发送，不会走到这里
 func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
 	return nil, errors.New("codex channel: /v1/messages endpoint not supported")
 }
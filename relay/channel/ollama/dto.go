@@ -59,6 +59,7 @@ type OllamaEmbeddingRequest struct {
 	Input      interface{}    `json:"input"`
 	Options    map[string]any `json:"options,omitempty"`
 	Dimensions int            `json:"dimensions,omitempty"`
+	KeepAlive  interface{}    `json:"keep_alive,omitempty"`
 }
 
 type OllamaEmbeddingResponse struct {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -259,6 +260,28 @@ func requestOpenAI2Embeddings(r dto.EmbeddingRequest) *OllamaEmbeddingRequest {
 	return &OllamaEmbeddingRequest{Model: r.Model, Input: input, Options: opts, Dimensions: r.Dimensions}
 }
 
+// applyModelOption 将渠道为该模型配置的 keep_alive / num_ctx 作为默认值写入请求，请求中已指定的参数不覆盖
+func applyModelOption(info *relaycommon.RelayInfo, keepAlive *interface{}, options map[string]any) map[string]any {
+	option := info.ChannelOtherSettings.GetOllamaModelOption(info.UpstreamModelName)
+	if option.KeepAlive != "" && *keepAlive == nil {
+		// 纯数字按秒处理（Ollama 不接受 "-1" 这类无单位的字符串）
+		if seconds, err := strconv.Atoi(option.KeepAlive); err == nil {
+			*keepAlive = seconds
+		} else {
+			*keepAlive = option.KeepAlive
+		}
+	}
+	if option.NumCtx > 0 {
+		if options == nil {
+			options = map[string]any{}
+		}
+		if _, ok := options["num_ctx"]; !ok {
+			options["num_ctx"] = option.NumCtx
+		}
+	}
+	return options
+}
+
 func ollamaEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
 	var oResp OllamaEmbeddingResponse
 	body, err := io.ReadAll(resp.Body)
@@ -0,0 +1,40 @@
+package ollama
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyModelOption(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "qwen3:8b",
+			ChannelOtherSettings: dto.ChannelOtherSettings{
+				OllamaModelOptions: map[string]dto.OllamaModelOption{
+					"*":        {KeepAlive: "30m", NumCtx: 4096},
+					"qwen3:8b": {KeepAlive: "-1"},
+				},
+			},
+		},
+	}
+
+	chatReq := &OllamaChatRequest{Model: "qwen3:8b", Options: map[string]any{}}
+	chatReq.Options = applyModelOption(info, &chatReq.KeepAlive, chatReq.Options)
+	require.Equal(t, -1, chatReq.KeepAlive)
+	require.Equal(t, 4096, chatReq.Options["num_ctx"])
+
+	// 请求中已指定的参数不被覆盖
+	embedReq := &OllamaEmbeddingRequest{Model: "qwen3:8b", KeepAlive: "5m", Options: map[string]any{"num_ctx": 512}}
+	embedReq.Options = applyModelOption(info, &embedReq.KeepAlive, embedReq.Options)
+	require.Equal(t, "5m", embedReq.KeepAlive)
+	require.Equal(t, 512, embedReq.Options["num_ctx"])
+
+	info.UpstreamModelName = "llama3.2"
+	genReq := &OllamaGenerateRequest{Model: "llama3.2"}
+	genReq.Options = applyModelOption(info, &genReq.KeepAlive, genReq.Options)
+	require.Equal(t, "30m", genReq.KeepAlive)
+	require.Equal(t, 4096, genReq.Options["num_ctx"])
+}
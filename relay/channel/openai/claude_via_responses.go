@@ -0,0 +1,154 @@
+package openai
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readFinalResponsesFromStream 从 Responses SSE 中读取终态事件携带的完整响应，
+// 用于上游总是流式返回（如 Codex）而客户端请求非流式的情况
+func readFinalResponsesFromStream(body io.Reader) (*dto.OpenAIResponsesResponse, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	var final *dto.OpenAIResponsesResponse
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var event dto.ResponsesStreamResponse
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "response.completed", "response.incomplete", "response.failed":
+			final = event.Response
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if final == nil {
+		return nil, fmt.Errorf("responses stream ended without a final response")
+	}
+	return final, nil
+}
+
+func OaiResponsesToClaudeHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	if resp == nil || resp.Body == nil {
+		return nil, types.NewOpenAIError(fmt.Errorf("invalid response"), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	defer service.CloseResponseBodyGracefully(resp)
+
+	var responsesResp *dto.OpenAIResponsesResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		final, err := readFinalResponsesFromStream(resp.Body)
+		if err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		responsesResp = final
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+		}
+		responsesResp = &dto.OpenAIResponsesResponse{}
+		if err := common.Unmarshal(body, responsesResp); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+	}
+
+	if oaiError := responsesResp.GetOpenAIError(); oaiError != nil && oaiError.Type != "" {
+		return nil, types.WithOpenAIError(*oaiError, resp.StatusCode)
+	}
+
+	claudeResp := service.ResponsesResponseToClaudeResponse(responsesResp)
+	usage := service.ResponsesUsageToChatUsage(responsesResp.Usage)
+	if usage.TotalTokens == 0 {
+		text := service.ExtractOutputTextFromResponses(responsesResp)
+		usage = service.ResponseText2Usage(c, text, info.UpstreamModelName, info.GetEstimatePromptTokens())
+		claudeResp.Usage = &dto.ClaudeUsage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens}
+	}
+
+	responseBody, err := common.Marshal(claudeResp)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeJsonMarshalFailed, http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := c.Writer.Write(responseBody); err != nil {
+		logger.LogError(c, "failed to write claude response: "+err.Error())
+	}
+	return usage, nil
+}
+
+func OaiResponsesToClaudeStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	if resp == nil || resp.Body == nil {
+		return nil, types.NewOpenAIError(fmt.Errorf("invalid response"), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	defer service.CloseResponseBodyGracefully(resp)
+
+	converter := service.NewResponsesToClaudeStreamConverter(helper.GetResponseID(c), info.UpstreamModelName, info.GetEstimatePromptTokens())
+	var (
+		outputText strings.Builder
+		streamErr  *types.NewAPIError
+	)
+	sendClaudeEvents := func(events []*dto.ClaudeResponse) {
+		for _, event := range events {
+			_ = helper.ClaudeData(c, *event)
+		}
+	}
+
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var streamResp dto.ResponsesStreamResponse
+		if err := common.UnmarshalJsonStr(data, &streamResp); err != nil {
+			logger.LogError(c, "failed to unmarshal responses stream event: "+err.Error())
+			return true
+		}
+		switch streamResp.Type {
+		case "response.output_text.delta", "response.reasoning_summary_text.delta", "response.function_call_arguments.delta":
+			outputText.WriteString(streamResp.Delta)
+		case "response.error", "response.failed":
+			if streamResp.Response != nil {
+				if oaiErr := streamResp.Response.GetOpenAIError(); oaiErr != nil && oaiErr.Type != "" {
+					streamErr = types.WithOpenAIError(*oaiErr, http.StatusInternalServerError)
+					return false
+				}
+			}
+			streamErr = types.NewOpenAIError(fmt.Errorf("responses stream error: %s", streamResp.Type), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+			return false
+		}
+		sendClaudeEvents(converter.ConvertEvent(&streamResp))
+		return true
+	})
+
+	if streamErr != nil {
+		return nil, streamErr
+	}
+	if converter.Usage == nil || converter.Usage.TotalTokens == 0 && converter.Usage.OutputTokens == 0 {
+		converter.Usage = service.ResponseText2Usage(c, outputText.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
+		converter.Usage.InputTokens = converter.Usage.PromptTokens
+		converter.Usage.OutputTokens = converter.Usage.CompletionTokens
+	}
+	sendClaudeEvents(converter.Finish())
+	return service.ResponsesUsageToChatUsage(converter.Usage), nil
+}
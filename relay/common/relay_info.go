@@ -114,6 +114,8 @@ type RelayInfo struct {
 	UserSetting            dto.UserSetting
 	UserEmail              string
 	UserQuota              int
+	OrgId                  int // 用户所属组织
+	ProjectId              int // 令牌所属项目
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	ReceivedResponseCount  int
@@ -442,6 +444,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		UserGroup:  common.GetContextKeyString(c, constant.ContextKeyUserGroup),
 		UserQuota:  common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
 		UserEmail:  common.GetContextKeyString(c, constant.ContextKeyUserEmail),
+		OrgId:      common.GetContextKeyInt(c, constant.ContextKeyUserOrgId),
+		ProjectId:  common.GetContextKeyInt(c, constant.ContextKeyTokenProjectId),
 
 		OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
 
@@ -476,6 +480,10 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		info.RequestURLPath = strings.TrimPrefix(info.RequestURLPath, "/pg")
 		info.RequestURLPath = "/v1" + info.RequestURLPath
 	}
+	// 审计重放以管理员身份执行，没有真实令牌，与 playground 一样只结算用户额度
+	if common.GetContextKeyInt(c, constant.ContextKeyAuditReplayOf) > 0 {
+		info.IsPlayground = true
+	}
 
 	userSetting, ok := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
 	if ok {
@@ -524,6 +532,8 @@ func GenRelayInfo(c *gin.Context, relayFormat types.RelayFormat, request dto.Req
 		info = genBaseRelayInfo(c, nil)
 	case types.RelayFormatMjProxy:
 		info = genBaseRelayInfo(c, nil)
+	case types.RelayFormatOpenAIFineTuning:
+		info = genBaseRelayInfo(c, nil)
 	default:
 		err = errors.New("invalid relay format")
 	}
@@ -778,3 +788,38 @@ func RemoveGeminiDisabledFields(jsonData []byte) ([]byte, error) {
 	}
 	return jsonDataAfter, nil
 }
+
+// CloneForAttempt 为并发执行的对冲请求复制一份 RelayInfo，避免两个请求共享转换与计量的可变状态
+func (info *RelayInfo) CloneForAttempt() *RelayInfo {
+	cp := *info
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		if claudeConvertInfo.Usage != nil {
+			usage := *claudeConvertInfo.Usage
+			claudeConvertInfo.Usage = &usage
+		}
+		cp.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.RerankerInfo != nil {
+		rerankerInfo := *info.RerankerInfo
+		cp.RerankerInfo = &rerankerInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		responsesUsageInfo := ResponsesUsageInfo{BuiltInTools: make(map[string]*BuildInToolInfo, len(info.BuiltInTools))}
+		for name, tool := range info.BuiltInTools {
+			toolInfo := *tool
+			responsesUsageInfo.BuiltInTools[name] = &toolInfo
+		}
+		cp.ResponsesUsageInfo = &responsesUsageInfo
+	}
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		cp.ChannelMeta = &channelMeta
+	}
+	if info.TaskRelayInfo != nil {
+		taskRelayInfo := *info.TaskRelayInfo
+		cp.TaskRelayInfo = &taskRelayInfo
+	}
+	cp.RequestConversionChain = append([]types.RelayFormat(nil), info.RequestConversionChain...)
+	return &cp
+}
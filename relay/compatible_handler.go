@@ -40,6 +40,12 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return types.NewError(fmt.Errorf("failed to copy request to GeneralOpenAIRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	restorePII, err := startPIIRedaction(c, info, request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	defer restorePII()
+
 	if request.WebSearchOptions != nil {
 		c.Set("chat_completion_web_search_context_size", request.WebSearchOptions.SearchContextSize)
 	}
@@ -98,6 +104,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	}
 
 	var requestBody io.Reader
+	var cacheLookup *service.ResponseCacheLookup
 
 	if passThroughGlobal || info.ChannelSetting.PassThroughBodyEnabled {
 		body, err := common.GetRequestBody(c)
@@ -178,6 +185,16 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 		logger.LogDebug(c, fmt.Sprintf("text request body: %s", string(jsonData)))
 
+		if info.RelayMode == relayconstant.RelayModeChatCompletions {
+			cacheLookup = service.PrepareResponseCache(c, info, jsonData)
+			if entry, ok := service.GetCachedResponse(c, cacheLookup); ok {
+				service.MarkResponseCacheHit(c, info)
+				replayCachedResponse(c, info, entry)
+				postConsumeQuota(c, info, &entry.Usage)
+				return nil
+			}
+		}
+
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
@@ -200,7 +217,25 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 	}
 
+	var finishCapture func(usage *dto.Usage)
+	if cacheLookup != nil {
+		finishCapture = startResponseCapture(c, info, cacheLookup, operation_setting.GetResponseCacheSetting().MaxBodyBytes)
+	}
+	var finishModeration func(success bool)
+	if info.RelayMode == relayconstant.RelayModeChatCompletions && operation_setting.GetModerationSetting().HasStage(true) {
+		finishModeration = startCompletionModeration(c, info)
+	}
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	if finishModeration != nil {
+		finishModeration(newApiErr == nil)
+	}
+	if finishCapture != nil {
+		var cachedUsage *dto.Usage
+		if newApiErr == nil {
+			cachedUsage, _ = usage.(*dto.Usage)
+		}
+		finishCapture(cachedUsage)
+	}
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
@@ -219,6 +254,10 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent ...string) {
+	if service.IsHedgeLoser(ctx) {
+		// 对冲请求落败的一方不计费
+		return
+	}
 	originUsage := usage
 	if usage == nil {
 		usage = &dto.Usage{
@@ -488,7 +527,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["image_generation_call"] = true
 		other["image_generation_call_price"] = imageGenerationCallPrice
 	}
-	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+	service.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
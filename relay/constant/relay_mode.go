@@ -3,6 +3,8 @@ package constant
 import (
 	"net/http"
 	"strings"
+
+	"github.com/QuantumNous/new-api/types"
 )
 
 const (
@@ -94,6 +96,48 @@ func Path2RelayMode(path string) int {
 	return relayMode
 }
 
+// Path2RelayFormat 根据请求路径判断接口格式，用于令牌范围校验；无法识别时返回空
+func Path2RelayFormat(path string) types.RelayFormat {
+	switch {
+	case strings.Contains(path, "/mj/"):
+		return types.RelayFormatMjProxy
+	case strings.HasPrefix(path, "/suno/") || strings.HasPrefix(path, "/kling/") || strings.HasPrefix(path, "/jimeng") ||
+		strings.HasPrefix(path, "/v1/video"):
+		return types.RelayFormatTask
+	case strings.HasPrefix(path, "/v1/messages"):
+		return types.RelayFormatClaude
+	case strings.HasPrefix(path, "/v1/chat/completions") || strings.HasPrefix(path, "/v1/completions") ||
+		strings.HasPrefix(path, "/v1/moderations") || strings.HasPrefix(path, "/pg/chat/completions"):
+		return types.RelayFormatOpenAI
+	case strings.HasPrefix(path, "/v1/responses/compact"):
+		return types.RelayFormatOpenAIResponsesCompaction
+	case strings.HasPrefix(path, "/v1/responses"):
+		return types.RelayFormatOpenAIResponses
+	case strings.HasPrefix(path, "/v1/images") || strings.HasPrefix(path, "/v1/edits"):
+		return types.RelayFormatOpenAIImage
+	case strings.HasPrefix(path, "/v1/audio"):
+		return types.RelayFormatOpenAIAudio
+	case strings.HasPrefix(path, "/v1/realtime"):
+		return types.RelayFormatOpenAIRealtime
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return types.RelayFormatRerank
+	// Gemini 的 embedContent 与 /v1/engines/:model/embeddings 也按向量接口处理
+	case strings.HasSuffix(path, "embeddings") || strings.HasSuffix(path, ":embedContent") || strings.HasSuffix(path, ":batchEmbedContents"):
+		return types.RelayFormatEmbedding
+	case strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1/models"):
+		return types.RelayFormatGemini
+	case strings.HasPrefix(path, "/v1/batches"):
+		return types.RelayFormatOpenAIBatch
+	case strings.HasPrefix(path, "/v1/files"):
+		return types.RelayFormatOpenAIFile
+	case strings.HasPrefix(path, "/v1/fine_tuning") || strings.HasPrefix(path, "/v1/fine-tunes"):
+		return types.RelayFormatOpenAIFineTuning
+	case strings.HasPrefix(path, "/v1/delegated_tokens"):
+		return types.RelayFormatDelegatedToken
+	}
+	return ""
+}
+
 func Path2RelayModeMidjourney(path string) int {
 	relayMode := RelayModeUnknown
 	if strings.HasSuffix(path, "/mj/submit/action") {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -42,6 +43,12 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// batch lines executed by the gateway are billed with the batch discount
+	if common.GetContextKeyString(ctx, constant.ContextKeyRelayBatchId) != "" {
+		groupRatioInfo.BatchRatio = ratio_setting.GetBatchRatio(relayInfo.OriginModelName)
+		groupRatioInfo.GroupRatio *= groupRatioInfo.BatchRatio
+	}
+
 	return groupRatioInfo
 }
 
@@ -0,0 +1,298 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const moderationFinishReason = "content_filter"
+
+// moderationEvent 暂存的一个 SSE 事件，payload 为 chat.completion.chunk 时可改写内容
+type moderationEvent struct {
+	raw     []byte
+	payload []byte
+}
+
+// moderationWriter 暂存补全内容，审核通过后再下发：非流式在结束时整体审核，
+// 流式每累积 checkChars 个字符或遇到结束事件时审核一次
+type moderationWriter struct {
+	gin.ResponseWriter
+	c          *gin.Context
+	info       *relaycommon.RelayInfo
+	stream     bool
+	checkChars int
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	held      []moderationEvent
+	heldText  map[int]*strings.Builder
+	heldChars int
+	// 已下发内容的末尾，与暂存内容一起审核，避免违规内容跨越两次检测被拆开
+	released  map[int]string
+	indices   map[int]struct{}
+	lastChunk []byte
+	blocked   bool
+}
+
+func (w *moderationWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stream {
+		return w.buf.Write(data)
+	}
+	if w.blocked {
+		return len(data), nil
+	}
+	w.buf.Write(data)
+	for {
+		idx := bytes.Index(w.buf.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := make([]byte, idx+2)
+		copy(event, w.buf.Next(idx+2))
+		w.handleEvent(event)
+		if w.blocked {
+			w.buf.Reset()
+			break
+		}
+	}
+	return len(data), nil
+}
+
+func (w *moderationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 由审核结果决定何时下发，忽略处理器的主动刷新
+func (w *moderationWriter) Flush() {}
+
+func ssePayload(event []byte) []byte {
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("data:")) {
+			return bytes.TrimSpace(line[len("data:"):])
+		}
+	}
+	return nil
+}
+
+func (w *moderationWriter) handleEvent(event []byte) {
+	payload := ssePayload(event)
+	if payload == nil || string(payload) == "[DONE]" || !gjson.ValidBytes(payload) {
+		w.held = append(w.held, moderationEvent{raw: event})
+		if string(payload) == "[DONE]" {
+			w.check()
+		}
+		return
+	}
+	finished := false
+	choices := gjson.GetBytes(payload, "choices")
+	choices.ForEach(func(_, choice gjson.Result) bool {
+		index := int(choice.Get("index").Int())
+		w.indices[index] = struct{}{}
+		if content := choice.Get("delta.content").String(); content != "" {
+			if w.heldText[index] == nil {
+				w.heldText[index] = &strings.Builder{}
+			}
+			w.heldText[index].WriteString(content)
+			w.heldChars += len(content)
+		}
+		if reason := choice.Get("finish_reason"); reason.Exists() && reason.String() != "" {
+			finished = true
+		}
+		return true
+	})
+	if choices.Exists() {
+		w.lastChunk = payload
+	}
+	w.held = append(w.held, moderationEvent{raw: event, payload: payload})
+	if finished || w.heldChars >= w.checkChars {
+		w.check()
+	}
+}
+
+// check 审核暂存的内容，通过后下发，redact 时将脱敏文本写入该 choice 的第一个内容事件并清空其余事件的内容
+func (w *moderationWriter) check() {
+	indices := make([]int, 0, len(w.heldText))
+	for index := range w.heldText {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		tail := w.released[index]
+		held := w.heldText[index].String()
+		action, redacted := service.ModerateCompletion(w.c, w.info, tail+held)
+		switch action {
+		case operation_setting.ModerationActionBlock:
+			w.block()
+			return
+		case operation_setting.ModerationActionRedact:
+			if strings.HasPrefix(redacted, tail) {
+				held = strings.TrimPrefix(redacted, tail)
+			} else {
+				// 命中内容跨越了已下发的部分，只能整体替换暂存内容
+				held = service.ModerationRedactPlaceholder
+			}
+			w.rewriteHeld(index, held)
+		}
+		if action == operation_setting.ModerationActionLog {
+			// 已记录的命中不再随末尾重复审核
+			w.released[index] = ""
+			continue
+		}
+		released := []rune(tail + held)
+		if len(released) > w.checkChars {
+			released = released[len(released)-w.checkChars:]
+		}
+		w.released[index] = string(released)
+	}
+	for _, event := range w.held {
+		if _, err := w.ResponseWriter.Write(event.raw); err != nil {
+			break
+		}
+	}
+	w.ResponseWriter.Flush()
+	w.held = nil
+	w.heldText = make(map[int]*strings.Builder)
+	w.heldChars = 0
+}
+
+func (w *moderationWriter) rewriteHeld(index int, redacted string) {
+	first := true
+	for i := range w.held {
+		event := &w.held[i]
+		if event.payload == nil {
+			continue
+		}
+		payload := event.payload
+		gjson.GetBytes(payload, "choices").ForEach(func(key, choice gjson.Result) bool {
+			if int(choice.Get("index").Int()) != index || choice.Get("delta.content").String() == "" {
+				return true
+			}
+			content := ""
+			if first {
+				content = redacted
+				first = false
+			}
+			if updated, err := sjson.SetBytes(payload, "choices."+key.String()+".delta.content", content); err == nil {
+				payload = updated
+			}
+			return true
+		})
+		event.payload = payload
+		event.raw = []byte("data: " + string(payload) + "\n\n")
+	}
+}
+
+// block 丢弃暂存内容，以 content_filter 结束本次流式响应，之后上游的输出不再下发
+func (w *moderationWriter) block() {
+	w.blocked = true
+	w.held = nil
+	ending := dto.ChatCompletionsStreamResponse{
+		Id:      gjson.GetBytes(w.lastChunk, "id").String(),
+		Object:  "chat.completion.chunk",
+		Created: gjson.GetBytes(w.lastChunk, "created").Int(),
+		Model:   gjson.GetBytes(w.lastChunk, "model").String(),
+	}
+	if len(w.indices) == 0 {
+		w.indices[0] = struct{}{}
+	}
+	for index := range w.indices {
+		reason := moderationFinishReason
+		ending.Choices = append(ending.Choices, dto.ChatCompletionsStreamResponseChoice{Index: index, FinishReason: &reason})
+	}
+	sort.Slice(ending.Choices, func(i, j int) bool { return ending.Choices[i].Index < ending.Choices[j].Index })
+	data, err := common.Marshal(ending)
+	if err != nil {
+		return
+	}
+	w.ResponseWriter.Write([]byte("data: " + string(data) + "\n\n"))
+	w.ResponseWriter.Write([]byte("data: [DONE]\n\n"))
+	w.ResponseWriter.Flush()
+}
+
+// finishNonStream 审核完整响应中每个 choice 的内容，拦截时清空内容并将 finish_reason 置为 content_filter
+func (w *moderationWriter) finishNonStream(success bool) {
+	body := w.buf.Bytes()
+	if success && w.Status() == http.StatusOK && gjson.ValidBytes(body) {
+		gjson.GetBytes(body, "choices").ForEach(func(key, choice gjson.Result) bool {
+			content := choice.Get("message.content")
+			if content.Type != gjson.String || content.String() == "" {
+				return true
+			}
+			action, redacted := service.ModerateCompletion(w.c, w.info, content.String())
+			prefix := "choices." + key.String()
+			switch action {
+			case operation_setting.ModerationActionBlock:
+				body, _ = sjson.SetBytes(body, prefix+".message.content", "")
+				body, _ = sjson.SetBytes(body, prefix+".finish_reason", moderationFinishReason)
+			case operation_setting.ModerationActionRedact:
+				body, _ = sjson.SetBytes(body, prefix+".message.content", redacted)
+			}
+			return true
+		})
+		if w.Header().Get("Content-Length") != "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	if len(body) > 0 {
+		if _, err := w.ResponseWriter.Write(body); err != nil {
+			common.SysError(fmt.Sprintf("failed to write moderated response: %s", err.Error()))
+		}
+	}
+}
+
+// startCompletionModeration 替换 c.Writer 以审核补全内容，返回的函数恢复原 writer 并下发剩余内容
+func startCompletionModeration(c *gin.Context, info *relaycommon.RelayInfo) func(success bool) {
+	original := c.Writer
+	checkChars := operation_setting.GetModerationSetting().StreamCheckChars
+	if checkChars <= 0 {
+		checkChars = 200
+	}
+	writer := &moderationWriter{
+		ResponseWriter: original,
+		c:              c,
+		info:           info,
+		stream:         info.IsStream,
+		checkChars:     checkChars,
+		heldText:       make(map[int]*strings.Builder),
+		released:       make(map[int]string),
+		indices:        make(map[int]struct{}),
+	}
+	c.Writer = writer
+	return func(success bool) {
+		writer.mu.Lock()
+		defer writer.mu.Unlock()
+		c.Writer = original
+		if !writer.stream {
+			writer.finishNonStream(success)
+			return
+		}
+		if writer.blocked {
+			return
+		}
+		if writer.buf.Len() > 0 {
+			writer.handleEvent(append([]byte(nil), writer.buf.Bytes()...))
+			writer.buf.Reset()
+		}
+		if !writer.blocked && (len(writer.held) > 0 || writer.heldChars > 0) {
+			writer.check()
+		}
+	}
+}
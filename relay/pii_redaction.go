@@ -0,0 +1,185 @@
+package relay
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式响应中的增量文本与工具调用参数字段
+var piiStreamExtraKeys = []string{"delta", "arguments", "partial_json"}
+
+// piiRehydrateWriter 将上游响应中的占位符还原为原值：流式响应逐个 SSE 事件处理，非流式响应在结束时整体处理
+type piiRehydrateWriter struct {
+	gin.ResponseWriter
+	rehydrator *service.PIIRehydrator
+
+	mu     sync.Mutex
+	stream bool
+	sniff  bool
+	buf    bytes.Buffer
+	// 产生暂存文本的事件，补发暂存文本时以其为模板
+	carryEvents map[string][]byte
+}
+
+func (w *piiRehydrateWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.sniff {
+		w.sniff = true
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	w.buf.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		idx := bytes.Index(w.buf.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := w.buf.Next(idx + 2)
+		if err := w.writeEvent(event); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// writeEvent 还原并写出单个事件；之前暂存的字段在本事件中没有后续片段时，先补发暂存文本
+func (w *piiRehydrateWriter) writeEvent(event []byte) error {
+	restored, touched := w.restoreEvent(event)
+	for _, key := range w.rehydrator.PendingChunkKeys() {
+		if touched[key] {
+			continue
+		}
+		if err := w.flushCarry(key); err != nil {
+			return err
+		}
+	}
+	_, err := w.ResponseWriter.Write(restored)
+	return err
+}
+
+// flushCarry 以产生暂存文本的事件为模板补发一个事件，模板中其他文本字段置空
+func (w *piiRehydrateWriter) flushCarry(key string) error {
+	text := w.rehydrator.FlushChunk(key)
+	template := w.carryEvents[key]
+	delete(w.carryEvents, key)
+	if text == "" || template == nil {
+		return nil
+	}
+	lines := bytes.Split(template, []byte("\n"))
+	for i, line := range lines {
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		payload := bytes.TrimSpace(line[len("data:"):])
+		if len(payload) == 0 || payload[0] != '{' {
+			continue
+		}
+		rewritten, _ := service.RewritePIITextFields(payload, piiStreamExtraKeys, func(path string, _ string) string {
+			if path == key {
+				return text
+			}
+			return ""
+		})
+		lines[i] = append([]byte("data: "), rewritten...)
+	}
+	_, err := w.ResponseWriter.Write(bytes.Join(lines, []byte("\n")))
+	return err
+}
+
+func (w *piiRehydrateWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// restoreEvent 还原单个 SSE 事件中 data 行的文本字段，同时返回本事件出现过的文本字段
+func (w *piiRehydrateWriter) restoreEvent(event []byte) ([]byte, map[string]bool) {
+	lines := bytes.Split(event, []byte("\n"))
+	touched := make(map[string]bool)
+	changed := false
+	for i, line := range lines {
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		payload := bytes.TrimSpace(line[len("data:"):])
+		if len(payload) == 0 || payload[0] != '{' {
+			continue
+		}
+		restored, ok := service.RewritePIITextFields(payload, piiStreamExtraKeys, func(path string, text string) string {
+			touched[path] = true
+			return w.rehydrator.RestoreChunk(path, text)
+		})
+		if ok {
+			lines[i] = append([]byte("data: "), restored...)
+			changed = true
+		}
+	}
+	for _, key := range w.rehydrator.PendingChunkKeys() {
+		if touched[key] {
+			if w.carryEvents == nil {
+				w.carryEvents = make(map[string][]byte)
+			}
+			w.carryEvents[key] = append([]byte(nil), event...)
+		}
+	}
+	if !changed {
+		return event, touched
+	}
+	return bytes.Join(lines, []byte("\n")), touched
+}
+
+func (w *piiRehydrateWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stream {
+		if w.buf.Len() > 0 {
+			event := w.buf.Bytes()
+			if !bytes.HasSuffix(event, []byte("\n\n")) {
+				event = append(event, "\n\n"...)
+			}
+			w.writeEvent(event)
+		}
+		// 流已结束，剩余的暂存文本全部补发
+		for _, key := range w.rehydrator.PendingChunkKeys() {
+			w.flushCarry(key)
+		}
+		return
+	}
+	if w.buf.Len() == 0 {
+		return
+	}
+	// 占位符不会与正常内容冲突，直接在整个响应体中替换，工具调用参数中的占位符也能还原
+	body := w.rehydrator.RestoreJSON(w.buf.Bytes())
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.Write(body)
+}
+
+// startPIIRedaction 在请求转换前脱敏个人信息，并替换 c.Writer 以在响应中还原；
+// 透传请求体时上游收到的是原始请求，不做处理。返回的函数需在处理结束时调用
+func startPIIRedaction[T any](c *gin.Context, info *relaycommon.RelayInfo, request *T) (func(), error) {
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+		return func() {}, nil
+	}
+	mapping, err := service.RedactRequestPII(c, info, request)
+	if err != nil || len(mapping) == 0 {
+		return func() {}, err
+	}
+	original := c.Writer
+	writer := &piiRehydrateWriter{ResponseWriter: original, rehydrator: service.NewPIIRehydrator(mapping)}
+	c.Writer = writer
+	return func() {
+		c.Writer = original
+		writer.finish()
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/ali"
 	"github.com/QuantumNous/new-api/relay/channel/aws"
@@ -51,6 +52,14 @@ import (
 )
 
 func GetAdaptor(apiType int) channel.Adaptor {
+	adaptor := getAdaptor(apiType)
+	if adaptor != nil && tracing.Enabled() {
+		return &tracedAdaptor{Adaptor: adaptor}
+	}
+	return adaptor
+}
+
+func getAdaptor(apiType int) channel.Adaptor {
 	switch apiType {
 	case constant.APITypeAli:
 		return &ali.Adaptor{}
@@ -0,0 +1,89 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const responseCacheHeader = "X-New-Api-Cache"
+
+// responseCaptureWriter 在写给客户端的同时保存响应体，超过上限后停止保存
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.limit > 0 && w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(data)
+}
+
+func (w *responseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// startResponseCapture 替换 c.Writer 以保存本次响应，返回的函数恢复原 writer 并在成功时写入缓存
+func startResponseCapture(c *gin.Context, info *relaycommon.RelayInfo, lookup *service.ResponseCacheLookup, maxBytes int) func(usage *dto.Usage) {
+	original := c.Writer
+	writer := &responseCaptureWriter{ResponseWriter: original, limit: maxBytes}
+	c.Writer = writer
+	c.Header(responseCacheHeader, "MISS")
+	return func(usage *dto.Usage) {
+		c.Writer = original
+		if usage == nil || writer.overflow || writer.Status() != http.StatusOK || service.IsHedgeLoser(c) {
+			return
+		}
+		service.StoreCachedResponse(lookup, service.ResponseCacheEntry{
+			Stream:      info.IsStream,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.buf.Bytes(),
+			Usage:       *usage,
+		})
+	}
+}
+
+// replayCachedResponse 原样回放缓存的响应，流式响应按 SSE 事件逐个写出
+func replayCachedResponse(c *gin.Context, info *relaycommon.RelayInfo, entry *service.ResponseCacheEntry) {
+	info.IsStream = entry.Stream
+	c.Header(responseCacheHeader, "HIT")
+	if !entry.Stream {
+		info.SetFirstResponseTime()
+		c.Data(http.StatusOK, entry.ContentType, entry.Body)
+		return
+	}
+	helper.SetEventStreamHeaders(c)
+	info.SetFirstResponseTime()
+	for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+		if len(event) == 0 {
+			continue
+		}
+		if _, err := c.Writer.Write(event); err != nil {
+			return
+		}
+		if err := helper.FlushWriter(c); err != nil {
+			return
+		}
+	}
+}
@@ -60,6 +60,24 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("failed to copy request to GeneralOpenAIRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	bridged := shouldResponsesUseChatCompletions(info.ApiType)
+	finishStore := func(bool) {}
+	if info.RelayMode != relayconstant.RelayModeResponsesCompact {
+		// 保存脱敏前的原始请求与返回给客户端的响应，桥接渠道的响应仅保存在网关；
+		// 先于个人信息脱敏安装，保存的是占位符还原后的响应，与原始请求一致
+		finishStore = startResponsesStore(c, info, responsesReq, !bridged)
+	}
+	storeSucceeded := false
+	defer func() {
+		finishStore(storeSucceeded)
+	}()
+
+	restorePII, err := startPIIRedaction(c, info, request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	defer restorePII()
+
 	err = helper.ModelMappedHelper(c, info, request)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
@@ -70,6 +88,15 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
+	if bridged {
+		usage, newAPIError := responsesViaChatCompletions(c, info, adaptor, request)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		storeSucceeded = true
+		postConsumeQuota(c, info, usage)
+		return nil
+	}
 	var requestBody io.Reader
 	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
 		body, err := common.GetRequestBody(c)
@@ -152,6 +179,7 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return nil
 	}
 
+	storeSucceeded = true
 	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, info, usageDto, "")
 	} else {
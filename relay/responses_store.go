@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesStoreWriter 在写给客户端的同时截取最终的响应对象：
+// 非流式保存响应体，流式只保留 response.completed / response.incomplete 事件中的响应
+type responsesStoreWriter struct {
+	gin.ResponseWriter
+	stream   bool
+	limit    int
+	overflow bool
+	body     bytes.Buffer
+	pending  bytes.Buffer
+	final    json.RawMessage
+}
+
+func (w *responsesStoreWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if !w.stream {
+		if w.limit > 0 && w.body.Len()+len(data) > w.limit {
+			w.overflow = true
+			w.body.Reset()
+			return
+		}
+		w.body.Write(data)
+		return
+	}
+	w.pending.Write(data)
+	for {
+		line, err := w.pending.ReadString('\n')
+		if err != nil {
+			w.pending.Reset()
+			w.pending.WriteString(line)
+			if w.limit > 0 && w.pending.Len() > w.limit {
+				w.overflow = true
+				w.pending.Reset()
+			}
+			return
+		}
+		w.captureLine(line)
+	}
+}
+
+func (w *responsesStoreWriter) captureLine(line string) {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return
+	}
+	// 只解析终态事件，避免逐条反序列化增量事件
+	if !strings.Contains(data, `"response.completed"`) && !strings.Contains(data, `"response.incomplete"`) {
+		return
+	}
+	var event struct {
+		Type     string          `json:"type"`
+		Response json.RawMessage `json:"response"`
+	}
+	if err := common.UnmarshalJsonStr(strings.TrimSpace(data), &event); err != nil {
+		return
+	}
+	if event.Type == "response.completed" || event.Type == "response.incomplete" {
+		w.final = event.Response
+	}
+}
+
+func (w *responsesStoreWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responsesStoreWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responsesStoreWriter) response() []byte {
+	if w.overflow {
+		return nil
+	}
+	if w.stream {
+		return w.final
+	}
+	return w.body.Bytes()
+}
+
+// startResponsesStore 替换 c.Writer 以截取本次响应，返回的函数恢复原 writer 并在成功时保存响应；
+// 未启用存储或请求设置 store=false 时返回空操作
+func startResponsesStore(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, upstreamStored bool) func(success bool) {
+	setting := operation_setting.GetResponseStoreSetting()
+	if !setting.Enabled || service.IsResponseStoreDisabledByRequest(request) {
+		return func(bool) {}
+	}
+	original := c.Writer
+	writer := &responsesStoreWriter{ResponseWriter: original, stream: info.IsStream, limit: setting.MaxBodyBytes}
+	c.Writer = writer
+	return func(success bool) {
+		c.Writer = original
+		if !success || writer.Status() != http.StatusOK || service.IsHedgeLoser(c) {
+			return
+		}
+		body := writer.response()
+		if len(body) == 0 {
+			return
+		}
+		if err := service.SaveStoredResponse(c, request, info.ChannelId, info.ChannelMultiKeyIndex, upstreamStored, body); err != nil {
+			logger.LogWarn(c, "failed to store response: "+err.Error())
+		}
+	}
+}
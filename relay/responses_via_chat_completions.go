@@ -0,0 +1,312 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldResponsesUseChatCompletions 上游不支持 /v1/responses 的渠道，请求经 Chat 转换为原生格式，响应再合成为 Responses 格式
+func shouldResponsesUseChatCompletions(apiType int) bool {
+	switch apiType {
+	case constant.APITypeAnthropic, constant.APITypeGemini, constant.APITypeVertexAi, constant.APITypeAws:
+		return true
+	default:
+		return false
+	}
+}
+
+// responsesBridgeWriter 截获适配器输出的 Chat 格式响应并改写为 Responses 格式：
+// 流式时逐条转换 SSE 分片，非流式时缓存完整响应体，由 finish 统一转换输出
+type responsesBridgeWriter struct {
+	gin.ResponseWriter
+	header    http.Header
+	status    int
+	stream    bool
+	id        string
+	started   bool
+	pending   bytes.Buffer
+	body      bytes.Buffer
+	errorBody bytes.Buffer // 流式时适配器输出的非 SSE 内容（通常是错误响应体）
+	converter *openaicompat.ChatToResponsesStreamConverter
+}
+
+func newResponsesBridgeWriter(original gin.ResponseWriter, id string, model string, stream bool) *responsesBridgeWriter {
+	return &responsesBridgeWriter{
+		ResponseWriter: original,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+		stream:         stream,
+		id:             id,
+		converter:      service.NewChatToResponsesStreamConverter(id, model, common.GetTimestamp()),
+	}
+}
+
+func (w *responsesBridgeWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responsesBridgeWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *responsesBridgeWriter) WriteHeaderNow() {}
+
+func (w *responsesBridgeWriter) Status() int {
+	return w.status
+}
+
+func (w *responsesBridgeWriter) Write(data []byte) (int, error) {
+	if !w.stream {
+		return w.body.Write(data)
+	}
+	w.pending.Write(data)
+	if err := w.processLines(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *responsesBridgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesBridgeWriter) Flush() {
+	if w.stream && w.started {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// start 发出响应头与 response.created 事件
+func (w *responsesBridgeWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	for k, v := range w.header {
+		if k == "Content-Length" {
+			continue
+		}
+		w.ResponseWriter.Header()[k] = v
+	}
+	w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+	w.ResponseWriter.WriteHeader(w.status)
+	return w.writeEvents(w.converter.Start())
+}
+
+func (w *responsesBridgeWriter) writeEvents(events []dto.ResponsesStreamResponse) error {
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+	}
+	if len(events) > 0 {
+		w.ResponseWriter.Flush()
+	}
+	return nil
+}
+
+func (w *responsesBridgeWriter) processLines() error {
+	for {
+		line, err := w.pending.ReadString('\n')
+		if err != nil {
+			// 不完整的行留待下次写入
+			w.pending.Reset()
+			w.pending.WriteString(line)
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if err := w.start(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, ":") {
+			// 保活注释原样转发
+			if _, err := w.ResponseWriter.WriteString(line + "\n\n"); err != nil {
+				return err
+			}
+			w.ResponseWriter.Flush()
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			if line != "" && !strings.HasPrefix(line, "event:") && !strings.HasPrefix(line, "id:") && !strings.HasPrefix(line, "retry:") {
+				w.errorBody.WriteString(line)
+				w.errorBody.WriteByte('\n')
+			}
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			common.SysLog("responses bridge: failed to unmarshal chat chunk: " + err.Error())
+			continue
+		}
+		if err := w.writeEvents(w.converter.ConvertChunk(&chunk)); err != nil {
+			return err
+		}
+	}
+}
+
+// finish 输出剩余的事件或转换后的完整响应，usage 为适配器统计的最终用量
+func (w *responsesBridgeWriter) finish(usage *dto.Usage) error {
+	if w.stream {
+		if w.pending.Len() > 0 {
+			w.pending.WriteString("\n")
+			if err := w.processLines(); err != nil {
+				return err
+			}
+		}
+		if err := w.start(); err != nil {
+			return err
+		}
+		if w.errorBody.Len() > 0 {
+			code, message := parseBridgeErrorBody(w.errorBody.Bytes())
+			return w.writeEvents(w.converter.Fail(code, message))
+		}
+		return w.writeEvents(w.converter.Finish(usage))
+	}
+
+	var chatResp dto.OpenAITextResponse
+	if err := common.Unmarshal(w.body.Bytes(), &chatResp); err != nil {
+		return fmt.Errorf("failed to parse chat response: %w", err)
+	}
+	if usage != nil {
+		chatResp.Usage = *usage
+	}
+	responsesResp := service.ChatCompletionsResponseToResponsesResponse(&chatResp, w.id)
+	data, err := common.Marshal(responsesResp)
+	if err != nil {
+		return err
+	}
+	for k, v := range w.header {
+		if k == "Content-Length" {
+			continue
+		}
+		w.ResponseWriter.Header()[k] = v
+	}
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err = w.ResponseWriter.Write(data)
+	return err
+}
+
+// parseBridgeErrorBody 从适配器输出的错误响应体中取出错误码与信息，无法解析时原样作为错误信息
+func parseBridgeErrorBody(body []byte) (string, string) {
+	var errResp struct {
+		Error *types.OpenAIError `json:"error"`
+	}
+	if err := common.Unmarshal(body, &errResp); err == nil && errResp.Error != nil && errResp.Error.Message != "" {
+		code := fmt.Sprintf("%v", errResp.Error.Code)
+		if errResp.Error.Code == nil || code == "" {
+			code = errResp.Error.Type
+		}
+		return code, errResp.Error.Message
+	}
+	return "server_error", strings.TrimSpace(string(body))
+}
+
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest) (*dto.Usage, *types.NewAPIError) {
+	info.AppendRequestConversion(types.RelayFormatOpenAI)
+
+	// 适配器按 Chat 请求处理：请求转换走 Chat 分支，响应输出 Chat 格式
+	savedRelayMode := info.RelayMode
+	savedRelayFormat := info.RelayFormat
+	savedRequestURLPath := info.RequestURLPath
+	savedShouldIncludeUsage := info.ShouldIncludeUsage
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RelayFormat = savedRelayFormat
+		info.RequestURLPath = savedRequestURLPath
+		info.ShouldIncludeUsage = savedShouldIncludeUsage
+	}()
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = types.RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+	info.ShouldIncludeUsage = true
+
+	convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+		}
+	}
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			newApiErr := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+			return nil, newApiErr
+		}
+	}
+
+	original := c.Writer
+	writer := newResponsesBridgeWriter(original, "resp_"+c.GetString(common.RequestIdKey), info.OriginModelName, info.IsStream)
+	c.Writer = writer
+	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = original
+	if newApiErr != nil {
+		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+		return nil, newApiErr
+	}
+
+	usageDto, _ := usage.(*dto.Usage)
+	if err := writer.finish(usageDto); err != nil {
+		logger.LogError(c, "responses bridge: "+err.Error())
+		if !info.IsStream && !c.Writer.Written() {
+			// 上游已成功返回并产生费用，仍按用量计费，不能交由重试再次请求上游
+			apiErr := types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+			c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.ToOpenAIError()})
+		}
+	}
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
+	}
+	return usageDto, nil
+}
@@ -97,6 +97,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/self/org", controller.GetSelfOrganization)
 
 				// 2FA routes
 				selfRoute.GET("/2fa/status", controller.Get2FAStatus)
@@ -139,6 +140,7 @@ func SetApiRouter(router *gin.Engine) {
 		appealRoute.Use(middleware.AdminAuth())
 		{
 			appealRoute.GET("/", controller.GetAllAppeals)
+			appealRoute.GET("/:id/moderation", controller.GetAppealModerationLogs)
 			appealRoute.POST("/:id/approve", controller.ApproveAppeal)
 			appealRoute.POST("/:id/reject", controller.RejectAppeal)
 		}
@@ -244,6 +246,7 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
 			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
 			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
+			channelRoute.POST("/ollama/sync/:id", controller.OllamaSyncModels)
 			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
 			channelRoute.GET("/tag/models", controller.GetTagModels)
 			channelRoute.POST("/copy/:id", controller.CopyChannel)
@@ -271,6 +274,20 @@ func SetApiRouter(router *gin.Engine) {
 			}
 		}
 
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.AdminAuth())
+		{
+			orgRoute.GET("/", controller.GetAllOrganizations)
+			orgRoute.POST("/", controller.AddOrganization)
+			orgRoute.PUT("/", controller.UpdateOrganization)
+			orgRoute.PUT("/member", controller.SetOrganizationMember)
+			orgRoute.GET("/project/:id", controller.GetProject)
+			orgRoute.POST("/project", controller.AddProject)
+			orgRoute.PUT("/project", controller.UpdateProject)
+			orgRoute.DELETE("/project/:id", controller.DeleteProject)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
@@ -318,11 +335,38 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
+		logRoute.GET("/end_user", middleware.AdminAuth(), controller.GetEndUserUsages)
+		logRoute.GET("/self/end_user", middleware.UserAuth(), controller.GetSelfEndUserUsages)
+		logRoute.GET("/export", middleware.AdminAuth(), controller.ExportUsage)
+		logRoute.GET("/self/export", middleware.UserAuth(), middleware.SearchRateLimit(), controller.ExportSelfUsage)
+		logRoute.POST("/statement", middleware.RootAuth(), controller.GenerateUsageStatements)
 		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
 
+		auditCaptureRoute := apiRouter.Group("/audit_capture")
+		auditCaptureRoute.Use(middleware.AdminAuth())
+		{
+			auditCaptureRoute.GET("/", controller.GetAuditCaptures)
+			auditCaptureRoute.DELETE("/", controller.DeleteHistoryAuditCaptures)
+			auditCaptureRoute.GET("/:id", controller.GetAuditCapture)
+			auditCaptureRoute.POST("/:id/replay", controller.ReplayAuditCapture)
+		}
+
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.RootAuth())
+		{
+			webhookRoute.GET("/events", controller.GetWebhookEventTypes)
+			webhookRoute.GET("/subscription/", controller.GetWebhookSubscriptions)
+			webhookRoute.POST("/subscription/", controller.CreateWebhookSubscription)
+			webhookRoute.PUT("/subscription/", controller.UpdateWebhookSubscription)
+			webhookRoute.DELETE("/subscription/:id", controller.DeleteWebhookSubscription)
+			webhookRoute.POST("/subscription/:id/test", controller.TestWebhookSubscription)
+			webhookRoute.GET("/delivery/", controller.GetWebhookDeliveries)
+			webhookRoute.POST("/delivery/:id/retry", controller.RetryWebhookDelivery)
+		}
+
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
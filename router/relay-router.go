@@ -15,6 +15,7 @@ func SetRelayRouter(router *gin.Engine) {
 	router.Use(middleware.DecompressRequestMiddleware())
 	router.Use(middleware.BodyStorageCleanup()) // 清理请求体存储
 	router.Use(middleware.StatsMiddleware())
+	router.Use(middleware.Tracing())
 	// https://platform.openai.com/docs/api-reference/introduction
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.TokenAuth())
@@ -145,20 +146,58 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAI)
 		})
 
+		// fine-tuning job creation selects a channel for the base model (or the training file's channel)
+		httpRouter.POST("/fine_tuning/jobs", controller.FineTuningJobCreate)
+		httpRouter.POST("/fine-tunes", controller.FineTuningJobCreate)
+
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
-		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
-		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
-		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
-		httpRouter.POST("/fine-tunes/:id/cancel", controller.RelayNotImplemented)
-		httpRouter.GET("/fine-tunes/:id/events", controller.RelayNotImplemented)
 		httpRouter.DELETE("/models/:model", controller.RelayNotImplemented)
 	}
+	{
+		// mint and revoke short-lived delegated tokens from the calling key
+		relayV1Router.POST("/delegated_tokens", controller.CreateDelegatedToken)
+		relayV1Router.DELETE("/delegated_tokens", controller.RevokeAllDelegatedTokens)
+		relayV1Router.DELETE("/delegated_tokens/:id", controller.RevokeDelegatedToken)
+	}
+	{
+		// stored responses are served from the gateway's response store (no channel selection)
+		responsesRouter := relayV1Router.Group("/responses")
+		responsesRouter.GET("/:id", controller.RelayResponseRetrieve)
+		responsesRouter.DELETE("/:id", controller.RelayResponseDelete)
+		responsesRouter.GET("/:id/input_items", controller.RelayResponseInputItems)
+	}
+	{
+		// file routes select the upstream channel themselves (no model in the request)
+		filesRouter := relayV1Router.Group("/files")
+		filesRouter.GET("", controller.RelayFileList)
+		filesRouter.POST("", controller.RelayFileUpload)
+		filesRouter.GET("/:id", controller.RelayFileRetrieve)
+		filesRouter.DELETE("/:id", controller.RelayFileDelete)
+		filesRouter.GET("/:id/content", controller.RelayFileContent)
+
+		// batch routes run each line through the normal relay pipeline (or the input file's upstream channel)
+		batchesRouter := relayV1Router.Group("/batches")
+		batchesRouter.GET("", controller.RelayBatchList)
+		batchesRouter.POST("", controller.RelayBatchCreate)
+		batchesRouter.GET("/:id", controller.RelayBatchRetrieve)
+		batchesRouter.POST("/:id/cancel", controller.RelayBatchCancel)
+
+		// fine-tuning jobs are polled on the channel and key that created them
+		fineTuningRouter := relayV1Router.Group("/fine_tuning/jobs")
+		fineTuningRouter.GET("", controller.FineTuningJobList)
+		fineTuningRouter.GET("/:id", controller.FineTuningJobRetrieve)
+		fineTuningRouter.POST("/:id/cancel", controller.FineTuningJobCancel)
+		fineTuningRouter.GET("/:id/events", controller.FineTuningJobSubresource("/events"))
+		fineTuningRouter.GET("/:id/checkpoints", controller.FineTuningJobSubresource("/checkpoints"))
+
+		// legacy /v1/fine-tunes routes share the fine-tuning jobs implementation
+		legacyFineTuneRouter := relayV1Router.Group("/fine-tunes")
+		legacyFineTuneRouter.GET("", controller.FineTuningJobList)
+		legacyFineTuneRouter.GET("/:id", controller.FineTuningJobRetrieve)
+		legacyFineTuneRouter.POST("/:id/cancel", controller.FineTuningJobCancel)
+		legacyFineTuneRouter.GET("/:id/events", controller.FineTuningJobSubresource("/events"))
+	}
 
 	relayMjRouter := router.Group("/mj")
 	relayMjRouter.Use(middleware.SystemPerformanceCheck())
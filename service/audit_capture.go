@@ -0,0 +1,371 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditCaptureResponse relay 层采集到的响应
+type AuditCaptureResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	Size        int64
+}
+
+var auditCaptureSecretWarnOnce sync.Once
+
+// ShouldStartAuditCapture 在请求开始时判断是否需要准备采集：渠道在分发后才确定，是否命中在结束时再判断
+func ShouldStartAuditCapture(c *gin.Context) bool {
+	setting := operation_setting.GetAuditCaptureSetting()
+	if !setting.Enabled || !setting.HasTargets() {
+		return false
+	}
+	// 加密密钥未固定时采集的数据重启后无法解密，不做采集
+	if !common.CryptoSecretConfigured {
+		auditCaptureSecretWarnOnce.Do(func() {
+			common.SysError("audit capture is enabled but CRYPTO_SECRET is not set, captures are skipped")
+		})
+		return false
+	}
+	// 重放请求的结果直接返回给管理员，不再重复采集
+	if _, ok := common.GetContextKey(c, constant.ContextKeyAuditReplayOf); ok {
+		return false
+	}
+	return setting.SampleRate >= 1 || rand.Float64() < setting.SampleRate
+}
+
+// RecordAuditCapture 保存命中采集对象的请求与响应，压缩加密在后台完成
+func RecordAuditCapture(c *gin.Context, relayFormat string, response AuditCaptureResponse) {
+	setting := operation_setting.GetAuditCaptureSetting()
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	if !setting.Matches(tokenId, userId, channelId) {
+		return
+	}
+	maxBytes := setting.MaxBodyBytes
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("audit capture skipped, failed to read request body: %v", err))
+		return
+	}
+	requestBody, err := storage.Bytes()
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("audit capture skipped, failed to read request body: %v", err))
+		return
+	}
+	capture := &model.AuditCapture{
+		RequestId:           c.GetString(common.RequestIdKey),
+		CreatedAt:           common.GetTimestamp(),
+		UserId:              userId,
+		TokenId:             tokenId,
+		ChannelId:           channelId,
+		ModelName:           common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		RelayFormat:         relayFormat,
+		Method:              c.Request.Method,
+		Path:                c.Request.URL.RequestURI(),
+		StatusCode:          response.StatusCode,
+		RequestSize:         storage.Size(),
+		ResponseSize:        response.Size,
+		RequestContentType:  c.Request.Header.Get("Content-Type"),
+		ResponseContentType: response.ContentType,
+		Storage:             setting.Storage,
+	}
+	if maxBytes > 0 && len(requestBody) > maxBytes {
+		requestBody = requestBody[:maxBytes]
+		capture.RequestTruncated = true
+	}
+	// 请求体存储在请求结束后即被清理，需要复制一份
+	requestBody = bytes.Clone(requestBody)
+	responseBody := response.Body
+	capture.ResponseTruncated = int64(len(responseBody)) < response.Size
+	gopool.Go(func() {
+		if err := saveAuditCapture(capture, requestBody, responseBody); err != nil {
+			common.SysError(fmt.Sprintf("failed to save audit capture for request %s: %v", capture.RequestId, err))
+		}
+	})
+}
+
+// sealAuditBody gzip 压缩后加密
+func sealAuditBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return common.EncryptWithSecret(buf.Bytes())
+}
+
+func openAuditBody(sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, nil
+	}
+	compressed, err := common.DecryptWithSecret(sealed)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func saveAuditCapture(capture *model.AuditCapture, requestBody []byte, responseBody []byte) error {
+	sealedRequest, err := sealAuditBody(requestBody)
+	if err != nil {
+		return err
+	}
+	sealedResponse, err := sealAuditBody(responseBody)
+	if err != nil {
+		return err
+	}
+	if capture.Storage != operation_setting.AuditCaptureStorageDisk {
+		capture.Storage = operation_setting.AuditCaptureStorageDatabase
+		capture.RequestBody = sealedRequest
+		capture.ResponseBody = sealedResponse
+		return capture.Insert()
+	}
+	name := fmt.Sprintf("audit-%d-%s", time.Now().UnixNano(), common.GetRandomString(8))
+	capture.RequestPath, _, err = common.WriteDiskStoreFile(name+"-req.bin", bytes.NewReader(sealedRequest), 0)
+	if err != nil {
+		return err
+	}
+	capture.ResponsePath, _, err = common.WriteDiskStoreFile(name+"-resp.bin", bytes.NewReader(sealedResponse), 0)
+	if err != nil {
+		os.Remove(capture.RequestPath)
+		return err
+	}
+	if err := capture.Insert(); err != nil {
+		removeAuditCaptureFiles(capture)
+		return err
+	}
+	return nil
+}
+
+func readAuditBody(sealed []byte, path string) ([]byte, error) {
+	if path != "" {
+		data, err := common.ReadDiskCacheFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sealed = data
+	}
+	return openAuditBody(sealed)
+}
+
+// LoadAuditCaptureBodies 解密采集记录的请求体与响应体
+func LoadAuditCaptureBodies(capture *model.AuditCapture) ([]byte, []byte, error) {
+	requestBody, err := readAuditBody(capture.RequestBody, capture.RequestPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read captured request: %w", err)
+	}
+	responseBody, err := readAuditBody(capture.ResponseBody, capture.ResponsePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read captured response: %w", err)
+	}
+	return requestBody, responseBody, nil
+}
+
+func removeAuditCaptureFiles(capture *model.AuditCapture) {
+	for _, path := range []string{capture.RequestPath, capture.ResponsePath} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			common.SysError(fmt.Sprintf("failed to remove audit capture file %s: %v", path, err))
+		}
+	}
+}
+
+// DeleteOldAuditCaptures 删除早于指定时间的采集记录，磁盘存储的记录先删除文件
+func DeleteOldAuditCaptures(ctx context.Context, targetTimestamp int64) (int64, error) {
+	var total int64 = 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		captures, err := model.GetOldAuditCaptureFiles(targetTimestamp, auditCaptureCleanupBatchSize)
+		if err != nil {
+			return total, err
+		}
+		ids := make([]int, 0, len(captures))
+		for _, capture := range captures {
+			removeAuditCaptureFiles(capture)
+			ids = append(ids, capture.Id)
+		}
+		count, err := model.DeleteAuditCapturesByIds(ids)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if len(captures) < auditCaptureCleanupBatchSize {
+			break
+		}
+	}
+	count, err := model.DeleteOldAuditCaptures(ctx, targetTimestamp, auditCaptureCleanupBatchSize)
+	return total + count, err
+}
+
+const (
+	auditCaptureCleanupTickInterval = time.Hour
+	auditCaptureCleanupBatchSize    = 100
+)
+
+var (
+	auditCaptureCleanupOnce    sync.Once
+	auditCaptureCleanupRunning atomic.Bool
+)
+
+// StartAuditCaptureCleanupTask 按保留天数定期清理采集记录
+func StartAuditCaptureCleanupTask() {
+	auditCaptureCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("audit capture cleanup task started: tick=%s", auditCaptureCleanupTickInterval))
+			ticker := time.NewTicker(auditCaptureCleanupTickInterval)
+			defer ticker.Stop()
+
+			runAuditCaptureCleanupOnce()
+			for range ticker.C {
+				runAuditCaptureCleanupOnce()
+			}
+		})
+	})
+}
+
+func runAuditCaptureCleanupOnce() {
+	retentionDays := operation_setting.GetAuditCaptureSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	if !auditCaptureCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer auditCaptureCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	target := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := DeleteOldAuditCaptures(ctx, target)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("audit capture cleanup task failed: %v", err))
+		return
+	}
+	if count > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("audit capture cleanup removed %d records", count))
+	}
+}
+
+// auditDiffMaxCells 逐行比较的最大规模，超过后整体视为替换
+const auditDiffMaxCells = 4_000_000
+
+// normalizeAuditBody 将 JSON 响应格式化为多行，SSE 等文本按原样分行，便于逐行比较
+func normalizeAuditBody(body []byte) []string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(body), "", "  "); err == nil {
+		body = buf.Bytes()
+	}
+	text := strings.TrimRight(string(body), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// DiffAuditResponses 逐行比较两次响应，返回以 " "、"-"、"+" 开头的差异行，无差异时返回 nil
+func DiffAuditResponses(original []byte, replayed []byte) []string {
+	a := normalizeAuditBody(original)
+	b := normalizeAuditBody(replayed)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(a) && prefix == len(b) {
+		return nil
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	diff := make([]string, 0, len(midA)+len(midB)+2)
+	if prefix > 0 {
+		diff = append(diff, " "+a[prefix-1])
+	}
+	if len(midA)*len(midB) > auditDiffMaxCells {
+		for _, line := range midA {
+			diff = append(diff, "-"+line)
+		}
+		for _, line := range midB {
+			diff = append(diff, "+"+line)
+		}
+	} else {
+		// 最长公共子序列
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) || j < len(midB) {
+			switch {
+			case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+				diff = append(diff, " "+midA[i])
+				i++
+				j++
+			case i < len(midA) && (j == len(midB) || lcs[i+1][j] >= lcs[i][j+1]):
+				diff = append(diff, "-"+midA[i])
+				i++
+			default:
+				diff = append(diff, "+"+midB[j])
+				j++
+			}
+		}
+	}
+	if suffix > 0 {
+		diff = append(diff, " "+a[len(a)-suffix])
+	}
+	return diff
+}
+
+func appendAuditReplayInfo(ctx *gin.Context, other map[string]interface{}) {
+	if captureId := common.GetContextKeyInt(ctx, constant.ContextKeyAuditReplayOf); captureId > 0 {
+		other["audit_replay_of"] = captureId
+	}
+}
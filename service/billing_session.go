@@ -7,13 +7,18 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ---------------------------------------------------------------------------
@@ -25,11 +30,13 @@ import (
 type BillingSession struct {
 	relayInfo        *relaycommon.RelayInfo
 	funding          FundingSource
-	preConsumedQuota int  // 实际预扣额度（信任用户可能为 0）
-	tokenConsumed    int  // 令牌额度实际扣减量
-	fundingSettled   bool // funding.Settle 已成功，资金来源已提交
-	settled          bool // Settle 全部完成（资金 + 令牌）
-	refunded         bool // Refund 已调用
+	preConsumedQuota int               // 实际预扣额度（信任用户可能为 0）
+	tokenConsumed    int               // 令牌额度实际扣减量
+	budget           model.BudgetChain // 请求所属的组织与项目
+	budgetConsumed   int               // 组织与项目额度实际扣减量
+	fundingSettled   bool              // funding.Settle 已成功，资金来源已提交
+	settled          bool              // Settle 全部完成（资金 + 令牌）
+	refunded         bool              // Refund 已调用
 	mu               sync.Mutex
 }
 
@@ -54,7 +61,12 @@ func (s *BillingSession) Settle(actualQuota int) error {
 		}
 		s.fundingSettled = true
 	}
-	// 2) 调整令牌额度
+	// 2) 调整组织与项目额度
+	if err := model.AdjustBudget(s.budget, delta); err != nil {
+		common.SysLog(fmt.Sprintf("error adjusting budget after funding settled (userId=%d, orgId=%d, projectId=%d, delta=%d): %s",
+			s.relayInfo.UserId, s.budget.OrgId, s.budget.ProjectId, delta, err.Error()))
+	}
+	// 3) 调整令牌额度
 	var tokenErr error
 	if !s.relayInfo.IsPlayground {
 		if delta > 0 {
@@ -68,7 +80,7 @@ func (s *BillingSession) Settle(actualQuota int) error {
 				s.relayInfo.UserId, s.relayInfo.TokenId, delta, tokenErr.Error()))
 		}
 	}
-	// 3) 更新 relayInfo 上的订阅 PostDelta（用于日志）
+	// 4) 更新 relayInfo 上的订阅 PostDelta（用于日志）
 	if s.funding.Source() == BillingSourceSubscription {
 		s.relayInfo.SubscriptionPostDelta += int64(delta)
 	}
@@ -85,6 +97,9 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	}
 	s.refunded = true
 	s.mu.Unlock()
+	metrics.RecordBillingRefund(s.funding.Source(), s.preConsumedQuota)
+	span := tracing.StartSpan(c, "billing.refund", attribute.Int("quota.pre_consumed", s.preConsumedQuota), attribute.String("billing.source", s.funding.Source()))
+	defer span.End()
 
 	logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还预扣费（token_quota=%s, funding=%s）",
 		s.relayInfo.UserId,
@@ -98,6 +113,8 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	isPlayground := s.relayInfo.IsPlayground
 	tokenConsumed := s.tokenConsumed
 	funding := s.funding
+	budget := s.budget
+	budgetConsumed := s.budgetConsumed
 
 	gopool.Go(func() {
 		// 1) 退还资金来源
@@ -110,6 +127,10 @@ func (s *BillingSession) Refund(c *gin.Context) {
 				common.SysLog("error refunding token quota: " + err.Error())
 			}
 		}
+		// 3) 退还组织与项目额度
+		if err := model.AdjustBudget(budget, -budgetConsumed); err != nil {
+			common.SysLog("error refunding budget: " + err.Error())
+		}
 	})
 }
 
@@ -125,7 +146,7 @@ func (s *BillingSession) needsRefundLocked() bool {
 		// fundingSettled 时资金来源已提交结算，不能再退预扣费
 		return false
 	}
-	if s.tokenConsumed > 0 {
+	if s.tokenConsumed > 0 || s.budgetConsumed > 0 {
 		return true
 	}
 	// 订阅可能在 tokenConsumed=0 时仍预扣了额度
@@ -144,7 +165,7 @@ func (s *BillingSession) GetPreConsumedQuota() int {
 // PreConsume — 统一预扣费入口（含信任额度旁路）
 // ---------------------------------------------------------------------------
 
-// preConsume 执行预扣费：信任检查 -> 令牌预扣 -> 资金来源预扣。
+// preConsume 执行预扣费：信任检查 -> 组织与项目预扣 -> 令牌预扣 -> 资金来源预扣。
 // 任一步骤失败时原子回滚已完成的步骤。
 func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIError {
 	effectiveQuota := quota
@@ -157,16 +178,36 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 需要预扣费 %s (funding=%s)", s.relayInfo.UserId, logger.FormatQuota(effectiveQuota), s.funding.Source()))
 	}
 
-	// ---- 1) 预扣令牌额度 ----
+	// ---- 0) 占用子令牌额度（不受信任旁路影响，占用在请求结束后按实际扣费修正） ----
+	if err := ReserveDelegatedTokenQuota(c, quota); err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+
+	// ---- 1) 预扣组织与项目额度（额度为 0 时仍检查状态、模型限制与剩余额度） ----
+	if !s.relayInfo.IsPlayground {
+		budget, err := model.GetBudgetChain(s.relayInfo.OrgId, s.relayInfo.ProjectId)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		if err := model.PreConsumeBudget(budget, ratio_setting.FormatMatchingModelName(s.relayInfo.OriginModelName), effectiveQuota); err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeBudgetFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		s.budget = budget
+		s.budgetConsumed = effectiveQuota
+	}
+
+	// ---- 2) 预扣令牌额度 ----
 	if effectiveQuota > 0 {
 		if err := PreConsumeTokenQuota(s.relayInfo, effectiveQuota); err != nil {
+			s.rollbackBudget(err)
 			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 		}
 		s.tokenConsumed = effectiveQuota
 	}
 
-	// ---- 2) 预扣资金来源 ----
+	// ---- 3) 预扣资金来源 ----
 	if err := s.funding.PreConsume(effectiveQuota); err != nil {
+		s.rollbackBudget(err)
 		// 预扣费失败，回滚令牌额度
 		if s.tokenConsumed > 0 && !s.relayInfo.IsPlayground {
 			if rollbackErr := model.IncreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, s.tokenConsumed); rollbackErr != nil {
@@ -191,6 +232,18 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 	return nil
 }
 
+// rollbackBudget 后续步骤失败时退还已预扣的组织与项目额度
+func (s *BillingSession) rollbackBudget(cause error) {
+	if s.budgetConsumed <= 0 {
+		return
+	}
+	if err := model.AdjustBudget(s.budget, -s.budgetConsumed); err != nil {
+		common.SysLog(fmt.Sprintf("error rolling back budget (userId=%d, orgId=%d, projectId=%d, amount=%d, cause=%s): %s",
+			s.relayInfo.UserId, s.budget.OrgId, s.budget.ProjectId, s.budgetConsumed, cause.Error(), err.Error()))
+	}
+	s.budgetConsumed = 0
+}
+
 // shouldTrust 统一信任额度检查，适用于钱包和订阅。
 func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 	trustQuota := common.GetTrustQuota()
@@ -207,6 +260,10 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 	if !tokenTrusted {
 		return false
 	}
+	// 周期预算余额不足信任额度时必须预扣，以便在预扣时检查预算
+	if budgetRemain, ok := common.GetContextKey(c, constant.ContextKeyTokenBudgetRemain); ok && budgetRemain.(int) <= trustQuota {
+		return false
+	}
 
 	switch s.funding.Source() {
 	case BillingSourceWallet:
@@ -32,6 +32,11 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
 		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
+		PublishWebhookEvent(constant.WebhookEventChannelDisabled, map[string]interface{}{
+			"channel_id":   channelError.ChannelId,
+			"channel_name": channelError.ChannelName,
+			"reason":       reason,
+		})
 	}
 }
 
@@ -41,6 +46,10 @@ func EnableChannel(channelId int, usingKey string, channelName string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
+		PublishWebhookEvent(constant.WebhookEventChannelEnabled, map[string]interface{}{
+			"channel_id":   channelId,
+			"channel_name": channelName,
+		})
 	}
 }
 
@@ -48,6 +57,37 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
 	}
+	return isChannelFaultError(channelType, err)
+}
+
+// IsCircuitBreakerFailure 判断错误是否计入渠道熔断器：除会触发自动禁用的错误外，还包括上游 5xx、限流与超时
+func IsCircuitBreakerFailure(channelType int, err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if isChannelFaultError(channelType, err) {
+		return true
+	}
+	if types.IsSkipRetryError(err) {
+		return false
+	}
+	return isTransientStatusCode(err.StatusCode)
+}
+
+// IsTransientChannelError 上游 5xx、限流与超时属于暂时性错误，可能自行恢复；
+// 密钥失效、账户停用、余额不足等错误即使以这些状态码返回也不算暂时性错误
+func IsTransientChannelError(channelType int, err *types.NewAPIError) bool {
+	if err == nil || types.IsChannelError(err) {
+		return false
+	}
+	return isTransientStatusCode(err.StatusCode) && !isPermanentChannelFault(channelType, err)
+}
+
+func isTransientStatusCode(code int) bool {
+	return code < 100 || code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+func isChannelFaultError(channelType int, err *types.NewAPIError) bool {
 	if err == nil {
 		return false
 	}
@@ -60,6 +100,11 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) {
 		return true
 	}
+	return isPermanentChannelFault(channelType, err)
+}
+
+// isPermanentChannelFault 按错误码、错误类型与关键词识别密钥或账户层面的错误
+func isPermanentChannelFault(channelType int, err *types.NewAPIError) bool {
 	//if err.StatusCode == http.StatusUnauthorized {
 	//	return true
 	//}
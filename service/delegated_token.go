@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DelegatedTokenPrefix 子令牌以该前缀开头，其后为 HS256 签名的 JWT
+const DelegatedTokenPrefix = "dt."
+
+const (
+	delegatedTokenUsageKeyPrefix   = "delegated_token_used:"
+	delegatedTokenRevokedKeyPrefix = "delegated_token_revoked:"
+)
+
+// DelegatedTokenClaims 子令牌的全部约束都写在签名内，校验时无需查询子令牌记录
+type DelegatedTokenClaims struct {
+	ParentTokenId int `json:"ptid"`
+	// 父令牌 key 经加密后写入，用于复用父令牌的缓存与计费
+	ParentKey string   `json:"pk"`
+	Quota     int      `json:"quota,omitempty"`
+	Models    []string `json:"models,omitempty"`
+	EndUserId string   `json:"end_user,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type MintDelegatedTokenRequest struct {
+	ExpiresIn int      `json:"expires_in"`
+	Quota     int      `json:"quota"`
+	Models    []string `json:"models"`
+	EndUserId string   `json:"end_user_id"`
+}
+
+type DelegatedTokenResponse struct {
+	Object        string   `json:"object"`
+	Token         string   `json:"token"`
+	Id            string   `json:"id"`
+	ParentTokenId int      `json:"parent_token_id"`
+	ExpiresAt     int64    `json:"expires_at"`
+	Quota         int      `json:"quota"`
+	Models        []string `json:"models"`
+	EndUserId     string   `json:"end_user_id,omitempty"`
+}
+
+func delegatedTokenSigningKey() []byte {
+	return []byte(common.GenerateHMAC("delegated_token"))
+}
+
+// MintDelegatedToken 基于父令牌签发子令牌，额度、模型与有效期只能在父令牌范围内收紧
+func MintDelegatedToken(parent *model.Token, req *MintDelegatedTokenRequest) (*DelegatedTokenResponse, error) {
+	setting := operation_setting.GetDelegatedTokenSetting()
+	if !setting.Enabled {
+		return nil, errors.New("delegated tokens are disabled")
+	}
+	// 父令牌 key 以 CRYPTO_SECRET 加密，未固定密钥时重启或跨节点后子令牌无法解密
+	if !common.CryptoSecretConfigured {
+		return nil, errors.New("delegated tokens require CRYPTO_SECRET to be set")
+	}
+	expiresIn := req.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = setting.DefaultTTLSeconds
+	}
+	if expiresIn <= 0 || expiresIn > setting.MaxTTLSeconds {
+		return nil, fmt.Errorf("expires_in must be between 1 and %d seconds", setting.MaxTTLSeconds)
+	}
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(expiresIn) * time.Second)
+	if parent.ExpiredTime != -1 && expiresAt.Unix() > parent.ExpiredTime {
+		expiresAt = time.Unix(parent.ExpiredTime, 0)
+	}
+	if req.Quota < 0 {
+		return nil, errors.New("quota must not be negative")
+	}
+	if !parent.UnlimitedQuota && req.Quota > parent.RemainQuota {
+		return nil, fmt.Errorf("quota exceeds the parent token remaining quota %d", parent.RemainQuota)
+	}
+	models := make([]string, 0, len(req.Models))
+	for _, modelName := range req.Models {
+		modelName = strings.TrimSpace(modelName)
+		if modelName != "" && !slices.Contains(models, modelName) {
+			models = append(models, modelName)
+		}
+	}
+	if parent.ModelLimitsEnabled {
+		parentModels := parent.GetModelLimits()
+		if len(models) == 0 {
+			models = parentModels
+		}
+		for _, modelName := range models {
+			if !slices.Contains(parentModels, modelName) {
+				return nil, fmt.Errorf("model %s is not allowed by the parent token", modelName)
+			}
+		}
+	}
+	endUserId := strings.TrimSpace(req.EndUserId)
+	if len(endUserId) > 64 {
+		return nil, errors.New("end_user_id must not exceed 64 characters")
+	}
+	encryptedKey, err := common.EncryptWithSecret([]byte(parent.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	id := "dtok_" + common.GetRandomString(24)
+	claims := DelegatedTokenClaims{
+		ParentTokenId: parent.Id,
+		ParentKey:     base64.RawURLEncoding.EncodeToString(encryptedKey),
+		Quota:         req.Quota,
+		Models:        models,
+		EndUserId:     endUserId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Subject:   strconv.Itoa(parent.UserId),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(delegatedTokenSigningKey())
+	if err != nil {
+		return nil, err
+	}
+	return &DelegatedTokenResponse{
+		Object:        "delegated_token",
+		Token:         DelegatedTokenPrefix + signed,
+		Id:            id,
+		ParentTokenId: parent.Id,
+		ExpiresAt:     expiresAt.Unix(),
+		Quota:         req.Quota,
+		Models:        models,
+		EndUserId:     endUserId,
+	}, nil
+}
+
+// ParseDelegatedToken 仅校验签名与有效期并解出父令牌 key，父令牌状态由调用方按普通令牌校验
+func ParseDelegatedToken(raw string) (*DelegatedTokenClaims, string, error) {
+	if !operation_setting.GetDelegatedTokenSetting().Enabled {
+		return nil, "", errors.New("子令牌功能未启用")
+	}
+	claims := &DelegatedTokenClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(raw, DelegatedTokenPrefix), claims, func(t *jwt.Token) (interface{}, error) {
+		return delegatedTokenSigningKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, "", errors.New("子令牌已过期")
+		}
+		return nil, "", errors.New("无效的子令牌")
+	}
+	encryptedKey, err := base64.RawURLEncoding.DecodeString(claims.ParentKey)
+	if err != nil {
+		return nil, "", errors.New("无效的子令牌")
+	}
+	parentKey, err := common.DecryptWithSecret(encryptedKey)
+	if err != nil {
+		return nil, "", errors.New("无效的子令牌")
+	}
+	return claims, string(parentKey), nil
+}
+
+func delegatedTokenRevokedKey(parentTokenId int, id string) string {
+	return fmt.Sprintf("%s%d:%s", delegatedTokenRevokedKeyPrefix, parentTokenId, id)
+}
+
+// RevokeDelegatedToken 撤销父令牌签发的单个子令牌，撤销记录保留到子令牌最长有效期之后
+func RevokeDelegatedToken(parentTokenId int, id string) error {
+	expiresAt := time.Now().Add(time.Duration(operation_setting.GetDelegatedTokenSetting().MaxTTLSeconds) * time.Second)
+	return addUsageCounter(delegatedTokenRevokedKey(parentTokenId, id), 1, expiresAt)
+}
+
+// CheckDelegatedTokenRevoked 子令牌被单独撤销，或签发不晚于父令牌的撤销时间时拒绝
+func CheckDelegatedTokenRevoked(parent *model.Token, claims *DelegatedTokenClaims) error {
+	if claims.IssuedAt == nil || claims.IssuedAt.Unix() <= parent.DelegatedRevokedAt {
+		return errors.New("子令牌已被撤销")
+	}
+	revoked, err := getUsageCounter(delegatedTokenRevokedKey(claims.ParentTokenId, claims.ID))
+	if err != nil {
+		return err
+	}
+	if revoked > 0 {
+		return errors.New("子令牌已被撤销")
+	}
+	return nil
+}
+
+// CheckDelegatedTokenQuota 子令牌额度用尽后拒绝新请求，单次请求的额度由 ReserveDelegatedTokenQuota 在预扣费时占用
+func CheckDelegatedTokenQuota(claims *DelegatedTokenClaims) error {
+	if claims.Quota <= 0 {
+		return nil
+	}
+	used, err := getUsageCounter(delegatedTokenUsageKeyPrefix + claims.ID)
+	if err != nil {
+		return err
+	}
+	if used >= claims.Quota {
+		return fmt.Errorf("子令牌额度已用尽，已使用: %d，额度: %d", used, claims.Quota)
+	}
+	return nil
+}
+
+// ReserveDelegatedTokenQuota 预扣费时在子令牌剩余额度内占用本次预扣额度，超出时拒绝并释放占用
+func ReserveDelegatedTokenQuota(c *gin.Context, quota int) error {
+	value, ok := common.GetContextKey(c, constant.ContextKeyDelegatedTokenClaims)
+	if !ok || quota <= 0 {
+		return nil
+	}
+	claims, ok := value.(*DelegatedTokenClaims)
+	if !ok || claims.Quota <= 0 {
+		return nil
+	}
+	key := delegatedTokenUsageKeyPrefix + claims.ID
+	used, err := incrUsageCounter(key, quota, claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if used > claims.Quota {
+		if err := addUsageCounter(key, -quota, claims.ExpiresAt.Time); err != nil {
+			common.SysLog(fmt.Sprintf("failed to release delegated token quota: id=%s, quota=%d, error=%v", claims.ID, quota, err))
+		}
+		return fmt.Errorf("子令牌剩余额度不足，已使用: %d，需要预扣: %d，额度: %d", used-quota, quota, claims.Quota)
+	}
+	common.SetContextKey(c, constant.ContextKeyDelegatedTokenReserved, common.GetContextKeyInt(c, constant.ContextKeyDelegatedTokenReserved)+quota)
+	return nil
+}
+
+// RecordDelegatedTokenUsage 请求结束后按实际扣费修正子令牌用量（多退少补预扣时的占用），父令牌的用量已在正常计费中累计
+func RecordDelegatedTokenUsage(c *gin.Context, claims *DelegatedTokenClaims) {
+	quota := common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota)
+	delta := quota - common.GetContextKeyInt(c, constant.ContextKeyDelegatedTokenReserved)
+	if delta == 0 {
+		return
+	}
+	if err := addUsageCounter(delegatedTokenUsageKeyPrefix+claims.ID, delta, claims.ExpiresAt.Time); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record delegated token usage: id=%s, quota=%d, error=%v", claims.ID, quota, err))
+	}
+}
+
+func appendDelegatedTokenInfo(ctx *gin.Context, other map[string]interface{}) {
+	if other == nil {
+		return
+	}
+	if id := common.GetContextKeyString(ctx, constant.ContextKeyDelegatedTokenId); id != "" {
+		other["delegated_token_id"] = id
+		if endUserId := common.GetContextKeyString(ctx, constant.ContextKeyDelegatedTokenEndUser); endUserId != "" {
+			other["end_user_id"] = endUserId
+		}
+	}
+}
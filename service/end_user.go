@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EndUserIdHeader 调用方可通过该请求头标识其终端用户，优先于请求体中的字段
+const EndUserIdHeader = "X-End-User-Id"
+
+const maxEndUserIdLength = 64
+
+// ResolveEndUserId 确定请求归属的终端用户：子令牌绑定的终端用户不可覆盖，其次为请求头，
+// 最后为请求体中的 OpenAI user 字段或 Claude metadata.user_id
+func ResolveEndUserId(c *gin.Context, request dto.Request) string {
+	endUserId := common.GetContextKeyString(c, constant.ContextKeyDelegatedTokenEndUser)
+	if endUserId == "" {
+		endUserId = c.GetHeader(EndUserIdHeader)
+	}
+	if endUserId == "" {
+		switch r := request.(type) {
+		case *dto.GeneralOpenAIRequest:
+			endUserId = r.User
+		case *dto.OpenAIResponsesRequest:
+			endUserId = r.User
+		case *dto.EmbeddingRequest:
+			endUserId = r.User
+		case *dto.ImageRequest:
+			if len(r.User) > 0 {
+				_ = common.Unmarshal(r.User, &endUserId)
+			}
+		case *dto.ClaudeRequest:
+			if len(r.Metadata) > 0 {
+				var metadata dto.ClaudeMetadata
+				if err := common.Unmarshal(r.Metadata, &metadata); err == nil {
+					endUserId = metadata.UserId
+				}
+			}
+		}
+	}
+	endUserId = strings.TrimSpace(endUserId)
+	if len(endUserId) > maxEndUserIdLength {
+		endUserId = endUserId[:maxEndUserIdLength]
+	}
+	if endUserId != "" {
+		common.SetContextKey(c, constant.ContextKeyEndUserId, endUserId)
+	}
+	return endUserId
+}
+
+func endUserQuotaKey(tokenId int, endUserId string, day string) string {
+	return fmt.Sprintf("end_user_quota:%d:%s:%s", tokenId, day, endUserId)
+}
+
+// CheckEndUserLimits 按令牌上配置的每终端用户请求频率与每日额度进行限制，未标识终端用户的请求不受限制
+func CheckEndUserLimits(c *gin.Context) *types.NewAPIError {
+	endUserId := common.GetContextKeyString(c, constant.ContextKeyEndUserId)
+	if endUserId == "" {
+		return nil
+	}
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	if rpm := common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserRateLimit); rpm > 0 {
+		key := fmt.Sprintf("%s:end_user_rpm:%d:%s", tokenRateLimitKeyPrefix, tokenId, endUserId)
+		state, err := getTokenLimiter().TakeTokens(c.Request.Context(), key, limiter.BucketRequest{
+			Requested: 1,
+			Required:  1,
+			Rate:      float64(rpm) / 60,
+			Capacity:  float64(rpm),
+		})
+		if err != nil {
+			logger.LogError(c, "end user rate limit check failed: "+err.Error())
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeRateLimitExceeded, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+		}
+		if !state.Allowed {
+			return tokenRateLimitExceeded(c, state.Wait, fmt.Sprintf("终端用户 %s 已达到请求频率限制：每分钟最多 %d 次", endUserId, rpm))
+		}
+	}
+	if quotaLimit := common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserQuotaLimit); quotaLimit > 0 {
+		used, err := getUsageCounter(endUserQuotaKey(tokenId, endUserId, time.Now().UTC().Format("20060102")))
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		if used >= quotaLimit {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("终端用户 %s 今日额度已用尽，已使用: %s，额度: %s", endUserId, logger.FormatQuota(used), logger.FormatQuota(quotaLimit)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+	}
+	return nil
+}
+
+// RecordEndUserUsage 请求结束后将实际扣费计入终端用户当日用量
+func RecordEndUserUsage(c *gin.Context) {
+	endUserId := common.GetContextKeyString(c, constant.ContextKeyEndUserId)
+	if endUserId == "" || common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserQuotaLimit) <= 0 {
+		return
+	}
+	quota := common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota)
+	if quota <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+	dayEnd := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	key := endUserQuotaKey(common.GetContextKeyInt(c, constant.ContextKeyTokenId), endUserId, now.Format("20060102"))
+	if err := addUsageCounter(key, quota, dayEnd.Add(time.Hour)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record end user usage: end_user=%s, quota=%d, error=%v", endUserId, quota, err))
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const fineTuningJobsPath = "/v1/fine_tuning/jobs"
+
+// fineTuningTaskStatus 将上游微调任务状态映射为任务表状态
+func fineTuningTaskStatus(status string) model.TaskStatus {
+	switch status {
+	case "validating_files", "queued":
+		return model.TaskStatusQueued
+	case "running":
+		return model.TaskStatusInProgress
+	case "succeeded":
+		return model.TaskStatusSuccess
+	case "failed", "cancelled":
+		return model.TaskStatusFailure
+	default:
+		return model.TaskStatusUnknown
+	}
+}
+
+// CreateFineTuningJob 将创建微调任务的请求转发到分发选中的渠道，并记录任务归属；
+// 上游已创建任务但写库失败时仍返回任务，以便调用方照常结算
+func CreateFineTuningJob(c *gin.Context, quota int) (*model.Task, error) {
+	channel, err := model.CacheGetChannel(common.GetContextKeyInt(c, constant.ContextKeyChannelId))
+	if err != nil {
+		return nil, err
+	}
+	if !IsRelayFileChannelSupported(channel.Type) {
+		return nil, fmt.Errorf("渠道 #%d 不支持微调接口", channel.Id)
+	}
+	key := common.GetContextKeyString(c, constant.ContextKeyChannelKey)
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doOpenAIChannelRequest(c.Request.Context(), channel, key, http.MethodPost, fineTuningJobsPath, bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var job dto.FineTuningJob
+	if err := readRelayFileJSON(resp, &job); err != nil {
+		return nil, err
+	}
+	if job.Id == "" {
+		return nil, errors.New("upstream fine-tuning api returned empty job id")
+	}
+
+	now := time.Now().Unix()
+	task := &model.Task{
+		TaskID:     job.Id,
+		Platform:   constant.TaskPlatformFineTuning,
+		UserId:     c.GetInt("id"),
+		Group:      common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		ChannelId:  channel.Id,
+		Action:     constant.TaskActionFineTuning,
+		SubmitTime: now,
+		Progress:   "0%",
+		Quota:      quota,
+		Properties: model.Properties{
+			OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		},
+		PrivateData: model.TaskPrivateData{
+			Key:     key,
+			TokenId: c.GetInt("token_id"),
+		},
+	}
+	applyFineTuningJob(c.Request.Context(), task, &job)
+	if err := task.Insert(); err != nil {
+		return task, err
+	}
+	return task, nil
+}
+
+// GetOwnedFineTuningTask 获取令牌自己创建的微调任务
+func GetOwnedFineTuningTask(c *gin.Context, jobId string) (*model.Task, error) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), jobId)
+	if err != nil {
+		return nil, err
+	}
+	if !exist || task.Platform != constant.TaskPlatformFineTuning || task.PrivateData.TokenId != c.GetInt("token_id") {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return task, nil
+}
+
+// FineTuningTaskJob 返回任务中保存的微调任务对象
+func FineTuningTaskJob(task *model.Task) *dto.FineTuningJob {
+	var job dto.FineTuningJob
+	if err := task.GetData(&job); err != nil || job.Id == "" {
+		job = dto.FineTuningJob{
+			Id:        task.TaskID,
+			Object:    "fine_tuning.job",
+			CreatedAt: task.SubmitTime,
+			Model:     task.Properties.OriginModelName,
+			Status:    "queued",
+		}
+	}
+	return &job
+}
+
+// DoFineTuningJobRequest 使用创建任务时的渠道与 key 请求上游微调任务接口，subPath 为空时请求任务本身
+func DoFineTuningJobRequest(ctx context.Context, task *model.Task, method string, subPath string, rawQuery string) (*http.Response, error) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	path := fineTuningJobsPath + "/" + task.TaskID + subPath
+	if rawQuery != "" {
+		path += "?" + rawQuery
+	}
+	return doOpenAIChannelRequest(ctx, channel, task.PrivateData.Key, method, path, nil, "")
+}
+
+// CancelFineTuningJob 取消上游微调任务并同步状态
+func CancelFineTuningJob(ctx context.Context, task *model.Task) error {
+	resp, err := DoFineTuningJobRequest(ctx, task, http.MethodPost, "/cancel", "")
+	if err != nil {
+		return err
+	}
+	var job dto.FineTuningJob
+	if err := readRelayFileJSON(resp, &job); err != nil {
+		return err
+	}
+	applyFineTuningJob(ctx, task, &job)
+	return task.Update()
+}
+
+// SyncFineTuningTask 拉取上游微调任务状态，成功后登记微调模型
+func SyncFineTuningTask(ctx context.Context, task *model.Task) error {
+	resp, err := DoFineTuningJobRequest(ctx, task, http.MethodGet, "", "")
+	if err != nil {
+		return err
+	}
+	var job dto.FineTuningJob
+	if err := readRelayFileJSON(resp, &job); err != nil {
+		var upstreamErr *RelayFileUpstreamError
+		if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound {
+			task.Status = model.TaskStatusFailure
+			task.Progress = "100%"
+			task.FailReason = "fine-tuning job not found upstream"
+			task.FinishTime = time.Now().Unix()
+			return task.Update()
+		}
+		return err
+	}
+	applyFineTuningJob(ctx, task, &job)
+	return task.Update()
+}
+
+// applyFineTuningJob 将上游任务对象写回任务记录，文件 ID 改写为网关文件 ID
+func applyFineTuningJob(ctx context.Context, task *model.Task, job *dto.FineTuningJob) {
+	rewriteFineTuningJobFiles(ctx, task, job)
+	wasSuccess := task.Status == model.TaskStatusSuccess
+	task.Status = fineTuningTaskStatus(job.Status)
+	switch task.Status {
+	case model.TaskStatusInProgress:
+		if task.StartTime == 0 {
+			task.StartTime = time.Now().Unix()
+		}
+		task.Progress = "50%"
+	case model.TaskStatusSuccess, model.TaskStatusFailure:
+		task.Progress = "100%"
+		if job.FinishedAt != nil {
+			task.FinishTime = *job.FinishedAt
+		} else if task.FinishTime == 0 {
+			task.FinishTime = time.Now().Unix()
+		}
+		if job.Error != nil && job.Error.Message != "" {
+			task.FailReason = job.Error.Message
+		} else if job.Status == "cancelled" {
+			task.FailReason = "cancelled"
+		}
+	}
+	task.SetData(job)
+
+	if task.Status == model.TaskStatusSuccess && !wasSuccess && job.FineTunedModel != nil && *job.FineTunedModel != "" {
+		if err := registerFineTunedModel(task, *job.FineTunedModel); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("fine-tuning job %s: failed to register model %s: %s", task.TaskID, *job.FineTunedModel, err.Error()))
+		}
+	}
+}
+
+// registerFineTunedModel 微调模型只对任务所属用户的分组可见
+func registerFineTunedModel(task *model.Task, modelName string) error {
+	channel, err := model.GetChannelById(task.ChannelId, true)
+	if err != nil {
+		return err
+	}
+	group, err := model.GetUserGroup(task.UserId, false)
+	if err != nil {
+		return err
+	}
+	if err := model.AddFineTunedAbility(group, modelName, channel); err != nil {
+		return err
+	}
+	model.InitChannelCache()
+	return nil
+}
+
+func rewriteFineTuningJobFiles(ctx context.Context, task *model.Task, job *dto.FineTuningJob) {
+	toGatewayFileId := func(upstreamFileId string, register bool) string {
+		if upstreamFileId == "" {
+			return upstreamFileId
+		}
+		relayFile, err := model.GetRelayFileByUpstreamFileId(task.UserId, task.ChannelId, upstreamFileId)
+		if err == nil {
+			return relayFile.FileId
+		}
+		if !register || !errors.Is(err, gorm.ErrRecordNotFound) {
+			return upstreamFileId
+		}
+		// 训练结果文件由上游生成，登记后用户才能通过 /v1/files 下载
+		relayFile = &model.RelayFile{
+			FileId:         model.RelayFileIdPrefix + common.GetRandomString(24),
+			UserId:         task.UserId,
+			TokenId:        task.PrivateData.TokenId,
+			ChannelId:      task.ChannelId,
+			UpstreamFileId: upstreamFileId,
+			Filename:       fmt.Sprintf("%s_results.csv", task.TaskID),
+			Purpose:        "fine-tune-results",
+			Status:         model.RelayFileStatusProcessed,
+		}
+		if channel, err := model.CacheGetChannel(task.ChannelId); err == nil && channel.ChannelInfo.IsMultiKey {
+			for idx, key := range channel.GetKeys() {
+				if key == task.PrivateData.Key {
+					relayFile.ChannelKeyIdx = idx
+					break
+				}
+			}
+		}
+		if retentionDays := operation_setting.GetFileSetting().RetentionDays; retentionDays > 0 {
+			relayFile.ExpiresAt = time.Now().Add(time.Duration(retentionDays) * 24 * time.Hour).Unix()
+		}
+		if err := relayFile.Insert(); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("fine-tuning job %s: failed to register result file: %s", task.TaskID, err.Error()))
+			return upstreamFileId
+		}
+		return relayFile.FileId
+	}
+	job.TrainingFile = toGatewayFileId(job.TrainingFile, false)
+	if job.ValidationFile != nil {
+		validationFile := toGatewayFileId(*job.ValidationFile, false)
+		job.ValidationFile = &validationFile
+	}
+	for i, resultFile := range job.ResultFiles {
+		job.ResultFiles[i] = toGatewayFileId(resultFile, true)
+	}
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsHedgeLoser 对冲请求中落败的一方已被取消，不结算、不记录消费日志
+func IsHedgeLoser(c *gin.Context) bool {
+	lost, ok := common.GetContextKeyType[*atomic.Bool](c, constant.ContextKeyHedgeLost)
+	return ok && lost.Load()
+}
+
+// IsHedgedRequest 是否为对冲请求中的一路，对冲请求的上游连接需要随落败取消而中断
+func IsHedgedRequest(c *gin.Context) bool {
+	_, ok := common.GetContextKeyType[*atomic.Bool](c, constant.ContextKeyHedgeLost)
+	return ok
+}
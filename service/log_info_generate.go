@@ -50,6 +50,11 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if IsResponseCacheHit(ctx) {
+		other["response_cache_hit"] = true
+		other["response_cache_ratio"] = relayInfo.PriceData.OtherRatios["response_cache"]
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -74,9 +79,24 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
+	appendBatchInfo(ctx, relayInfo, other)
+	appendModerationInfo(ctx, other)
+	appendPIIRedactionInfo(ctx, other)
+	appendAuditReplayInfo(ctx, other)
+	appendDelegatedTokenInfo(ctx, other)
 	return other
 }
 
+func appendBatchInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.PriceData.GroupRatioInfo.BatchRatio <= 0 {
+		return
+	}
+	other["batch_ratio"] = relayInfo.PriceData.GroupRatioInfo.BatchRatio
+	if batchId := common.GetContextKeyString(ctx, constant.ContextKeyRelayBatchId); batchId != "" {
+		other["batch_id"] = batchId
+	}
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ModerationPhasePrompt     = "prompt"
+	ModerationPhaseCompletion = "completion"
+
+	ModerationRedactPlaceholder = "**###**"
+	moderationDefaultTimeout    = 10 * time.Second
+)
+
+// ModerationDecision 单个审核阶段的命中记录，写入日志 other.moderation 供申诉审核查看
+type ModerationDecision struct {
+	Stage      string   `json:"stage"`
+	Type       string   `json:"type"`
+	Phase      string   `json:"phase"`
+	Action     string   `json:"action"`
+	Categories []string `json:"categories,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+type moderationResult struct {
+	Flagged    bool
+	Categories []string
+	Reason     string
+	// 脱敏后的文本，为空表示无法定位违规片段
+	Redacted string
+}
+
+type moderationClassifierResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+type moderationWebhookPayload struct {
+	Stage     string `json:"stage"`
+	Phase     string `json:"phase"`
+	Text      string `json:"text"`
+	RequestId string `json:"request_id"`
+	UserId    int    `json:"user_id"`
+	Group     string `json:"group"`
+	Model     string `json:"model"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type moderationWebhookResponse struct {
+	Flagged      bool     `json:"flagged"`
+	Categories   []string `json:"categories"`
+	Reason       string   `json:"reason"`
+	RedactedText string   `json:"redacted_text"`
+}
+
+func moderationStageName(stage operation_setting.ModerationStage) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return stage.Type
+}
+
+func moderationStageTimeout(stage operation_setting.ModerationStage) time.Duration {
+	if stage.TimeoutSeconds > 0 {
+		return time.Duration(stage.TimeoutSeconds) * time.Second
+	}
+	return moderationDefaultTimeout
+}
+
+// moderationGatewayBaseURL classifier 通过本网关的 /v1/moderations 调用，复用渠道选择与计费
+func moderationGatewayBaseURL() string {
+	if baseURL := operation_setting.GetModerationSetting().GatewayBaseURL; baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = strconv.Itoa(*common.Port)
+	}
+	return "http://127.0.0.1:" + port
+}
+
+func runKeywordModeration(stage operation_setting.ModerationStage, text string) moderationResult {
+	patterns := stage.Words
+	if len(patterns) == 0 {
+		patterns = setting.SensitiveWords
+	}
+	hit, matches, redacted := RegexReplace(text, patterns, ModerationRedactPlaceholder, false)
+	return moderationResult{Flagged: hit, Categories: matches, Redacted: redacted}
+}
+
+func runClassifierModeration(ctx context.Context, stage operation_setting.ModerationStage, text string) (moderationResult, error) {
+	if stage.Model == "" || stage.ApiKey == "" {
+		return moderationResult{}, errors.New("classifier model or api key not configured")
+	}
+	body, err := common.Marshal(map[string]any{
+		"model": stage.Model,
+		"input": text,
+	})
+	if err != nil {
+		return moderationResult{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, moderationGatewayBaseURL()+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return moderationResult{}, err
+	}
+	apiKey := stage.ApiKey
+	if !strings.HasPrefix(apiKey, "sk-") {
+		apiKey = "sk-" + apiKey
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return moderationResult{}, fmt.Errorf("classifier returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var parsed moderationClassifierResponse
+	if err := common.Unmarshal(respBody, &parsed); err != nil {
+		return moderationResult{}, err
+	}
+	result := moderationResult{}
+	for _, r := range parsed.Results {
+		if stage.Threshold > 0 {
+			for category, score := range r.CategoryScores {
+				if score >= stage.Threshold {
+					result.Categories = append(result.Categories, category)
+				}
+			}
+			result.Flagged = result.Flagged || len(result.Categories) > 0
+			continue
+		}
+		if r.Flagged {
+			result.Flagged = true
+			for category, flagged := range r.Categories {
+				if flagged {
+					result.Categories = append(result.Categories, category)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func runWebhookModeration(ctx context.Context, c *gin.Context, info *relaycommon.RelayInfo, stage operation_setting.ModerationStage, phase string, text string) (moderationResult, error) {
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(stage.URL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return moderationResult{}, fmt.Errorf("request reject: %v", err)
+	}
+	payload, err := common.Marshal(moderationWebhookPayload{
+		Stage:     moderationStageName(stage),
+		Phase:     phase,
+		Text:      text,
+		RequestId: c.GetString(common.RequestIdKey),
+		UserId:    info.UserId,
+		Group:     info.UsingGroup,
+		Model:     info.OriginModelName,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return moderationResult{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stage.URL, bytes.NewReader(payload))
+	if err != nil {
+		return moderationResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stage.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", generateSignature(stage.Secret, payload))
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return moderationResult{}, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	var parsed moderationWebhookResponse
+	if err := common.Unmarshal(respBody, &parsed); err != nil {
+		return moderationResult{}, err
+	}
+	return moderationResult{
+		Flagged:    parsed.Flagged,
+		Categories: parsed.Categories,
+		Reason:     parsed.Reason,
+		Redacted:   parsed.RedactedText,
+	}, nil
+}
+
+func runModerationStage(c *gin.Context, info *relaycommon.RelayInfo, stage operation_setting.ModerationStage, phase string, text string) (moderationResult, error) {
+	switch stage.Type {
+	case operation_setting.ModerationStageKeyword:
+		return runKeywordModeration(stage, text), nil
+	case operation_setting.ModerationStageClassifier:
+		ctx, cancel := context.WithTimeout(c.Request.Context(), moderationStageTimeout(stage))
+		defer cancel()
+		return runClassifierModeration(ctx, stage, text)
+	case operation_setting.ModerationStageWebhook:
+		ctx, cancel := context.WithTimeout(c.Request.Context(), moderationStageTimeout(stage))
+		defer cancel()
+		return runWebhookModeration(ctx, c, info, stage, phase, text)
+	default:
+		return moderationResult{}, fmt.Errorf("unknown moderation stage type: %s", stage.Type)
+	}
+}
+
+// runModerationPipeline 按顺序执行各阶段：block 立即停止，redact 后续阶段审核脱敏后的文本，
+// 阶段调用失败时记录日志并跳过，不影响请求
+func runModerationPipeline(c *gin.Context, info *relaycommon.RelayInfo, phase string, text string) (string, string, []ModerationDecision) {
+	moderationSetting := operation_setting.GetModerationSetting()
+	groupAction := moderationSetting.ModerationAction(info.UsingGroup)
+	action := ""
+	result := text
+	var decisions []ModerationDecision
+	for _, stage := range moderationSetting.Stages {
+		if (phase == ModerationPhasePrompt && !stage.OnPrompt) || (phase == ModerationPhaseCompletion && !stage.OnCompletion) {
+			continue
+		}
+		res, err := runModerationStage(c, info, stage, phase, result)
+		if err != nil {
+			logger.LogError(c, fmt.Sprintf("moderation stage %s failed: %s", moderationStageName(stage), err.Error()))
+			continue
+		}
+		if !res.Flagged {
+			continue
+		}
+		decisions = append(decisions, ModerationDecision{
+			Stage:      moderationStageName(stage),
+			Type:       stage.Type,
+			Phase:      phase,
+			Action:     groupAction,
+			Categories: res.Categories,
+			Reason:     res.Reason,
+		})
+		switch groupAction {
+		case operation_setting.ModerationActionBlock:
+			return groupAction, result, decisions
+		case operation_setting.ModerationActionRedact:
+			if res.Redacted != "" {
+				result = res.Redacted
+			} else {
+				result = ModerationRedactPlaceholder
+			}
+		}
+		action = groupAction
+	}
+	return action, result, decisions
+}
+
+func appendModerationDecisions(c *gin.Context, decisions []ModerationDecision) {
+	if len(decisions) == 0 {
+		return
+	}
+	existing, _ := common.GetContextKeyType[[]ModerationDecision](c, constant.ContextKeyModerationDecisions)
+	common.SetContextKey(c, constant.ContextKeyModerationDecisions, append(existing, decisions...))
+}
+
+func appendModerationInfo(ctx *gin.Context, other map[string]interface{}) {
+	if decisions, ok := common.GetContextKeyType[[]ModerationDecision](ctx, constant.ContextKeyModerationDecisions); ok && len(decisions) > 0 {
+		other["moderation"] = decisions
+	}
+}
+
+// promptRedactor 根据首轮整体审核的结果逐段脱敏，不再为每段文本重复调用外部审核服务：
+// 关键词阶段在本地逐段匹配替换；分类器与 webhook 只对整体文本给出结论，无法定位到具体片段，命中时整段替换
+type promptRedactor struct {
+	keywordStages []operation_setting.ModerationStage
+	wholeText     bool
+}
+
+func newPromptRedactor(decisions []ModerationDecision) *promptRedactor {
+	r := &promptRedactor{}
+	flaggedKeywordStages := make(map[string]bool)
+	for _, decision := range decisions {
+		if decision.Type == operation_setting.ModerationStageKeyword {
+			flaggedKeywordStages[decision.Stage] = true
+		} else {
+			r.wholeText = true
+		}
+	}
+	for _, stage := range operation_setting.GetModerationSetting().Stages {
+		if stage.OnPrompt && stage.Type == operation_setting.ModerationStageKeyword && flaggedKeywordStages[moderationStageName(stage)] {
+			r.keywordStages = append(r.keywordStages, stage)
+		}
+	}
+	return r
+}
+
+func (r *promptRedactor) redact(text string) (string, bool) {
+	if text == "" {
+		return text, false
+	}
+	if r.wholeText {
+		return ModerationRedactPlaceholder, true
+	}
+	result := text
+	changed := false
+	for _, stage := range r.keywordStages {
+		if res := runKeywordModeration(stage, result); res.Flagged {
+			result = res.Redacted
+			changed = true
+		}
+	}
+	return result, changed
+}
+
+// redactPromptRequest 逐段脱敏请求中的文本，只支持 OpenAI 格式的请求
+func redactPromptRequest(request dto.Request, decisions []ModerationDecision) bool {
+	textRequest, ok := request.(*dto.GeneralOpenAIRequest)
+	if !ok {
+		return false
+	}
+	redactor := newPromptRedactor(decisions)
+	if prompt, ok := textRequest.Prompt.(string); ok {
+		if redacted, changed := redactor.redact(prompt); changed {
+			textRequest.Prompt = redacted
+		}
+	}
+	for i := range textRequest.Messages {
+		message := &textRequest.Messages[i]
+		if message.IsStringContent() {
+			if redacted, changed := redactor.redact(message.StringContent()); changed {
+				message.SetStringContent(redacted)
+			}
+			continue
+		}
+		parts := message.ParseContent()
+		changed := false
+		for j := range parts {
+			if parts[j].Type != dto.ContentTypeText {
+				continue
+			}
+			if redacted, ok := redactor.redact(parts[j].Text); ok {
+				parts[j].Text = redacted
+				changed = true
+			}
+		}
+		if changed {
+			message.SetMediaContent(parts)
+		}
+	}
+	return true
+}
+
+// recordModerationBlock 拦截的请求不会进入渠道重试流程，这里单独写入错误日志，便于申诉时追溯
+func recordModerationBlock(c *gin.Context, info *relaycommon.RelayInfo, decisions []ModerationDecision) {
+	other := map[string]interface{}{
+		"moderation":   decisions,
+		"request_path": c.Request.URL.Path,
+	}
+	model.RecordErrorLog(c, info.UserId, 0, info.OriginModelName, c.GetString("token_name"), "请求内容未通过审核", info.TokenId, 0, info.IsStream, info.UsingGroup, other)
+}
+
+// ModeratePrompt 在请求转发前审核提示词，redact 时直接改写请求中的文本
+func ModeratePrompt(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, text string) *types.NewAPIError {
+	if info.RelayMode == relayconstant.RelayModeModerations || text == "" || !operation_setting.GetModerationSetting().HasStage(false) {
+		return nil
+	}
+	action, _, decisions := runModerationPipeline(c, info, ModerationPhasePrompt, text)
+	if action == operation_setting.ModerationActionRedact && !redactPromptRequest(request, decisions) {
+		// 无法改写的请求格式退化为拦截
+		action = operation_setting.ModerationActionBlock
+		for i := range decisions {
+			decisions[i].Action = action
+			decisions[i].Reason = strings.TrimSpace(decisions[i].Reason + " redaction not supported for this request format")
+		}
+	}
+	appendModerationDecisions(c, decisions)
+	if action != operation_setting.ModerationActionBlock {
+		return nil
+	}
+	logger.LogWarn(c, fmt.Sprintf("prompt blocked by moderation stage %s", decisions[len(decisions)-1].Stage))
+	recordModerationBlock(c, info, decisions)
+	return types.NewErrorWithStatusCode(errors.New("request content blocked by moderation"), types.ErrorCodeModerationBlocked, http.StatusBadRequest,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// ModerateCompletion 审核补全内容，返回处理方式（空表示通过）与脱敏后的文本
+func ModerateCompletion(c *gin.Context, info *relaycommon.RelayInfo, text string) (string, string) {
+	if text == "" {
+		return "", text
+	}
+	action, result, decisions := runModerationPipeline(c, info, ModerationPhaseCompletion, text)
+	appendModerationDecisions(c, decisions)
+	return action, result
+}
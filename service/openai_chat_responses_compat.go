@@ -16,3 +16,31 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	return openaicompat.ExtractOutputTextFromResponses(resp)
 }
+
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	return openaicompat.ResponsesRequestToChatCompletionsRequest(req)
+}
+
+func ChatCompletionsResponseToResponsesResponse(resp *dto.OpenAITextResponse, id string) *dto.OpenAIResponsesResponse {
+	return openaicompat.ChatCompletionsResponseToResponsesResponse(resp, id)
+}
+
+func NewChatToResponsesStreamConverter(id string, model string, createdAt int64) *openaicompat.ChatToResponsesStreamConverter {
+	return openaicompat.NewChatToResponsesStreamConverter(id, model, createdAt)
+}
+
+func ClaudeRequestToResponsesRequest(req *dto.ClaudeRequest) (*dto.OpenAIResponsesRequest, error) {
+	return openaicompat.ClaudeRequestToResponsesRequest(req)
+}
+
+func ResponsesResponseToClaudeResponse(resp *dto.OpenAIResponsesResponse) *dto.ClaudeResponse {
+	return openaicompat.ResponsesResponseToClaudeResponse(resp)
+}
+
+func ResponsesUsageToChatUsage(usage *dto.Usage) *dto.Usage {
+	return openaicompat.ResponsesUsageToChatUsage(usage)
+}
+
+func NewResponsesToClaudeStreamConverter(id string, model string, inputTokens int) *openaicompat.ResponsesToClaudeStreamConverter {
+	return openaicompat.NewResponsesToClaudeStreamConverter(id, model, inputTokens)
+}
@@ -0,0 +1,385 @@
+package openaicompat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	responsesItemTypeMessage      = "message"
+	responsesItemTypeReasoning    = "reasoning"
+	responsesItemTypeFunctionCall = "function_call"
+)
+
+// ChatUsageToResponsesUsage 将 Chat 用量转换为 Responses 用量，同时保留 prompt/completion 字段供计费读取
+func ChatUsageToResponsesUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	out := *usage
+	out.InputTokens = usage.PromptTokens
+	out.OutputTokens = usage.CompletionTokens
+	if out.TotalTokens == 0 {
+		out.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	out.InputTokensDetails = &dto.InputTokenDetails{
+		CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		ImageTokens:  usage.PromptTokensDetails.ImageTokens,
+		AudioTokens:  usage.PromptTokensDetails.AudioTokens,
+	}
+	return &out
+}
+
+func responsesStatusFromFinishReason(finishReason string) (string, *dto.IncompleteDetails) {
+	if finishReason == "length" {
+		return "incomplete", &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	}
+	return "completed", nil
+}
+
+func newResponsesResponse(id string, model string, createdAt int, status string) *dto.OpenAIResponsesResponse {
+	return &dto.OpenAIResponsesResponse{
+		ID:         id,
+		Object:     "response",
+		CreatedAt:  createdAt,
+		Status:     status,
+		Model:      model,
+		Output:     make([]dto.ResponsesOutput, 0),
+		ToolChoice: "auto",
+		Tools:      make([]map[string]any, 0),
+	}
+}
+
+func newReasoningOutput(id string, text string) dto.ResponsesOutput {
+	item := dto.ResponsesOutput{
+		Type:    responsesItemTypeReasoning,
+		ID:      id,
+		Status:  "completed",
+		Summary: make([]dto.ResponsesReasoningSummaryPart, 0, 1),
+	}
+	if text != "" {
+		item.Summary = append(item.Summary, dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text})
+	}
+	return item
+}
+
+func newMessageOutput(id string, text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   responsesItemTypeMessage,
+		ID:     id,
+		Status: "completed",
+		Role:   "assistant",
+		Content: []dto.ResponsesOutputContent{
+			{Type: "output_text", Text: text, Annotations: make([]interface{}, 0)},
+		},
+	}
+}
+
+func newFunctionCallOutput(id string, callId string, name string, arguments string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:      responsesItemTypeFunctionCall,
+		ID:        id,
+		Status:    "completed",
+		CallId:    callId,
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+// ChatCompletionsResponseToResponsesResponse 将 Chat Completions 非流式响应转换为 Responses 响应
+func ChatCompletionsResponseToResponsesResponse(resp *dto.OpenAITextResponse, id string) *dto.OpenAIResponsesResponse {
+	createdAt := int(common.GetTimestamp())
+	switch v := resp.Created.(type) {
+	case float64:
+		createdAt = int(v)
+	case int64:
+		createdAt = int(v)
+	case int:
+		createdAt = v
+	}
+	out := newResponsesResponse(id, resp.Model, createdAt, "completed")
+	suffix := strings.TrimPrefix(id, "resp_")
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		out.Status, out.IncompleteDetails = responsesStatusFromFinishReason(choice.FinishReason)
+		msg := choice.Message
+		reasoning := msg.ReasoningContent
+		if reasoning == "" {
+			reasoning = msg.Reasoning
+		}
+		if reasoning != "" {
+			out.Output = append(out.Output, newReasoningOutput(fmt.Sprintf("rs_%s_%d", suffix, len(out.Output)), reasoning))
+		}
+		if text := msg.StringContent(); text != "" {
+			out.Output = append(out.Output, newMessageOutput(fmt.Sprintf("msg_%s_%d", suffix, len(out.Output)), text))
+		}
+		for _, toolCall := range msg.ParseToolCalls() {
+			out.Output = append(out.Output, newFunctionCallOutput(fmt.Sprintf("fc_%s_%d", suffix, len(out.Output)), toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+	}
+	out.Usage = ChatUsageToResponsesUsage(&resp.Usage)
+	return out
+}
+
+type responsesStreamItem struct {
+	outputIndex int
+	item        dto.ResponsesOutput
+	text        strings.Builder
+	done        bool
+}
+
+// ChatToResponsesStreamConverter 将 Chat Completions 流式分片转换为 Responses SSE 事件：
+// reasoning_content 映射为 reasoning 条目，content 映射为 message 条目，tool_calls 按 index 映射为 function_call 条目
+type ChatToResponsesStreamConverter struct {
+	id           string
+	suffix       string
+	model        string
+	createdAt    int
+	items        []*responsesStreamItem
+	reasoning    *responsesStreamItem
+	message      *responsesStreamItem
+	toolCalls    map[int]*responsesStreamItem
+	finishReason string
+	usage        *dto.Usage
+}
+
+func NewChatToResponsesStreamConverter(id string, model string, createdAt int64) *ChatToResponsesStreamConverter {
+	return &ChatToResponsesStreamConverter{
+		id:        id,
+		suffix:    strings.TrimPrefix(id, "resp_"),
+		model:     model,
+		createdAt: int(createdAt),
+		toolCalls: make(map[int]*responsesStreamItem),
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) snapshot(status string) *dto.OpenAIResponsesResponse {
+	resp := newResponsesResponse(s.id, s.model, s.createdAt, status)
+	for _, item := range s.items {
+		resp.Output = append(resp.Output, item.item)
+	}
+	return resp
+}
+
+// Start 返回 response.created 与 response.in_progress 事件
+func (s *ChatToResponsesStreamConverter) Start() []dto.ResponsesStreamResponse {
+	return []dto.ResponsesStreamResponse{
+		{Type: "response.created", Response: s.snapshot("in_progress")},
+		{Type: "response.in_progress", Response: s.snapshot("in_progress")},
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) openItem(item dto.ResponsesOutput) (*responsesStreamItem, dto.ResponsesStreamResponse) {
+	streamItem := &responsesStreamItem{outputIndex: len(s.items), item: item}
+	s.items = append(s.items, streamItem)
+	added := streamItem.item
+	return streamItem, dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemAdded,
+		OutputIndex: common.GetPointer(streamItem.outputIndex),
+		Item:        &added,
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) itemID(prefix string) string {
+	return fmt.Sprintf("%s_%s_%d", prefix, s.suffix, len(s.items))
+}
+
+func (s *ChatToResponsesStreamConverter) closeReasoning() []dto.ResponsesStreamResponse {
+	item := s.reasoning
+	if item == nil {
+		return nil
+	}
+	s.reasoning = nil
+	item.done = true
+	text := item.text.String()
+	item.item = newReasoningOutput(item.item.ID, text)
+	done := item.item
+	return []dto.ResponsesStreamResponse{
+		{Type: "response.reasoning_summary_text.done", ItemID: item.item.ID, OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0), Text: text},
+		{Type: "response.reasoning_summary_part.done", ItemID: item.item.ID, OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0), Part: &dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text}},
+		{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &done},
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) closeMessage() []dto.ResponsesStreamResponse {
+	item := s.message
+	if item == nil {
+		return nil
+	}
+	s.message = nil
+	item.done = true
+	text := item.text.String()
+	item.item = newMessageOutput(item.item.ID, text)
+	done := item.item
+	return []dto.ResponsesStreamResponse{
+		{Type: "response.output_text.done", ItemID: item.item.ID, OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Text: text},
+		{Type: "response.content_part.done", ItemID: item.item.ID, OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Part: &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: text}},
+		{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &done},
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) closeToolCalls() []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	for _, item := range s.items {
+		if item.done || item.item.Type != responsesItemTypeFunctionCall {
+			continue
+		}
+		item.done = true
+		item.item.Arguments = item.text.String()
+		item.item.Status = "completed"
+		done := item.item
+		events = append(events,
+			dto.ResponsesStreamResponse{Type: "response.function_call_arguments.done", ItemID: item.item.ID, OutputIndex: common.GetPointer(item.outputIndex), Arguments: item.item.Arguments},
+			dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &done},
+		)
+	}
+	s.toolCalls = make(map[int]*responsesStreamItem)
+	return events
+}
+
+// ConvertChunk 将一个 Chat 流式分片转换为零个或多个 Responses 事件
+func (s *ChatToResponsesStreamConverter) ConvertChunk(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	if chunk == nil {
+		return nil
+	}
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	var events []dto.ResponsesStreamResponse
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			events = append(events, s.closeMessage()...)
+			events = append(events, s.closeToolCalls()...)
+			if s.reasoning == nil {
+				item, added := s.openItem(dto.ResponsesOutput{
+					Type:    responsesItemTypeReasoning,
+					ID:      s.itemID("rs"),
+					Status:  "in_progress",
+					Summary: make([]dto.ResponsesReasoningSummaryPart, 0),
+				})
+				s.reasoning = item
+				events = append(events, added, dto.ResponsesStreamResponse{
+					Type:         "response.reasoning_summary_part.added",
+					ItemID:       item.item.ID,
+					OutputIndex:  common.GetPointer(item.outputIndex),
+					SummaryIndex: common.GetPointer(0),
+					Part:         &dto.ResponsesReasoningSummaryPart{Type: "summary_text"},
+				})
+			}
+			s.reasoning.text.WriteString(reasoning)
+			events = append(events, dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_text.delta",
+				ItemID:       s.reasoning.item.ID,
+				OutputIndex:  common.GetPointer(s.reasoning.outputIndex),
+				SummaryIndex: common.GetPointer(0),
+				Delta:        reasoning,
+			})
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			events = append(events, s.closeReasoning()...)
+			events = append(events, s.closeToolCalls()...)
+			if s.message == nil {
+				item, added := s.openItem(dto.ResponsesOutput{
+					Type:    responsesItemTypeMessage,
+					ID:      s.itemID("msg"),
+					Status:  "in_progress",
+					Role:    "assistant",
+					Content: make([]dto.ResponsesOutputContent, 0),
+				})
+				s.message = item
+				events = append(events, added, dto.ResponsesStreamResponse{
+					Type:         "response.content_part.added",
+					ItemID:       item.item.ID,
+					OutputIndex:  common.GetPointer(item.outputIndex),
+					ContentIndex: common.GetPointer(0),
+					Part:         &dto.ResponsesReasoningSummaryPart{Type: "output_text"},
+				})
+			}
+			s.message.text.WriteString(content)
+			events = append(events, dto.ResponsesStreamResponse{
+				Type:         "response.output_text.delta",
+				ItemID:       s.message.item.ID,
+				OutputIndex:  common.GetPointer(s.message.outputIndex),
+				ContentIndex: common.GetPointer(0),
+				Delta:        content,
+			})
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			events = append(events, s.closeReasoning()...)
+			events = append(events, s.closeMessage()...)
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			item, ok := s.toolCalls[index]
+			if !ok {
+				var added dto.ResponsesStreamResponse
+				item, added = s.openItem(dto.ResponsesOutput{
+					Type:   responsesItemTypeFunctionCall,
+					ID:     s.itemID("fc"),
+					Status: "in_progress",
+					CallId: toolCall.ID,
+					Name:   toolCall.Function.Name,
+				})
+				s.toolCalls[index] = item
+				events = append(events, added)
+			}
+			if toolCall.Function.Arguments != "" {
+				item.text.WriteString(toolCall.Function.Arguments)
+				events = append(events, dto.ResponsesStreamResponse{
+					Type:        "response.function_call_arguments.delta",
+					ItemID:      item.item.ID,
+					OutputIndex: common.GetPointer(item.outputIndex),
+					Delta:       toolCall.Function.Arguments,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// Finish 结束所有未完成的条目并返回 response.completed（或 incomplete）事件；usage 为空时使用流中的用量
+func (s *ChatToResponsesStreamConverter) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	events = append(events, s.closeReasoning()...)
+	events = append(events, s.closeMessage()...)
+	events = append(events, s.closeToolCalls()...)
+
+	status, incompleteDetails := responsesStatusFromFinishReason(s.finishReason)
+	resp := s.snapshot(status)
+	resp.IncompleteDetails = incompleteDetails
+	if usage == nil {
+		usage = s.usage
+	}
+	resp.Usage = ChatUsageToResponsesUsage(usage)
+	eventType := "response.completed"
+	if status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	return append(events, dto.ResponsesStreamResponse{Type: eventType, Response: resp})
+}
+
+// Fail 结束所有未完成的条目并返回 response.failed 事件，用于适配器以非 SSE 格式输出的错误
+func (s *ChatToResponsesStreamConverter) Fail(code string, message string) []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	events = append(events, s.closeReasoning()...)
+	events = append(events, s.closeMessage()...)
+	events = append(events, s.closeToolCalls()...)
+
+	resp := s.snapshot("failed")
+	resp.Error = map[string]string{"code": code, "message": message}
+	resp.Usage = ChatUsageToResponsesUsage(s.usage)
+	return append(events, dto.ResponsesStreamResponse{Type: "response.failed", Response: resp})
+}
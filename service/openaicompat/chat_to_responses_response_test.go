@@ -0,0 +1,128 @@
+package openaicompat
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponsesRequestToChatCompletionsRequest(t *testing.T) {
+	req := &dto.OpenAIResponsesRequest{
+		Model:        "claude-3-5-sonnet",
+		Instructions: []byte(`"be brief"`),
+		Input: []byte(`[
+			{"role":"user","content":[{"type":"input_text","text":"weather?"}]},
+			{"type":"function_call","call_id":"c1","name":"get_weather","arguments":"{}"},
+			{"type":"function_call","call_id":"c2","name":"get_time","arguments":"{}"},
+			{"type":"function_call_output","call_id":"c1","output":"sunny"}
+		]`),
+		Tools:      []byte(`[{"type":"function","name":"get_weather","parameters":{"type":"object"}}]`),
+		ToolChoice: []byte(`{"type":"function","name":"get_weather"}`),
+		Text:       []byte(`{"format":{"type":"json_schema","name":"w","schema":{"type":"object"}}}`),
+	}
+	chatReq, err := ResponsesRequestToChatCompletionsRequest(req)
+	require.NoError(t, err)
+	require.Len(t, chatReq.Messages, 4)
+	require.Equal(t, "system", chatReq.Messages[0].Role)
+	require.Equal(t, "weather?", chatReq.Messages[1].ParseContent()[0].Text)
+	// 连续的 function_call 合并为一条助手消息
+	require.Len(t, chatReq.Messages[2].ParseToolCalls(), 2)
+	require.Equal(t, "tool", chatReq.Messages[3].Role)
+	require.Equal(t, "c1", chatReq.Messages[3].ToolCallId)
+	require.Equal(t, "get_weather", chatReq.Tools[0].Function.Name)
+	require.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chatReq.ToolChoice)
+	require.Equal(t, "json_schema", chatReq.ResponseFormat.Type)
+
+	req.Tools = []byte(`[{"type":"web_search_preview"}]`)
+	_, err = ResponsesRequestToChatCompletionsRequest(req)
+	require.Error(t, err)
+}
+
+func TestChatToResponsesStreamConverter(t *testing.T) {
+	converter := NewChatToResponsesStreamConverter("resp_1", "m", 1)
+	chunk := func(data string) *dto.ChatCompletionsStreamResponse {
+		var c dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(data, &c))
+		return &c
+	}
+
+	var events []dto.ResponsesStreamResponse
+	events = append(events, converter.Start()...)
+	events = append(events, converter.ConvertChunk(chunk(`{"choices":[{"index":0,"delta":{"reasoning_content":"hmm"}}]}`))...)
+	events = append(events, converter.ConvertChunk(chunk(`{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`))...)
+	events = append(events, converter.ConvertChunk(chunk(`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\""}}]}}]}`))...)
+	events = append(events, converter.ConvertChunk(chunk(`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`))...)
+	events = append(events, converter.Finish(&dto.Usage{PromptTokens: 3, CompletionTokens: 5})...)
+
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.reasoning_summary_part.added",
+		"response.reasoning_summary_text.delta",
+		"response.reasoning_summary_text.done",
+		"response.reasoning_summary_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, types)
+
+	completed := events[len(events)-1].Response
+	require.Equal(t, "completed", completed.Status)
+	require.Len(t, completed.Output, 3)
+	require.Equal(t, "hmm", completed.Output[0].Summary[0].Text)
+	require.Equal(t, "Hi", completed.Output[1].Content[0].Text)
+	require.Equal(t, "call_1", completed.Output[2].CallId)
+	require.Equal(t, `{"a":1}`, completed.Output[2].Arguments)
+	require.Equal(t, 3, completed.Usage.InputTokens)
+	require.Equal(t, 5, completed.Usage.OutputTokens)
+}
+
+func TestChatToResponsesIncompleteDetails(t *testing.T) {
+	converter := NewChatToResponsesStreamConverter("resp_1", "m", 1)
+	var c dto.ChatCompletionsStreamResponse
+	require.NoError(t, common.UnmarshalJsonStr(`{"choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"length"}]}`, &c))
+	converter.Start()
+	converter.ConvertChunk(&c)
+	events := converter.Finish(&dto.Usage{PromptTokens: 3, CompletionTokens: 5})
+
+	completed := events[len(events)-1].Response
+	require.Equal(t, "response.incomplete", events[len(events)-1].Type)
+	require.Equal(t, "incomplete", completed.Status)
+	data, err := common.Marshal(completed.IncompleteDetails)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"reason":"max_output_tokens"}`, string(data))
+}
+
+func TestChatToResponsesStreamFail(t *testing.T) {
+	converter := NewChatToResponsesStreamConverter("resp_1", "m", 1)
+	var c dto.ChatCompletionsStreamResponse
+	require.NoError(t, common.UnmarshalJsonStr(`{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`, &c))
+	converter.ConvertChunk(&c)
+
+	events := converter.Fail("server_error", "upstream stream broken")
+	last := events[len(events)-1]
+	require.Equal(t, "response.failed", last.Type)
+	require.Equal(t, "failed", last.Response.Status)
+	require.Equal(t, map[string]string{"code": "server_error", "message": "upstream stream broken"}, last.Response.Error)
+	// 已输出的文本条目照常结束
+	require.Equal(t, "response.output_item.done", events[len(events)-2].Type)
+	require.Len(t, last.Response.Output, 1)
+}
@@ -0,0 +1,372 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// claudeResponsesInputBuilder 按原始顺序将 Claude 消息内容块写为 Responses input 条目，
+// 连续的文本、图片等内容块合并为同一条 message
+type claudeResponsesInputBuilder struct {
+	items   []map[string]any
+	role    string
+	pending []map[string]any
+}
+
+func (b *claudeResponsesInputBuilder) flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+	b.items = append(b.items, map[string]any{
+		"type":    "message",
+		"role":    b.role,
+		"content": b.pending,
+	})
+	b.pending = nil
+}
+
+func (b *claudeResponsesInputBuilder) addPart(part map[string]any) {
+	b.pending = append(b.pending, part)
+}
+
+func (b *claudeResponsesInputBuilder) addItem(item map[string]any) {
+	b.flush()
+	b.items = append(b.items, item)
+}
+
+func claudeTextPartType(role string) string {
+	if role == "assistant" {
+		return "output_text"
+	}
+	return "input_text"
+}
+
+func claudeImageSourceToURL(source *dto.ClaudeMessageSource) (string, error) {
+	if source == nil {
+		return "", errors.New("image source is required")
+	}
+	switch source.Type {
+	case "base64":
+		return fmt.Sprintf("data:%s;base64,%s", source.MediaType, common.Interface2String(source.Data)), nil
+	case "url":
+		return source.Url, nil
+	default:
+		return "", fmt.Errorf("image source type %q is not supported", source.Type)
+	}
+}
+
+func claudeDocumentToResponsesPart(block dto.ClaudeMediaMessage) (map[string]any, error) {
+	source := block.Source
+	if source == nil {
+		return nil, errors.New("document source is required")
+	}
+	switch source.Type {
+	case "base64":
+		return map[string]any{
+			"type":      "input_file",
+			"filename":  "document.pdf",
+			"file_data": fmt.Sprintf("data:%s;base64,%s", source.MediaType, common.Interface2String(source.Data)),
+		}, nil
+	case "url":
+		return map[string]any{"type": "input_file", "file_url": source.Url}, nil
+	case "text":
+		return map[string]any{"type": "input_text", "text": common.Interface2String(source.Data)}, nil
+	default:
+		return nil, fmt.Errorf("document source type %q is not supported", source.Type)
+	}
+}
+
+// claudeToolResultToResponsesOutput 将 tool_result 的内容转为 function_call_output 的 output：
+// 纯文本输出字符串，包含图片时输出内容数组
+func claudeToolResultToResponsesOutput(block dto.ClaudeMediaMessage) (any, error) {
+	if block.Content == nil || block.IsStringContent() {
+		return block.GetStringContent(), nil
+	}
+	parts := make([]map[string]any, 0)
+	hasImage := false
+	var text strings.Builder
+	for _, sub := range block.ParseMediaContent() {
+		switch sub.Type {
+		case dto.ContentTypeText:
+			text.WriteString(sub.GetText())
+			parts = append(parts, map[string]any{"type": "input_text", "text": sub.GetText()})
+		case "image":
+			url, err := claudeImageSourceToURL(sub.Source)
+			if err != nil {
+				return nil, err
+			}
+			hasImage = true
+			parts = append(parts, map[string]any{"type": "input_image", "image_url": url})
+		}
+	}
+	if !hasImage {
+		return text.String(), nil
+	}
+	return parts, nil
+}
+
+func claudeToolsToResponsesTools(raw any) ([]map[string]any, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	tools, err := common.Any2Type[[]map[string]any](raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	out := make([]map[string]any, 0, len(tools))
+	for _, tool := range tools {
+		toolType, _ := tool["type"].(string)
+		switch {
+		case toolType == "" || toolType == "custom":
+			parameters := tool["input_schema"]
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			converted := map[string]any{
+				"type":       "function",
+				"name":       tool["name"],
+				"parameters": parameters,
+			}
+			if description, ok := tool["description"].(string); ok && description != "" {
+				converted["description"] = description
+			}
+			out = append(out, converted)
+		case strings.HasPrefix(toolType, "web_search"):
+			out = append(out, map[string]any{"type": "web_search"})
+		default:
+			return nil, fmt.Errorf("tool type %q is not supported on responses channels", toolType)
+		}
+	}
+	return out, nil
+}
+
+func claudeToolChoiceToResponses(raw any) (json.RawMessage, bool, error) {
+	if raw == nil {
+		return nil, false, nil
+	}
+	choice, err := common.Any2Type[dto.ClaudeToolChoice](raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid tool_choice: %w", err)
+	}
+	var out any
+	switch choice.Type {
+	case "auto", "":
+		out = "auto"
+	case "any":
+		out = "required"
+	case "none":
+		out = "none"
+	case "tool":
+		out = map[string]any{"type": "function", "name": choice.Name}
+	default:
+		return nil, false, fmt.Errorf("tool_choice type %q is not supported", choice.Type)
+	}
+	data, err := common.Marshal(out)
+	return data, choice.DisableParallelToolUse, err
+}
+
+// claudeThinkingToReasoningEffort 按思考预算估算推理强度
+func claudeThinkingToReasoningEffort(thinking *dto.Thinking, outputConfig json.RawMessage) string {
+	if len(outputConfig) > 0 {
+		var config struct {
+			Effort string `json:"effort"`
+		}
+		if err := common.Unmarshal(outputConfig, &config); err == nil && config.Effort != "" {
+			return config.Effort
+		}
+	}
+	budget := thinking.GetBudgetTokens()
+	switch {
+	case thinking.Type == "adaptive" || budget == 0:
+		return "medium"
+	case budget < 4096:
+		return "low"
+	case budget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// ClaudeRequestToResponsesRequest 将 Claude Messages 请求转换为 /v1/responses 请求，供只支持 Responses 的渠道（Codex 等）使用。
+// thinking 块携带签名时作为加密推理条目回传，cache_control 等 Claude 专有字段直接忽略
+func ClaudeRequestToResponsesRequest(req *dto.ClaudeRequest) (*dto.OpenAIResponsesRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+
+	out := &dto.OpenAIResponsesRequest{
+		Model:           req.Model,
+		Stream:          req.Stream,
+		Temperature:     req.Temperature,
+		MaxOutputTokens: req.MaxTokens,
+	}
+	if req.TopP != 0 {
+		out.TopP = common.GetPointer(req.TopP)
+	}
+
+	var instructions string
+	if req.IsStringSystem() {
+		instructions = req.GetStringSystem()
+	} else if req.System != nil {
+		texts := make([]string, 0)
+		for _, block := range req.ParseSystem() {
+			if text := block.GetText(); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		instructions = strings.Join(texts, "\n")
+	}
+	if instructions != "" {
+		data, err := common.Marshal(instructions)
+		if err != nil {
+			return nil, err
+		}
+		out.Instructions = data
+	}
+
+	builder := &claudeResponsesInputBuilder{}
+	for _, message := range req.Messages {
+		role := message.Role
+		if role != "user" && role != "assistant" {
+			return nil, fmt.Errorf("unsupported message role %q", role)
+		}
+		builder.flush()
+		builder.role = role
+		if message.IsStringContent() {
+			builder.addPart(map[string]any{"type": claudeTextPartType(role), "text": message.GetStringContent()})
+			continue
+		}
+		blocks, err := message.ParseContent()
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			switch block.Type {
+			case dto.ContentTypeText:
+				builder.addPart(map[string]any{"type": claudeTextPartType(role), "text": block.GetText()})
+			case "image":
+				url, err := claudeImageSourceToURL(block.Source)
+				if err != nil {
+					return nil, err
+				}
+				builder.addPart(map[string]any{"type": "input_image", "image_url": url})
+			case "document":
+				part, err := claudeDocumentToResponsesPart(block)
+				if err != nil {
+					return nil, err
+				}
+				builder.addPart(part)
+			case "tool_use":
+				arguments, err := common.Marshal(block.Input)
+				if err != nil {
+					return nil, err
+				}
+				if block.Input == nil {
+					arguments = []byte("{}")
+				}
+				builder.addItem(map[string]any{
+					"type":      "function_call",
+					"call_id":   block.Id,
+					"name":      block.Name,
+					"arguments": string(arguments),
+				})
+			case "tool_result":
+				output, err := claudeToolResultToResponsesOutput(block)
+				if err != nil {
+					return nil, err
+				}
+				builder.addItem(map[string]any{
+					"type":    "function_call_output",
+					"call_id": block.ToolUseId,
+					"output":  output,
+				})
+			case "thinking":
+				// 没有签名的思考内容无法作为推理条目回传给上游
+				if block.Signature == "" {
+					continue
+				}
+				summary := make([]map[string]any, 0, 1)
+				if block.Thinking != nil && *block.Thinking != "" {
+					summary = append(summary, map[string]any{"type": "summary_text", "text": *block.Thinking})
+				}
+				builder.addItem(map[string]any{
+					"type":              "reasoning",
+					"summary":           summary,
+					"encrypted_content": block.Signature,
+				})
+			case "redacted_thinking":
+				continue
+			default:
+				return nil, fmt.Errorf("content block type %q is not supported on responses channels", block.Type)
+			}
+		}
+	}
+	builder.flush()
+	input, err := common.Marshal(builder.items)
+	if err != nil {
+		return nil, err
+	}
+	out.Input = input
+
+	tools, err := claudeToolsToResponsesTools(req.Tools)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		if out.Tools, err = common.Marshal(tools); err != nil {
+			return nil, err
+		}
+	}
+	toolChoice, disableParallel, err := claudeToolChoiceToResponses(req.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	out.ToolChoice = toolChoice
+	if disableParallel {
+		out.ParallelToolCalls = json.RawMessage("false")
+	}
+
+	if req.Thinking != nil && req.Thinking.Type != "disabled" {
+		out.Reasoning = &dto.Reasoning{
+			Effort:  claudeThinkingToReasoningEffort(req.Thinking, req.OutputConfig),
+			Summary: "auto",
+		}
+		// 加密推理内容作为 thinking 块的签名返回，下一轮请求时回传
+		out.Include = json.RawMessage(`["reasoning.encrypted_content"]`)
+	}
+
+	if len(req.OutputFormat) > 0 {
+		var format map[string]any
+		if err := common.Unmarshal(req.OutputFormat, &format); err != nil {
+			return nil, fmt.Errorf("invalid output_format: %w", err)
+		}
+		if formatType, _ := format["type"].(string); formatType == "json_schema" {
+			text := map[string]any{"format": map[string]any{
+				"type":   "json_schema",
+				"name":   "output",
+				"schema": format["schema"],
+				"strict": true,
+			}}
+			if out.Text, err = common.Marshal(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(req.Metadata) > 0 {
+		var metadata dto.ClaudeMetadata
+		if err := common.Unmarshal(req.Metadata, &metadata); err == nil {
+			out.User = metadata.UserId
+		}
+	}
+	return out, nil
+}
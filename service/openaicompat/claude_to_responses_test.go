@@ -0,0 +1,92 @@
+package openaicompat
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaudeRequestToResponsesRequest(t *testing.T) {
+	var req dto.ClaudeRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"model": "gpt-5-codex",
+		"max_tokens": 1024,
+		"system": [{"type":"text","text":"be brief","cache_control":{"type":"ephemeral"}}],
+		"thinking": {"type":"enabled","budget_tokens":8000},
+		"tools": [{"name":"get_weather","input_schema":{"type":"object"}}],
+		"tool_choice": {"type":"any","disable_parallel_tool_use":true},
+		"messages": [
+			{"role":"user","content":[{"type":"text","text":"weather?"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]},
+			{"role":"assistant","content":[
+				{"type":"thinking","thinking":"look it up","signature":"enc_1"},
+				{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}
+			]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"sunny"}]}
+		]
+	}`, &req))
+
+	out, err := ClaudeRequestToResponsesRequest(&req)
+	require.NoError(t, err)
+	require.JSONEq(t, `"be brief"`, string(out.Instructions))
+	require.JSONEq(t, `"required"`, string(out.ToolChoice))
+	require.JSONEq(t, `false`, string(out.ParallelToolCalls))
+	require.Equal(t, "medium", out.Reasoning.Effort)
+	require.JSONEq(t, `[{"type":"function","name":"get_weather","parameters":{"type":"object"}}]`, string(out.Tools))
+	require.JSONEq(t, `[
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"weather?"},{"type":"input_image","image_url":"data:image/png;base64,AAA"}]},
+		{"type":"reasoning","summary":[{"type":"summary_text","text":"look it up"}],"encrypted_content":"enc_1"},
+		{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+		{"type":"function_call_output","call_id":"call_1","output":"sunny"}
+	]`, string(out.Input))
+}
+
+func TestResponsesToClaudeStreamConverter(t *testing.T) {
+	converter := NewResponsesToClaudeStreamConverter("resp_fallback", "m", 3)
+	event := func(data string) *dto.ResponsesStreamResponse {
+		var e dto.ResponsesStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(data, &e))
+		return &e
+	}
+
+	var events []*dto.ClaudeResponse
+	for _, data := range []string{
+		`{"type":"response.created","response":{"id":"resp_1"}}`,
+		`{"type":"response.output_item.added","item":{"id":"rs_1","type":"reasoning"}}`,
+		`{"type":"response.reasoning_summary_part.added","item_id":"rs_1"}`,
+		`{"type":"response.reasoning_summary_text.delta","item_id":"rs_1","delta":"hmm"}`,
+		`{"type":"response.output_item.done","item":{"id":"rs_1","type":"reasoning","encrypted_content":"enc"}}`,
+		`{"type":"response.output_item.added","item":{"id":"fc_1","type":"function_call","call_id":"call_1","name":"f"}}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{}"}`,
+		`{"type":"response.output_item.done","item":{"id":"fc_1","type":"function_call"}}`,
+		`{"type":"response.completed","response":{"id":"resp_1","status":"completed","usage":{"input_tokens":10,"output_tokens":4}}}`,
+	} {
+		events = append(events, converter.ConvertEvent(event(data))...)
+	}
+	require.Nil(t, converter.Finish())
+
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []string{
+		"message_start",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	}, types)
+	require.Equal(t, "msg_1", events[0].Message.Id)
+	require.Equal(t, "enc", events[3].Delta.Signature)
+	require.Equal(t, 1, *events[5].Index)
+	require.Equal(t, "tool_use", *events[8].Delta.StopReason)
+	require.Equal(t, 10, events[8].Usage.InputTokens)
+	require.Equal(t, 4, events[8].Usage.OutputTokens)
+}
@@ -0,0 +1,332 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// responsesInputItem 覆盖 Responses input 数组中 message / function_call / function_call_output 三类条目
+type responsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+type responsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+func responsesContentToChatParts(raw json.RawMessage) ([]dto.MediaContent, error) {
+	var parts []map[string]any
+	if err := common.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	out := make([]dto.MediaContent, 0, len(parts))
+	for _, part := range parts {
+		partType, _ := part["type"].(string)
+		switch partType {
+		case "input_text", "output_text", "text", "summary_text":
+			out = append(out, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: common.Interface2String(part["text"]),
+			})
+		case "refusal":
+			out = append(out, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: common.Interface2String(part["refusal"]),
+			})
+		case "input_image":
+			url := normalizeChatImageURLToString(part["image_url"])
+			if s, ok := url.(string); !ok || s == "" {
+				if fileId := common.Interface2String(part["file_id"]); fileId != "" {
+					return nil, errors.New("input_image with file_id is not supported in chat compatibility mode")
+				}
+			}
+			imageUrl := &dto.MessageImageUrl{Url: common.Interface2String(url)}
+			if detail, ok := part["detail"].(string); ok {
+				imageUrl.Detail = detail
+			}
+			out = append(out, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: imageUrl,
+			})
+		case "input_file":
+			file := make(map[string]any)
+			for _, key := range []string{"file_id", "file_data", "filename"} {
+				if v, ok := part[key]; ok {
+					file[key] = v
+				}
+			}
+			if fileUrl := common.Interface2String(part["file_url"]); fileUrl != "" {
+				file["file_data"] = fileUrl
+			}
+			out = append(out, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: file,
+			})
+		case "input_audio":
+			out = append(out, dto.MediaContent{
+				Type:       dto.ContentTypeInputAudio,
+				InputAudio: part["input_audio"],
+			})
+		default:
+			return nil, fmt.Errorf("unsupported content type %q in chat compatibility mode", partType)
+		}
+	}
+	return out, nil
+}
+
+func chatPartsToText(parts []dto.MediaContent) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type == dto.ContentTypeText {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// responsesOutputToString 将 function_call_output 的 output（字符串或内容数组）转为工具消息文本
+func responsesOutputToString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	if common.GetJsonType(raw) == "string" {
+		var s string
+		_ = common.Unmarshal(raw, &s)
+		return s
+	}
+	if parts, err := responsesContentToChatParts(raw); err == nil {
+		if text := chatPartsToText(parts); text != "" {
+			return text
+		}
+	}
+	return string(raw)
+}
+
+func convertResponsesTextToChatResponseFormat(raw json.RawMessage) *dto.ResponseFormat {
+	if len(raw) == 0 {
+		return nil
+	}
+	var text struct {
+		Format map[string]any `json:"format"`
+	}
+	if err := common.Unmarshal(raw, &text); err != nil || text.Format == nil {
+		return nil
+	}
+	formatType, _ := text.Format["type"].(string)
+	switch formatType {
+	case "json_object":
+		return &dto.ResponseFormat{Type: formatType}
+	case "json_schema":
+		schema := make(map[string]any)
+		for key, value := range text.Format {
+			if key == "type" {
+				continue
+			}
+			schema[key] = value
+		}
+		schemaRaw, _ := common.Marshal(schema)
+		return &dto.ResponseFormat{Type: formatType, JsonSchema: schemaRaw}
+	default:
+		return nil
+	}
+}
+
+func convertResponsesToolChoiceToChat(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	if common.GetJsonType(raw) == "string" {
+		var s string
+		_ = common.Unmarshal(raw, &s)
+		return s
+	}
+	var m map[string]any
+	if err := common.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	// Responses: {"type":"function","name":"..."}
+	// Chat: {"type":"function","function":{"name":"..."}}
+	if t, _ := m["type"].(string); t == "function" {
+		if name, ok := m["name"].(string); ok && name != "" {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": name},
+			}
+		}
+	}
+	return m
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 /v1/responses 请求转换为 Chat Completions 请求，
+// 供只支持 Chat 的渠道（Claude、Gemini 等）复用各自的 Chat 转换逻辑
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if req.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported in chat compatibility mode")
+	}
+
+	messages := make([]dto.Message, 0)
+	if len(req.Instructions) > 0 {
+		var instructions string
+		if err := common.Unmarshal(req.Instructions, &instructions); err != nil {
+			return nil, fmt.Errorf("invalid instructions: %w", err)
+		}
+		if strings.TrimSpace(instructions) != "" {
+			messages = append(messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+
+	switch common.GetJsonType(req.Input) {
+	case "string":
+		var input string
+		_ = common.Unmarshal(req.Input, &input)
+		messages = append(messages, dto.Message{Role: "user", Content: input})
+	case "array":
+		var items []responsesInputItem
+		if err := common.Unmarshal(req.Input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		for _, item := range items {
+			itemType := item.Type
+			if itemType == "" {
+				itemType = "message"
+			}
+			switch itemType {
+			case "message":
+				role := strings.TrimSpace(item.Role)
+				if role == "developer" {
+					role = "system"
+				}
+				if role == "" {
+					return nil, errors.New("input message role is required")
+				}
+				msg := dto.Message{Role: role}
+				switch common.GetJsonType(item.Content) {
+				case "string":
+					var s string
+					_ = common.Unmarshal(item.Content, &s)
+					msg.Content = s
+				case "array":
+					parts, err := responsesContentToChatParts(item.Content)
+					if err != nil {
+						return nil, err
+					}
+					// 助手与系统消息只保留文本，避免上游拒绝非用户角色的多模态内容
+					if role == "user" {
+						// 使用 []any 保存，下游转换按 Content 重建消息时仍能解析出各内容块
+						content := make([]any, 0, len(parts))
+						for _, part := range parts {
+							content = append(content, part)
+						}
+						msg.Content = content
+					} else {
+						msg.Content = chatPartsToText(parts)
+					}
+				default:
+					msg.Content = ""
+				}
+				messages = append(messages, msg)
+			case "function_call":
+				toolCall := dto.ToolCallRequest{
+					ID:   item.CallId,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      item.Name,
+						Arguments: item.Arguments,
+					},
+				}
+				// 连续的 function_call 合并到同一条助手消息
+				if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+					toolCalls := append(messages[n-1].ParseToolCalls(), toolCall)
+					messages[n-1].SetToolCalls(toolCalls)
+					continue
+				}
+				msg := dto.Message{Role: "assistant", Content: ""}
+				msg.SetToolCalls([]dto.ToolCallRequest{toolCall})
+				messages = append(messages, msg)
+			case "function_call_output":
+				messages = append(messages, dto.Message{
+					Role:       "tool",
+					Content:    responsesOutputToString(item.Output),
+					ToolCallId: item.CallId,
+				})
+			case "reasoning":
+				// 推理条目由上游重新生成，不回传
+				continue
+			default:
+				return nil, fmt.Errorf("unsupported input item type %q in chat compatibility mode", itemType)
+			}
+		}
+	case "":
+		// input 可省略
+	default:
+		return nil, errors.New("input must be a string or an array")
+	}
+
+	out := &dto.GeneralOpenAIRequest{
+		Model:          req.Model,
+		Messages:       messages,
+		Stream:         req.Stream,
+		MaxTokens:      req.MaxOutputTokens,
+		Temperature:    req.Temperature,
+		ResponseFormat: convertResponsesTextToChatResponseFormat(req.Text),
+		ToolChoice:     convertResponsesToolChoiceToChat(req.ToolChoice),
+		User:           req.User,
+	}
+	if req.Stream {
+		out.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.TopP != nil {
+		out.TopP = *req.TopP
+	}
+	if req.Reasoning != nil && req.Reasoning.Effort != "" {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			out.ParallelTooCalls = &parallel
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		var tools []responsesTool
+		if err := common.Unmarshal(req.Tools, &tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+		for _, tool := range tools {
+			if tool.Type != "function" {
+				return nil, fmt.Errorf("tool type %q is not supported in chat compatibility mode", tool.Type)
+			}
+			out.Tools = append(out.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+	}
+
+	return out, nil
+}
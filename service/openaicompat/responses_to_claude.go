@@ -0,0 +1,328 @@
+package openaicompat
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/reasonmap"
+)
+
+// ResponsesUsageToClaudeUsage 将 Responses 用量转为 Claude 用量，缓存命中部分计入 cache_read_input_tokens
+func ResponsesUsageToClaudeUsage(usage *dto.Usage) *dto.ClaudeUsage {
+	if usage == nil {
+		return &dto.ClaudeUsage{}
+	}
+	cached := 0
+	if usage.InputTokensDetails != nil {
+		cached = usage.InputTokensDetails.CachedTokens
+	}
+	inputTokens := usage.InputTokens - cached
+	if inputTokens < 0 {
+		inputTokens = 0
+	}
+	return &dto.ClaudeUsage{
+		InputTokens:          inputTokens,
+		OutputTokens:         usage.OutputTokens,
+		CacheReadInputTokens: cached,
+	}
+}
+
+// ResponsesUsageToChatUsage 将 Responses 用量转为计费使用的 Chat 用量
+func ResponsesUsageToChatUsage(usage *dto.Usage) *dto.Usage {
+	out := &dto.Usage{}
+	if usage == nil {
+		return out
+	}
+	out.PromptTokens = usage.InputTokens
+	out.CompletionTokens = usage.OutputTokens
+	out.TotalTokens = usage.TotalTokens
+	if out.TotalTokens == 0 {
+		out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	}
+	if usage.InputTokensDetails != nil {
+		out.PromptTokensDetails.CachedTokens = usage.InputTokensDetails.CachedTokens
+	}
+	return out
+}
+
+// responsesClaudeStopReason 由响应状态与输出条目推断 Claude 的 stop_reason
+func responsesClaudeStopReason(resp *dto.OpenAIResponsesResponse, hasToolUse bool) string {
+	finishReason := "stop"
+	if resp != nil && resp.IncompleteDetails != nil {
+		switch resp.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			finishReason = "length"
+		case "content_filter":
+			finishReason = constant.FinishReasonContentFilter
+		}
+	} else if hasToolUse {
+		finishReason = "tool_calls"
+	}
+	return reasonmap.OpenAIFinishReasonToClaudeStopReason(finishReason)
+}
+
+func responsesIdToClaudeMessageId(id string) string {
+	return "msg_" + strings.TrimPrefix(id, "resp_")
+}
+
+func responsesReasoningText(item *dto.ResponsesOutput) string {
+	texts := make([]string, 0, len(item.Summary))
+	for _, part := range item.Summary {
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func responsesArgumentsToClaudeInput(arguments string) any {
+	if strings.TrimSpace(arguments) == "" {
+		return map[string]any{}
+	}
+	var input map[string]any
+	if err := common.UnmarshalJsonStr(arguments, &input); err != nil {
+		return arguments
+	}
+	return input
+}
+
+// ResponsesResponseToClaudeResponse 将 /v1/responses 非流式响应转为 Claude Messages 响应：
+// reasoning 条目转为 thinking 块（加密内容作为签名），function_call 转为 tool_use
+func ResponsesResponseToClaudeResponse(resp *dto.OpenAIResponsesResponse) *dto.ClaudeResponse {
+	contents := make([]dto.ClaudeMediaMessage, 0, len(resp.Output))
+	hasToolUse := false
+	for i := range resp.Output {
+		item := &resp.Output[i]
+		switch item.Type {
+		case "reasoning":
+			thinking := responsesReasoningText(item)
+			if thinking == "" && item.EncryptedContent == "" {
+				continue
+			}
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:      "thinking",
+				Thinking:  common.GetPointer(thinking),
+				Signature: item.EncryptedContent,
+			})
+		case "message":
+			for _, part := range item.Content {
+				if part.Type != "output_text" && part.Type != "refusal" {
+					continue
+				}
+				block := dto.ClaudeMediaMessage{Type: dto.ContentTypeText}
+				block.SetText(part.Text)
+				contents = append(contents, block)
+			}
+		case "function_call":
+			hasToolUse = true
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    item.CallId,
+				Name:  item.Name,
+				Input: responsesArgumentsToClaudeInput(item.Arguments),
+			})
+		}
+	}
+	return &dto.ClaudeResponse{
+		Id:         responsesIdToClaudeMessageId(resp.ID),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      resp.Model,
+		Content:    contents,
+		StopReason: responsesClaudeStopReason(resp, hasToolUse),
+		Usage:      ResponsesUsageToClaudeUsage(resp.Usage),
+	}
+}
+
+// ResponsesToClaudeStreamConverter 将 /v1/responses 流式事件重建为 Claude Messages 流式事件
+type ResponsesToClaudeStreamConverter struct {
+	id          string
+	model       string
+	inputTokens int
+	started     bool
+	done        bool
+	nextIndex   int
+	// 当前打开的内容块：按 Responses 条目 ID 记录对应的 Claude 块索引
+	openBlocks map[string]int
+	// 推理条目已输出的摘要段数，段与段之间补充换行
+	summaryParts map[string]int
+	hasToolUse   bool
+	Usage        *dto.Usage
+}
+
+// NewResponsesToClaudeStreamConverter id 为上游事件不含响应 ID 时使用的消息 ID，inputTokens 为 message_start 中预估的输入 token 数
+func NewResponsesToClaudeStreamConverter(id string, model string, inputTokens int) *ResponsesToClaudeStreamConverter {
+	return &ResponsesToClaudeStreamConverter{
+		id:           id,
+		model:        model,
+		inputTokens:  inputTokens,
+		openBlocks:   make(map[string]int),
+		summaryParts: make(map[string]int),
+	}
+}
+
+func (s *ResponsesToClaudeStreamConverter) start(id string) []*dto.ClaudeResponse {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	if id == "" {
+		id = s.id
+	}
+	msg := &dto.ClaudeMediaMessage{
+		Id:    responsesIdToClaudeMessageId(id),
+		Type:  "message",
+		Role:  "assistant",
+		Model: s.model,
+		Usage: &dto.ClaudeUsage{InputTokens: s.inputTokens},
+	}
+	msg.SetContent(make([]any, 0))
+	return []*dto.ClaudeResponse{{Type: "message_start", Message: msg}}
+}
+
+func (s *ResponsesToClaudeStreamConverter) openBlock(itemId string, block dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	if _, ok := s.openBlocks[itemId]; ok {
+		return nil
+	}
+	index := s.nextIndex
+	s.nextIndex++
+	s.openBlocks[itemId] = index
+	return []*dto.ClaudeResponse{{
+		Type:         "content_block_start",
+		Index:        common.GetPointer(index),
+		ContentBlock: &block,
+	}}
+}
+
+func (s *ResponsesToClaudeStreamConverter) delta(itemId string, delta dto.ClaudeMediaMessage) *dto.ClaudeResponse {
+	return &dto.ClaudeResponse{
+		Type:  "content_block_delta",
+		Index: common.GetPointer(s.openBlocks[itemId]),
+		Delta: &delta,
+	}
+}
+
+func (s *ResponsesToClaudeStreamConverter) closeBlock(itemId string) []*dto.ClaudeResponse {
+	index, ok := s.openBlocks[itemId]
+	if !ok {
+		return nil
+	}
+	delete(s.openBlocks, itemId)
+	return []*dto.ClaudeResponse{{Type: "content_block_stop", Index: common.GetPointer(index)}}
+}
+
+func (s *ResponsesToClaudeStreamConverter) openTextBlock(itemId string) []*dto.ClaudeResponse {
+	return s.openBlock(itemId, dto.ClaudeMediaMessage{Type: dto.ContentTypeText, Text: common.GetPointer("")})
+}
+
+func (s *ResponsesToClaudeStreamConverter) openThinkingBlock(itemId string) []*dto.ClaudeResponse {
+	return s.openBlock(itemId, dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer("")})
+}
+
+// ConvertEvent 转换一个 Responses 流式事件，返回需要按顺序输出的 Claude 事件
+func (s *ResponsesToClaudeStreamConverter) ConvertEvent(event *dto.ResponsesStreamResponse) []*dto.ClaudeResponse {
+	if s.done {
+		return nil
+	}
+	var out []*dto.ClaudeResponse
+	if !s.started {
+		id := ""
+		if event.Response != nil {
+			id = event.Response.ID
+		}
+		out = append(out, s.start(id)...)
+	}
+
+	switch event.Type {
+	case dto.ResponsesOutputTypeItemAdded:
+		if event.Item == nil {
+			break
+		}
+		// 推理条目在收到摘要或加密内容时才打开 thinking 块，避免输出空的思考块
+		switch event.Item.Type {
+		case "function_call":
+			s.hasToolUse = true
+			out = append(out, s.openBlock(event.Item.ID, dto.ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    event.Item.CallId,
+				Name:  event.Item.Name,
+				Input: map[string]any{},
+			})...)
+		}
+	case "response.reasoning_summary_text.delta":
+		out = append(out, s.openThinkingBlock(event.ItemID)...)
+		if event.Delta != "" {
+			out = append(out, s.delta(event.ItemID, dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: common.GetPointer(event.Delta)}))
+		}
+	case "response.reasoning_summary_part.added":
+		out = append(out, s.openThinkingBlock(event.ItemID)...)
+		if s.summaryParts[event.ItemID] > 0 {
+			out = append(out, s.delta(event.ItemID, dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: common.GetPointer("\n\n")}))
+		}
+		s.summaryParts[event.ItemID]++
+	case "response.output_text.delta", "response.refusal.delta":
+		out = append(out, s.openTextBlock(event.ItemID)...)
+		if event.Delta != "" {
+			out = append(out, s.delta(event.ItemID, dto.ClaudeMediaMessage{Type: "text_delta", Text: common.GetPointer(event.Delta)}))
+		}
+	case "response.function_call_arguments.delta":
+		if _, ok := s.openBlocks[event.ItemID]; ok && event.Delta != "" {
+			out = append(out, s.delta(event.ItemID, dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: common.GetPointer(event.Delta)}))
+		}
+	case dto.ResponsesOutputTypeItemDone:
+		if event.Item == nil {
+			break
+		}
+		if event.Item.Type == "reasoning" && event.Item.EncryptedContent != "" {
+			out = append(out, s.openThinkingBlock(event.Item.ID)...)
+			out = append(out, s.delta(event.Item.ID, dto.ClaudeMediaMessage{Type: "signature_delta", Signature: event.Item.EncryptedContent}))
+		}
+		out = append(out, s.closeBlock(event.Item.ID)...)
+	case "response.completed", "response.incomplete":
+		out = append(out, s.finish(event.Response)...)
+	}
+	return out
+}
+
+func (s *ResponsesToClaudeStreamConverter) finish(resp *dto.OpenAIResponsesResponse) []*dto.ClaudeResponse {
+	var out []*dto.ClaudeResponse
+	itemIds := make([]string, 0, len(s.openBlocks))
+	for itemId := range s.openBlocks {
+		itemIds = append(itemIds, itemId)
+	}
+	sort.Slice(itemIds, func(i, j int) bool {
+		return s.openBlocks[itemIds[i]] < s.openBlocks[itemIds[j]]
+	})
+	for _, itemId := range itemIds {
+		out = append(out, s.closeBlock(itemId)...)
+	}
+	if resp != nil && resp.Usage != nil {
+		s.Usage = resp.Usage
+	}
+	usage := ResponsesUsageToClaudeUsage(s.Usage)
+	if usage.InputTokens == 0 && usage.CacheReadInputTokens == 0 {
+		usage.InputTokens = s.inputTokens
+	}
+	out = append(out,
+		&dto.ClaudeResponse{
+			Type:  "message_delta",
+			Usage: usage,
+			Delta: &dto.ClaudeMediaMessage{
+				StopReason: common.GetPointer(responsesClaudeStopReason(resp, s.hasToolUse)),
+			},
+		},
+		&dto.ClaudeResponse{Type: "message_stop"},
+	)
+	s.done = true
+	return out
+}
+
+// Finish 上游未发送终态事件时补全结束事件；已结束时返回空
+func (s *ResponsesToClaudeStreamConverter) Finish() []*dto.ClaudeResponse {
+	if s.done {
+		return nil
+	}
+	out := s.start("")
+	return append(out, s.finish(nil)...)
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+type piiDetector struct {
+	name    string
+	re      *regexp.Regexp
+	isValid func(match string) bool
+}
+
+// 按顺序匹配：长数字串优先，避免卡号、身份证号被识别为电话
+var piiBuiltinDetectors = []piiDetector{
+	{name: operation_setting.PIIDetectorCreditCard, re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), isValid: luhnValid},
+	{name: operation_setting.PIIDetectorIdCard, re: regexp.MustCompile(`\b\d{17}[\dXx]\b`), isValid: chineseIdCardValid},
+	{name: operation_setting.PIIDetectorSSN, re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{name: operation_setting.PIIDetectorEmail, re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)},
+	{name: operation_setting.PIIDetectorPhone, re: regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?(?:\(\d{3}\)[ -]?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b|\b1[3-9]\d{9}\b`)},
+}
+
+// piiTextKeys 只处理这些字段下的字符串，模型名、图片地址、工具参数等保持不变
+var piiTextKeys = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"prompt":       true,
+	"input":        true,
+	"system":       true,
+	"instructions": true,
+}
+
+func luhnValid(match string) bool {
+	digits := make([]int, 0, len(match))
+	for _, r := range match {
+		if unicode.IsDigit(r) {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func chineseIdCardValid(match string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checks := "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(match[i]-'0') * weights[i]
+	}
+	return strings.ToUpper(match[17:]) == string(checks[sum%11])
+}
+
+// PIIRedactor 按分组策略识别个人信息，同一取值始终映射为同一占位符
+type PIIRedactor struct {
+	detectors []piiDetector
+	// 占位符 -> 原值
+	Mapping map[string]string
+}
+
+func NewPIIRedactor(group string) *PIIRedactor {
+	setting := operation_setting.GetPIIRedactionSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	policy := setting.PolicyForGroup(group)
+	if policy.IsEmpty() {
+		return nil
+	}
+	enabled := make(map[string]bool, len(policy.Detectors))
+	for _, name := range policy.Detectors {
+		enabled[name] = true
+	}
+	redactor := &PIIRedactor{Mapping: make(map[string]string)}
+	for _, detector := range piiBuiltinDetectors {
+		if enabled[detector.name] {
+			redactor.detectors = append(redactor.detectors, detector)
+		}
+	}
+	for _, rule := range policy.Rules {
+		if rule.Name == "" || rule.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid pii redaction rule %s: %v", rule.Name, err))
+			continue
+		}
+		redactor.detectors = append(redactor.detectors, piiDetector{name: rule.Name, re: re})
+	}
+	if len(redactor.detectors) == 0 {
+		return nil
+	}
+	return redactor
+}
+
+func piiPlaceholder(name string, value string) string {
+	return fmt.Sprintf("[%s_%s]", strings.ToUpper(name), common.GenerateHMAC(name + ":" + value)[:8])
+}
+
+// Redact 将文本中的个人信息替换为占位符
+func (r *PIIRedactor) Redact(text string) string {
+	for _, detector := range r.detectors {
+		text = detector.re.ReplaceAllStringFunc(text, func(match string) string {
+			if detector.isValid != nil && !detector.isValid(match) {
+				return match
+			}
+			placeholder := piiPlaceholder(detector.name, match)
+			r.Mapping[placeholder] = match
+			return placeholder
+		})
+	}
+	return text
+}
+
+func escapePIIPathKey(key string) string {
+	replacer := strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`)
+	return replacer.Replace(key)
+}
+
+func walkPIITextFields(value gjson.Result, path string, key string, keys map[string]bool, fn func(path string, text string)) {
+	switch {
+	case value.IsObject():
+		value.ForEach(func(k, v gjson.Result) bool {
+			childPath := escapePIIPathKey(k.String())
+			if path != "" {
+				childPath = path + "." + childPath
+			}
+			walkPIITextFields(v, childPath, k.String(), keys, fn)
+			return true
+		})
+	case value.IsArray():
+		i := 0
+		value.ForEach(func(_, v gjson.Result) bool {
+			walkPIITextFields(v, fmt.Sprintf("%s.%d", path, i), key, keys, fn)
+			i++
+			return true
+		})
+	case value.Type == gjson.String:
+		if keys[key] {
+			fn(path, value.String())
+		}
+	}
+}
+
+// RewritePIITextFields 遍历 JSON 中文本字段（数组元素沿用所在字段名），用 rewrite 的结果替换原值
+func RewritePIITextFields(data []byte, extraKeys []string, rewrite func(path string, text string) string) ([]byte, bool) {
+	keys := piiTextKeys
+	if len(extraKeys) > 0 {
+		keys = make(map[string]bool, len(piiTextKeys)+len(extraKeys))
+		for k := range piiTextKeys {
+			keys[k] = true
+		}
+		for _, k := range extraKeys {
+			keys[k] = true
+		}
+	}
+	type change struct {
+		path string
+		text string
+	}
+	var changes []change
+	walkPIITextFields(gjson.ParseBytes(data), "", "", keys, func(path string, text string) {
+		if rewritten := rewrite(path, text); rewritten != text {
+			changes = append(changes, change{path: path, text: rewritten})
+		}
+	})
+	if len(changes) == 0 {
+		return data, false
+	}
+	for _, ch := range changes {
+		updated, err := sjson.SetBytes(data, ch.path, ch.text)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to rewrite field %s: %v", ch.path, err))
+			continue
+		}
+		data = updated
+	}
+	return data, true
+}
+
+// RedactRequestPII 在请求转换前将文本中的个人信息替换为占位符，返回占位符到原值的映射，无替换时返回 nil
+func RedactRequestPII[T any](c *gin.Context, info *relaycommon.RelayInfo, request *T) (map[string]string, error) {
+	redactor := NewPIIRedactor(info.UsingGroup)
+	if redactor == nil {
+		return nil, nil
+	}
+	data, err := common.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	data, changed := RewritePIITextFields(data, nil, func(_ string, text string) string {
+		return redactor.Redact(text)
+	})
+	if !changed || len(redactor.Mapping) == 0 {
+		return nil, nil
+	}
+	var redacted T
+	if err := common.Unmarshal(data, &redacted); err != nil {
+		return nil, err
+	}
+	*request = redacted
+	common.SetContextKey(c, constant.ContextKeyPIIRedactedCount, len(redactor.Mapping))
+	return redactor.Mapping, nil
+}
+
+// PIIRehydrator 在响应中将占位符还原为原值，流式响应中被拆开的占位符暂存到下一段再还原
+type PIIRehydrator struct {
+	replacer     *strings.Replacer
+	jsonReplacer *strings.Replacer
+	placeholders []string
+	carry        map[string]string
+}
+
+func NewPIIRehydrator(mapping map[string]string) *PIIRehydrator {
+	placeholders := make([]string, 0, len(mapping))
+	pairs := make([]string, 0, len(mapping)*2)
+	jsonPairs := make([]string, 0, len(mapping)*2)
+	for placeholder, original := range mapping {
+		placeholders = append(placeholders, placeholder)
+		pairs = append(pairs, placeholder, original)
+		escaped, _ := common.Marshal(original)
+		jsonPairs = append(jsonPairs, placeholder, string(escaped[1:len(escaped)-1]))
+	}
+	sort.Strings(placeholders)
+	return &PIIRehydrator{
+		replacer:     strings.NewReplacer(pairs...),
+		jsonReplacer: strings.NewReplacer(jsonPairs...),
+		placeholders: placeholders,
+		carry:        make(map[string]string),
+	}
+}
+
+// Restore 还原完整文本中的占位符
+func (r *PIIRehydrator) Restore(text string) string {
+	return r.replacer.Replace(text)
+}
+
+// RestoreJSON 还原 JSON 文本中的占位符，原值按 JSON 字符串转义
+func (r *PIIRehydrator) RestoreJSON(data []byte) []byte {
+	return []byte(r.jsonReplacer.Replace(string(data)))
+}
+
+// RestoreChunk 还原流式片段，末尾可能是占位符前半段时暂存，与同一字段的下一段拼接后再还原
+func (r *PIIRehydrator) RestoreChunk(key string, text string) string {
+	text = r.carry[key] + text
+	delete(r.carry, key)
+	text = r.replacer.Replace(text)
+	idx := strings.LastIndexByte(text, '[')
+	if idx < 0 || strings.IndexByte(text[idx:], ']') >= 0 {
+		return text
+	}
+	suffix := text[idx:]
+	for _, placeholder := range r.placeholders {
+		if len(suffix) < len(placeholder) && strings.HasPrefix(placeholder, suffix) {
+			r.carry[key] = suffix
+			return text[:idx]
+		}
+	}
+	return text
+}
+
+// FlushChunk 取出字段暂存的末尾文本，该字段不再有后续片段或流结束时调用，避免尾部内容丢失
+func (r *PIIRehydrator) FlushChunk(key string) string {
+	text := r.carry[key]
+	delete(r.carry, key)
+	return text
+}
+
+// PendingChunkKeys 返回仍有暂存文本的字段
+func (r *PIIRehydrator) PendingChunkKeys() []string {
+	keys := make([]string, 0, len(r.carry))
+	for key := range r.carry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendPIIRedactionInfo(ctx *gin.Context, other map[string]interface{}) {
+	if count := common.GetContextKeyInt(ctx, constant.ContextKeyPIIRedactedCount); count > 0 {
+		other["pii_redacted"] = count
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIIRehydratorRestoreChunk(t *testing.T) {
+	r := NewPIIRehydrator(map[string]string{"[EMAIL_1a2b3c4d]": "alice@example.com"})
+	key := "choices.0.delta.content"
+
+	// 被拆开的占位符暂存到下一段再还原
+	require.Equal(t, "mail: ", r.RestoreChunk(key, "mail: [EMA"))
+	require.Equal(t, []string{key}, r.PendingChunkKeys())
+	require.Equal(t, "alice@example.com ok", r.RestoreChunk(key, "IL_1a2b3c4d] ok"))
+	require.Empty(t, r.PendingChunkKeys())
+
+	// 不同字段的暂存互不影响
+	require.Equal(t, "a ", r.RestoreChunk(key, "a [E"))
+	require.Equal(t, "b [x]", r.RestoreChunk("delta", "b [x]"))
+	require.Equal(t, []string{key}, r.PendingChunkKeys())
+
+	// 流结束时取出的暂存文本原样补发
+	require.Equal(t, "[E", r.FlushChunk(key))
+	require.Empty(t, r.PendingChunkKeys())
+	require.Equal(t, "", r.FlushChunk(key))
+}
+
+func TestPIIRehydratorRestoreJSON(t *testing.T) {
+	r := NewPIIRehydrator(map[string]string{"[NAME_1a2b3c4d]": `Bob "B"`})
+	require.Equal(t, `{"content":"hi Bob \"B\""}`, string(r.RestoreJSON([]byte(`{"content":"hi [NAME_1a2b3c4d]"}`))))
+	require.Equal(t, `hi Bob "B"`, r.Restore("hi [NAME_1a2b3c4d]"))
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
@@ -219,7 +220,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	}
 	other := GenerateWssOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
-	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+	RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.InputTokens,
 		CompletionTokens: usage.OutputTokens,
@@ -236,6 +237,10 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 }
 
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
+	if IsHedgeLoser(ctx) {
+		// 对冲请求落败的一方不计费
+		return
+	}
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
@@ -317,7 +322,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		cacheCreationTokens5m, cacheCreationRatio5m,
 		cacheCreationTokens1h, cacheCreationRatio1h,
 		modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
-	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+	RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
@@ -356,6 +361,10 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if IsHedgeLoser(ctx) {
+		// 对冲请求落败的一方不计费
+		return
+	}
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.PromptTokensDetails.TextTokens
@@ -423,7 +432,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	}
 	other := GenerateAudioOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
-	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+	RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.PromptTokens,
 		CompletionTokens: usage.CompletionTokens,
@@ -439,6 +448,19 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	})
 }
 
+// RecordConsumeLog 记录消费日志，并将本次实际计费回传到请求上下文，
+// 供批处理汇总、TPM 限流结算与子令牌、终端用户用量累计使用，同时计入 Prometheus 消费指标
+func RecordConsumeLog(c *gin.Context, userId int, params model.RecordConsumeLogParams) {
+	if common.GetContextKeyString(c, constant.ContextKeyRelayBatchId) != "" {
+		common.SetContextKey(c, constant.ContextKeyRelayBatchLineQuota, params.Quota)
+	}
+	common.SetContextKey(c, constant.ContextKeyConsumedPromptTokens, common.GetContextKeyInt(c, constant.ContextKeyConsumedPromptTokens)+params.PromptTokens)
+	common.SetContextKey(c, constant.ContextKeyConsumedCompletionTokens, common.GetContextKeyInt(c, constant.ContextKeyConsumedCompletionTokens)+params.CompletionTokens)
+	common.SetContextKey(c, constant.ContextKeyConsumedQuota, common.GetContextKeyInt(c, constant.ContextKeyConsumedQuota)+params.Quota)
+	metrics.RecordConsume(params.ChannelId, params.ModelName, params.Group, params.PromptTokens, params.CompletionTokens, params.Quota)
+	model.RecordConsumeLog(c, userId, params)
+}
+
 func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -456,6 +478,17 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
+	// 周期预算对无限额度令牌同样生效
+	if token.HasBudget() {
+		if err := model.ResetTokenBudgetIfDue(token); err != nil {
+			return err
+		}
+		if token.BudgetRemain < quota {
+			return fmt.Errorf("token %s budget is not enough, budget remain: %s, need quota: %s, resets at %s",
+				token.BudgetPeriod, logger.FormatQuota(token.BudgetRemain), logger.FormatQuota(quota),
+				time.Unix(token.BudgetNextResetTime, 0).UTC().Format(time.RFC3339))
+		}
+	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
 		return err
@@ -498,6 +531,13 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		budget, err := model.GetBudgetChain(relayInfo.OrgId, relayInfo.ProjectId)
+		if err != nil {
+			return err
+		}
+		if err = model.AdjustBudget(budget, quota); err != nil {
+			return err
+		}
 	}
 
 	if sendEmail {
@@ -522,6 +562,14 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 		consumeQuota := quota + preConsumedQuota
 		if relayInfo.UserQuota-consumeQuota < threshold {
 			quotaTooLow = true
+			// 仅在本次请求使余额跌破阈值时推送一次事件
+			if relayInfo.UserQuota >= threshold {
+				PublishWebhookEvent(constant.WebhookEventQuotaThresholdCrossed, map[string]interface{}{
+					"user_id":   relayInfo.UserId,
+					"threshold": threshold,
+					"quota":     relayInfo.UserQuota - consumeQuota,
+				})
+			}
 		}
 		if quotaTooLow {
 			prompt := "您的额度即将用尽"
@@ -0,0 +1,585 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// RelayBatchEndpoints 支持的批处理端点
+var RelayBatchEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+	"/v1/moderations",
+}
+
+// 单行 JSONL 的最大长度
+const relayBatchMaxLineBytes = 32 << 20
+
+// ErrRelayBatchInsufficientQuota 预扣批处理额度时用户、令牌或组织项目额度不足
+var ErrRelayBatchInsufficientQuota = errors.New("insufficient quota for batch")
+
+// RelayBatchInput 解析后的批处理输入
+type RelayBatchInput struct {
+	Lines  []*dto.OpenAIBatchInputLine
+	Models map[string]string // custom_id -> model
+}
+
+// NewRelayBatchScanner 按行读取 JSONL，允许较长的单行
+func NewRelayBatchScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), relayBatchMaxLineBytes)
+	return scanner
+}
+
+// ParseRelayBatchInput 读取并校验批处理输入文件
+func ParseRelayBatchInput(reader io.Reader, endpoint string) (*RelayBatchInput, error) {
+	maxLines := operation_setting.GetBatchSetting().MaxLines
+	input := &RelayBatchInput{Models: make(map[string]string)}
+	scanner := NewRelayBatchScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line dto.OpenAIBatchInputLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			return nil, fmt.Errorf("line %d: invalid json: %s", lineNo, err.Error())
+		}
+		if line.CustomId == "" {
+			return nil, fmt.Errorf("line %d: custom_id is required", lineNo)
+		}
+		if _, ok := input.Models[line.CustomId]; ok {
+			return nil, fmt.Errorf("line %d: duplicate custom_id %s", lineNo, line.CustomId)
+		}
+		if line.Method != "" && !strings.EqualFold(line.Method, http.MethodPost) {
+			return nil, fmt.Errorf("line %d: only POST method is supported", lineNo)
+		}
+		if line.Url != endpoint {
+			return nil, fmt.Errorf("line %d: url %s does not match batch endpoint %s", lineNo, line.Url, endpoint)
+		}
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := common.Unmarshal(line.Body, &body); err != nil || body.Model == "" {
+			return nil, fmt.Errorf("line %d: body.model is required", lineNo)
+		}
+		input.Models[line.CustomId] = body.Model
+		input.Lines = append(input.Lines, &line)
+		if maxLines > 0 && len(input.Lines) > maxLines {
+			return nil, fmt.Errorf("batch exceeds %d requests", maxLines)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(input.Lines) == 0 {
+		return nil, errors.New("input file is empty")
+	}
+	return input, nil
+}
+
+// LoadRelayBatchInput 读取批处理引用的输入文件
+func LoadRelayBatchInput(ctx context.Context, inputFile *model.RelayFile, endpoint string) (*RelayBatchInput, error) {
+	content, err := OpenRelayFileContent(ctx, inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return ParseRelayBatchInput(content, endpoint)
+}
+
+// CanForwardRelayBatch 判断批处理能否转发到输入文件所在渠道的上游 Batch API
+func CanForwardRelayBatch(inputFile *model.RelayFile, input *RelayBatchInput) bool {
+	if !operation_setting.GetBatchSetting().PreferUpstream || inputFile.IsLocal() {
+		return false
+	}
+	channel, err := model.CacheGetChannel(inputFile.ChannelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled || !IsRelayFileChannelSupported(channel.Type) {
+		return false
+	}
+	// 上游计费按行结算，需要每个模型都由该渠道提供且已配置价格
+	channelModels := channel.GetModels()
+	for _, modelName := range input.Models {
+		if !lo.Contains(channelModels, modelName) {
+			return false
+		}
+		if _, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+			continue
+		}
+		if _, ok, _ := ratio_setting.GetModelRatio(modelName); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func applyUpstreamRelayBatch(batch *model.RelayBatch, upstream *dto.OpenAIBatch) {
+	if upstream.Status != "" {
+		batch.Status = upstream.Status
+	}
+	batch.TotalCount = upstream.RequestCounts.Total
+	batch.CompletedCount = upstream.RequestCounts.Completed
+	batch.FailedCount = upstream.RequestCounts.Failed
+	derefTimestamp := func(v *int64) int64 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	batch.InProgressAt = derefTimestamp(upstream.InProgressAt)
+	batch.FinalizingAt = derefTimestamp(upstream.FinalizingAt)
+	batch.CompletedAt = derefTimestamp(upstream.CompletedAt)
+	batch.FailedAt = derefTimestamp(upstream.FailedAt)
+	batch.CancelledAt = derefTimestamp(upstream.CancelledAt)
+	batch.ExpiresAt = derefTimestamp(upstream.ExpiresAt)
+	if upstream.Errors != nil && len(upstream.Errors.Data) > 0 {
+		messages := make([]string, 0, len(upstream.Errors.Data))
+		for _, e := range upstream.Errors.Data {
+			messages = append(messages, e.Message)
+		}
+		batch.FailReason = strings.Join(messages, "; ")
+	}
+}
+
+// CreateUpstreamRelayBatch 在输入文件所在渠道创建上游批处理
+func CreateUpstreamRelayBatch(ctx context.Context, batch *model.RelayBatch, inputFile *model.RelayFile, metadata map[string]string) error {
+	channel, err := model.CacheGetChannel(inputFile.ChannelId)
+	if err != nil {
+		return err
+	}
+	payload, err := common.Marshal(dto.OpenAIBatchRequest{
+		InputFileId:      inputFile.UpstreamFileId,
+		Endpoint:         batch.Endpoint,
+		CompletionWindow: batch.CompletionWindow,
+		Metadata:         metadata,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := doRelayFileRequest(ctx, channel, inputFile.ChannelKeyIdx, http.MethodPost, "/v1/batches", bytes.NewReader(payload), "application/json")
+	if err != nil {
+		return err
+	}
+	var upstream dto.OpenAIBatch
+	if err := readRelayFileJSON(resp, &upstream); err != nil {
+		return err
+	}
+	if upstream.Id == "" {
+		return errors.New("upstream batch api returned empty batch id")
+	}
+	batch.Mode = model.RelayBatchModeUpstream
+	batch.ChannelId = inputFile.ChannelId
+	batch.ChannelKeyIdx = inputFile.ChannelKeyIdx
+	batch.UpstreamBatchId = upstream.Id
+	applyUpstreamRelayBatch(batch, &upstream)
+	return nil
+}
+
+// CancelUpstreamRelayBatch 取消上游批处理，终态由轮询同步
+func CancelUpstreamRelayBatch(ctx context.Context, batch *model.RelayBatch) error {
+	channel, err := model.CacheGetChannel(batch.ChannelId)
+	if err != nil {
+		return err
+	}
+	resp, err := doRelayFileRequest(ctx, channel, batch.ChannelKeyIdx, http.MethodPost, "/v1/batches/"+batch.UpstreamBatchId+"/cancel", nil, "")
+	if err != nil {
+		return err
+	}
+	var upstream dto.OpenAIBatch
+	if err := readRelayFileJSON(resp, &upstream); err != nil {
+		return err
+	}
+	applyUpstreamRelayBatch(batch, &upstream)
+	return batch.Update()
+}
+
+// SyncUpstreamRelayBatch 同步上游批处理状态，进入终态后登记结果文件并结算
+func SyncUpstreamRelayBatch(ctx context.Context, batch *model.RelayBatch) error {
+	channel, err := model.CacheGetChannel(batch.ChannelId)
+	if err != nil {
+		return err
+	}
+	resp, err := doRelayFileRequest(ctx, channel, batch.ChannelKeyIdx, http.MethodGet, "/v1/batches/"+batch.UpstreamBatchId, nil, "")
+	if err != nil {
+		return err
+	}
+	var upstream dto.OpenAIBatch
+	if err := readRelayFileJSON(resp, &upstream); err != nil {
+		return err
+	}
+	applyUpstreamRelayBatch(batch, &upstream)
+	if !batch.IsFinished() {
+		return batch.Update()
+	}
+
+	if upstream.OutputFileId != nil && *upstream.OutputFileId != "" && batch.OutputFileId == "" {
+		outputFile, err := registerUpstreamBatchFile(batch, *upstream.OutputFileId, "output")
+		if err != nil {
+			return err
+		}
+		batch.OutputFileId = outputFile.FileId
+	}
+	if upstream.ErrorFileId != nil && *upstream.ErrorFileId != "" && batch.ErrorFileId == "" {
+		errorFile, err := registerUpstreamBatchFile(batch, *upstream.ErrorFileId, "error")
+		if err != nil {
+			return err
+		}
+		batch.ErrorFileId = errorFile.FileId
+	}
+	if err := batch.Update(); err != nil {
+		return err
+	}
+	return SettleUpstreamRelayBatch(ctx, batch)
+}
+
+func registerUpstreamBatchFile(batch *model.RelayBatch, upstreamFileId string, kind string) (*model.RelayFile, error) {
+	relayFile := &model.RelayFile{
+		FileId:         model.RelayFileIdPrefix + common.GetRandomString(24),
+		UserId:         batch.UserId,
+		TokenId:        batch.TokenId,
+		ChannelId:      batch.ChannelId,
+		ChannelKeyIdx:  batch.ChannelKeyIdx,
+		UpstreamFileId: upstreamFileId,
+		Filename:       fmt.Sprintf("%s_%s.jsonl", batch.BatchId, kind),
+		Purpose:        "batch_" + kind,
+		Status:         model.RelayFileStatusProcessed,
+	}
+	if retentionDays := operation_setting.GetFileSetting().RetentionDays; retentionDays > 0 {
+		relayFile.ExpiresAt = time.Now().Add(time.Duration(retentionDays) * 24 * time.Hour).Unix()
+	}
+	return relayFile, relayFile.Insert()
+}
+
+// 结算租约时长，结算流程异常中断时租约过期后可被重新领取
+const relayBatchSettleLeaseSeconds = 10 * 60
+
+// SettleUpstreamRelayBatch 读取上游输出文件，按每行实际用量结算，并与创建时的预扣额度多退少补；
+// 读取输入或输出文件失败时释放结算租约，由下一轮轮询重试
+func SettleUpstreamRelayBatch(ctx context.Context, batch *model.RelayBatch) error {
+	ok, err := model.ClaimRelayBatchSettlement(batch.Id, common.GetTimestamp(), relayBatchSettleLeaseSeconds)
+	if err != nil || !ok {
+		return err
+	}
+	total, err := settleUpstreamRelayBatchLines(ctx, batch)
+	if err != nil {
+		if releaseErr := model.ReleaseRelayBatchSettlement(batch.Id); releaseErr != nil {
+			logger.LogError(ctx, fmt.Sprintf("batch %s: failed to release settlement: %s", batch.BatchId, releaseErr.Error()))
+		}
+		return err
+	}
+	batch.Quota += total
+	batch.Settled = true
+	batch.SettlingAt = 0
+	return model.FinishRelayBatchSettlement(batch.Id, batch.Quota)
+}
+
+func settleUpstreamRelayBatchLines(ctx context.Context, batch *model.RelayBatch) (int, error) {
+	models := batch.GetInputModels()
+	if models == nil {
+		// 兼容未保存快照的历史批次
+		inputFile, err := model.GetRelayFileByFileId(batch.UserId, batch.InputFileId)
+		if err != nil {
+			return 0, err
+		}
+		input, err := LoadRelayBatchInput(ctx, inputFile, batch.Endpoint)
+		if err != nil {
+			return 0, err
+		}
+		models = input.Models
+	}
+	settler, err := newRelayBatchSettler(batch)
+	if err != nil {
+		return 0, err
+	}
+	if batch.OutputFileId != "" {
+		outputFile, err := model.GetRelayFileByFileId(batch.UserId, batch.OutputFileId)
+		if err != nil {
+			return 0, err
+		}
+		content, err := OpenRelayFileContent(ctx, outputFile)
+		if err != nil {
+			return 0, err
+		}
+		defer content.Close()
+
+		scanner := NewRelayBatchScanner(content)
+		for scanner.Scan() {
+			raw := bytes.TrimSpace(scanner.Bytes())
+			if len(raw) == 0 {
+				continue
+			}
+			var line dto.OpenAIBatchOutputLine
+			if err := common.Unmarshal(raw, &line); err != nil || line.Response == nil {
+				continue
+			}
+			if line.Response.StatusCode != http.StatusOK {
+				continue
+			}
+			modelName, ok := models[line.CustomId]
+			if !ok {
+				continue
+			}
+			settler.settleLine(modelName, line.Response.Body)
+		}
+		if err := scanner.Err(); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("batch %s: failed to read output file: %s", batch.BatchId, err.Error()))
+		}
+	}
+	settler.reconcile()
+	return settler.total, nil
+}
+
+type relayBatchSettler struct {
+	batch      *model.RelayBatch
+	token      *model.Token
+	budget     model.BudgetChain
+	groupRatio float64
+	ctx        *gin.Context
+	total      int
+}
+
+func newRelayBatchSettler(batch *model.RelayBatch) (*relayBatchSettler, error) {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return nil, err
+	}
+	userGroup, err := model.GetUserGroup(batch.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	user, err := model.GetUserCache(batch.UserId)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := model.GetBudgetChain(user.OrgId, token.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	// 后台结算没有请求上下文，构造一个用于记录日志
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, batch.Endpoint, nil)
+	c.Set(common.RequestIdKey, batch.BatchId)
+	if username, err := model.GetUsernameById(batch.UserId, false); err == nil {
+		c.Set("username", username)
+	}
+	return &relayBatchSettler{
+		batch:      batch,
+		token:      token,
+		budget:     budget,
+		groupRatio: GetUserGroupRatio(userGroup, batch.Group),
+		ctx:        c,
+	}, nil
+}
+
+func (s *relayBatchSettler) settleLine(modelName string, body []byte) {
+	var resp struct {
+		Usage *dto.Usage `json:"usage"`
+	}
+	_ = common.Unmarshal(body, &resp)
+	usage := resp.Usage
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	promptTokens := usage.PromptTokens
+	completionTokens := usage.CompletionTokens
+	cachedTokens := usage.PromptTokensDetails.CachedTokens
+	if promptTokens == 0 && completionTokens == 0 {
+		// Responses API 使用 input/output tokens
+		promptTokens = usage.InputTokens
+		completionTokens = usage.OutputTokens
+		if usage.InputTokensDetails != nil {
+			cachedTokens = usage.InputTokensDetails.CachedTokens
+		}
+	}
+
+	batchRatio := ratio_setting.GetBatchRatio(modelName)
+	groupRatio := s.groupRatio * batchRatio
+	modelPrice, usePrice := ratio_setting.GetModelPrice(modelName, false)
+	var quota int
+	var content string
+	if usePrice {
+		quota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		content = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f，批处理倍率 %.2f", modelPrice, s.groupRatio, batchRatio)
+	} else {
+		modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+		completionRatio := ratio_setting.GetCompletionRatio(modelName)
+		cacheRatio, _ := ratio_setting.GetCacheRatio(modelName)
+		tokens := float64(promptTokens-cachedTokens) + float64(cachedTokens)*cacheRatio + float64(completionTokens)*completionRatio
+		quota = int(tokens * modelRatio * groupRatio)
+		if quota == 0 && modelRatio != 0 && groupRatio != 0 && promptTokens+completionTokens > 0 {
+			quota = 1
+		}
+		content = fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，分组倍率 %.2f，批处理倍率 %.2f", modelRatio, completionRatio, s.groupRatio, batchRatio)
+	}
+
+	if quota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(s.batch.UserId, quota)
+		model.UpdateChannelUsedQuota(s.batch.ChannelId, quota)
+	}
+	s.total += quota
+
+	metrics.RecordConsume(s.batch.ChannelId, modelName, s.batch.Group, promptTokens, completionTokens, quota)
+	model.RecordConsumeLog(s.ctx, s.batch.UserId, model.RecordConsumeLogParams{
+		ChannelId:        s.batch.ChannelId,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		ModelName:        modelName,
+		TokenName:        s.token.Name,
+		Quota:            quota,
+		Content:          content,
+		TokenId:          s.token.Id,
+		Group:            s.batch.Group,
+		Other: map[string]interface{}{
+			"group_ratio": s.groupRatio,
+			"batch_ratio": batchRatio,
+			"batch_id":    s.batch.BatchId,
+		},
+	})
+}
+
+// reconcile 按实际用量与预扣额度的差额调整用户、令牌与组织项目额度
+func (s *relayBatchSettler) reconcile() {
+	delta := s.total - s.batch.PreConsumedQuota
+	if delta == 0 {
+		return
+	}
+	if err := adjustRelayBatchQuota(s.batch.UserId, s.token, s.budget, delta); err != nil {
+		logger.LogError(s.ctx, fmt.Sprintf("batch %s: failed to reconcile quota (delta=%d): %s", s.batch.BatchId, delta, err.Error()))
+	}
+}
+
+func adjustRelayBatchQuota(userId int, token *model.Token, budget model.BudgetChain, delta int) error {
+	var errs []error
+	if delta > 0 {
+		errs = append(errs, model.DecreaseUserQuota(userId, delta), model.DecreaseTokenQuota(token.Id, token.Key, delta))
+	} else {
+		errs = append(errs, model.IncreaseUserQuota(userId, -delta, false), model.IncreaseTokenQuota(token.Id, token.Key, -delta))
+	}
+	errs = append(errs, model.AdjustBudget(budget, delta))
+	return errors.Join(errs...)
+}
+
+// estimateRelayBatchQuota 估算批处理额度：按次计费的模型取单价，其余按请求体估算输入 token 并计入最大输出 token
+func estimateRelayBatchQuota(input *RelayBatchInput, groupRatio float64) int {
+	total := 0
+	for _, line := range input.Lines {
+		modelName := input.Models[line.CustomId]
+		ratio := groupRatio * ratio_setting.GetBatchRatio(modelName)
+		if modelPrice, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+			total += int(modelPrice * common.QuotaPerUnit * ratio)
+			continue
+		}
+		var body struct {
+			MaxTokens           int `json:"max_tokens"`
+			MaxCompletionTokens int `json:"max_completion_tokens"`
+			MaxOutputTokens     int `json:"max_output_tokens"`
+		}
+		_ = common.Unmarshal(line.Body, &body)
+		promptTokens := EstimateTokenByModel(modelName, string(line.Body))
+		completionTokens := max(body.MaxTokens, body.MaxCompletionTokens, body.MaxOutputTokens)
+		modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+		completionRatio := ratio_setting.GetCompletionRatio(modelName)
+		total += int((float64(promptTokens) + float64(completionTokens)*completionRatio) * modelRatio * ratio)
+	}
+	return total
+}
+
+// PreConsumeRelayBatchQuota 上游批处理由上游执行、结束后才能结算，创建前按估算额度预扣，避免用户额度被大批次透支
+func PreConsumeRelayBatchQuota(batch *model.RelayBatch, input *RelayBatchInput) error {
+	userGroup, err := model.GetUserGroup(batch.UserId, false)
+	if err != nil {
+		return err
+	}
+	quota := estimateRelayBatchQuota(input, GetUserGroupRatio(userGroup, batch.Group))
+	if quota <= 0 {
+		return nil
+	}
+	userQuota, err := model.GetUserQuota(batch.UserId, false)
+	if err != nil {
+		return err
+	}
+	if userQuota < quota {
+		return fmt.Errorf("%w: 用户剩余额度 %s，批处理预估额度 %s", ErrRelayBatchInsufficientQuota, logger.FormatQuota(userQuota), logger.FormatQuota(quota))
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota && token.RemainQuota < quota {
+		return fmt.Errorf("%w: 令牌剩余额度 %s，批处理预估额度 %s", ErrRelayBatchInsufficientQuota, logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
+	}
+	user, err := model.GetUserCache(batch.UserId)
+	if err != nil {
+		return err
+	}
+	budget, err := model.GetBudgetChain(user.OrgId, token.ProjectId)
+	if err != nil {
+		return err
+	}
+	// 逐个模型检查组织与项目的模型限制，最后一次调用扣减额度
+	modelNames := lo.Uniq(lo.Values(input.Models))
+	sort.Strings(modelNames)
+	for i, modelName := range modelNames {
+		consume := 0
+		if i == len(modelNames)-1 {
+			consume = quota
+		}
+		if err := model.PreConsumeBudget(budget, ratio_setting.FormatMatchingModelName(modelName), consume); err != nil {
+			return fmt.Errorf("%w: %s", ErrRelayBatchInsufficientQuota, err.Error())
+		}
+	}
+	if err := errors.Join(model.DecreaseUserQuota(batch.UserId, quota), model.DecreaseTokenQuota(token.Id, token.Key, quota)); err != nil {
+		_ = adjustRelayBatchQuota(batch.UserId, token, budget, -quota)
+		return err
+	}
+	batch.PreConsumedQuota = quota
+	return nil
+}
+
+// RefundRelayBatchPreConsumed 批次未能在上游创建时退还预扣额度
+func RefundRelayBatchPreConsumed(batch *model.RelayBatch) error {
+	if batch.PreConsumedQuota <= 0 {
+		return nil
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return err
+	}
+	user, err := model.GetUserCache(batch.UserId)
+	if err != nil {
+		return err
+	}
+	budget, err := model.GetBudgetChain(user.OrgId, token.ProjectId)
+	if err != nil {
+		return err
+	}
+	if err := adjustRelayBatchQuota(batch.UserId, token, budget, -batch.PreConsumedQuota); err != nil {
+		return err
+	}
+	batch.PreConsumedQuota = 0
+	return nil
+}
@@ -0,0 +1,465 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var relayFileIdPattern = regexp.MustCompile(regexp.QuoteMeta(model.RelayFileIdPrefix) + `[A-Za-z0-9]+`)
+
+// RelayFileUpstreamError 上游文件接口返回的非 2xx 响应
+type RelayFileUpstreamError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *RelayFileUpstreamError) Error() string {
+	return fmt.Sprintf("upstream file api returned status %d: %s", e.StatusCode, string(e.Body))
+}
+
+// IsRelayFileChannelSupported 判断渠道是否支持 OpenAI 文件接口
+func IsRelayFileChannelSupported(channelType int) bool {
+	if channelType == constant.ChannelTypeAzure {
+		return false
+	}
+	apiType, _ := common.ChannelType2APIType(channelType)
+	return apiType == constant.APITypeOpenAI
+}
+
+// SelectRelayFileChannel 为文件上传选择上游渠道，modelName 为空时使用配置的默认模型
+func SelectRelayFileChannel(c *gin.Context, modelName string) (*model.Channel, error) {
+	if modelName == "" {
+		modelName = operation_setting.GetFileSetting().DefaultModel
+	}
+	var channel *model.Channel
+	var err error
+	if specificId := c.GetString(string(constant.ContextKeyTokenSpecificChannelId)); specificId != "" {
+		var id int
+		if _, err = fmt.Sscanf(specificId, "%d", &id); err != nil {
+			return nil, errors.New("无效的渠道 Id")
+		}
+		channel, err = model.CacheGetChannel(id)
+		if err != nil {
+			return nil, err
+		}
+		if channel.Status != common.ChannelStatusEnabled {
+			return nil, errors.New("该渠道已被禁用")
+		}
+	} else {
+		usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		channel, _, err = CacheGetRandomSatisfiedChannel(&RetryParam{
+			Ctx:        c,
+			ModelName:  modelName,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("分组 %s 下模型 %s 无可用渠道", usingGroup, modelName)
+		}
+	}
+	if !IsRelayFileChannelSupported(channel.Type) {
+		return nil, fmt.Errorf("渠道 #%d 不支持文件接口", channel.Id)
+	}
+	return channel, nil
+}
+
+func relayFileChannelKey(channel *model.Channel, keyIdx int) (string, error) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, nil
+	}
+	keys := channel.GetKeys()
+	if keyIdx < 0 || keyIdx >= len(keys) {
+		return "", fmt.Errorf("渠道 #%d 的 key 索引 %d 已不存在", channel.Id, keyIdx)
+	}
+	return keys[keyIdx], nil
+}
+
+func doRelayFileRequest(ctx context.Context, channel *model.Channel, keyIdx int, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	key, err := relayFileChannelKey(channel, keyIdx)
+	if err != nil {
+		return nil, err
+	}
+	return doOpenAIChannelRequest(ctx, channel, key, method, path, body, contentType)
+}
+
+// doOpenAIChannelRequest 使用指定 key 直接请求 OpenAI 兼容渠道的管理类接口（文件、批处理、微调等）
+func doOpenAIChannelRequest(ctx context.Context, channel *model.Channel, key string, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if channel.OpenAIOrganization != nil && *channel.OpenAIOrganization != "" {
+		req.Header.Set("OpenAI-Organization", *channel.OpenAIOrganization)
+	}
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func readRelayFileJSON(resp *http.Response, v any) error {
+	defer CloseResponseBodyGracefully(resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &RelayFileUpstreamError{StatusCode: resp.StatusCode, Body: body}
+	}
+	if v == nil {
+		return nil
+	}
+	return common.Unmarshal(body, v)
+}
+
+// UploadRelayFile 将文件保存到本地（可选）并转发到上游渠道，返回网关文件记录
+func UploadRelayFile(c *gin.Context, channel *model.Channel, fileHeader *multipart.FileHeader, purpose string) (*model.RelayFile, error) {
+	setting := operation_setting.GetFileSetting()
+	maxBytes := operation_setting.GetFileMaxBytes()
+	if maxBytes > 0 && fileHeader.Size > maxBytes {
+		return nil, fmt.Errorf("file exceeds %d MB", setting.MaxFileSizeMB)
+	}
+
+	relayFile := &model.RelayFile{
+		FileId:    model.RelayFileIdPrefix + common.GetRandomString(24),
+		UserId:    c.GetInt("id"),
+		TokenId:   c.GetInt("token_id"),
+		ChannelId: channel.Id,
+		Filename:  fileHeader.Filename,
+		Purpose:   purpose,
+		Bytes:     fileHeader.Size,
+		Status:    model.RelayFileStatusUploaded,
+	}
+	if setting.RetentionDays > 0 {
+		relayFile.ExpiresAt = time.Now().Add(time.Duration(setting.RetentionDays) * 24 * time.Hour).Unix()
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var upload io.Reader = src
+	if setting.KeepLocalCopy {
+		localPath, written, err := common.WriteDiskStoreFile(relayFile.FileId, src, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		relayFile.LocalPath = localPath
+		relayFile.Bytes = written
+		localFile, err := os.Open(localPath)
+		if err != nil {
+			_ = os.Remove(localPath)
+			return nil, err
+		}
+		defer localFile.Close()
+		upload = localFile
+	}
+
+	_, keyIdx, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		removeRelayFileLocalCopy(relayFile)
+		return nil, apiErr
+	}
+	relayFile.ChannelKeyIdx = keyIdx
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		err := writer.WriteField("purpose", purpose)
+		if err == nil {
+			var part io.Writer
+			part, err = writer.CreateFormFile("file", fileHeader.Filename)
+			if err == nil {
+				_, err = io.Copy(part, upload)
+			}
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	resp, err := doRelayFileRequest(c.Request.Context(), channel, keyIdx, http.MethodPost, "/v1/files", pr, writer.FormDataContentType())
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		removeRelayFileLocalCopy(relayFile)
+		return nil, err
+	}
+	var upstreamFile dto.OpenAIFile
+	if err := readRelayFileJSON(resp, &upstreamFile); err != nil {
+		removeRelayFileLocalCopy(relayFile)
+		return nil, err
+	}
+	if upstreamFile.Id == "" {
+		removeRelayFileLocalCopy(relayFile)
+		return nil, errors.New("upstream file api returned empty file id")
+	}
+	relayFile.UpstreamFileId = upstreamFile.Id
+	if upstreamFile.Status != "" {
+		relayFile.Status = upstreamFile.Status
+	}
+	if err := relayFile.Insert(); err != nil {
+		removeRelayFileLocalCopy(relayFile)
+		return nil, err
+	}
+	return relayFile, nil
+}
+
+func removeRelayFileLocalCopy(relayFile *model.RelayFile) {
+	if relayFile.LocalPath == "" {
+		return
+	}
+	if err := os.Remove(relayFile.LocalPath); err != nil && !os.IsNotExist(err) {
+		common.SysError(fmt.Sprintf("failed to remove local file %s: %s", relayFile.LocalPath, err.Error()))
+	}
+	relayFile.LocalPath = ""
+}
+
+// RefreshRelayFileStatus 文件尚未处理完成时，从上游同步处理状态
+func RefreshRelayFileStatus(ctx context.Context, relayFile *model.RelayFile) error {
+	if relayFile.Status != model.RelayFileStatusUploaded || relayFile.IsLocal() {
+		return nil
+	}
+	channel, err := model.CacheGetChannel(relayFile.ChannelId)
+	if err != nil {
+		return err
+	}
+	resp, err := doRelayFileRequest(ctx, channel, relayFile.ChannelKeyIdx, http.MethodGet, "/v1/files/"+relayFile.UpstreamFileId, nil, "")
+	if err != nil {
+		return err
+	}
+	var upstreamFile dto.OpenAIFile
+	if err := readRelayFileJSON(resp, &upstreamFile); err != nil {
+		return err
+	}
+	if upstreamFile.Status != "" && upstreamFile.Status != relayFile.Status {
+		relayFile.Status = upstreamFile.Status
+		return relayFile.Update()
+	}
+	return nil
+}
+
+// OpenRelayFileContent 打开文件内容，优先读取本地副本，否则从上游渠道拉取
+func OpenRelayFileContent(ctx context.Context, relayFile *model.RelayFile) (io.ReadCloser, error) {
+	if relayFile.LocalPath != "" {
+		file, err := os.Open(relayFile.LocalPath)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if relayFile.IsLocal() {
+		return nil, fmt.Errorf("文件 %s 内容已不存在", relayFile.FileId)
+	}
+	channel, err := model.CacheGetChannel(relayFile.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRelayFileRequest(ctx, channel, relayFile.ChannelKeyIdx, http.MethodGet, "/v1/files/"+relayFile.UpstreamFileId+"/content", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readRelayFileJSON(resp, nil)
+	}
+	return resp.Body, nil
+}
+
+// DeleteRelayFile 删除上游文件和本地副本，并将记录标记为已删除
+func DeleteRelayFile(ctx context.Context, relayFile *model.RelayFile) error {
+	if relayFile.IsLocal() {
+		removeRelayFileLocalCopy(relayFile)
+		return model.MarkRelayFileDeleted(relayFile.Id)
+	}
+	channel, err := model.CacheGetChannel(relayFile.ChannelId)
+	if err == nil {
+		resp, reqErr := doRelayFileRequest(ctx, channel, relayFile.ChannelKeyIdx, http.MethodDelete, "/v1/files/"+relayFile.UpstreamFileId, nil, "")
+		if reqErr == nil {
+			reqErr = readRelayFileJSON(resp, nil)
+		}
+		var upstreamErr *RelayFileUpstreamError
+		if reqErr != nil && !(errors.As(reqErr, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound) {
+			return reqErr
+		}
+	} else {
+		// 渠道已被删除，上游文件无法再访问，仅清理本地记录
+		common.SysLog(fmt.Sprintf("relay file %s: channel #%d not found, skip upstream delete", relayFile.FileId, relayFile.ChannelId))
+	}
+	removeRelayFileLocalCopy(relayFile)
+	return model.MarkRelayFileDeleted(relayFile.Id)
+}
+
+// ResolveRelayFileReferences 查找请求体中引用的网关文件 ID，改写为上游文件 ID，
+// 并返回文件所绑定的渠道对应的文件记录；请求未引用网关文件时返回 nil
+func ResolveRelayFileReferences(c *gin.Context) (*model.RelayFile, error) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil, nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(body, []byte(model.RelayFileIdPrefix)) {
+		return nil, nil
+	}
+	matches := relayFileIdPattern.FindAll(body, -1)
+	fileIds := make([]string, 0, len(matches))
+	seen := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		id := string(match)
+		if !seen[id] {
+			seen[id] = true
+			fileIds = append(fileIds, id)
+		}
+	}
+	files, err := model.GetRelayFilesByFileIds(c.GetInt("id"), fileIds)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*model.RelayFile, len(files))
+	for _, file := range files {
+		found[file.FileId] = file
+	}
+	var pinned *model.RelayFile
+	for _, id := range fileIds {
+		file, ok := found[id]
+		if !ok {
+			return nil, fmt.Errorf("文件 %s 不存在", id)
+		}
+		if file.IsLocal() {
+			return nil, fmt.Errorf("文件 %s 仅支持通过 /v1/files 接口下载", id)
+		}
+		if pinned == nil {
+			pinned = file
+		} else if pinned.ChannelId != file.ChannelId || pinned.ChannelKeyIdx != file.ChannelKeyIdx {
+			return nil, errors.New("请求引用的文件位于不同的上游渠道，无法在同一请求中使用")
+		}
+		body = bytes.ReplaceAll(body, []byte(id), []byte(file.UpstreamFileId))
+	}
+	if err := common.ReplaceRequestBody(c, body); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// ApplyRelayFileKeyPin 多 Key 渠道下，将请求固定到上传文件时所使用的 key
+func ApplyRelayFileKeyPin(c *gin.Context, channel *model.Channel, relayFile *model.RelayFile) {
+	if channel == nil || relayFile == nil || !channel.ChannelInfo.IsMultiKey {
+		return
+	}
+	key, err := relayFileChannelKey(channel, relayFile.ChannelKeyIdx)
+	if err != nil {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
+	common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, relayFile.ChannelKeyIdx)
+}
+
+const (
+	relayFileCleanupTickInterval = 10 * time.Minute
+	relayFileCleanupBatchSize    = 100
+	// 上游删除连续失败的重试上限，重试间隔按 tick 指数退避，最长 1 天
+	relayFileCleanupMaxAttempts = 8
+	relayFileCleanupMaxBackoff  = 24 * time.Hour
+)
+
+var (
+	relayFileCleanupOnce    sync.Once
+	relayFileCleanupRunning atomic.Bool
+)
+
+// StartRelayFileCleanupTask 定期删除超过保留期限的文件
+func StartRelayFileCleanupTask() {
+	relayFileCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("relay file cleanup task started: tick=%s", relayFileCleanupTickInterval))
+			ticker := time.NewTicker(relayFileCleanupTickInterval)
+			defer ticker.Stop()
+
+			runRelayFileCleanupOnce()
+			for range ticker.C {
+				runRelayFileCleanupOnce()
+			}
+		})
+	})
+}
+
+func runRelayFileCleanupOnce() {
+	if !relayFileCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer relayFileCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	now := common.GetTimestamp()
+	files, err := model.GetExpiredRelayFiles(now, relayFileCleanupMaxAttempts, relayFileCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("relay file cleanup task failed: %v", err))
+		return
+	}
+	for _, file := range files {
+		deleteCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := DeleteRelayFile(deleteCtx, file)
+		cancel()
+		if err == nil {
+			continue
+		}
+		attempts := file.CleanupAttempts + 1
+		if attempts >= relayFileCleanupMaxAttempts {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to delete expired relay file %s after %d attempts, giving up: %v", file.FileId, attempts, err))
+		} else {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to delete expired relay file %s (attempt %d): %v", file.FileId, attempts, err))
+		}
+		if markErr := model.MarkRelayFileCleanupFailed(file.Id, attempts, now+int64(relayFileCleanupBackoff(attempts).Seconds())); markErr != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to record relay file cleanup failure %s: %v", file.FileId, markErr))
+		}
+	}
+}
+
+func relayFileCleanupBackoff(attempts int) time.Duration {
+	backoff := relayFileCleanupTickInterval << (attempts - 1)
+	if backoff <= 0 || backoff > relayFileCleanupMaxBackoff {
+		return relayFileCleanupMaxBackoff
+	}
+	return backoff
+}
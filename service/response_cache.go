@@ -0,0 +1,179 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const responseCacheNamespace = "new-api:response_cache:v1"
+
+var (
+	responseCacheOnce sync.Once
+	responseCache     *cachex.HybridCache[ResponseCacheEntry]
+)
+
+// ResponseCacheEntry 缓存的客户端响应体及其用量，命中时原样回放
+type ResponseCacheEntry struct {
+	Stream      bool      `json:"stream"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+}
+
+// ResponseCacheLookup 描述一次请求的缓存判定结果
+type ResponseCacheLookup struct {
+	Key   string
+	TTL   time.Duration
+	Store bool
+}
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		setting := operation_setting.GetResponseCacheSetting()
+		capacity := setting.MaxEntries
+		if capacity <= 0 {
+			capacity = 10_000
+		}
+		defaultTTLSeconds := setting.DefaultTTLSeconds
+		if defaultTTLSeconds <= 0 {
+			defaultTTLSeconds = 3600
+		}
+
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, capacity).
+					WithTTL(time.Duration(defaultTTLSeconds) * time.Second).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+// responseCacheDirectives 解析请求头中的 Cache-Control，no-cache 跳过读取缓存，no-store 既不读也不写
+func responseCacheDirectives(c *gin.Context) (noCache bool, noStore bool) {
+	for _, value := range c.Request.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache":
+				noCache = true
+			case "no-store":
+				noCache = true
+				noStore = true
+			}
+		}
+	}
+	return
+}
+
+// responseCacheTTL 令牌设置优先，其次是分组设置与默认值，返回 0 表示不缓存
+func responseCacheTTL(c *gin.Context, info *relaycommon.RelayInfo) time.Duration {
+	tokenTTL := common.GetContextKeyInt(c, constant.ContextKeyTokenResponseCacheTTL)
+	if tokenTTL < 0 {
+		return 0
+	}
+	if tokenTTL > 0 {
+		return time.Duration(tokenTTL) * time.Second
+	}
+	return time.Duration(operation_setting.GetResponseCacheSetting().ResponseCacheTTLSeconds(info.UsingGroup)) * time.Second
+}
+
+// PrepareResponseCache 根据最终发往上游的请求体（已应用参数覆盖）计算缓存键，返回 nil 表示本次请求不参与缓存
+func PrepareResponseCache(c *gin.Context, info *relaycommon.RelayInfo, requestBody []byte) *ResponseCacheLookup {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	_, noStore := responseCacheDirectives(c)
+	if noStore {
+		return nil
+	}
+	ttl := responseCacheTTL(c, info)
+	if ttl <= 0 {
+		return nil
+	}
+	scope := "shared"
+	if !setting.SharedAcrossUsers {
+		scope = fmt.Sprintf("user:%d", info.UserId)
+	}
+	// 审核动作按分组配置，缓存按分组隔离，避免宽松分组缓存的内容被回放给拦截分组
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s|%s|%d|%d|%s|", scope, info.UsingGroup, info.RelayMode, info.ApiType, info.UpstreamModelName)
+	_, _ = h.Write(requestBody)
+	return &ResponseCacheLookup{
+		Key:   hex.EncodeToString(h.Sum(nil)),
+		TTL:   ttl,
+		Store: true,
+	}
+}
+
+// GetCachedResponse 读取缓存，请求带 Cache-Control: no-cache 时跳过
+func GetCachedResponse(c *gin.Context, lookup *ResponseCacheLookup) (*ResponseCacheEntry, bool) {
+	if lookup == nil {
+		return nil, false
+	}
+	if noCache, _ := responseCacheDirectives(c); noCache {
+		return nil, false
+	}
+	entry, found, err := getResponseCache().Get(lookup.Key)
+	if err != nil {
+		common.SysError("failed to get response cache: " + err.Error())
+		return nil, false
+	}
+	if !found || len(entry.Body) == 0 {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// StoreCachedResponse 写入缓存，超过大小上限或没有用量的响应不缓存
+func StoreCachedResponse(lookup *ResponseCacheLookup, entry ResponseCacheEntry) {
+	if lookup == nil || !lookup.Store || len(entry.Body) == 0 || entry.Usage.TotalTokens <= 0 {
+		return
+	}
+	if maxBytes := operation_setting.GetResponseCacheSetting().MaxBodyBytes; maxBytes > 0 && len(entry.Body) > maxBytes {
+		return
+	}
+	if err := getResponseCache().SetWithTTL(lookup.Key, entry, lookup.TTL); err != nil {
+		common.SysError("failed to set response cache: " + err.Error())
+	}
+}
+
+// MarkResponseCacheHit 标记请求命中缓存，并按配置的倍率计费
+func MarkResponseCacheHit(c *gin.Context, info *relaycommon.RelayInfo) {
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+	if info.PriceData.OtherRatios == nil {
+		info.PriceData.OtherRatios = make(map[string]float64)
+	}
+	// 倍率允许为 0，这里不走 AddOtherRatio
+	ratio := operation_setting.GetResponseCacheSetting().HitBillingRatio
+	if ratio < 0 {
+		ratio = 0
+	}
+	info.PriceData.OtherRatios["response_cache"] = ratio
+}
+
+func IsResponseCacheHit(c *gin.Context) bool {
+	return common.GetContextKeyBool(c, constant.ContextKeyResponseCacheHit)
+}
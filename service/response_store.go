@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	ginKeyResponseStoreRequest = "response_store_request"
+	// responseStoreMaxHistory 展开历史时沿 previous_response_id 回溯的最大轮数
+	responseStoreMaxHistory = 200
+)
+
+// responseStoreRequest 展开历史前的原始请求信息，保存本轮响应时只记录本轮的输入
+type responseStoreRequest struct {
+	PreviousResponseId string
+	Input              json.RawMessage
+}
+
+// normalizeResponsesInput 将 input（字符串或条目数组）统一为条目数组
+func normalizeResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{"type": "message", "role": "user", "content": text})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	case "":
+		return []json.RawMessage{}, nil
+	default:
+		return nil, errors.New("input must be a string or an array")
+	}
+}
+
+// replayableOutputItem 将上一轮的 output 条目改写为可作为 input 回传的形式：
+// 去掉上游生成的条目 ID（目标渠道上不存在），不带加密内容的推理条目无法回传，直接丢弃
+func replayableOutputItem(raw json.RawMessage) (json.RawMessage, bool) {
+	var item map[string]any
+	if err := common.Unmarshal(raw, &item); err != nil {
+		return nil, false
+	}
+	if itemType, _ := item["type"].(string); itemType == "reasoning" {
+		if encrypted, _ := item["encrypted_content"].(string); encrypted == "" {
+			return nil, false
+		}
+		return raw, true
+	}
+	delete(item, "id")
+	data, err := common.Marshal(item)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// ErrResponseStoreUnavailable 读取保存的响应时数据库出错，属于服务端错误，不应按请求错误返回
+var ErrResponseStoreUnavailable = errors.New("response store unavailable")
+
+// buildStoredResponseHistory 沿 previous_response_id 回溯，按时间顺序拼接每轮的输入与输出条目
+func buildStoredResponseHistory(tokenId int, stored *model.StoredResponse) ([]json.RawMessage, error) {
+	chain := []*model.StoredResponse{stored}
+	seen := map[string]bool{stored.ResponseId: true}
+	for current := stored; current.PreviousResponseId != ""; {
+		if len(chain) >= responseStoreMaxHistory {
+			return nil, fmt.Errorf("response %s has too many previous responses", stored.ResponseId)
+		}
+		if seen[current.PreviousResponseId] {
+			break
+		}
+		previous, err := model.GetStoredResponse(tokenId, current.PreviousResponseId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("previous response %s not found or expired", current.PreviousResponseId)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrResponseStoreUnavailable, err)
+		}
+		seen[previous.ResponseId] = true
+		chain = append(chain, previous)
+		current = previous
+	}
+
+	history := make([]json.RawMessage, 0)
+	for i := len(chain) - 1; i >= 0; i-- {
+		var inputItems, outputItems []json.RawMessage
+		if err := common.UnmarshalJsonStr(chain[i].InputItems, &inputItems); err != nil {
+			return nil, fmt.Errorf("invalid stored input of response %s: %w", chain[i].ResponseId, err)
+		}
+		if err := common.UnmarshalJsonStr(chain[i].OutputItems, &outputItems); err != nil {
+			return nil, fmt.Errorf("invalid stored output of response %s: %w", chain[i].ResponseId, err)
+		}
+		history = append(history, inputItems...)
+		for _, item := range outputItems {
+			if replayable, ok := replayableOutputItem(item); ok {
+				history = append(history, replayable)
+			}
+		}
+	}
+	return history, nil
+}
+
+// ResolveStoredResponseReference 解析 /v1/responses 请求中的 previous_response_id：
+// 引用的响应由网关保存且可交由原渠道处理（pin 模式）时返回该响应，由调用方固定渠道；
+// 否则将历史展开到 input 中并去掉 previous_response_id。未引用网关保存的响应时返回 nil
+func ResolveStoredResponseReference(c *gin.Context) (*model.StoredResponse, error) {
+	setting := operation_setting.GetResponseStoreSetting()
+	if !setting.Enabled || c.Request.Method != http.MethodPost || !strings.HasPrefix(c.Request.URL.Path, "/v1/responses") {
+		return nil, nil
+	}
+	var request struct {
+		PreviousResponseID string          `json:"previous_response_id"`
+		Input              json.RawMessage `json:"input"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return nil, err
+	}
+	c.Set(ginKeyResponseStoreRequest, &responseStoreRequest{
+		PreviousResponseId: request.PreviousResponseID,
+		Input:              request.Input,
+	})
+	if request.PreviousResponseID == "" {
+		return nil, nil
+	}
+	stored, err := model.GetStoredResponse(c.GetInt("token_id"), request.PreviousResponseID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 不是网关保存的响应，交由上游解析
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %v", ErrResponseStoreUnavailable, err)
+	}
+	if setting.Mode == operation_setting.ResponseStoreModePin && stored.UpstreamStored {
+		return stored, nil
+	}
+	return nil, ExpandStoredResponseHistory(c, stored)
+}
+
+// ExpandStoredResponseHistory 将保存的历史展开到请求体的 input 中，并去掉 previous_response_id
+func ExpandStoredResponseHistory(c *gin.Context, stored *model.StoredResponse) error {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]json.RawMessage
+	if err := common.Unmarshal(body, &request); err != nil {
+		return err
+	}
+	history, err := buildStoredResponseHistory(c.GetInt("token_id"), stored)
+	if err != nil {
+		return err
+	}
+	input, err := normalizeResponsesInput(request["input"])
+	if err != nil {
+		return err
+	}
+	request["input"], err = common.Marshal(append(history, input...))
+	if err != nil {
+		return err
+	}
+	delete(request, "previous_response_id")
+	body, err = common.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return common.ReplaceRequestBody(c, body)
+}
+
+// ApplyStoredResponseKeyPin 多 Key 渠道下，将请求固定到生成上一轮响应时所使用的 key
+func ApplyStoredResponseKeyPin(c *gin.Context, channel *model.Channel, stored *model.StoredResponse) {
+	if channel == nil || stored == nil || channel.Id != stored.ChannelId || !channel.ChannelInfo.IsMultiKey {
+		return
+	}
+	key, err := relayFileChannelKey(channel, stored.ChannelKeyIdx)
+	if err != nil {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
+	common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, stored.ChannelKeyIdx)
+}
+
+// IsResponseStoreDisabledByRequest 请求显式设置 store=false 时不保存响应
+func IsResponseStoreDisabledByRequest(request *dto.OpenAIResponsesRequest) bool {
+	if request == nil || len(request.Store) == 0 {
+		return false
+	}
+	var store bool
+	if err := common.Unmarshal(request.Store, &store); err != nil {
+		return false
+	}
+	return !store
+}
+
+// SaveStoredResponse 保存本轮响应；body 为返回给客户端的响应对象，upstreamStored 表示上游同样保存了该响应
+func SaveStoredResponse(c *gin.Context, request *dto.OpenAIResponsesRequest, channelId int, channelKeyIdx int, upstreamStored bool, body []byte) error {
+	var response struct {
+		ID     string          `json:"id"`
+		Model  string          `json:"model"`
+		Output json.RawMessage `json:"output"`
+	}
+	if err := common.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if response.ID == "" {
+		return errors.New("response id is empty")
+	}
+
+	previousResponseId := request.PreviousResponseID
+	input := request.Input
+	if v, ok := c.Get(ginKeyResponseStoreRequest); ok {
+		if original, ok := v.(*responseStoreRequest); ok {
+			previousResponseId = original.PreviousResponseId
+			input = original.Input
+		}
+	}
+	inputItems, err := normalizeResponsesInput(input)
+	if err != nil {
+		return err
+	}
+	inputData, err := common.Marshal(inputItems)
+	if err != nil {
+		return err
+	}
+	outputData := []byte("[]")
+	if common.GetJsonType(response.Output) == "array" {
+		outputData = response.Output
+	}
+	modelName := response.Model
+	if modelName == "" {
+		modelName = request.Model
+	}
+
+	stored := &model.StoredResponse{
+		ResponseId:         response.ID,
+		UserId:             c.GetInt("id"),
+		TokenId:            c.GetInt("token_id"),
+		ChannelId:          channelId,
+		ChannelKeyIdx:      channelKeyIdx,
+		Model:              modelName,
+		PreviousResponseId: previousResponseId,
+		UpstreamStored:     upstreamStored,
+		InputItems:         string(inputData),
+		OutputItems:        string(outputData),
+		Body:               string(body),
+	}
+	if ttlHours := operation_setting.GetResponseStoreSetting().TTLHours; ttlHours > 0 {
+		stored.ExpiresAt = common.GetTimestamp() + int64(ttlHours)*3600
+	}
+	return stored.Insert()
+}
+
+// GetStoredResponseInputItems 返回响应的输入条目，缺少 ID 的条目按位置生成稳定的 ID
+func GetStoredResponseInputItems(stored *model.StoredResponse) ([]map[string]any, error) {
+	var items []map[string]any
+	if err := common.UnmarshalJsonStr(stored.InputItems, &items); err != nil {
+		return nil, err
+	}
+	suffix := strings.TrimPrefix(stored.ResponseId, "resp_")
+	for i, item := range items {
+		if id, _ := item["id"].(string); id == "" {
+			item["id"] = fmt.Sprintf("item_%s_%d", suffix, i)
+		}
+		if _, ok := item["type"]; !ok {
+			item["type"] = "message"
+		}
+	}
+	return items, nil
+}
+
+// DeleteStoredResponse 删除网关保存的响应，上游同样保存时一并删除上游响应
+func DeleteStoredResponse(ctx context.Context, stored *model.StoredResponse) error {
+	if stored.UpstreamStored {
+		channel, err := model.CacheGetChannel(stored.ChannelId)
+		if err == nil && channel.Type == constant.ChannelTypeOpenAI {
+			resp, reqErr := doRelayFileRequest(ctx, channel, stored.ChannelKeyIdx, http.MethodDelete, "/v1/responses/"+stored.ResponseId, nil, "")
+			if reqErr == nil {
+				reqErr = readRelayFileJSON(resp, nil)
+			}
+			var upstreamErr *RelayFileUpstreamError
+			if reqErr != nil && !(errors.As(reqErr, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound) {
+				// 上游删除失败不影响网关记录的删除
+				logger.LogWarn(ctx, fmt.Sprintf("failed to delete upstream response %s: %v", stored.ResponseId, reqErr))
+			}
+		}
+	}
+	return model.DeleteStoredResponse(stored.Id)
+}
+
+const (
+	responseStoreCleanupTickInterval = 30 * time.Minute
+	responseStoreCleanupBatchSize    = 500
+)
+
+var (
+	responseStoreCleanupOnce    sync.Once
+	responseStoreCleanupRunning atomic.Bool
+)
+
+// StartResponseStoreCleanupTask 定期删除超过保存期限的响应
+func StartResponseStoreCleanupTask() {
+	responseStoreCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("response store cleanup task started: tick=%s", responseStoreCleanupTickInterval))
+			ticker := time.NewTicker(responseStoreCleanupTickInterval)
+			defer ticker.Stop()
+
+			runResponseStoreCleanupOnce()
+			for range ticker.C {
+				runResponseStoreCleanupOnce()
+			}
+		})
+	})
+}
+
+func runResponseStoreCleanupOnce() {
+	if !responseStoreCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer responseStoreCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	now := common.GetTimestamp()
+	var total int64
+	for {
+		deleted, err := model.DeleteExpiredStoredResponses(now, responseStoreCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("response store cleanup task failed: %v", err))
+			return
+		}
+		total += deleted
+		if deleted < responseStoreCleanupBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("response store cleanup: deleted %d expired responses", total))
+	}
+}
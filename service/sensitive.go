@@ -45,29 +45,5 @@ func SensitiveWordContains(text string) (bool, []string) {
 
 // SensitiveWordReplace 敏感词替换，返回是否包含敏感词和替换后的文本（支持正则）
 func SensitiveWordReplace(text string, returnImmediately bool) (bool, []string, string) {
-	if len(setting.SensitiveWords) == 0 {
-		return false, nil, text
-	}
-
-	var matches []string
-	result := text
-
-	for _, pattern := range setting.SensitiveWords {
-		re := getOrCompileRegex(pattern)
-		if re == nil {
-			continue
-		}
-		if re.MatchString(result) {
-			matches = append(matches, pattern)
-			result = re.ReplaceAllString(result, "**###**")
-			if returnImmediately {
-				return true, matches, result
-			}
-		}
-	}
-
-	if len(matches) > 0 {
-		return true, matches, result
-	}
-	return false, nil, text
+	return RegexReplace(text, setting.SensitiveWords, "**###**", returnImmediately)
 }
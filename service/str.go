@@ -217,3 +217,32 @@ func RegexSearch(text string, patterns []string, stopImmediately bool) (bool, []
 	}
 	return false, nil
 }
+
+// RegexReplace 将命中的敏感词替换为 replacement，返回是否命中、命中的规则和替换后的文本（支持正则）
+func RegexReplace(text string, patterns []string, replacement string, returnImmediately bool) (bool, []string, string) {
+	if len(patterns) == 0 || len(text) == 0 {
+		return false, nil, text
+	}
+
+	var matches []string
+	result := text
+
+	for _, pattern := range patterns {
+		re := getOrCompileRegex(pattern)
+		if re == nil {
+			continue
+		}
+		if re.MatchString(result) {
+			matches = append(matches, pattern)
+			result = re.ReplaceAllString(result, replacement)
+			if returnImmediately {
+				return true, matches, result
+			}
+		}
+	}
+
+	if len(matches) > 0 {
+		return true, matches, result
+	}
+	return false, nil, text
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tokenRateLimitKeyPrefix = "tokenRateLimit"
+
+var (
+	memoryTokenLimiterOnce sync.Once
+	memoryTokenLimiter     *limiter.MemoryLimiter
+)
+
+func getTokenLimiter() limiter.TokenLimiter {
+	if common.RedisEnabled && common.RDB != nil {
+		return limiter.New(context.Background(), common.RDB)
+	}
+	memoryTokenLimiterOnce.Do(func() {
+		memoryTokenLimiter = limiter.NewMemoryLimiter()
+	})
+	return memoryTokenLimiter
+}
+
+type tokenRateLimitScope struct {
+	label string
+	key   string
+	limit operation_setting.TokenRateLimit
+}
+
+func (s tokenRateLimitScope) bucketKey(kind string) string {
+	return fmt.Sprintf("%s:%s:%s", tokenRateLimitKeyPrefix, kind, s.key)
+}
+
+func (s tokenRateLimitScope) bucketRequest(tpm int, requested float64, required float64, force bool) limiter.BucketRequest {
+	return limiter.BucketRequest{
+		Requested: requested,
+		Required:  math.Min(required, float64(tpm)),
+		Rate:      float64(tpm) / 60,
+		Capacity:  float64(tpm),
+		Force:     force,
+	}
+}
+
+// resolveTokenRateLimitScopes 令牌与用户各自独立计量，分组与模型为所有请求共享
+func resolveTokenRateLimitScopes(info *relaycommon.RelayInfo) []tokenRateLimitScope {
+	setting := operation_setting.GetTokenRateLimitSetting()
+	scopes := make([]tokenRateLimitScope, 0, 4)
+	add := func(label string, key string, limit operation_setting.TokenRateLimit) {
+		if !limit.IsZero() {
+			scopes = append(scopes, tokenRateLimitScope{label: label, key: key, limit: limit})
+		}
+	}
+	tokenLimit := setting.Token
+	if override, ok := setting.TokenOverrides[info.TokenId]; ok {
+		tokenLimit = override
+	}
+	if info.TokenId != 0 {
+		add("令牌", fmt.Sprintf("token:%d", info.TokenId), tokenLimit)
+	}
+	userLimit := setting.User
+	if override, ok := setting.UserOverrides[info.UserId]; ok {
+		userLimit = override
+	}
+	add("用户", fmt.Sprintf("user:%d", info.UserId), userLimit)
+	add("分组", "group:"+info.UsingGroup, setting.Groups[info.UsingGroup])
+	add("模型", "model:"+info.OriginModelName, setting.Models[info.OriginModelName])
+	return scopes
+}
+
+// tokenRateLimitHold 记录本次请求已占用的并发槽位与已预扣的输入 token
+type tokenRateLimitHold struct {
+	limiter   limiter.TokenLimiter
+	member    string
+	estimated int
+	slots     []string
+	inputs    []tokenRateLimitScope
+	outputs   []tokenRateLimitScope
+}
+
+func (h *tokenRateLimitHold) release(ctx context.Context, promptTokens int, completionTokens int, consumed bool) {
+	for _, key := range h.slots {
+		if err := h.limiter.ReleaseSlot(ctx, key, h.member); err != nil {
+			common.SysError("failed to release concurrency slot: " + err.Error())
+		}
+	}
+	// 请求失败时退还预扣的输入 token；成功时按实际用量补扣差额
+	inputDelta := -h.estimated
+	if consumed {
+		inputDelta = promptTokens - h.estimated
+	}
+	if inputDelta != 0 {
+		for _, scope := range h.inputs {
+			req := scope.bucketRequest(scope.limit.InputTPM, float64(inputDelta), 0, true)
+			if _, err := h.limiter.TakeTokens(ctx, scope.bucketKey("input"), req); err != nil {
+				common.SysError("failed to settle input tpm: " + err.Error())
+			}
+		}
+	}
+	if consumed && completionTokens > 0 {
+		for _, scope := range h.outputs {
+			req := scope.bucketRequest(scope.limit.OutputTPM, float64(completionTokens), 0, true)
+			if _, err := h.limiter.TakeTokens(ctx, scope.bucketKey("output"), req); err != nil {
+				common.SysError("failed to settle output tpm: " + err.Error())
+			}
+		}
+	}
+}
+
+// tokenRateLimitHeaders 按剩余比例最小的维度返回 OpenAI 风格的 x-ratelimit-* 响应头
+type tokenRateLimitHeaders struct {
+	set       bool
+	limit     int
+	remaining int64
+	reset     time.Duration
+}
+
+func (h *tokenRateLimitHeaders) observe(tpm int, state limiter.BucketState) {
+	remaining := max(state.Remaining, 0)
+	if h.set && float64(remaining)/float64(tpm) >= float64(h.remaining)/float64(h.limit) {
+		return
+	}
+	h.set = true
+	h.limit = tpm
+	h.remaining = remaining
+	h.reset = time.Duration(float64(int64(tpm)-state.Remaining) / (float64(tpm) / 60) * float64(time.Second)).Round(time.Millisecond)
+}
+
+func (h *tokenRateLimitHeaders) write(c *gin.Context) {
+	if !h.set {
+		return
+	}
+	c.Header("x-ratelimit-limit-tokens", strconv.Itoa(h.limit))
+	c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(h.remaining, 10))
+	c.Header("x-ratelimit-reset-tokens", h.reset.String())
+}
+
+func tokenRateLimitExceeded(c *gin.Context, wait time.Duration, message string) *types.NewAPIError {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	return types.NewErrorWithStatusCode(fmt.Errorf("%s", message), types.ErrorCodeRateLimitExceeded, http.StatusTooManyRequests,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// AcquireTokenRateLimit 检查并发与输入/输出 TPM 限制并预扣估算的输入 token，
+// 返回的函数需在请求结束时调用，用于释放并发槽位并按实际用量结算
+func AcquireTokenRateLimit(c *gin.Context, info *relaycommon.RelayInfo, estimatedTokens int) (func(), *types.NewAPIError) {
+	noop := func() {}
+	if !operation_setting.GetTokenRateLimitSetting().Enabled || setting.IsUserExemptFromRateLimit(info.UserId) {
+		return noop, nil
+	}
+	scopes := resolveTokenRateLimitScopes(info)
+	if len(scopes) == 0 {
+		return noop, nil
+	}
+
+	ctx := c.Request.Context()
+	slotTTL := time.Duration(operation_setting.GetTokenRateLimitSetting().SlotTimeoutSeconds) * time.Second
+	if slotTTL <= 0 {
+		slotTTL = 10 * time.Minute
+	}
+	estimatedTokens = max(estimatedTokens, 0)
+	hold := &tokenRateLimitHold{
+		limiter:   getTokenLimiter(),
+		member:    c.GetString(common.RequestIdKey),
+		estimated: estimatedTokens,
+	}
+	if hold.member == "" {
+		hold.member = common.GetUUID()
+	}
+	headers := &tokenRateLimitHeaders{}
+
+	var apiErr *types.NewAPIError
+	for _, scope := range scopes {
+		limit := scope.limit
+		if limit.MaxConcurrency > 0 {
+			key := scope.bucketKey("concurrency")
+			ok, current, err := hold.limiter.AcquireSlot(ctx, key, hold.member, limit.MaxConcurrency, slotTTL)
+			if err != nil {
+				apiErr = types.NewError(err, types.ErrorCodeRateLimitExceeded, types.ErrOptionWithSkipRetry())
+				break
+			}
+			if !ok {
+				apiErr = tokenRateLimitExceeded(c, time.Second, fmt.Sprintf("您已达到%s并发限制：最多同时进行 %d 个请求，当前 %d 个", scope.label, limit.MaxConcurrency, current))
+				break
+			}
+			hold.slots = append(hold.slots, key)
+		}
+		if limit.InputTPM > 0 {
+			req := scope.bucketRequest(limit.InputTPM, float64(estimatedTokens), float64(max(estimatedTokens, 1)), false)
+			state, err := hold.limiter.TakeTokens(ctx, scope.bucketKey("input"), req)
+			if err != nil {
+				apiErr = types.NewError(err, types.ErrorCodeRateLimitExceeded, types.ErrOptionWithSkipRetry())
+				break
+			}
+			if !state.Allowed {
+				headers.observe(limit.InputTPM, state)
+				apiErr = tokenRateLimitExceeded(c, state.Wait, fmt.Sprintf("您已达到%s输入 TPM 限制：每分钟最多 %d tokens，本次请求约 %d tokens", scope.label, limit.InputTPM, estimatedTokens))
+				break
+			}
+			headers.observe(limit.InputTPM, state)
+			hold.inputs = append(hold.inputs, scope)
+		}
+		if limit.OutputTPM > 0 {
+			// 输出 token 在请求结束后才能确定，这里只要求桶未透支
+			state, err := hold.limiter.TakeTokens(ctx, scope.bucketKey("output"), scope.bucketRequest(limit.OutputTPM, 0, 1, false))
+			if err != nil {
+				apiErr = types.NewError(err, types.ErrorCodeRateLimitExceeded, types.ErrOptionWithSkipRetry())
+				break
+			}
+			if !state.Allowed {
+				apiErr = tokenRateLimitExceeded(c, state.Wait, fmt.Sprintf("您已达到%s输出 TPM 限制：每分钟最多 %d tokens", scope.label, limit.OutputTPM))
+				break
+			}
+			hold.outputs = append(hold.outputs, scope)
+		}
+	}
+	headers.write(c)
+	if apiErr != nil {
+		if apiErr.StatusCode != http.StatusTooManyRequests {
+			logger.LogError(c, "token rate limit check failed: "+apiErr.Error())
+			apiErr.StatusCode = http.StatusInternalServerError
+		}
+		hold.release(context.Background(), 0, 0, false)
+		return noop, apiErr
+	}
+	return func() {
+		promptTokens, consumed := common.GetContextKey(c, constant.ContextKeyConsumedPromptTokens)
+		completionTokens := common.GetContextKeyInt(c, constant.ContextKeyConsumedCompletionTokens)
+		prompt, _ := promptTokens.(int)
+		hold.release(context.Background(), prompt, completionTokens, consumed)
+	}, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// tokenScopeGenerationFormats 支持流式、输出上限与工具调用的生成类接口
+var tokenScopeGenerationFormats = []types.RelayFormat{
+	types.RelayFormatOpenAI,
+	types.RelayFormatClaude,
+	types.RelayFormatGemini,
+	types.RelayFormatOpenAIResponses,
+}
+
+func getTokenScopes(c *gin.Context) *dto.TokenScopes {
+	value, ok := common.GetContextKey(c, constant.ContextKeyTokenScopes)
+	if !ok {
+		return nil
+	}
+	scopes, ok := value.(*dto.TokenScopes)
+	if !ok || !scopes.IsRestricted() {
+		return nil
+	}
+	return scopes
+}
+
+// isModelListingRequest 模型列表查询不属于任何接口格式，不受格式范围限制
+func isModelListingRequest(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet {
+		return false
+	}
+	path := c.Request.URL.Path
+	return strings.HasPrefix(path, "/v1/models") || strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1beta/openai/models")
+}
+
+// CheckTokenScopeFormat 在鉴权时校验请求的接口格式是否在令牌范围内，覆盖不经过分发的接口；
+// 限制了接口格式时，无法识别格式的路径一律拒绝
+func CheckTokenScopeFormat(c *gin.Context) error {
+	scopes := getTokenScopes(c)
+	if scopes == nil || len(scopes.RelayFormats) == 0 || isModelListingRequest(c) {
+		return nil
+	}
+	format := relayconstant.Path2RelayFormat(c.Request.URL.Path)
+	if format == "" {
+		return fmt.Errorf("该令牌无权调用此接口")
+	}
+	if !slices.Contains(scopes.RelayFormats, string(format)) {
+		return fmt.Errorf("该令牌无权调用 %s 接口", format)
+	}
+	return nil
+}
+
+// CheckTokenScopes 在分发时校验请求能力是否在令牌范围内，接口格式已在鉴权时校验；
+// 配置了输出上限但请求未指定时，改写请求体补上该上限
+func CheckTokenScopes(c *gin.Context) error {
+	scopes := getTokenScopes(c)
+	if scopes == nil {
+		return nil
+	}
+	format := relayconstant.Path2RelayFormat(c.Request.URL.Path)
+	if !scopes.HasCapabilityLimits() || !slices.Contains(tokenScopeGenerationFormats, format) {
+		return nil
+	}
+	if format == types.RelayFormatGemini && isGeminiNonGenerationPath(c.Request.URL.Path) {
+		return nil
+	}
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	if !gjson.ValidBytes(body) {
+		return nil
+	}
+
+	stream := gjson.GetBytes(body, "stream").Bool()
+	if format == types.RelayFormatGemini {
+		stream = strings.Contains(c.Request.URL.Path, ":streamGenerateContent") || c.Query("alt") == "sse"
+	}
+	switch scopes.StreamMode {
+	case dto.TokenStreamModeOnly:
+		if !stream {
+			return fmt.Errorf("该令牌仅允许流式请求")
+		}
+	case dto.TokenStreamModeNonStream:
+		if stream {
+			return fmt.Errorf("该令牌仅允许非流式请求")
+		}
+	}
+
+	if scopes.DenyTools || scopes.DenyWebSearch {
+		toolUse, webSearch := detectRequestTools(body, format)
+		if scopes.DenyTools && toolUse {
+			return fmt.Errorf("该令牌不允许使用工具调用")
+		}
+		if scopes.DenyWebSearch && webSearch {
+			return fmt.Errorf("该令牌不允许使用联网搜索")
+		}
+	}
+
+	if scopes.MaxOutputTokens > 0 {
+		paths := maxOutputTokensPaths(format)
+		specified := false
+		for _, path := range paths {
+			result := gjson.GetBytes(body, path)
+			if !result.Exists() || result.Type == gjson.Null {
+				continue
+			}
+			specified = true
+			if result.Int() > int64(scopes.MaxOutputTokens) {
+				return fmt.Errorf("请求的最大输出 token 数 %d 超过令牌上限 %d", result.Int(), scopes.MaxOutputTokens)
+			}
+		}
+		if !specified {
+			body, err = sjson.SetBytes(body, paths[0], scopes.MaxOutputTokens)
+			if err != nil {
+				return err
+			}
+			if err = common.ReplaceRequestBody(c, body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isGeminiNonGenerationPath Gemini 路径中的计数等非生成类操作不做能力校验
+func isGeminiNonGenerationPath(path string) bool {
+	return !strings.Contains(path, ":generateContent") && !strings.Contains(path, ":streamGenerateContent")
+}
+
+// maxOutputTokensPaths 各格式中表示输出上限的字段，第一个用于补全
+func maxOutputTokensPaths(format types.RelayFormat) []string {
+	switch format {
+	case types.RelayFormatOpenAIResponses:
+		return []string{"max_output_tokens"}
+	case types.RelayFormatGemini:
+		return []string{"generationConfig.maxOutputTokens", "generation_config.max_output_tokens"}
+	case types.RelayFormatClaude:
+		return []string{"max_tokens"}
+	default:
+		return []string{"max_tokens", "max_completion_tokens"}
+	}
+}
+
+// detectRequestTools 判断请求是否声明了工具调用以及联网搜索类内置工具
+func detectRequestTools(body []byte, format types.RelayFormat) (toolUse bool, webSearch bool) {
+	if format == types.RelayFormatOpenAI {
+		if gjson.GetBytes(body, "web_search_options").Exists() {
+			webSearch = true
+		}
+		if len(gjson.GetBytes(body, "functions").Array()) > 0 {
+			toolUse = true
+		}
+	}
+	for _, tool := range gjson.GetBytes(body, "tools").Array() {
+		if format == types.RelayFormatGemini {
+			tool.ForEach(func(key, _ gjson.Result) bool {
+				switch key.String() {
+				case "googleSearch", "google_search", "googleSearchRetrieval", "google_search_retrieval":
+					webSearch = true
+				default:
+					toolUse = true
+				}
+				return true
+			})
+			continue
+		}
+		if strings.HasPrefix(tool.Get("type").String(), "web_search") {
+			webSearch = true
+		} else {
+			toolUse = true
+		}
+	}
+	return toolUse, webSearch
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// usageCounterStore is used for in-memory usage accounting when Redis is disabled
+var (
+	usageCounterStore       sync.Map
+	usageCounterCleanupOnce sync.Once
+)
+
+type usageCounter struct {
+	mu        sync.Mutex
+	value     int
+	expiresAt time.Time
+}
+
+func startUsageCounterCleanupTask() {
+	gopool.Go(func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			now := time.Now()
+			usageCounterStore.Range(func(key, value interface{}) bool {
+				if counter, ok := value.(*usageCounter); ok && now.After(counter.expiresAt) {
+					usageCounterStore.Delete(key)
+				}
+				return true
+			})
+		}
+	})
+}
+
+// getUsageCounter 读取按额度累计的计数，过期或不存在时为 0
+func getUsageCounter(key string) (int, error) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			if err.Error() == "redis: nil" {
+				return 0, nil
+			}
+			return 0, err
+		}
+		count, _ := strconv.Atoi(value)
+		return count, nil
+	}
+	if value, ok := usageCounterStore.Load(key); ok {
+		counter := value.(*usageCounter)
+		counter.mu.Lock()
+		defer counter.mu.Unlock()
+		if time.Now().After(counter.expiresAt) {
+			return 0, nil
+		}
+		return counter.value, nil
+	}
+	return 0, nil
+}
+
+// addUsageCounter 累加计数，计数在 expiresAt 之后失效
+func addUsageCounter(key string, delta int, expiresAt time.Time) error {
+	_, err := incrUsageCounter(key, delta, expiresAt)
+	return err
+}
+
+// incrUsageCounter 累加计数并返回累加后的值
+func incrUsageCounter(key string, delta int, expiresAt time.Time) (int, error) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.IncrBy(ctx, key, int64(delta))
+		pipe.ExpireAt(ctx, key, expiresAt)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+		return int(incr.Val()), nil
+	}
+	usageCounterCleanupOnce.Do(startUsageCounterCleanupTask)
+	value, _ := usageCounterStore.LoadOrStore(key, &usageCounter{expiresAt: expiresAt})
+	counter := value.(*usageCounter)
+	counter.mu.Lock()
+	if time.Now().After(counter.expiresAt) {
+		counter.value = 0
+		counter.expiresAt = expiresAt
+	}
+	counter.value += delta
+	current := counter.value
+	counter.mu.Unlock()
+	return current, nil
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	UsageExportFormatCSV     = "csv"
+	UsageExportFormatNDJSON  = "ndjson"
+	UsageExportFormatParquet = "parquet"
+
+	UsageExportSourceLogs      = "logs"
+	UsageExportSourceQuotaData = "quota_data"
+)
+
+const usageExportBatchSize = 1000
+
+// UsageLogExportRow 单条日志的导出格式，cost 为按 QuotaPerUnit 换算后的金额
+type UsageLogExportRow struct {
+	Id               int     `json:"id" parquet:"id"`
+	CreatedAt        int64   `json:"created_at" parquet:"created_at"`
+	Type             int     `json:"type" parquet:"type"`
+	UserId           int     `json:"user_id" parquet:"user_id"`
+	Username         string  `json:"username" parquet:"username"`
+	TokenId          int     `json:"token_id" parquet:"token_id"`
+	TokenName        string  `json:"token_name" parquet:"token_name"`
+	ModelName        string  `json:"model_name" parquet:"model_name"`
+	ChannelId        int     `json:"channel_id" parquet:"channel_id"`
+	Group            string  `json:"group" parquet:"group"`
+	PromptTokens     int     `json:"prompt_tokens" parquet:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens" parquet:"completion_tokens"`
+	Quota            int     `json:"quota" parquet:"quota"`
+	Cost             float64 `json:"cost" parquet:"cost"`
+	UseTime          int     `json:"use_time" parquet:"use_time"`
+	IsStream         bool    `json:"is_stream" parquet:"is_stream"`
+	RequestId        string  `json:"request_id" parquet:"request_id"`
+	EndUserId        string  `json:"end_user_id" parquet:"end_user_id"`
+}
+
+// UsageQuotaDataExportRow 按小时汇总的用量导出格式
+type UsageQuotaDataExportRow struct {
+	Id        int     `json:"id" parquet:"id"`
+	CreatedAt int64   `json:"created_at" parquet:"created_at"`
+	UserId    int     `json:"user_id" parquet:"user_id"`
+	Username  string  `json:"username" parquet:"username"`
+	ModelName string  `json:"model_name" parquet:"model_name"`
+	Count     int     `json:"count" parquet:"count"`
+	TokenUsed int     `json:"token_used" parquet:"token_used"`
+	Quota     int     `json:"quota" parquet:"quota"`
+	Cost      float64 `json:"cost" parquet:"cost"`
+}
+
+// QuotaToCost 按 QuotaPerUnit 将额度换算为金额
+func QuotaToCost(quota int64) float64 {
+	if common.QuotaPerUnit <= 0 {
+		return 0
+	}
+	return float64(quota) / common.QuotaPerUnit
+}
+
+// UsageExportContentType 返回导出格式对应的 Content-Type，格式不支持时返回 false
+func UsageExportContentType(format string) (string, bool) {
+	switch format {
+	case UsageExportFormatCSV:
+		return "text/csv; charset=utf-8", true
+	case UsageExportFormatNDJSON:
+		return "application/x-ndjson", true
+	case UsageExportFormatParquet:
+		return "application/vnd.apache.parquet", true
+	default:
+		return "", false
+	}
+}
+
+// ExportUsage 按批读取筛选后的日志或汇总数据，以指定格式流式写入 w；flush 在每批写入后调用
+func ExportUsage(w io.Writer, source string, format string, filter *model.UsageExportFilter, flush func()) error {
+	switch source {
+	case UsageExportSourceLogs:
+		writer, err := newUsageExportWriter[UsageLogExportRow](w, format)
+		if err != nil {
+			return err
+		}
+		err = model.ForEachLogBatch(filter, usageExportBatchSize, func(logs []*model.Log) error {
+			rows := make([]UsageLogExportRow, 0, len(logs))
+			for _, log := range logs {
+				rows = append(rows, UsageLogExportRow{
+					Id:               log.Id,
+					CreatedAt:        log.CreatedAt,
+					Type:             log.Type,
+					UserId:           log.UserId,
+					Username:         log.Username,
+					TokenId:          log.TokenId,
+					TokenName:        log.TokenName,
+					ModelName:        log.ModelName,
+					ChannelId:        log.ChannelId,
+					Group:            log.Group,
+					PromptTokens:     log.PromptTokens,
+					CompletionTokens: log.CompletionTokens,
+					Quota:            log.Quota,
+					Cost:             QuotaToCost(int64(log.Quota)),
+					UseTime:          log.UseTime,
+					IsStream:         log.IsStream,
+					RequestId:        log.RequestId,
+					EndUserId:        log.EndUserId,
+				})
+			}
+			return writeUsageExportBatch(writer, rows, flush)
+		})
+		return closeUsageExportWriter(writer, err)
+	case UsageExportSourceQuotaData:
+		writer, err := newUsageExportWriter[UsageQuotaDataExportRow](w, format)
+		if err != nil {
+			return err
+		}
+		err = model.ForEachQuotaDataBatch(filter, usageExportBatchSize, func(data []*model.QuotaData) error {
+			rows := make([]UsageQuotaDataExportRow, 0, len(data))
+			for _, d := range data {
+				rows = append(rows, UsageQuotaDataExportRow{
+					Id:        d.Id,
+					CreatedAt: d.CreatedAt,
+					UserId:    d.UserID,
+					Username:  d.Username,
+					ModelName: d.ModelName,
+					Count:     d.Count,
+					TokenUsed: d.TokenUsed,
+					Quota:     d.Quota,
+					Cost:      QuotaToCost(int64(d.Quota)),
+				})
+			}
+			return writeUsageExportBatch(writer, rows, flush)
+		})
+		return closeUsageExportWriter(writer, err)
+	default:
+		return fmt.Errorf("unsupported export source: %s", source)
+	}
+}
+
+func writeUsageExportBatch[T any](writer usageExportWriter[T], rows []T, flush func()) error {
+	if err := writer.Write(rows); err != nil {
+		return err
+	}
+	if flush != nil {
+		flush()
+	}
+	return nil
+}
+
+func closeUsageExportWriter[T any](writer usageExportWriter[T], err error) error {
+	closeErr := writer.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// usageExportWriter 将一批行写入输出，Close 负责写出尾部（如 Parquet footer）
+type usageExportWriter[T any] interface {
+	Write(rows []T) error
+	Close() error
+}
+
+func newUsageExportWriter[T any](w io.Writer, format string) (usageExportWriter[T], error) {
+	switch format {
+	case UsageExportFormatCSV:
+		return newCSVExportWriter[T](w)
+	case UsageExportFormatNDJSON:
+		return &ndjsonExportWriter[T]{w: w}, nil
+	case UsageExportFormatParquet:
+		return &parquetExportWriter[T]{w: parquet.NewGenericWriter[T](w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// csvExportWriter 以结构体的 json 标签作为表头，按字段顺序输出
+type csvExportWriter[T any] struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter[T any](w io.Writer) (*csvExportWriter[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("csv export requires a struct row type")
+	}
+	header := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		header = append(header, name)
+	}
+	writer := &csvExportWriter[T]{w: csv.NewWriter(w)}
+	if err := writer.w.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (c *csvExportWriter[T]) Write(rows []T) error {
+	for i := range rows {
+		v := reflect.ValueOf(rows[i])
+		record := make([]string, v.NumField())
+		for j := 0; j < v.NumField(); j++ {
+			record[j] = formatCSVExportValue(v.Field(j))
+		}
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvExportWriter[T]) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatCSVExportValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.String:
+		return v.String()
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+type ndjsonExportWriter[T any] struct {
+	w io.Writer
+}
+
+func (n *ndjsonExportWriter[T]) Write(rows []T) error {
+	for i := range rows {
+		line, err := common.Marshal(rows[i])
+		if err != nil {
+			return err
+		}
+		if _, err := n.w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonExportWriter[T]) Close() error {
+	return nil
+}
+
+// parquetExportWriter 每批写入一个 row group，内存占用与批大小相关
+type parquetExportWriter[T any] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (p *parquetExportWriter[T]) Write(rows []T) error {
+	if _, err := p.w.Write(rows); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p *parquetExportWriter[T]) Close() error {
+	return p.w.Close()
+}
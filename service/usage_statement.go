@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const usageStatementTickInterval = 1 * time.Hour
+
+var (
+	usageStatementOnce    sync.Once
+	usageStatementRunning atomic.Bool
+)
+
+// UsageStatementLine 账单中的一行：一个用户在账期内某个模型的用量与金额
+type UsageStatementLine struct {
+	Period           string  `json:"period" parquet:"period"`
+	UserId           int     `json:"user_id" parquet:"user_id"`
+	Username         string  `json:"username" parquet:"username"`
+	ModelName        string  `json:"model_name" parquet:"model_name"`
+	Requests         int64   `json:"requests" parquet:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens" parquet:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" parquet:"completion_tokens"`
+	Quota            int64   `json:"quota" parquet:"quota"`
+	Cost             float64 `json:"cost" parquet:"cost"`
+}
+
+type UsageStatementResult struct {
+	Period string   `json:"period"`
+	Users  int      `json:"users"`
+	Orgs   int      `json:"orgs"`
+	Files  []string `json:"files"`
+	Emails int      `json:"emails"`
+	// 写入失败的文件与发送失败的邮件数
+	Failures int `json:"failures"`
+}
+
+type usageStatement struct {
+	title string
+	email string
+	file  string
+	lines []UsageStatementLine
+}
+
+func StartUsageStatementTask() {
+	usageStatementOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("usage statement task started: tick=%s", usageStatementTickInterval))
+			ticker := time.NewTicker(usageStatementTickInterval)
+			defer ticker.Stop()
+
+			runUsageStatementOnce()
+			for range ticker.C {
+				runUsageStatementOnce()
+			}
+		})
+	})
+}
+
+func runUsageStatementOnce() {
+	setting := operation_setting.GetUsageStatementSetting()
+	if !setting.Enabled {
+		return
+	}
+	if !usageStatementRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer usageStatementRunning.Store(false)
+
+	now := time.Now().UTC()
+	if now.Day() < setting.DayOfMonth {
+		return
+	}
+	period := PreviousUsageStatementPeriod(now)
+	if setting.LastPeriod >= period {
+		return
+	}
+	ctx := context.Background()
+	delivered := make(map[string]bool)
+	if setting.PendingPeriod == period {
+		for _, key := range setting.Delivered {
+			delivered[key] = true
+		}
+	}
+	result, err := generateUsageStatements(period, delivered)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("usage statement task failed: period=%s, error=%v", period, err))
+		return
+	}
+	// 有输出失败时账期保持待处理并记录已送达的输出，下次执行只重试失败的部分
+	if result.Failures > 0 {
+		if err := saveUsageStatementDelivered(period, delivered); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to save usage statement delivery state: %v", err))
+		}
+		logger.LogWarn(ctx, fmt.Sprintf("usage statement task incomplete: period=%s, files=%d, emails=%d, failures=%d", period, len(result.Files), result.Emails, result.Failures))
+		return
+	}
+	if err := model.UpdateOption("usage_statement_setting.last_period", period); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to save usage statement period: %v", err))
+	}
+	if err := saveUsageStatementDelivered("", nil); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to clear usage statement delivery state: %v", err))
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("usage statements generated: period=%s, users=%d, orgs=%d, files=%d, emails=%d, failures=%d", period, result.Users, result.Orgs, len(result.Files), result.Emails, result.Failures))
+}
+
+// saveUsageStatementDelivered 保存未完成账期中已成功的输出，period 为空时清空
+func saveUsageStatementDelivered(period string, delivered map[string]bool) error {
+	keys := make([]string, 0, len(delivered))
+	for key := range delivered {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data, err := common.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateOption("usage_statement_setting.delivered", string(data)); err != nil {
+		return err
+	}
+	return model.UpdateOption("usage_statement_setting.pending_period", period)
+}
+
+// PreviousUsageStatementPeriod 返回 now 所在月份的上一个账期（YYYY-MM）
+func PreviousUsageStatementPeriod(now time.Time) string {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+}
+
+// parseStatementPeriod 将 YYYY-MM 解析为该自然月（UTC）的起止时间
+func parseStatementPeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", period, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q, expected YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// GenerateUsageStatements 生成指定账期的个人与组织账单，按设置写入磁盘并发送邮件；
+// 单个文件或邮件失败只记录日志，不影响其他账单
+func GenerateUsageStatements(period string) (*UsageStatementResult, error) {
+	return generateUsageStatements(period, nil)
+}
+
+// generateUsageStatements delivered 非 nil 时跳过其中已成功的输出，并记入本次成功的输出
+func generateUsageStatements(period string, delivered map[string]bool) (*UsageStatementResult, error) {
+	start, end, err := parseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := model.GetUsageStatementRows(start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]int, 0)
+	userLines := make(map[int][]UsageStatementLine)
+	for _, row := range rows {
+		if _, ok := userLines[row.UserId]; !ok {
+			userIds = append(userIds, row.UserId)
+		}
+		userLines[row.UserId] = append(userLines[row.UserId], UsageStatementLine{
+			Period:           period,
+			UserId:           row.UserId,
+			Username:         row.Username,
+			ModelName:        row.ModelName,
+			Requests:         row.Requests,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			Quota:            row.Quota,
+			Cost:             QuotaToCost(row.Quota),
+		})
+	}
+	users, err := model.GetUsersForStatement(userIds)
+	if err != nil {
+		return nil, err
+	}
+	userById := make(map[int]*model.User, len(users))
+	for _, user := range users {
+		userById[user.Id] = user
+	}
+
+	// 组织账单按生成时的成员关系汇总成员的用量
+	orgIds := make([]int, 0)
+	orgLines := make(map[int][]UsageStatementLine)
+	statements := make([]*usageStatement, 0, len(userIds))
+	for _, userId := range userIds {
+		lines := userLines[userId]
+		statement := &usageStatement{
+			title: fmt.Sprintf("用户 %s（#%d）", lines[0].Username, userId),
+			file:  fmt.Sprintf("user_%d", userId),
+			lines: lines,
+		}
+		if user, ok := userById[userId]; ok {
+			statement.email = user.Email
+			if user.OrgId != 0 {
+				if _, ok := orgLines[user.OrgId]; !ok {
+					orgIds = append(orgIds, user.OrgId)
+				}
+				orgLines[user.OrgId] = append(orgLines[user.OrgId], lines...)
+			}
+		}
+		statements = append(statements, statement)
+	}
+	orgs, err := model.GetOrganizationsByIds(orgIds)
+	if err != nil {
+		return nil, err
+	}
+	orgNames := make(map[int]string, len(orgs))
+	for _, org := range orgs {
+		orgNames[org.Id] = org.Name
+	}
+	orgStatements := make([]*usageStatement, 0, len(orgIds))
+	for _, orgId := range orgIds {
+		orgStatements = append(orgStatements, &usageStatement{
+			title: fmt.Sprintf("组织 %s（#%d）", orgNames[orgId], orgId),
+			file:  fmt.Sprintf("org_%d", orgId),
+			lines: orgLines[orgId],
+		})
+	}
+
+	result := &UsageStatementResult{
+		Period: period,
+		Users:  len(statements),
+		Orgs:   len(orgStatements),
+		Files:  make([]string, 0),
+	}
+	setting := operation_setting.GetUsageStatementSetting()
+	if setting.WriteToDisk {
+		dir := setting.OutputDir
+		if dir == "" {
+			dir = filepath.Join(common.GetDiskFileStoreDir(), "statements")
+		}
+		dir = filepath.Join(dir, period)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create statement directory: %w", err)
+		}
+		for _, statement := range append(statements, orgStatements...) {
+			key := "file:" + statement.file
+			if delivered[key] {
+				continue
+			}
+			path, err := writeUsageStatementFile(dir, setting.Format, statement)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to write usage statement %s: %s", statement.file, err.Error()))
+				result.Failures++
+				continue
+			}
+			markUsageStatementDelivered(delivered, key)
+			result.Files = append(result.Files, path)
+		}
+	}
+
+	subject := fmt.Sprintf("%s %s 用量账单", common.SystemName, period)
+	if setting.EmailUsers {
+		for _, statement := range statements {
+			key := "email:" + statement.file
+			if statement.email == "" || delivered[key] {
+				continue
+			}
+			if err := common.SendEmail(subject, statement.email, renderUsageStatementHTML(period, []*usageStatement{statement}, true)); err != nil {
+				common.SysError(fmt.Sprintf("failed to send usage statement to %s: %s", statement.email, err.Error()))
+				result.Failures++
+				continue
+			}
+			markUsageStatementDelivered(delivered, key)
+			result.Emails++
+		}
+	}
+	if setting.FinanceEmail != "" && !delivered["finance"] {
+		content := renderUsageStatementHTML(period, orgStatements, true) + renderUsageStatementHTML(period, statements, false)
+		if err := common.SendEmail(subject, setting.FinanceEmail, content); err != nil {
+			common.SysError(fmt.Sprintf("failed to send usage statement summary: %s", err.Error()))
+			result.Failures++
+		} else {
+			markUsageStatementDelivered(delivered, "finance")
+			result.Emails++
+		}
+	}
+	return result, nil
+}
+
+func markUsageStatementDelivered(delivered map[string]bool, key string) {
+	if delivered != nil {
+		delivered[key] = true
+	}
+}
+
+func writeUsageStatementFile(dir string, format string, statement *usageStatement) (string, error) {
+	if _, ok := UsageExportContentType(format); !ok {
+		format = UsageExportFormatCSV
+	}
+	path := filepath.Join(dir, statement.file+"."+format)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	writer, err := newUsageExportWriter[UsageStatementLine](file, format)
+	if err == nil {
+		err = closeUsageExportWriter(writer, writer.Write(statement.lines))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// renderUsageStatementHTML 渲染账单邮件正文；detail 为 false 时每个账单只输出一行合计
+func renderUsageStatementHTML(period string, statements []*usageStatement, detail bool) string {
+	if len(statements) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("<h3>%s 账期用量</h3>", html.EscapeString(period)))
+	b.WriteString("<table border='1' cellpadding='4' cellspacing='0'><tr><th>账单</th><th>模型</th><th>请求数</th><th>输入 tokens</th><th>输出 tokens</th><th>额度</th><th>金额</th></tr>")
+	for _, statement := range statements {
+		var total UsageStatementLine
+		for _, line := range statement.lines {
+			if detail {
+				b.WriteString(usageStatementHTMLRow(statement.title, line.ModelName, line))
+			}
+			total.Requests += line.Requests
+			total.PromptTokens += line.PromptTokens
+			total.CompletionTokens += line.CompletionTokens
+			total.Quota += line.Quota
+		}
+		total.Cost = QuotaToCost(total.Quota)
+		b.WriteString(usageStatementHTMLRow(statement.title, "合计", total))
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+func usageStatementHTMLRow(title string, modelName string, line UsageStatementLine) string {
+	return fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%.6f</td></tr>",
+		html.EscapeString(title), html.EscapeString(modelName), line.Requests, line.PromptTokens, line.CompletionTokens, line.Quota, line.Cost)
+}
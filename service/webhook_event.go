@@ -0,0 +1,209 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	webhookDeliveryTickInterval    = 5 * time.Second
+	webhookDeliveryBatchSize       = 100
+	webhookDeliveryCleanupInterval = 1 * time.Hour
+	webhookResponseSnippetLimit    = 512
+)
+
+var (
+	webhookDeliveryOnce        sync.Once
+	webhookDeliveryRunning     atomic.Bool
+	webhookDeliveryCleanupLast atomic.Int64
+	webhookDeliveryWake        = make(chan struct{}, 1)
+)
+
+// PublishWebhookEvent 发布事件：写入持久化队列后唤醒投递任务，没有订阅方时不做任何事
+func PublishWebhookEvent(event string, data map[string]interface{}) {
+	if model.EnqueueWebhookEvent(event, data) > 0 {
+		select {
+		case webhookDeliveryWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SendWebhookTestEvent 向指定订阅方立即投递一次 ping 事件，用于验证地址与签名
+func SendWebhookTestEvent(sub *model.WebhookSubscription) (*model.WebhookDelivery, error) {
+	deliveries, err := model.CreateWebhookDeliveries([]*model.WebhookSubscription{sub}, constant.WebhookEventPing, map[string]interface{}{
+		"subscription_id": sub.Id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := deliveries[0]
+	return delivery, deliverWebhook(sub, delivery)
+}
+
+func StartWebhookDeliveryTask() {
+	webhookDeliveryOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("webhook delivery task started: tick=%s", webhookDeliveryTickInterval))
+			ticker := time.NewTicker(webhookDeliveryTickInterval)
+			defer ticker.Stop()
+
+			runWebhookDeliveryOnce()
+			for {
+				select {
+				case <-ticker.C:
+				case <-webhookDeliveryWake:
+				}
+				runWebhookDeliveryOnce()
+			}
+		})
+	})
+}
+
+func runWebhookDeliveryOnce() {
+	if !webhookDeliveryRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer webhookDeliveryRunning.Store(false)
+
+	ctx := context.Background()
+	subs := make(map[int]*model.WebhookSubscription)
+	for {
+		deliveries, err := model.GetDueWebhookDeliveries(time.Now().Unix(), webhookDeliveryBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("webhook delivery task failed: %v", err))
+			return
+		}
+		for _, delivery := range deliveries {
+			sub, ok := subs[delivery.SubscriptionId]
+			if !ok {
+				sub, err = model.GetWebhookSubscriptionById(delivery.SubscriptionId)
+				if err != nil {
+					sub = nil
+				}
+				subs[delivery.SubscriptionId] = sub
+			}
+			if err := deliverWebhook(sub, delivery); err != nil {
+				// 结果写库失败时本轮不再继续，避免重复取到同一批记录
+				logger.LogWarn(ctx, fmt.Sprintf("failed to update webhook delivery %d: %v", delivery.Id, err))
+				return
+			}
+		}
+		if len(deliveries) < webhookDeliveryBatchSize {
+			break
+		}
+	}
+
+	retentionDays := operation_setting.GetWebhookEventSetting().RetentionDays
+	lastCleanup := time.Unix(webhookDeliveryCleanupLast.Load(), 0)
+	if retentionDays > 0 && time.Since(lastCleanup) >= webhookDeliveryCleanupInterval {
+		before := time.Now().AddDate(0, 0, -retentionDays).Unix()
+		if n, err := model.DeleteOldWebhookDeliveries(before, 1000); err == nil {
+			webhookDeliveryCleanupLast.Store(time.Now().Unix())
+			if common.DebugEnabled && n > 0 {
+				logger.LogDebug(ctx, "webhook delivery cleanup: deleted_count=%d", n)
+			}
+		}
+	}
+}
+
+// webhookRetryDelay 第 n 次失败后的重试间隔，按指数退避并受上限约束
+func webhookRetryDelay(attempts int) time.Duration {
+	setting := operation_setting.GetWebhookEventSetting()
+	delay := time.Duration(setting.RetryBaseSeconds) * time.Second
+	maxDelay := time.Duration(setting.RetryMaxSeconds) * time.Second
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// deliverWebhook 发送一次投递并记录结果；失败时按退避安排下次重试，达到最大次数或订阅方已失效则标记为失败
+func deliverWebhook(sub *model.WebhookSubscription, delivery *model.WebhookDelivery) error {
+	delivery.Attempts++
+	var statusCode int
+	var err error
+	final := false
+	if sub == nil || !sub.Enabled {
+		err = errors.New("subscription deleted or disabled")
+		final = true
+	} else {
+		statusCode, err = sendWebhookEvent(sub, delivery)
+	}
+	delivery.ResponseCode = statusCode
+	if err == nil {
+		delivery.Status = model.WebhookDeliveryStatusSuccess
+		delivery.LastError = ""
+		delivery.DeliveredAt = time.Now().Unix()
+	} else {
+		delivery.LastError = err.Error()
+		if final || delivery.Attempts >= operation_setting.GetWebhookEventSetting().MaxAttempts {
+			delivery.Status = model.WebhookDeliveryStatusFailed
+		} else {
+			delivery.Status = model.WebhookDeliveryStatusPending
+			delivery.NextAttemptAt = time.Now().Add(webhookRetryDelay(delivery.Attempts)).Unix()
+		}
+	}
+	return delivery.UpdateResult()
+}
+
+// sendWebhookEvent 以与用户通知 webhook 相同的签名方式推送事件正文，返回响应状态码
+func sendWebhookEvent(sub *model.WebhookSubscription, delivery *model.WebhookDelivery) (int, error) {
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(sub.Url, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return 0, fmt.Errorf("request reject: %v", err)
+	}
+	timeout := time.Duration(operation_setting.GetWebhookEventSetting().TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NewAPI-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Id", delivery.EventId)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.Id))
+	if sub.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", generateSignature(sub.Secret, payload))
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseSnippetLimit))
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, snippet)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	statuses []int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func setupWebhookEventTest(t *testing.T, statuses ...int) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// 内存数据库每个连接相互独立
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.WebhookSubscription{}, &model.WebhookDelivery{}))
+	originDB := model.DB
+	model.DB = db
+
+	fetchSetting := system_setting.GetFetchSetting()
+	originSSRF := fetchSetting.EnableSSRFProtection
+	fetchSetting.EnableSSRFProtection = false
+	setting := operation_setting.GetWebhookEventSetting()
+	originSetting := *setting
+	setting.Enabled = true
+	setting.RetryBaseSeconds = 0
+	setting.MaxAttempts = 3
+	if GetHttpClient() == nil {
+		InitHttpClient()
+	}
+
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(func() {
+		server.Close()
+		model.DB = originDB
+		fetchSetting.EnableSSRFProtection = originSSRF
+		*setting = originSetting
+	})
+	return receiver, server
+}
+
+func TestWebhookEventFilterAndSignature(t *testing.T) {
+	receiver, server := setupWebhookEventTest(t)
+
+	tokenSub := &model.WebhookSubscription{Url: server.URL, Secret: "s3cret", Events: constant.WebhookEventTokenCreated, Enabled: true}
+	require.NoError(t, tokenSub.Insert())
+	channelSub := &model.WebhookSubscription{Url: server.URL, Events: constant.WebhookEventChannelDisabled, Enabled: true}
+	require.NoError(t, channelSub.Insert())
+	disabledSub := &model.WebhookSubscription{Url: server.URL, Enabled: false}
+	require.NoError(t, disabledSub.Insert())
+
+	require.Equal(t, 1, model.EnqueueWebhookEvent(constant.WebhookEventTokenCreated, map[string]interface{}{"token_id": 7}))
+	runWebhookDeliveryOnce()
+
+	require.Equal(t, 1, receiver.count())
+	req, body := receiver.requests[0], receiver.bodies[0]
+	require.Equal(t, constant.WebhookEventTokenCreated, req.Header.Get("X-Webhook-Event"))
+	require.Equal(t, generateSignature("s3cret", body), req.Header.Get("X-Webhook-Signature"))
+
+	var payload model.WebhookEventPayload
+	require.NoError(t, common.Unmarshal(body, &payload))
+	require.Equal(t, constant.WebhookEventTokenCreated, payload.Event)
+	require.Equal(t, req.Header.Get("X-Webhook-Id"), payload.Id)
+
+	deliveries, total, err := model.GetWebhookDeliveries(tokenSub.Id, "", "", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, model.WebhookDeliveryStatusSuccess, deliveries[0].Status)
+	require.Equal(t, 1, deliveries[0].Attempts)
+	require.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+}
+
+func TestWebhookEventRetryUntilSuccess(t *testing.T) {
+	receiver, server := setupWebhookEventTest(t, http.StatusInternalServerError, http.StatusOK)
+
+	sub := &model.WebhookSubscription{Url: server.URL, Enabled: true}
+	require.NoError(t, sub.Insert())
+	require.Equal(t, 1, model.EnqueueWebhookEvent(constant.WebhookEventUserArchived, map[string]interface{}{"user_id": 1}))
+
+	runWebhookDeliveryOnce()
+	deliveries, _, err := model.GetWebhookDeliveries(sub.Id, "", "", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, model.WebhookDeliveryStatusPending, deliveries[0].Status)
+	require.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseCode)
+	require.Contains(t, deliveries[0].LastError, "500")
+
+	runWebhookDeliveryOnce()
+	deliveries, _, err = model.GetWebhookDeliveries(sub.Id, "", "", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, model.WebhookDeliveryStatusSuccess, deliveries[0].Status)
+	require.Equal(t, 2, deliveries[0].Attempts)
+	require.Equal(t, 2, receiver.count())
+	// 重试投递的正文与签名对象保持不变
+	require.Equal(t, receiver.bodies[0], receiver.bodies[1])
+}
+
+func TestWebhookEventGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver, server := setupWebhookEventTest(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK)
+
+	sub := &model.WebhookSubscription{Url: server.URL, Enabled: true}
+	require.NoError(t, sub.Insert())
+	model.EnqueueWebhookEvent(constant.WebhookEventChannelEnabled, map[string]interface{}{"channel_id": 3})
+
+	for i := 0; i < 5; i++ {
+		runWebhookDeliveryOnce()
+	}
+	deliveries, _, err := model.GetWebhookDeliveries(sub.Id, "", "", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, model.WebhookDeliveryStatusFailed, deliveries[0].Status)
+	require.Equal(t, 3, deliveries[0].Attempts)
+	require.Equal(t, 3, receiver.count())
+
+	// 手动重试再投递一次
+	require.NoError(t, model.RetryWebhookDelivery(deliveries[0].Id))
+	runWebhookDeliveryOnce()
+	delivery, err := model.GetWebhookDeliveryById(deliveries[0].Id)
+	require.NoError(t, err)
+	require.Equal(t, model.WebhookDeliveryStatusSuccess, delivery.Status)
+	require.Equal(t, 4, receiver.count())
+}
+
+func TestWebhookRetryDelayBackoff(t *testing.T) {
+	setting := operation_setting.GetWebhookEventSetting()
+	origin := *setting
+	t.Cleanup(func() { *setting = origin })
+	setting.RetryBaseSeconds = 30
+	setting.RetryMaxSeconds = 300
+
+	require.Equal(t, 30*time.Second, webhookRetryDelay(1))
+	require.Equal(t, 60*time.Second, webhookRetryDelay(2))
+	require.Equal(t, 240*time.Second, webhookRetryDelay(4))
+	require.Equal(t, 300*time.Second, webhookRetryDelay(5))
+	require.Equal(t, 300*time.Second, webhookRetryDelay(20))
+}
@@ -0,0 +1,58 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	AuditCaptureStorageDatabase = "database"
+	AuditCaptureStorageDisk     = "disk"
+)
+
+type AuditCaptureSetting struct {
+	// 启用后对命中的请求保存完整请求体与响应体，压缩并加密存储
+	Enabled bool `json:"enabled"`
+	// 按令牌、用户、渠道 ID 选择需要采集的请求，命中任意一项即采集
+	TokenIds   []int `json:"token_ids"`
+	UserIds    []int `json:"user_ids"`
+	ChannelIds []int `json:"channel_ids"`
+	// 采样率，取值 0~1
+	SampleRate float64 `json:"sample_rate"`
+	// 请求体与响应体各自保存的最大字节数，超出部分截断
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 保留天数，0 表示不自动清理
+	RetentionDays int `json:"retention_days"`
+	// 存储位置：database 或 disk
+	Storage string `json:"storage"`
+}
+
+var auditCaptureSetting = AuditCaptureSetting{
+	Enabled:       false,
+	TokenIds:      []int{},
+	UserIds:       []int{},
+	ChannelIds:    []int{},
+	SampleRate:    1,
+	MaxBodyBytes:  1 << 20,
+	RetentionDays: 7,
+	Storage:       AuditCaptureStorageDatabase,
+}
+
+func init() {
+	config.GlobalConfig.Register("audit_capture_setting", &auditCaptureSetting)
+}
+
+func GetAuditCaptureSetting() *AuditCaptureSetting {
+	return &auditCaptureSetting
+}
+
+// HasTargets 是否配置了任何采集对象
+func (s *AuditCaptureSetting) HasTargets() bool {
+	return len(s.TokenIds) > 0 || len(s.UserIds) > 0 || len(s.ChannelIds) > 0
+}
+
+// Matches 判断请求是否属于采集对象
+func (s *AuditCaptureSetting) Matches(tokenId int, userId int, channelId int) bool {
+	return slices.Contains(s.TokenIds, tokenId) || slices.Contains(s.UserIds, userId) || slices.Contains(s.ChannelIds, channelId)
+}
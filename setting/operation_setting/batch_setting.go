@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting /v1/batches 批处理配置
+type BatchSetting struct {
+	// PreferUpstream 输入文件所在渠道支持 Batch API 时，优先转发到上游批处理接口
+	PreferUpstream bool `json:"prefer_upstream"`
+	// LocalConcurrency 网关本地执行批处理时每个批次的并发数
+	LocalConcurrency int `json:"local_concurrency"`
+	// MaxLocalRunning 同时在本地执行的批次数上限
+	MaxLocalRunning int `json:"max_local_running"`
+	// MaxLines 单个批次允许的最大请求行数
+	MaxLines int `json:"max_lines"`
+	// PollIntervalSeconds 批次状态轮询间隔（秒）
+	PollIntervalSeconds int `json:"poll_interval_seconds"`
+}
+
+var batchSetting = BatchSetting{
+	PreferUpstream:      true,
+	LocalConcurrency:    4,
+	MaxLocalRunning:     2,
+	MaxLines:            50000,
+	PollIntervalSeconds: 30,
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
@@ -0,0 +1,50 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ChannelSelectStrategyWeightedRandom = "weighted_random"
+	ChannelSelectStrategyLeastInflight  = "least_inflight"
+	ChannelSelectStrategyEWMALatency    = "ewma_latency"
+	ChannelSelectStrategyTTFT           = "ttft"
+)
+
+type ChannelSelectSetting struct {
+	// 未单独配置的分组使用的默认策略
+	DefaultStrategy string `json:"default_strategy"`
+	// 分组 -> 策略
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// EWMA 平滑系数，越大越偏向最近的请求
+	EWMAAlpha float64 `json:"ewma_alpha"`
+	// 超过该时间没有新样本的渠道统计视为过期，重新参与探索
+	StatsTTLSeconds int `json:"stats_ttl_seconds"`
+}
+
+var channelSelectSetting = ChannelSelectSetting{
+	DefaultStrategy: ChannelSelectStrategyWeightedRandom,
+	GroupStrategies: map[string]string{},
+	EWMAAlpha:       0.3,
+	StatsTTLSeconds: 600,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_select_setting", &channelSelectSetting)
+}
+
+func GetChannelSelectSetting() *ChannelSelectSetting {
+	return &channelSelectSetting
+}
+
+// GetChannelSelectStrategy 返回分组使用的渠道选择策略，未知策略回退为加权随机
+func GetChannelSelectStrategy(group string) string {
+	strategy, ok := channelSelectSetting.GroupStrategies[group]
+	if !ok || strategy == "" {
+		strategy = channelSelectSetting.DefaultStrategy
+	}
+	switch strategy {
+	case ChannelSelectStrategyLeastInflight, ChannelSelectStrategyEWMALatency, ChannelSelectStrategyTTFT:
+		return strategy
+	default:
+		return ChannelSelectStrategyWeightedRandom
+	}
+}
@@ -0,0 +1,40 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type CircuitBreakerSetting struct {
+	// 启用后，relay 请求的渠道错误交给熔断器处理，不再直接自动禁用渠道
+	Enabled bool `json:"enabled"`
+	// 错误率统计的滚动窗口
+	WindowSeconds int `json:"window_seconds"`
+	// 窗口内请求数达到该值才会计算错误率
+	MinRequests int `json:"min_requests"`
+	// 错误率达到该值时熔断
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// 首次熔断的冷却时间，连续熔断时翻倍，最长 MaxCooldownSeconds
+	CooldownSeconds    int `json:"cooldown_seconds"`
+	MaxCooldownSeconds int `json:"max_cooldown_seconds"`
+	// 半开状态下两次探测请求的最小间隔
+	ProbeIntervalSeconds int `json:"probe_interval_seconds"`
+	// 半开状态下连续成功多少次后恢复
+	HalfOpenSuccesses int `json:"half_open_successes"`
+}
+
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:              false,
+	WindowSeconds:        60,
+	MinRequests:          10,
+	ErrorRateThreshold:   0.5,
+	CooldownSeconds:      30,
+	MaxCooldownSeconds:   600,
+	ProbeIntervalSeconds: 5,
+	HalfOpenSuccesses:    2,
+}
+
+func init() {
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
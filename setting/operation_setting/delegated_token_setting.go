@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type DelegatedTokenSetting struct {
+	// 是否允许使用令牌签发短期子令牌，关闭后已签发的子令牌同时失效
+	Enabled bool `json:"enabled"`
+	// 未指定有效期时的默认有效期（秒）
+	DefaultTTLSeconds int `json:"default_ttl_seconds"`
+	// 子令牌最长有效期（秒）
+	MaxTTLSeconds int `json:"max_ttl_seconds"`
+}
+
+var delegatedTokenSetting = DelegatedTokenSetting{
+	Enabled:           false,
+	DefaultTTLSeconds: 900,
+	MaxTTLSeconds:     86400,
+}
+
+func init() {
+	config.GlobalConfig.Register("delegated_token_setting", &delegatedTokenSetting)
+}
+
+func GetDelegatedTokenSetting() *DelegatedTokenSetting {
+	return &delegatedTokenSetting
+}
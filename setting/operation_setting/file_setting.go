@@ -0,0 +1,38 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FileSetting /v1/files 网关文件存储配置
+type FileSetting struct {
+	// DefaultModel 上传请求未指定 model 时，用于选择上游渠道的模型
+	DefaultModel string `json:"default_model"`
+	// MaxFileSizeMB 单个文件大小上限（MB）
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// KeepLocalCopy 是否在本地磁盘保留文件副本，下载内容时优先读取本地
+	KeepLocalCopy bool `json:"keep_local_copy"`
+	// RetentionDays 文件保留天数，0 表示不过期
+	RetentionDays int `json:"retention_days"`
+}
+
+var fileSetting = FileSetting{
+	DefaultModel:  "gpt-4o-mini",
+	MaxFileSizeMB: 512,
+	KeepLocalCopy: true,
+	RetentionDays: 0,
+}
+
+func init() {
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+// GetFileMaxBytes 获取单个文件大小上限（字节）
+func GetFileMaxBytes() int64 {
+	if fileSetting.MaxFileSizeMB <= 0 {
+		return 0
+	}
+	return int64(fileSetting.MaxFileSizeMB) << 20
+}
@@ -0,0 +1,50 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组或模型配置为 0 时使用的默认对冲延迟
+	DefaultDelayMs int `json:"default_delay_ms"`
+	// 分组 -> 对冲延迟（毫秒），未配置的分组不对冲
+	GroupDelayMs map[string]int `json:"group_delay_ms"`
+	// 模型 -> 对冲延迟（毫秒），优先于分组配置
+	ModelDelayMs map[string]int `json:"model_delay_ms"`
+}
+
+var hedgeSetting = HedgeSetting{
+	Enabled:        false,
+	DefaultDelayMs: 2000,
+	GroupDelayMs:   map[string]int{},
+	ModelDelayMs:   map[string]int{},
+}
+
+func init() {
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// GetHedgeDelay 返回分组与模型对应的对冲延迟，未开启对冲时返回 false
+func GetHedgeDelay(group string, modelName string) (time.Duration, bool) {
+	if !hedgeSetting.Enabled {
+		return 0, false
+	}
+	delayMs, ok := hedgeSetting.ModelDelayMs[modelName]
+	if !ok {
+		delayMs, ok = hedgeSetting.GroupDelayMs[group]
+	}
+	if !ok || delayMs < 0 {
+		return 0, false
+	}
+	if delayMs == 0 {
+		delayMs = hedgeSetting.DefaultDelayMs
+	}
+	return time.Duration(delayMs) * time.Millisecond, true
+}
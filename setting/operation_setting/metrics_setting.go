@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type MetricsSetting struct {
+	// 启用后在 /metrics 暴露 Prometheus 指标
+	Enabled bool `json:"enabled"`
+	// 非空时抓取方需携带 Authorization: Bearer <scrape_secret>，为空时仅管理员可访问
+	ScrapeSecret string `json:"scrape_secret"`
+	// 渠道、模型、分组每个标签最多保留的取值数量，超出的取值统一记为 "other"
+	MaxLabelValues int `json:"max_label_values"`
+}
+
+var metricsSetting = MetricsSetting{
+	Enabled:        false,
+	ScrapeSecret:   "",
+	MaxLabelValues: 200,
+}
+
+func init() {
+	config.GlobalConfig.Register("metrics_setting", &metricsSetting)
+}
+
+func GetMetricsSetting() *MetricsSetting {
+	return &metricsSetting
+}
@@ -0,0 +1,144 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModerationStageKeyword    = "keyword"
+	ModerationStageClassifier = "classifier"
+	ModerationStageWebhook    = "webhook"
+)
+
+const (
+	ModerationActionBlock  = "block"
+	ModerationActionRedact = "redact"
+	ModerationActionLog    = "log"
+)
+
+// ModerationStage 审核流水线中的一个阶段，按配置顺序依次执行
+type ModerationStage struct {
+	Name string `json:"name"`
+	// keyword / classifier / webhook
+	Type         string `json:"type"`
+	OnPrompt     bool   `json:"on_prompt"`
+	OnCompletion bool   `json:"on_completion"`
+	// keyword：敏感词或 regex: 开头的正则，为空时使用系统敏感词列表
+	Words []string `json:"words,omitempty"`
+	// classifier：通过本网关的 /v1/moderations 调用的审核模型
+	Model string `json:"model,omitempty"`
+	// classifier：调用网关使用的令牌
+	ApiKey string `json:"api_key,omitempty"`
+	// classifier：任一类别得分不低于阈值即判定违规，0 表示使用模型返回的 flagged
+	Threshold float64 `json:"threshold,omitempty"`
+	// webhook：外部审核服务地址与签名密钥
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"`
+	// classifier / webhook 单次调用超时（秒）
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+type ModerationSetting struct {
+	Enabled bool              `json:"enabled"`
+	Stages  []ModerationStage `json:"stages"`
+	// 命中后的处理方式：block 拦截、redact 脱敏后放行、log 仅记录。
+	// redact 通过改写解析后的请求实现，开启请求透传（全局或渠道）时原始请求体被直接转发，提示词脱敏不生效
+	DefaultAction string `json:"default_action"`
+	// 按分组覆盖处理方式
+	GroupActions map[string]string `json:"group_actions"`
+	// 流式补全每累积多少字符检测一次，检测通过前内容暂不下发
+	StreamCheckChars int `json:"stream_check_chars"`
+	// classifier 调用的网关地址，为空时使用本机监听端口
+	GatewayBaseURL string `json:"gateway_base_url"`
+}
+
+var moderationSetting = ModerationSetting{
+	Enabled:          false,
+	Stages:           []ModerationStage{},
+	DefaultAction:    ModerationActionBlock,
+	GroupActions:     map[string]string{},
+	StreamCheckChars: 200,
+}
+
+func init() {
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// ModerationAction 返回分组生效的处理方式
+func (s *ModerationSetting) ModerationAction(group string) string {
+	action := s.DefaultAction
+	if groupAction, ok := s.GroupActions[group]; ok {
+		action = groupAction
+	}
+	switch action {
+	case ModerationActionRedact, ModerationActionLog:
+		return action
+	default:
+		return ModerationActionBlock
+	}
+}
+
+// HasStage 是否存在作用于指定阶段（prompt / completion）的审核
+func (s *ModerationSetting) HasStage(onCompletion bool) bool {
+	if !s.Enabled {
+		return false
+	}
+	for _, stage := range s.Stages {
+		if (onCompletion && stage.OnCompletion) || (!onCompletion && stage.OnPrompt) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactModerationStages 清空 stages JSON 中的 api_key / secret，供选项接口回显
+func RedactModerationStages(value string) string {
+	var stages []ModerationStage
+	if err := common.UnmarshalJsonStr(value, &stages); err != nil {
+		return "[]"
+	}
+	for i := range stages {
+		stages[i].ApiKey = ""
+		stages[i].Secret = ""
+	}
+	data, err := common.Marshal(stages)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// RestoreModerationStageSecrets 未填写 api_key / secret 的阶段沿用当前同名同类型阶段的值，
+// 避免回显时被清空的密钥在保存后丢失
+func RestoreModerationStageSecrets(value string) (string, error) {
+	var stages []ModerationStage
+	if err := common.UnmarshalJsonStr(value, &stages); err != nil {
+		return "", err
+	}
+	current := make(map[string]ModerationStage, len(moderationSetting.Stages))
+	for _, stage := range moderationSetting.Stages {
+		current[stage.Type+"|"+stage.Name] = stage
+	}
+	for i := range stages {
+		old, ok := current[stages[i].Type+"|"+stages[i].Name]
+		if !ok {
+			continue
+		}
+		if stages[i].ApiKey == "" {
+			stages[i].ApiKey = old.ApiKey
+		}
+		if stages[i].Secret == "" {
+			stages[i].Secret = old.Secret
+		}
+	}
+	data, err := common.Marshal(stages)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
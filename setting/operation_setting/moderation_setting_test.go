@@ -0,0 +1,25 @@
+package operation_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerationStageSecretsRoundTrip(t *testing.T) {
+	saved := moderationSetting.Stages
+	t.Cleanup(func() { moderationSetting.Stages = saved })
+	moderationSetting.Stages = []ModerationStage{
+		{Name: "w", Type: ModerationStageWebhook, URL: "http://a", Secret: "s1"},
+		{Name: "c", Type: ModerationStageClassifier, ApiKey: "sk-1"},
+	}
+
+	redacted := RedactModerationStages(`[{"name":"w","type":"webhook","secret":"s1"},{"name":"c","type":"classifier","api_key":"sk-1"}]`)
+	require.NotContains(t, redacted, "s1")
+	require.NotContains(t, redacted, "sk-1")
+
+	restored, err := RestoreModerationStageSecrets(`[{"name":"w","type":"webhook","url":"http://b"},{"name":"c","type":"classifier","api_key":"sk-2"}]`)
+	require.NoError(t, err)
+	require.Contains(t, restored, `"secret":"s1"`)
+	require.Contains(t, restored, `"api_key":"sk-2"`)
+}
@@ -0,0 +1,61 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	PIIDetectorEmail      = "email"
+	PIIDetectorPhone      = "phone"
+	PIIDetectorIdCard     = "id_card"
+	PIIDetectorSSN        = "ssn"
+	PIIDetectorCreditCard = "credit_card"
+)
+
+// PIIRedactionRule 自定义脱敏规则，Name 用作占位符前缀
+type PIIRedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// PIIRedactionPolicy 一组生效的检测器与自定义规则
+type PIIRedactionPolicy struct {
+	// 内置检测器：email、phone、id_card、ssn、credit_card
+	Detectors []string           `json:"detectors"`
+	Rules     []PIIRedactionRule `json:"rules"`
+}
+
+func (p PIIRedactionPolicy) IsEmpty() bool {
+	return len(p.Detectors) == 0 && len(p.Rules) == 0
+}
+
+type PIIRedactionSetting struct {
+	// 启用后请求发往上游前将个人信息替换为占位符，并在响应中还原
+	Enabled bool               `json:"enabled"`
+	Default PIIRedactionPolicy `json:"default"`
+	// 按分组覆盖默认策略，空策略表示该分组不脱敏
+	Groups map[string]PIIRedactionPolicy `json:"groups"`
+}
+
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled: false,
+	Default: PIIRedactionPolicy{
+		Detectors: []string{PIIDetectorEmail, PIIDetectorPhone, PIIDetectorIdCard, PIIDetectorSSN, PIIDetectorCreditCard},
+		Rules:     []PIIRedactionRule{},
+	},
+	Groups: map[string]PIIRedactionPolicy{},
+}
+
+func init() {
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// PolicyForGroup 返回分组生效的脱敏策略
+func (s *PIIRedactionSetting) PolicyForGroup(group string) PIIRedactionPolicy {
+	if policy, ok := s.Groups[group]; ok {
+		return policy
+	}
+	return s.Default
+}
@@ -0,0 +1,49 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type ResponseCacheSetting struct {
+	// 启用后对完全相同的对话补全请求直接回放缓存的响应
+	Enabled bool `json:"enabled"`
+	// 默认缓存时长（秒）
+	DefaultTTLSeconds int `json:"default_ttl_seconds"`
+	// 分组缓存时长（秒），覆盖默认值；小于 0 表示该分组不使用缓存
+	GroupTTLSeconds map[string]int `json:"group_ttl_seconds"`
+	// 命中缓存时按原价乘以该倍率计费，0 表示仅收取最低额度
+	HitBillingRatio float64 `json:"hit_billing_ratio"`
+	// 单条响应超过该大小（字节）时不缓存
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 内存缓存最大条目数（未启用 Redis 时生效）
+	MaxEntries int `json:"max_entries"`
+	// 是否在不同用户之间共享缓存，默认每个用户独立
+	SharedAcrossUsers bool `json:"shared_across_users"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	DefaultTTLSeconds: 3600,
+	GroupTTLSeconds:   map[string]int{},
+	HitBillingRatio:   0.1,
+	MaxBodyBytes:      1 << 20,
+	MaxEntries:        10_000,
+	SharedAcrossUsers: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// ResponseCacheTTLSeconds 返回分组的缓存时长，0 表示不缓存
+func (s *ResponseCacheSetting) ResponseCacheTTLSeconds(group string) int {
+	if ttl, ok := s.GroupTTLSeconds[group]; ok && ttl != 0 {
+		if ttl < 0 {
+			return 0
+		}
+		return ttl
+	}
+	return s.DefaultTTLSeconds
+}
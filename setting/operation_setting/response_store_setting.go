@@ -0,0 +1,37 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	// ResponseStoreModePin 后续请求固定到生成上一轮响应的渠道，由上游解析 previous_response_id
+	ResponseStoreModePin = "pin"
+	// ResponseStoreModeInline 将保存的历史展开到 input 中，后续请求可被分配到任意渠道
+	ResponseStoreModeInline = "inline"
+)
+
+// ResponseStoreSetting /v1/responses 网关响应存储配置
+type ResponseStoreSetting struct {
+	// Enabled 启用后保存每个响应的输入与输出条目，用于解析 previous_response_id 及查询、删除响应
+	Enabled bool `json:"enabled"`
+	// Mode previous_response_id 的处理方式：pin 或 inline；原渠道不可用或不支持时总是展开历史
+	Mode string `json:"mode"`
+	// TTLHours 响应保存时长（小时），0 表示不过期
+	TTLHours int `json:"ttl_hours"`
+	// MaxBodyBytes 单个响应超过该大小（字节）时不保存
+	MaxBodyBytes int `json:"max_body_bytes"`
+}
+
+var responseStoreSetting = ResponseStoreSetting{
+	Enabled:      false,
+	Mode:         ResponseStoreModePin,
+	TTLHours:     720,
+	MaxBodyBytes: 4 << 20,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_store_setting", &responseStoreSetting)
+}
+
+func GetResponseStoreSetting() *ResponseStoreSetting {
+	return &responseStoreSetting
+}
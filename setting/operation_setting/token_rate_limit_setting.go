@@ -0,0 +1,53 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenRateLimit 单个维度的 TPM 与并发限制，0 表示不限制
+type TokenRateLimit struct {
+	// 每分钟输入 token 数
+	InputTPM int `json:"input_tpm"`
+	// 每分钟输出 token 数
+	OutputTPM int `json:"output_tpm"`
+	// 同时进行中的请求数
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+func (l TokenRateLimit) IsZero() bool {
+	return l.InputTPM <= 0 && l.OutputTPM <= 0 && l.MaxConcurrency <= 0
+}
+
+type TokenRateLimitSetting struct {
+	// 启用后按令牌、用户、分组、模型四个维度限制 TPM 与并发
+	Enabled bool `json:"enabled"`
+	// 每个令牌的默认限制
+	Token TokenRateLimit `json:"token"`
+	// 每个用户的默认限制
+	User TokenRateLimit `json:"user"`
+	// 按令牌 ID 覆盖默认限制
+	TokenOverrides map[int]TokenRateLimit `json:"token_overrides"`
+	// 按用户 ID 覆盖默认限制
+	UserOverrides map[int]TokenRateLimit `json:"user_overrides"`
+	// 分组内所有请求共享的限制
+	Groups map[string]TokenRateLimit `json:"groups"`
+	// 同一模型所有请求共享的限制
+	Models map[string]TokenRateLimit `json:"models"`
+	// 并发槽位的最长占用时间（秒），超时后自动释放，防止异常退出导致槽位泄漏
+	SlotTimeoutSeconds int `json:"slot_timeout_seconds"`
+}
+
+var tokenRateLimitSetting = TokenRateLimitSetting{
+	Enabled:            false,
+	TokenOverrides:     map[int]TokenRateLimit{},
+	UserOverrides:      map[int]TokenRateLimit{},
+	Groups:             map[string]TokenRateLimit{},
+	Models:             map[string]TokenRateLimit{},
+	SlotTimeoutSeconds: 600,
+}
+
+func init() {
+	config.GlobalConfig.Register("token_rate_limit_setting", &tokenRateLimitSetting)
+}
+
+func GetTokenRateLimitSetting() *TokenRateLimitSetting {
+	return &tokenRateLimitSetting
+}
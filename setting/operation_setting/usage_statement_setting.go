@@ -0,0 +1,42 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type UsageStatementSetting struct {
+	// 启用后每月自动生成上一个自然月（UTC）的用户与组织账单
+	Enabled bool `json:"enabled"`
+	// 每月几号生成上月账单，取值 1~28
+	DayOfMonth int `json:"day_of_month"`
+	// 账单文件格式：csv 或 parquet
+	Format string `json:"format"`
+	// 是否将账单文件写入磁盘
+	WriteToDisk bool `json:"write_to_disk"`
+	// 账单文件目录，留空时使用文件存储目录下的 statements
+	OutputDir string `json:"output_dir"`
+	// 是否将个人账单发送到用户邮箱
+	EmailUsers bool `json:"email_users"`
+	// 组织账单与汇总的收件人，多个以分号分隔，留空则不发送
+	FinanceEmail string `json:"finance_email"`
+	// 最近一次已生成的账期（YYYY-MM），由系统维护
+	LastPeriod string `json:"last_period"`
+	// 部分输出失败、等待重试的账期及其已成功的输出，由系统维护
+	PendingPeriod string   `json:"pending_period"`
+	Delivered     []string `json:"delivered"`
+}
+
+var usageStatementSetting = UsageStatementSetting{
+	Enabled:     false,
+	DayOfMonth:  1,
+	Format:      "csv",
+	WriteToDisk: true,
+	EmailUsers:  false,
+	Delivered:   []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_statement_setting", &usageStatementSetting)
+}
+
+func GetUsageStatementSetting() *UsageStatementSetting {
+	return &usageStatementSetting
+}
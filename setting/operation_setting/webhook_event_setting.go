@@ -0,0 +1,35 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type WebhookEventSetting struct {
+	// 是否向订阅方推送系统事件
+	Enabled bool `json:"enabled"`
+	// 单次投递超时（秒）
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// 最大投递次数，超过后标记为失败
+	MaxAttempts int `json:"max_attempts"`
+	// 首次重试间隔（秒），之后按指数退避
+	RetryBaseSeconds int `json:"retry_base_seconds"`
+	// 重试间隔上限（秒）
+	RetryMaxSeconds int `json:"retry_max_seconds"`
+	// 投递记录保留天数，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var webhookEventSetting = WebhookEventSetting{
+	Enabled:          true,
+	TimeoutSeconds:   10,
+	MaxAttempts:      8,
+	RetryBaseSeconds: 30,
+	RetryMaxSeconds:  3600,
+	RetentionDays:    30,
+}
+
+func init() {
+	config.GlobalConfig.Register("webhook_event_setting", &webhookEventSetting)
+}
+
+func GetWebhookEventSetting() *WebhookEventSetting {
+	return &webhookEventSetting
+}
@@ -0,0 +1,40 @@
+package ratio_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BatchRatioSetting Batch API 计费折扣倍率配置
+type BatchRatioSetting struct {
+	// DefaultRatio 默认批处理倍率（OpenAI Batch API 为 50% 折扣）
+	DefaultRatio float64 `json:"default_ratio"`
+	// ModelRatio 按模型覆盖的批处理倍率
+	ModelRatio map[string]float64 `json:"model_ratio"`
+}
+
+var batchRatioSetting = BatchRatioSetting{
+	DefaultRatio: 0.5,
+	ModelRatio:   map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_ratio_setting", &batchRatioSetting)
+}
+
+func GetBatchRatioSetting() *BatchRatioSetting {
+	return &batchRatioSetting
+}
+
+// GetBatchRatio 获取模型的批处理倍率，未单独配置时使用默认倍率
+func GetBatchRatio(modelName string) float64 {
+	if ratio, ok := batchRatioSetting.ModelRatio[modelName]; ok && ratio >= 0 {
+		return ratio
+	}
+	if ratio, ok := batchRatioSetting.ModelRatio[FormatMatchingModelName(modelName)]; ok && ratio >= 0 {
+		return ratio
+	}
+	if batchRatioSetting.DefaultRatio < 0 {
+		return 1
+	}
+	return batchRatioSetting.DefaultRatio
+}
@@ -377,6 +377,12 @@ func GetModelPrice(name string, printErr bool) (float64, bool) {
 				return basePrice, true
 			}
 		}
+		// Fallback: fine-tuned model (e.g., "ft:gpt-4o-mini:org::id") uses its base model price
+		if baseName, ok := fineTunedBaseModelName(name); ok {
+			if basePrice, ok := modelPriceMap.Get(baseName); ok {
+				return basePrice, true
+			}
+		}
 		if printErr {
 			common.SysError("model price not found: " + name)
 		}
@@ -389,6 +395,18 @@ func UpdateModelRatioByJSONString(jsonStr string) error {
 	return types.LoadFromJsonStringWithCallback(modelRatioMap, jsonStr, InvalidateExposedDataCache)
 }
 
+// fineTunedBaseModelName 解析微调模型名 ft:<base>:<org>:<suffix>:<id> 中的基础模型
+func fineTunedBaseModelName(name string) (string, bool) {
+	if !strings.HasPrefix(name, "ft:") {
+		return "", false
+	}
+	parts := strings.Split(name, ":")
+	if len(parts) < 2 || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
 // 处理带有思考预算的模型名称，方便统一定价
 func handleThinkingBudgetModel(name, prefix, wildcard string) string {
 	if strings.HasPrefix(name, prefix) && strings.Contains(name, "-thinking-") {
@@ -409,6 +427,11 @@ func GetModelRatio(name string) (float64, bool, string) {
 				return baseRatio, true, baseName
 			}
 		}
+		if baseName, ok := fineTunedBaseModelName(name); ok {
+			if baseRatio, ok := modelRatioMap.Get(baseName); ok {
+				return baseRatio, true, baseName
+			}
+		}
 		if strings.HasSuffix(name, CompactModelSuffix) {
 			if wildcardRatio, ok := modelRatioMap.Get(CompactWildcardModelKey); ok {
 				return wildcardRatio, true, name
@@ -468,6 +491,12 @@ func GetCompletionRatio(name string) float64 {
 			return ratio
 		}
 	}
+	if ftBaseName, ok := fineTunedBaseModelName(name); ok {
+		baseName = ftBaseName
+		if ratio, ok := completionRatioMap.Get(baseName); ok {
+			return ratio
+		}
+	}
 
 	// Try hardcoded ratio with base name
 	hardCodedRatio, contain = getHardcodedCompletionModelRatio(baseName)
@@ -6,6 +6,7 @@ type GroupRatioInfo struct {
 	GroupRatio        float64
 	GroupSpecialRatio float64
 	HasSpecialRatio   bool
+	BatchRatio        float64 // 批处理倍率，已计入 GroupRatio；0 表示非批处理请求
 }
 
 type PriceData struct {
@@ -16,4 +16,10 @@ const (
 
 	RelayFormatTask    = "task"
 	RelayFormatMjProxy = "mj_proxy"
+
+	// 以下仅用于令牌范围按接口分类，不作为转发格式
+	RelayFormatOpenAIBatch      = "openai_batch"
+	RelayFormatOpenAIFile       = "openai_file"
+	RelayFormatOpenAIFineTuning = "openai_fine_tuning"
+	RelayFormatDelegatedToken   = "delegated_token"
 )